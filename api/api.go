@@ -0,0 +1,277 @@
+// Package api serves an HTTP control API for the emulator, letting external
+// tools and test harnesses drive a running instance: load ROMs, pause,
+// resume and step it, read its registers and memory, press keys and save
+// and restore its state.
+//
+// Requests and responses are JSON, except for ROMs, which are posted as
+// their raw bytes. Errors are answered with a status code and a JSON object
+// with an "error" field. The endpoints are:
+//
+//	GET  /status             ROM, whether paused, frames and instructions run
+//	POST /rom?name=NAME      load the ROM in the body and reset
+//	POST /pause              pause execution
+//	POST /resume             resume execution
+//	POST /step               execute one instruction, pausing first
+//	POST /reset              reset the machine
+//	GET  /registers          the CPU registers
+//	GET  /memory?addr=A&n=N  N bytes of RAM from A (hex), as hex
+//	POST /keys/K/down        press keypad key K (hex)
+//	POST /keys/K/up          release keypad key K
+//	GET  /state              the state of the machine, as DumpStateJSON writes
+//	PUT  /state              restore a state returned by GET /state
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// pollInterval is how often a step is checked for having finished.
+const pollInterval = 10 * time.Millisecond
+
+// maxRomSize is the size of the largest ROM accepted, that of 64KB of RAM.
+const maxRomSize = 1 << 16
+
+// defaultMemoryLen is how many bytes GET /memory returns when n isn't given.
+const defaultMemoryLen = 64
+
+// ListenAndServe listens on the TCP address addr and serves the control API
+// until listening fails.
+func ListenAndServe(addr string, c *core.Chip8) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	c.Logger().Infof("Serving the control API on http://%s/", ln.Addr())
+
+	return http.Serve(ln, &server{c: c})
+}
+
+// server answers API requests for an emulator.
+type server struct {
+	c *core.Chip8
+}
+
+// status is the response to GET /status.
+type status struct {
+	Rom          string `json:"rom"`
+	Sha1         string `json:"sha1"`
+	Paused       bool   `json:"paused"`
+	StopReason   string `json:"stop_reason,omitempty"`
+	Frames       uint64 `json:"frames"`
+	Instructions uint64 `json:"instructions"`
+}
+
+// registers is the response to GET /registers.
+type registers struct {
+	V      []int `json:"v"`
+	I      int   `json:"i"`
+	PC     int   `json:"pc"`
+	SP     int   `json:"sp"`
+	DT     int   `json:"dt"`
+	ST     int   `json:"st"`
+	Opcode int   `json:"opcode"`
+	Stack  []int `json:"stack"`
+}
+
+// memory is the response to GET /memory.
+type memory struct {
+	Addr int    `json:"addr"`
+	Data string `json:"data"` // hex
+}
+
+// apiError is an error answered with the HTTP status code.
+type apiError struct {
+	code int
+	err  error
+}
+
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+// badRequest returns an error answered with 400 Bad Request.
+func badRequest(format string, args ...interface{}) error {
+	return &apiError{http.StatusBadRequest, fmt.Errorf(format, args...)}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.handle(r)
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		code := http.StatusInternalServerError
+		if e, ok := err.(*apiError); ok {
+			code = e.code
+		}
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if raw, ok := resp.([]byte); ok {
+		w.Write(raw)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handle executes the request, returning the response to encode as JSON,
+// or JSON already encoded.
+func (s *server) handle(r *http.Request) (interface{}, error) {
+	c := s.c
+	path := strings.Trim(r.URL.Path, "/")
+	route := r.Method + " " + path
+	if strings.HasPrefix(path, "keys/") {
+		route = r.Method + " keys"
+	}
+
+	switch route {
+	case "GET status":
+		return s.status(), nil
+	case "POST rom":
+		return s.loadRom(r)
+	case "POST pause":
+		c.Do(func() { c.SetPaused(true) })
+		return s.status(), nil
+	case "POST resume":
+		c.Do(func() { c.SetPaused(false) })
+		return s.status(), nil
+	case "POST step":
+		s.step()
+		return s.registers(), nil
+	case "POST reset":
+		c.Do(c.Reset)
+		return s.status(), nil
+	case "GET registers":
+		return s.registers(), nil
+	case "GET memory":
+		return s.memory(r)
+	case "POST keys":
+		return s.key(path)
+	case "GET state":
+		var state []byte
+		var err error
+		c.Do(func() { state, err = c.DumpStateJSON() })
+		return state, err
+	case "PUT state":
+		state, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		c.Do(func() { err = c.LoadStateJSON(state) })
+		if err != nil {
+			return nil, badRequest("%v", err)
+		}
+		return s.status(), nil
+	}
+
+	return nil, &apiError{http.StatusNotFound, fmt.Errorf("no endpoint %s /%s", r.Method, path)}
+}
+
+// status returns what the emulator is running.
+func (s *server) status() status {
+	c := s.c
+	var st status
+	c.Do(func() {
+		st = status{Rom: c.RomName(), Sha1: c.RomHash(), Paused: c.Paused(), StopReason: c.StopReason()}
+		st.Frames, st.Instructions = c.Counters()
+	})
+
+	return st
+}
+
+// loadRom loads the ROM posted in place of the one running.
+func (s *server) loadRom(r *http.Request) (interface{}, error) {
+	rom, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxRomSize))
+	if err != nil {
+		return nil, badRequest("reading ROM: %v", err)
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "api.ch8"
+	}
+	s.c.Do(func() { err = s.c.SwapRomData(name, rom) })
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+
+	return s.status(), nil
+}
+
+// step executes one instruction, waiting for it to have been.
+func (s *server) step() {
+	c := s.c
+	c.Do(func() {
+		c.SetPaused(true)
+		c.Step()
+	})
+
+	var halted bool
+	for !halted {
+		time.Sleep(pollInterval)
+		c.Do(func() { halted = c.Halted() })
+	}
+}
+
+// registers returns the CPU registers.
+func (s *server) registers() registers {
+	var r core.Registers
+	s.c.Do(func() { r = s.c.Registers() })
+
+	regs := registers{I: int(r.I), PC: int(r.PC), SP: int(r.SP), DT: int(r.DT), ST: int(r.ST), Opcode: int(r.Opcode)}
+	for _, v := range r.V {
+		regs.V = append(regs.V, int(v))
+	}
+	for _, addr := range r.Stack {
+		regs.Stack = append(regs.Stack, int(addr))
+	}
+
+	return regs
+}
+
+// memory returns the RAM asked for by the addr and n query parameters.
+func (s *server) memory(r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	addr, err := strconv.ParseUint(strings.TrimPrefix(q.Get("addr"), "0x"), 16, 16)
+	if err != nil {
+		return nil, badRequest("addr: %q is not a hex address", q.Get("addr"))
+	}
+	n := defaultMemoryLen
+	if q.Get("n") != "" {
+		v, err := strconv.ParseUint(q.Get("n"), 0, 17)
+		if err != nil {
+			return nil, badRequest("n: %q is not a byte count", q.Get("n"))
+		}
+		n = int(v)
+	}
+
+	var data []byte
+	s.c.Do(func() { data = s.c.Memory(uint16(addr), n) })
+
+	return memory{Addr: int(addr), Data: hex.EncodeToString(data)}, nil
+}
+
+// key presses or releases the key of a keys/K/down or keys/K/up path.
+func (s *server) key(path string) (interface{}, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 || (parts[2] != "down" && parts[2] != "up") {
+		return nil, &apiError{http.StatusNotFound, fmt.Errorf("no endpoint /%s, expected /keys/K/down or /keys/K/up", path)}
+	}
+	key, err := strconv.ParseUint(parts[1], 16, 4)
+	if err != nil {
+		return nil, badRequest("%q is not a key, expected 0-f", parts[1])
+	}
+	pressed := parts[2] == "down"
+	s.c.Do(func() { s.c.SetKey(uint8(key), pressed) })
+
+	return map[string]bool{"pressed": pressed}, nil
+}
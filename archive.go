@@ -0,0 +1,69 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// isZip reports whether the ROM given is a zip archive to run a ROM of.
+func isZip(rom string) bool {
+	return strings.EqualFold(path.Ext(rom), ".zip")
+}
+
+// extractRom extracts the ROM called entry from the zip archive at
+// archivePath, or the first one in it if entry is empty, and returns the path
+// it was saved to by cacheRom. Entries are ROMs if they have one of the
+// romExtensions.
+func extractRom(archivePath, entry string) (string, error) {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	for _, file := range r.File {
+		name := path.Base(file.Name)
+		if entry != "" && file.Name != entry && name != entry {
+			continue
+		}
+		if entry == "" && !isRomEntry(name) {
+			continue
+		}
+		if file.UncompressedSize64 > maxDownloadSize {
+			return "", fmt.Errorf("%s: %s is larger than the %d bytes a ROM may be", archivePath, file.Name, maxDownloadSize)
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", archivePath, err)
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(rc, maxDownloadSize))
+		rc.Close()
+		if err != nil {
+			return "", fmt.Errorf("%s: %s: %v", archivePath, file.Name, err)
+		}
+
+		logger.Infof("Extracting %s from %s", file.Name, archivePath)
+		return cacheRom(name, data)
+	}
+
+	if entry != "" {
+		return "", fmt.Errorf("%s: no entry called %q", archivePath, entry)
+	}
+	return "", fmt.Errorf("%s: no ROMs (%s) in it", archivePath, strings.Join(romExtensions, ", "))
+}
+
+// isRomEntry reports whether an entry of an archive, called name, is a ROM.
+func isRomEntry(name string) bool {
+	for _, ext := range romExtensions {
+		if strings.EqualFold(path.Ext(name), ext) {
+			return true
+		}
+	}
+
+	return false
+}
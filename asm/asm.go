@@ -0,0 +1,731 @@
+// Package asm implements an assembler for Chip-8 programs written in the
+// syntax of Octo (https://github.com/JohnEarnest/Octo), e.g.
+//
+//	: main
+//		v0 := 10
+//		i := hex v0
+//		loop
+//			sprite v1 v2 5
+//			v3 := key
+//		again
+//
+// Labels, :const and :alias, :org, :byte and :call, the structured if/else
+// and loop/while blocks and the standard Chip-8 statements are supported.
+// Macros, :calc, the <, >, <= and >= comparisons and the SCHIP and XO-CHIP
+// extensions are not.
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	origin  = 0x200 // address the ROM is loaded at
+	memSize = 4096
+)
+
+// token is a word of the source, and the line it is on.
+type token struct {
+	text string
+	line int
+}
+
+// tokenize splits src into words separated by whitespace, dropping
+// comments, which run from # to the end of the line.
+func tokenize(src string) []token {
+	var toks []token
+	for n, line := range strings.Split(src, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		for _, word := range strings.Fields(line) {
+			toks = append(toks, token{text: word, line: n + 1})
+		}
+	}
+
+	return toks
+}
+
+// fixup is an instruction referring to a label not yet defined, whose
+// address is filled in once the label is.
+type fixup struct {
+	addr  int // address of the instruction
+	label string
+	line  int
+}
+
+// block is an if ... begin or loop statement still open.
+type block struct {
+	kind   string // "begin", "else" or "loop"
+	addr   int    // address of the jump to patch, or the start of a loop
+	whiles []int  // addresses of the jumps out of a loop
+	line   int
+}
+
+// assembler holds the state of an assembly.
+type assembler struct {
+	toks []token
+	pos  int
+
+	rom    []byte // program bytes, from origin
+	filled []bool // which bytes of rom were assembled, rather than skipped
+	here   int    // address the next byte is assembled to
+	org    token  // the last :org, which may move back over assembled bytes
+
+	line  int         // line of the statement being assembled, 0 for none
+	lines map[int]int // address of the first byte assembled from each line
+
+	labels  map[string]int
+	consts  map[string]int
+	aliases map[string]int // register numbers, by name
+	fixups  []fixup
+	blocks  []block
+}
+
+// Assemble assembles the Octo source src into a ROM. Execution starts at the
+// label main; unless main is the first thing in the source, a jump to it is
+// placed at the start of the ROM.
+//
+// It also returns the address of the first byte assembled from each line of
+// the source, by line number, for debuggers to map lines to addresses.
+func Assemble(src []byte) (rom []byte, lines map[int]int, err error) {
+	a := &assembler{
+		toks:    tokenize(string(src)),
+		here:    origin,
+		labels:  make(map[string]int),
+		consts:  make(map[string]int),
+		aliases: make(map[string]int),
+		lines:   make(map[int]int),
+	}
+	if len(a.toks) < 2 || a.toks[0].text != ":" || a.toks[1].text != "main" {
+		a.jumpTo(0x1000, "main", 1) // can't fail, the ROM is empty
+	}
+
+	for a.pos < len(a.toks) {
+		if err := a.statement(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(a.blocks) > 0 {
+		b := a.blocks[len(a.blocks)-1]
+		return nil, nil, fmt.Errorf("line %d: %s is never closed", b.line, b.kind)
+	}
+	if _, ok := a.labels["main"]; !ok {
+		return nil, nil, fmt.Errorf("no main label")
+	}
+	for _, f := range a.fixups {
+		addr, ok := a.labels[f.label]
+		if !ok {
+			return nil, nil, fmt.Errorf("line %d: undefined name %q", f.line, f.label)
+		}
+		a.patch(f.addr, addr)
+	}
+
+	return a.rom, a.lines, nil
+}
+
+// next returns the next token, or an error at the end of the source.
+func (a *assembler) next() (token, error) {
+	if a.pos >= len(a.toks) {
+		line := 0
+		if len(a.toks) > 0 {
+			line = a.toks[len(a.toks)-1].line
+		}
+		return token{line: line}, fmt.Errorf("line %d: unexpected end of source", line)
+	}
+	t := a.toks[a.pos]
+	a.pos++
+
+	return t, nil
+}
+
+// peek returns the text of the next token, or "" at the end of the source.
+func (a *assembler) peek() string {
+	if a.pos >= len(a.toks) {
+		return ""
+	}
+
+	return a.toks[a.pos].text
+}
+
+// expect consumes the next token, which must be text.
+func (a *assembler) expect(text string) error {
+	t, err := a.next()
+	if err != nil {
+		return err
+	}
+	if t.text != text {
+		return fmt.Errorf("line %d: expected %q, found %q", t.line, text, t.text)
+	}
+
+	return nil
+}
+
+// emit assembles the bytes b at the current address.
+func (a *assembler) emit(b ...byte) error {
+	for _, v := range b {
+		if a.here >= memSize {
+			return fmt.Errorf("program does not fit in memory")
+		}
+		i := a.here - origin
+		for len(a.rom) <= i {
+			a.rom = append(a.rom, 0)
+			a.filled = append(a.filled, false)
+		}
+		if a.filled[i] {
+			return fmt.Errorf("line %d: :org moves over %#x, which is already assembled", a.org.line, a.here)
+		}
+		a.rom[i], a.filled[i] = v, true
+		if _, ok := a.lines[a.line]; !ok && a.line > 0 {
+			a.lines[a.line] = a.here
+		}
+		a.here++
+	}
+
+	return nil
+}
+
+// op assembles the instruction op.
+func (a *assembler) op(op int) error {
+	return a.emit(byte(op>>8), byte(op))
+}
+
+// patch sets the address of the instruction at addr to target.
+func (a *assembler) patch(addr, target int) {
+	i := addr - origin
+	a.rom[i] = a.rom[i]&0xF0 | byte(target>>8&0x0F)
+	a.rom[i+1] = byte(target)
+}
+
+// jumpTo assembles the instruction op, taking the address of label, which
+// may be defined later.
+func (a *assembler) jumpTo(op int, label string, line int) error {
+	if addr, ok := a.labels[label]; ok {
+		return a.op(op | addr)
+	}
+	a.fixups = append(a.fixups, fixup{addr: a.here, label: label, line: line})
+
+	return a.op(op)
+}
+
+// statement assembles the next statement.
+func (a *assembler) statement() error {
+	t, err := a.next()
+	if err != nil {
+		return err
+	}
+	a.line = t.line
+
+	switch t.text {
+	case ":":
+		name, err := a.name()
+		if err != nil {
+			return err
+		}
+		if _, ok := a.labels[name.text]; ok {
+			return fmt.Errorf("line %d: label %q is already defined", name.line, name.text)
+		}
+		a.labels[name.text] = a.here
+		return nil
+	case ":const":
+		name, err := a.name()
+		if err != nil {
+			return err
+		}
+		v, err := a.value()
+		if err != nil {
+			return err
+		}
+		a.consts[name.text] = v
+		return nil
+	case ":alias":
+		name, err := a.name()
+		if err != nil {
+			return err
+		}
+		r, err := a.register()
+		if err != nil {
+			return err
+		}
+		a.aliases[name.text] = r
+		return nil
+	case ":org":
+		v, err := a.value()
+		if err != nil {
+			return err
+		}
+		if v < origin || v >= memSize {
+			return fmt.Errorf("line %d: :org %#x is outside the program", t.line, v)
+		}
+		a.here, a.org = v, t
+		return nil
+	case ":byte":
+		v, err := a.byteValue()
+		if err != nil {
+			return err
+		}
+		return a.emit(byte(v))
+	case ":call":
+		return a.addrOp(0x2000)
+	case "clear":
+		return a.op(0x00E0)
+	case "return", ";":
+		return a.op(0x00EE)
+	case "jump":
+		return a.addrOp(0x1000)
+	case "jump0":
+		return a.addrOp(0xB000)
+	case "native":
+		return a.addrOp(0x0000)
+	case "sprite":
+		x, err := a.register()
+		if err != nil {
+			return err
+		}
+		y, err := a.register()
+		if err != nil {
+			return err
+		}
+		n, err := a.value()
+		if err != nil {
+			return err
+		}
+		if n < 0 || n > 15 {
+			return fmt.Errorf("line %d: sprite height %d is not 0-15", t.line, n)
+		}
+		return a.op(0xD000 | x<<8 | y<<4 | n)
+	case "bcd":
+		return a.regOp(0xF033)
+	case "save":
+		return a.regOp(0xF055)
+	case "load":
+		return a.regOp(0xF065)
+	case "saveflags":
+		return a.regOp(0xF075)
+	case "loadflags":
+		return a.regOp(0xF085)
+	case "delay", "buzzer":
+		if err := a.expect(":="); err != nil {
+			return err
+		}
+		if t.text == "delay" {
+			return a.regOp(0xF015)
+		}
+		return a.regOp(0xF018)
+	case "i":
+		return a.assignI()
+	case "if":
+		return a.ifStatement(t)
+	case "else":
+		return a.elseStatement(t)
+	case "end":
+		return a.endStatement(t)
+	case "loop":
+		a.blocks = append(a.blocks, block{kind: "loop", addr: a.here, line: t.line})
+		return nil
+	case "while":
+		return a.whileStatement(t)
+	case "again":
+		return a.againStatement(t)
+	}
+
+	if strings.HasPrefix(t.text, ":") {
+		return fmt.Errorf("line %d: unsupported directive %s", t.line, t.text)
+	}
+	if r, ok := a.registerNamed(t.text); ok {
+		return a.assignRegister(r)
+	}
+	if v, ok := a.number(t.text); ok {
+		if v < -128 || v > 255 {
+			return fmt.Errorf("line %d: %d does not fit in a byte", t.line, v)
+		}
+		return a.emit(byte(v))
+	}
+	if !isName(t.text) {
+		return fmt.Errorf("line %d: unexpected %q", t.line, t.text)
+	}
+
+	// Any other name calls a subroutine.
+	return a.jumpTo(0x2000, t.text, t.line)
+}
+
+// name reads a name for a label, constant or alias.
+func (a *assembler) name() (token, error) {
+	t, err := a.next()
+	if err != nil {
+		return t, err
+	}
+	if !isName(t.text) {
+		return t, fmt.Errorf("line %d: %q is not a valid name", t.line, t.text)
+	}
+	if _, ok := a.registerNamed(t.text); ok {
+		return t, fmt.Errorf("line %d: %q is a register", t.line, t.text)
+	}
+
+	return t, nil
+}
+
+// isName reports whether s can name a label, constant or alias.
+func isName(s string) bool {
+	if s == "" || keywords[s] || s[0] == ':' || s[0] == '-' || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+
+	return !strings.ContainsAny(s, "=<>!|&^+")
+}
+
+// keywords are the words which can't be used as names.
+var keywords = map[string]bool{
+	"clear": true, "return": true, "jump": true, "jump0": true, "native": true,
+	"sprite": true, "bcd": true, "save": true, "load": true, "delay": true,
+	"saveflags": true, "loadflags": true,
+	"buzzer": true, "i": true, "if": true, "then": true, "begin": true,
+	"else": true, "end": true, "loop": true, "while": true, "again": true,
+	"key": true, "-key": true, "hex": true, "random": true,
+}
+
+// registerNamed returns the number of the register or alias s, if it is one.
+func (a *assembler) registerNamed(s string) (int, bool) {
+	if r, ok := a.aliases[s]; ok {
+		return r, true
+	}
+	if len(s) == 2 && (s[0] == 'v' || s[0] == 'V') {
+		if r, err := strconv.ParseUint(s[1:], 16, 4); err == nil {
+			return int(r), true
+		}
+	}
+
+	return 0, false
+}
+
+// register reads a register.
+func (a *assembler) register() (int, error) {
+	t, err := a.next()
+	if err != nil {
+		return 0, err
+	}
+	r, ok := a.registerNamed(t.text)
+	if !ok {
+		return 0, fmt.Errorf("line %d: %q is not a register", t.line, t.text)
+	}
+
+	return r, nil
+}
+
+// number returns the value of the literal or constant s, if it is one.
+func (a *assembler) number(s string) (int, bool) {
+	if v, ok := a.consts[s]; ok {
+		return v, true
+	}
+	v, err := strconv.ParseInt(s, 0, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	return int(v), true
+}
+
+// value reads a number or constant.
+func (a *assembler) value() (int, error) {
+	t, err := a.next()
+	if err != nil {
+		return 0, err
+	}
+	v, ok := a.number(t.text)
+	if !ok {
+		return 0, fmt.Errorf("line %d: %q is not a number", t.line, t.text)
+	}
+
+	return v, nil
+}
+
+// byteValue reads a number or constant which fits in a byte. Negative
+// numbers are stored in two's complement.
+func (a *assembler) byteValue() (int, error) {
+	line := a.toks[a.pos-1].line
+	v, err := a.value()
+	if err != nil {
+		return 0, err
+	}
+	if v < -128 || v > 255 {
+		return 0, fmt.Errorf("line %d: %d does not fit in a byte", line, v)
+	}
+
+	return v & 0xFF, nil
+}
+
+// addrOp reads an address, a label or number, and assembles op with it.
+func (a *assembler) addrOp(op int) error {
+	t, err := a.next()
+	if err != nil {
+		return err
+	}
+	if v, ok := a.number(t.text); ok {
+		if v < 0 || v >= memSize {
+			return fmt.Errorf("line %d: %#x is not an address", t.line, v)
+		}
+		return a.op(op | v)
+	}
+	if !isName(t.text) {
+		return fmt.Errorf("line %d: %q is not an address", t.line, t.text)
+	}
+
+	return a.jumpTo(op, t.text, t.line)
+}
+
+// regOp reads a register and assembles op with it as X.
+func (a *assembler) regOp(op int) error {
+	x, err := a.register()
+	if err != nil {
+		return err
+	}
+
+	return a.op(op | x<<8)
+}
+
+// assignI assembles a statement starting with i.
+func (a *assembler) assignI() error {
+	t, err := a.next()
+	if err != nil {
+		return err
+	}
+
+	switch t.text {
+	case ":=":
+		if a.peek() == "hex" {
+			a.pos++
+			return a.regOp(0xF029)
+		}
+		return a.addrOp(0xA000)
+	case "+=":
+		return a.regOp(0xF01E)
+	}
+
+	return fmt.Errorf("line %d: unexpected %q after i", t.line, t.text)
+}
+
+// aluOps are the 8XYN instructions, by operator.
+var aluOps = map[string]int{
+	":=":  0x8000,
+	"|=":  0x8001,
+	"&=":  0x8002,
+	"^=":  0x8003,
+	"+=":  0x8004,
+	"-=":  0x8005,
+	">>=": 0x8006,
+	"=-":  0x8007,
+	"<<=": 0x800E,
+}
+
+// assignRegister assembles a statement starting with the register x.
+func (a *assembler) assignRegister(x int) error {
+	t, err := a.next()
+	if err != nil {
+		return err
+	}
+	src := a.peek()
+
+	if t.text == ":=" {
+		switch src {
+		case "random":
+			a.pos++
+			v, err := a.byteValue()
+			if err != nil {
+				return err
+			}
+			return a.op(0xC000 | x<<8 | v)
+		case "delay":
+			a.pos++
+			return a.op(0xF007 | x<<8)
+		case "key":
+			a.pos++
+			return a.op(0xF00A | x<<8)
+		}
+	}
+
+	op, ok := aluOps[t.text]
+	if !ok {
+		return fmt.Errorf("line %d: unexpected %q after a register", t.line, t.text)
+	}
+	if y, ok := a.registerNamed(src); ok {
+		a.pos++
+		return a.op(op | x<<8 | y<<4)
+	}
+
+	// Constants can be assigned, added and subtracted.
+	switch t.text {
+	case ":=", "+=", "-=":
+	default:
+		return fmt.Errorf("line %d: %s needs a register", t.line, t.text)
+	}
+	v, err := a.byteValue()
+	if err != nil {
+		return err
+	}
+	switch t.text {
+	case ":=":
+		return a.op(0x6000 | x<<8 | v)
+	case "+=":
+		return a.op(0x7000 | x<<8 | v)
+	}
+
+	return a.op(0x7000 | x<<8 | -v&0xFF)
+}
+
+// condition reads a condition, e.g. "v0 == 5" or "v1 -key", and returns the
+// instruction which skips the next one when the condition is false, or when
+// it is true if negate is set.
+func (a *assembler) condition(negate bool) (int, error) {
+	x, err := a.register()
+	if err != nil {
+		return 0, err
+	}
+	t, err := a.next()
+	if err != nil {
+		return 0, err
+	}
+
+	equal := false
+	switch t.text {
+	case "key", "-key":
+		pressed := t.text == "key"
+		if pressed != negate {
+			return 0xE0A1 | x<<8, nil // skip if not pressed
+		}
+		return 0xE09E | x<<8, nil // skip if pressed
+	case "==":
+		equal = true
+	case "!=":
+	case "<", ">", "<=", ">=":
+		return 0, fmt.Errorf("line %d: the %s comparison is not supported", t.line, t.text)
+	default:
+		return 0, fmt.Errorf("line %d: unexpected %q in a condition", t.line, t.text)
+	}
+
+	// Skip when the registers differ for ==, and are equal for !=.
+	skipEqual := equal == negate
+	if y, ok := a.registerNamed(a.peek()); ok {
+		a.pos++
+		if skipEqual {
+			return 0x5000 | x<<8 | y<<4, nil
+		}
+		return 0x9000 | x<<8 | y<<4, nil
+	}
+	v, err := a.byteValue()
+	if err != nil {
+		return 0, err
+	}
+	if skipEqual {
+		return 0x3000 | x<<8 | v, nil
+	}
+
+	return 0x4000 | x<<8 | v, nil
+}
+
+// ifStatement assembles an if ... then statement, or opens an if ... begin
+// block.
+func (a *assembler) ifStatement(t token) error {
+	start := a.pos
+	if _, err := a.condition(false); err != nil {
+		return err
+	}
+	kw, err := a.next()
+	if err != nil {
+		return err
+	}
+
+	switch kw.text {
+	case "then":
+		a.pos = start
+		skip, _ := a.condition(false)
+		a.pos++
+		if err := a.op(skip); err != nil {
+			return err
+		}
+		return a.statement()
+	case "begin":
+		a.pos = start
+		skip, _ := a.condition(true)
+		a.pos++
+		if err := a.op(skip); err != nil {
+			return err
+		}
+		a.blocks = append(a.blocks, block{kind: "begin", addr: a.here, line: t.line})
+		return a.op(0x1000)
+	}
+
+	return fmt.Errorf("line %d: expected then or begin, found %q", kw.line, kw.text)
+}
+
+// elseStatement assembles the else of an if ... begin block.
+func (a *assembler) elseStatement(t token) error {
+	if len(a.blocks) == 0 || a.blocks[len(a.blocks)-1].kind != "begin" {
+		return fmt.Errorf("line %d: else without if ... begin", t.line)
+	}
+	b := &a.blocks[len(a.blocks)-1]
+
+	jump := a.here
+	if err := a.op(0x1000); err != nil {
+		return err
+	}
+	a.patch(b.addr, a.here)
+	b.kind, b.addr = "else", jump
+
+	return nil
+}
+
+// endStatement closes an if ... begin block.
+func (a *assembler) endStatement(t token) error {
+	if len(a.blocks) == 0 || a.blocks[len(a.blocks)-1].kind == "loop" {
+		return fmt.Errorf("line %d: end without if ... begin", t.line)
+	}
+	b := a.blocks[len(a.blocks)-1]
+	a.blocks = a.blocks[:len(a.blocks)-1]
+	a.patch(b.addr, a.here)
+
+	return nil
+}
+
+// whileStatement assembles a jump out of the innermost loop, taken when the
+// condition following is false.
+func (a *assembler) whileStatement(t token) error {
+	i := len(a.blocks) - 1
+	for i >= 0 && a.blocks[i].kind != "loop" {
+		i--
+	}
+	if i < 0 {
+		return fmt.Errorf("line %d: while outside a loop", t.line)
+	}
+
+	skip, err := a.condition(true)
+	if err != nil {
+		return err
+	}
+	if err := a.op(skip); err != nil {
+		return err
+	}
+	a.blocks[i].whiles = append(a.blocks[i].whiles, a.here)
+
+	return a.op(0x1000)
+}
+
+// againStatement closes a loop, jumping back to its start.
+func (a *assembler) againStatement(t token) error {
+	if len(a.blocks) == 0 || a.blocks[len(a.blocks)-1].kind != "loop" {
+		return fmt.Errorf("line %d: again without loop", t.line)
+	}
+	b := a.blocks[len(a.blocks)-1]
+	a.blocks = a.blocks[:len(a.blocks)-1]
+
+	if err := a.op(0x1000 | b.addr); err != nil {
+		return err
+	}
+	for _, addr := range b.whiles {
+		a.patch(addr, a.here)
+	}
+
+	return nil
+}
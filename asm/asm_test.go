@@ -0,0 +1,138 @@
+package asm
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []byte
+	}{
+		{"main first", ": main clear return", []byte{0x00, 0xE0, 0x00, 0xEE}},
+		{"jump to main", ": sub return : main sub", []byte{0x12, 0x04, 0x00, 0xEE, 0x22, 0x02}},
+		{"forward label", ": main jump done v1 := 1 : done return", []byte{0x12, 0x04, 0x61, 0x01, 0x00, 0xEE}},
+		{"const and alias", ":const five 5 :alias x v3 : main x := five", []byte{0x12, 0x02, 0x63, 0x05}},
+		{"comments", ": main # start\n\tclear # clear the display", []byte{0x00, 0xE0}},
+
+		{"load byte", ": main v1 := 0x12", []byte{0x61, 0x12}},
+		{"add byte", ": main v1 += 3", []byte{0x71, 0x03}},
+		{"subtract byte", ": main v1 -= 1", []byte{0x71, 0xFF}},
+		{"load register", ": main v1 := v2", []byte{0x81, 0x20}},
+		{"or", ": main v1 |= v2", []byte{0x81, 0x21}},
+		{"and", ": main v1 &= v2", []byte{0x81, 0x22}},
+		{"xor", ": main v1 ^= v2", []byte{0x81, 0x23}},
+		{"add", ": main v1 += v2", []byte{0x81, 0x24}},
+		{"subtract", ": main v1 -= v2", []byte{0x81, 0x25}},
+		{"shift right", ": main v1 >>= v2", []byte{0x81, 0x26}},
+		{"subtract from", ": main v1 =- v2", []byte{0x81, 0x27}},
+		{"shift left", ": main v1 <<= v2", []byte{0x81, 0x2E}},
+		{"random", ": main v1 := random 0x0F", []byte{0xC1, 0x0F}},
+		{"read delay", ": main v1 := delay", []byte{0xF1, 0x07}},
+		{"wait key", ": main v1 := key", []byte{0xF1, 0x0A}},
+		{"set delay", ": main delay := v1", []byte{0xF1, 0x15}},
+		{"set buzzer", ": main buzzer := v1", []byte{0xF1, 0x18}},
+		{"load i", ": main i := 0x300", []byte{0xA3, 0x00}},
+		{"add i", ": main i += v1", []byte{0xF1, 0x1E}},
+		{"hex digit", ": main i := hex v1", []byte{0xF1, 0x29}},
+		{"bcd", ": main bcd v1", []byte{0xF1, 0x33}},
+		{"save", ": main save v1", []byte{0xF1, 0x55}},
+		{"load", ": main load v1", []byte{0xF1, 0x65}},
+		{"saveflags", ": main saveflags v1", []byte{0xF1, 0x75}},
+		{"loadflags", ": main loadflags v1", []byte{0xF1, 0x85}},
+		{"sprite", ": main sprite v1 v2 5", []byte{0xD1, 0x25}},
+		{"jump0", ": main jump0 0x300", []byte{0xB3, 0x00}},
+		{"native", ": main native 0x123", []byte{0x01, 0x23}},
+		{"call", ": main :call 0x300", []byte{0x23, 0x00}},
+		{"bytes", ": main :byte 0xAB :byte -1 7", []byte{0xAB, 0xFF, 0x07}},
+
+		// if ... then skips the statement when the condition is false.
+		{"if equal then", ": main if v1 == 5 then v2 := 1", []byte{0x41, 0x05, 0x62, 0x01}},
+		{"if not equal then", ": main if v1 != 5 then v2 := 1", []byte{0x31, 0x05, 0x62, 0x01}},
+		{"if registers equal then", ": main if v1 == v2 then clear", []byte{0x91, 0x20, 0x00, 0xE0}},
+		{"if key then", ": main if v1 key then clear", []byte{0xE1, 0xA1, 0x00, 0xE0}},
+		{"if not key then", ": main if v1 -key then clear", []byte{0xE1, 0x9E, 0x00, 0xE0}},
+
+		// if ... begin skips the jump past the block when it is true.
+		{"if begin", ": main if v1 == 5 begin v2 := 1 end", []byte{0x31, 0x05, 0x12, 0x06, 0x62, 0x01}},
+		{"if begin else", ": main if v1 == 5 begin v2 := 1 else v2 := 2 end",
+			[]byte{0x31, 0x05, 0x12, 0x08, 0x62, 0x01, 0x12, 0x0A, 0x62, 0x02}},
+		{"if key begin", ": main if v1 key begin clear end", []byte{0xE1, 0x9E, 0x12, 0x06, 0x00, 0xE0}},
+
+		{"loop", ": main loop clear again", []byte{0x00, 0xE0, 0x12, 0x00}},
+		{"loop while", ": main loop v1 += 1 while v1 != 10 again",
+			[]byte{0x71, 0x01, 0x41, 0x0A, 0x12, 0x08, 0x12, 0x00}},
+		{"nested loop while", ": main loop loop while v1 == 1 again while v2 == 2 again",
+			[]byte{0x31, 0x01, 0x12, 0x06, 0x12, 0x00, 0x32, 0x02, 0x12, 0x0C, 0x12, 0x00}},
+
+		{"org", ": main jump 0x204 :org 0x204 clear", []byte{0x12, 0x04, 0x00, 0x00, 0x00, 0xE0}},
+		{"org back into a gap", ": main jump 0x206 :org 0x206 clear :org 0x202 :byte 1 :byte 2",
+			[]byte{0x12, 0x06, 0x01, 0x02, 0x00, 0x00, 0x00, 0xE0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rom, _, err := Assemble([]byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(rom, tt.want) {
+				t.Errorf("Assemble(%q) = % X, want % X", tt.src, rom, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // start of the error
+	}{
+		{"clear", "no main label"},
+		{": main\n: main", "line 2: label \"main\" is already defined"},
+		{": main\n\tv1 := 0x100", "line 2: 256 does not fit in a byte"},
+		{": main\n\tjump nowhere", "line 2: undefined name \"nowhere\""},
+		{": main\n\tloop\n\tclear", "line 2: loop is never closed"},
+		{": main\n\tif v1 == 1 begin", "line 2: begin is never closed"},
+		{": main\n\tend", "line 2: end without if ... begin"},
+		{": main\n\tagain", "line 2: again without loop"},
+		{": main\n\twhile v1 == 1", "line 2: while outside a loop"},
+		{": main\n\tif v1 < 3 then clear", "line 2: the < comparison is not supported"},
+		{": main\n\tif v1 == 3 clear", "line 2: expected then or begin"},
+		{": main\n\tsprite v1 v2 16", "line 2: sprite height 16 is not 0-15"},
+		{": main\n\tv1 |= 3", "line 2: |= needs a register"},
+		{": main\n\t:org 0x100", "line 2: :org 0x100 is outside the program"},
+		{": main\n\t:calc x { 1 }", "line 2: unsupported directive :calc"},
+		{": main\n\tclear clear\n:org 0x200\n\treturn", "line 3: :org moves over 0x200, which is already assembled"},
+		{": main\n\tv1 :=", "line 2: unexpected end of source"},
+	}
+	for _, tt := range tests {
+		_, _, err := Assemble([]byte(tt.src))
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("Assemble(%q) = %v, want error %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestAssembleLines(t *testing.T) {
+	src := `# draws a digit
+: main
+	v0 := 5 v1 := 10
+	i := hex v0
+
+	loop
+		sprite v1 v1 5
+	again
+`
+	_, lines, err := Assemble([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]int{3: 0x200, 4: 0x204, 7: 0x206, 8: 0x208}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("lines = %#x, want %#x", lines, want)
+	}
+}
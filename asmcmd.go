@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/n-ulricksen/chip8/asm"
+)
+
+// runAsm implements the asm subcommand, assembling Octo source into a ROM:
+//
+//	chip8 asm [-o game.ch8] game.8o
+func runAsm(args []string) {
+	fs := newCommandFlags("asm")
+	out := fs.String("o", "", "Write the ROM to this file (default: the source file with a .ch8 extension)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	path := fs.Arg(0)
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rom, _, err := asm.Assemble(src)
+	if err != nil {
+		log.Fatalf("%s: %v\n", path, err)
+	}
+
+	if *out == "" {
+		*out = strings.TrimSuffix(path, filepath.Ext(path)) + ".ch8"
+	}
+	if err := ioutil.WriteFile(*out, rom, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net"
+	"os"
+)
+
+// runAttach implements the attach command, connecting the terminal to the
+// debugger console an emulator serves with -console, possibly on another
+// machine:
+//
+//	chip8 attach example.com:4712
+//
+// Commands are typed as at the -repl console. It ends when the console is
+// detached from or the emulator quits.
+func runAttach(args []string) {
+	fs := newCommandFlags("attach")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	conn, err := net.Dial("tcp", fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	go func() {
+		io.Copy(conn, os.Stdin)
+		// Stdin ended: detach, letting the console's output finish.
+		conn.(*net.TCPConn).CloseWrite()
+	}()
+	if _, err := io.Copy(os.Stdout, conn); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build ebiten
+// +build ebiten
+
+package main
+
+import (
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/n-ulricksen/chip8/ebitenui"
+)
+
+func init() {
+	backends["ebiten"] = func(c *core.Chip8) error {
+		fe := ebitenui.New(layout)
+		var runErr error
+		if err := fe.Run(func() { runErr = c.Run(fe) }); err != nil {
+			return err
+		}
+
+		return runErr
+	}
+}
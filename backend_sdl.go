@@ -0,0 +1,91 @@
+//go:build !nosdl
+// +build !nosdl
+
+package main
+
+import (
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/n-ulricksen/chip8/sdlui"
+)
+
+func init() {
+	backends["sdl"] = func(c *core.Chip8) error {
+		var fe *sdlui.Frontend
+		opts := sdlOptions(c)
+		opts.LoadRom = func(c *core.Chip8, path string) error {
+			if err := changeRom(c, path); err != nil {
+				return err
+			}
+			fe.SetStateDir(stateDir(c))
+			return nil
+		}
+		fe, err := sdlui.New(opts)
+		if err != nil {
+			return err
+		}
+		if autosave {
+			fe.OfferResume(c)
+		}
+		rebind = func() error {
+			return fe.Rebind(sdlOptions(c))
+		}
+		if clock == clockVSync {
+			// Waiting for vsync in Render paces the emulator.
+			return c.Run(fe)
+		}
+
+		return c.RunConcurrently(fe)
+	}
+	launchers["sdl"] = func(roms []launcherRom) (string, bool, error) {
+		return sdlui.ChooseRom(romItems(roms), fontpath, logger)
+	}
+}
+
+// sdlOptions returns the options of the SDL frontend set by the flags and
+// the config file.
+func sdlOptions(c *core.Chip8) sdlui.Options {
+	return sdlui.Options{
+		Debug:         flagdebug,
+		VSync:         clock == clockVSync,
+		Layout:        layout,
+		Keypad:        keypad,
+		Scale:         scale,
+		Keys:          keymap,
+		Buttons:       padmap,
+		GameKeys:      gamekeys,
+		GameButtons:   gamepad,
+		SaveKeys:      saveKeys,
+		ScreenshotDir: shotdir,
+		StateDir:      stateDir(c),
+		Autosave:      autosave,
+		FontPath:      fontpath,
+		Volume:        volume,
+		Tone:          tone,
+		Logger:        logger,
+
+		Roms: func() []sdlui.RomItem {
+			return romItems(launcherRoms())
+		},
+	}
+}
+
+// romItems converts ROMs listed by a launcher to those of the SDL frontend.
+func romItems(roms []launcherRom) []sdlui.RomItem {
+	items := make([]sdlui.RomItem, len(roms))
+	for i, rom := range roms {
+		items[i] = sdlui.RomItem{Path: rom.path, Title: rom.title, Details: rom.details, Recent: rom.recent}
+	}
+
+	return items
+}
+
+// saveKeys writes keypad bindings rebound in the SDL window to the config
+// file.
+func saveKeys(keys map[string]uint8) error {
+	if err := saveKeymap(cfgpath, "keys", keys); err != nil {
+		return err
+	}
+	logger.Infof("Keybindings saved to %s", cfgpath)
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/n-ulricksen/chip8/remoteui"
+	"github.com/n-ulricksen/chip8/streamui"
+	"github.com/n-ulricksen/chip8/termui"
+)
+
+// backends maps the names accepted by -backend to functions running the
+// emulator with that frontend. Frontends needing extra libraries register
+// themselves from files guarded by build tags.
+var backends = map[string]func(c *core.Chip8) error{
+	"terminal": func(c *core.Chip8) error {
+		return c.Run(termui.New(layout))
+	},
+	"remote": func(c *core.Chip8) error {
+		if serveaddr == "" {
+			serveaddr = ":8080"
+		}
+		f, err := remoteui.New(serveaddr)
+		if err != nil {
+			return fmt.Errorf("remote play server: %v", err)
+		}
+		logger.Infof("Serving remote play on http://%s/", serveaddr)
+		stopOnInterrupt(c)
+		return c.Run(f)
+	},
+	"headless": func(c *core.Chip8) error {
+		stopOnInterrupt(c)
+		if mjpegaddr == "" {
+			return c.Run(nullFrontend{})
+		}
+		streamScale := scale
+		if streamScale == 0 {
+			streamScale = 10
+		}
+		f, err := streamui.New(mjpegaddr, streamScale)
+		if err != nil {
+			return fmt.Errorf("display stream: %v", err)
+		}
+		logger.Infof("Streaming the display on http://%s/", mjpegaddr)
+		return c.Run(f)
+	},
+}
+
+// nullFrontend shows nothing and reads no input, for running the emulator
+// headless, driven through the control API or a debugger.
+type nullFrontend struct{}
+
+func (nullFrontend) Render(c *core.Chip8) {}
+
+func (nullFrontend) PollEvents(c *core.Chip8) {}
+
+func (nullFrontend) Close() {}
+
+// stopOnInterrupt stops the emulator on Ctrl-C, for backends with no window
+// or terminal to quit from, so recordings in progress are saved.
+func stopOnInterrupt(c *core.Chip8) {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		<-interrupts
+		signal.Stop(interrupts)
+		c.Do(c.Stop)
+	}()
+}
+
+// launchers maps the names of backends able to show a list of ROMs, for the
+// one to run to be chosen from when none is given, to functions doing so.
+// They return the path of the ROM chosen, or false if none was.
+var launchers = map[string]func(roms []launcherRom) (string, bool, error){}
+
+// launcherRom is a ROM listed by a launcher.
+type launcherRom struct {
+	path    string
+	title   string // name shown
+	details string // shown while the ROM is highlighted
+	recent  bool   // played recently
+}
+
+// backendPreference is the order backends are picked in when -backend isn't
+// given.
+var backendPreference = []string{"sdl", "ebiten", "terminal", "remote", "headless"}
+
+// backendNames returns the names of the backends built into the binary, most
+// preferred first.
+func backendNames() []string {
+	var names []string
+	for _, name := range backendPreference {
+		if _, ok := backends[name]; ok {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// headlessFrontend renders nothing, stopping the emulator after a number of
+// frames, or when execution pauses on an invalid opcode. It times each
+// frame.
+type headlessFrontend struct {
+	frames uint64 // frames to run for, 0 for as long as it takes
+
+	last  time.Time       // when the last frame ended
+	times []time.Duration // how long each frame took
+}
+
+func (fe *headlessFrontend) Render(c *core.Chip8) {
+	now := time.Now()
+	if !fe.last.IsZero() {
+		fe.times = append(fe.times, now.Sub(fe.last))
+	}
+	fe.last = now
+
+	if frames, _ := c.Counters(); (fe.frames > 0 && frames+1 >= fe.frames) || c.Halted() {
+		c.Stop()
+	}
+}
+
+func (fe *headlessFrontend) PollEvents(c *core.Chip8) {}
+
+func (fe *headlessFrontend) Close() {}
+
+// runBench implements the bench command, running a ROM as fast as possible
+// for a number of frames and reporting the rate instructions were executed
+// at, how long frames took and the memory allocated doing so. Timers tick
+// once a frame and the seed is fixed, so runs are repeatable.
+func runBench(args []string) {
+	fs := newCommandFlags("bench")
+	frames := fs.Uint64("frames", 1000, "Number of frames to run for")
+	fs.Int64Var(&seed, "seed", 1, "Seed for the random number generator")
+	fs.StringVar(&hashpath, "hashes", "", "Write a hash of the display, registers and RAM after every frame to this file, to compare runs")
+	profilingFlags(fs)
+	fs.Parse(args)
+	rom, ok := romArg(fs)
+	if !ok {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	c, err := core.NewChip8(core.Options{Seed: seed, Unpaced: true, Deterministic: true, HashesPath: hashpath, Logger: logger})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := c.LoadRom(rom); err != nil {
+		log.Fatal("Error loading ROM: ", err)
+	}
+
+	fe := &headlessFrontend{frames: *frames, times: make([]time.Duration, 0, *frames)}
+	var before, after runtime.MemStats
+	stopProfiling := startProfiling()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	err = c.Run(fe)
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	stopProfiling()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	n, instructions := c.Counters()
+	if reason := c.StopReason(); reason != "" {
+		fmt.Println("Stopped early:", reason)
+	}
+	fmt.Printf("Frames:        %d in %v\n", n, elapsed.Round(time.Millisecond))
+	fmt.Printf("Instructions:  %d, %.0f per second\n", instructions, float64(instructions)/elapsed.Seconds())
+	fmt.Printf("Frame rate:    %.0f per second\n", float64(n)/elapsed.Seconds())
+
+	if len(fe.times) > 0 {
+		times := fe.times
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+		fmt.Printf("Frame times:   min %v, median %v, 99th percentile %v, max %v\n",
+			times[0], times[len(times)/2], times[len(times)*99/100], times[len(times)-1])
+	}
+
+	allocs := after.Mallocs - before.Mallocs
+	bytes := after.TotalAlloc - before.TotalAlloc
+	fmt.Printf("Allocations:   %d (%d bytes)", allocs, bytes)
+	if n > 0 {
+		fmt.Printf(", %.1f (%d bytes) a frame", float64(allocs)/float64(n), bytes/n)
+	}
+	fmt.Println()
+	fmt.Printf("GC cycles:     %d\n", after.NumGC-before.NumGC)
+}
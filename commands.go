@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command is a subcommand of the chip8 binary, e.g. "chip8 disasm game.ch8".
+type command struct {
+	name    string
+	args    string // arguments after the options, for the usage
+	summary string
+	run     func(args []string)
+}
+
+// commands are the subcommands, in the order the usage lists them. It is set
+// in init, as the help command refers to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"run", "ROM", "Run a ROM, given by path or by name in the ROM directories", runRun},
+		{"debug", "ROM", "Run a ROM with the debug panel and debugger options", runDebug},
+		{"attach", "ADDRESS", "Attach to the debugger console of an emulator run with -console", runAttach},
+		{"disasm", "ROM", "Print the disassembly of a ROM", runDisasm},
+		{"asm", "SOURCE", "Assemble Octo source into a ROM", runAsm},
+		{"info", "ROM", "Analyze a ROM without running it", runInfo},
+		{"diff", "ROM ROM", "Compare two ROMs by address", runDiff},
+		{"tracecmp", "ROM TRACE", "Compare the execution of a ROM with a trace from another emulator", runTraceCmp},
+		{"bench", "ROM", "Measure how fast a ROM is emulated, without a display", runBench},
+		{"help", "[COMMAND]", "Show the usage of chip8 or of a command", runHelp},
+	}
+}
+
+// findCommand returns the command called name, if any.
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+
+	return command{}, false
+}
+
+// runCommand runs the command called name with the arguments following it.
+func runCommand(name string, args []string) {
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	cmd.run(args)
+}
+
+// usage prints the commands to stderr.
+func usage() {
+	out := os.Stderr
+	fmt.Fprintln(out, "Usage: chip8 COMMAND [options] [arguments]")
+	fmt.Fprintln(out, "       chip8 [options] ROM  (the same as run, also taking the debug options)")
+	fmt.Fprintln(out, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(out, "\nRun \"chip8 help COMMAND\" for the options of a command.")
+}
+
+// newCommandFlags returns the flag set of the command called name, printing
+// its usage on errors and -h.
+func newCommandFlags(name string) *flag.FlagSet {
+	cmd, _ := findCommand(name)
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, strings.TrimSpace("Usage: chip8 "+cmd.name+" [options] "+cmd.args))
+		fmt.Fprintf(out, "\n%s.\n", cmd.summary)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(out, "\nOptions:")
+			fs.PrintDefaults()
+		}
+		if fs.Lookup("config") != nil {
+			fmt.Fprintln(out, "\nOptions not given are read from GOCHIP8_<OPTION> environment variables, e.g.")
+			fmt.Fprintln(out, "GOCHIP8_SPEED, or GOCHIP8_ROM for -p, and then from the config file.")
+		}
+	}
+
+	return fs
+}
+
+// runHelp implements the help command.
+func runHelp(args []string) {
+	if len(args) == 0 {
+		usage()
+		return
+	}
+
+	if _, ok := findCommand(args[0]); !ok || args[0] == "help" {
+		runCommand(args[0], nil)
+		return
+	}
+	runCommand(args[0], []string{"-h"})
+}
@@ -0,0 +1,560 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// legacyConfigPath is the config file read before there was one in the
+// user's config directory. It is still read if only it exists.
+const legacyConfigPath = "./chip8.toml"
+
+// configDir returns the directory gochip8 keeps its config in, e.g.
+// ~/.config/gochip8.
+func configDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "."
+	}
+
+	return filepath.Join(dir, "gochip8")
+}
+
+// cacheDir returns the directory gochip8 keeps files which can be done
+// without in, e.g. ~/.cache/gochip8.
+func cacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "."
+	}
+
+	return filepath.Join(dir, "gochip8")
+}
+
+// defaultConfigPath returns the config file read when -config isn't given:
+// config.toml in configDir, unless only legacyConfigPath exists. It is fine
+// for neither to exist.
+func defaultConfigPath() string {
+	path := filepath.Join(configDir(), "config.toml")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if _, err := os.Stat(legacyConfigPath); err == nil {
+			return legacyConfigPath
+		}
+	}
+
+	return path
+}
+
+// config holds the settings read from a TOML config file, by section and
+// then by key:
+//
+//	# comment
+//	speed = 700
+//	quirks = ["keyrelease"]
+//	[keys]
+//	"Keypad 1" = 0xC
+//	[game."pong.ch8".keys]
+//	W = "1"
+//
+// Tables are sections named by their dotted path, such as
+// game."pong.ch8".keys, and the settings before the first one are in the
+// section named "". Settings in that section are named after command line
+// flags, see applySettings. Sections under game."<ROM name or hash>"
+// override the settings of the section with the same name for that ROM
+// only, and a [game."<ROM name or hash>"] section the settings before the
+// first section.
+type config map[string]map[string]interface{}
+
+// loadConfig reads and parses the config file at path.
+func loadConfig(path string) (config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := parseConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return cfg, nil
+}
+
+// parseConfig parses the contents of a config file.
+func parseConfig(data []byte) (config, error) {
+	var doc map[string]interface{}
+	if _, err := toml.Decode(string(data), &doc); err != nil {
+		return nil, err
+	}
+
+	cfg := config{}
+	if err := cfg.addTable(nil, doc); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// addTable adds the table at path, and the tables in it, as sections. Tables
+// holding only tables, such as game in [game.TETRIS.keys], aren't sections.
+func (cfg config) addTable(path []string, table map[string]interface{}) error {
+	name := joinDotted(path)
+	if len(table) == 0 {
+		cfg[name] = map[string]interface{}{}
+	}
+	for key, value := range table {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			if err := cfg.addTable(append(path[:len(path):len(path)], key), value); err != nil {
+				return err
+			}
+		case []map[string]interface{}:
+			return fmt.Errorf("%s: arrays of tables aren't supported", joinDotted(append(path, key)))
+		default:
+			if cfg[name] == nil {
+				cfg[name] = map[string]interface{}{}
+			}
+			cfg[name][key] = value
+		}
+	}
+
+	return nil
+}
+
+// value returns the setting key of the named section as a string, as the
+// flag it is named after would be given it: arrays as their items separated
+// by commas, and numbers and booleans as Go formats them. It is empty if
+// there is no such setting.
+func (cfg config) value(section, key string) string {
+	return valueString(cfg[section][key])
+}
+
+// valueString returns a setting as config.value does.
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = valueString(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// envAliases name the environment variables of the flags whose own names are
+// too terse to make sense of.
+var envAliases = map[string]string{
+	"p": "GOCHIP8_ROM",
+	"t": "GOCHIP8_TEST",
+	"d": "GOCHIP8_DEBUG",
+}
+
+// envName returns the name of the environment variable setting the flag:
+// GOCHIP8_ followed by the flag in upper case, with dashes as underscores,
+// e.g. GOCHIP8_TRACE_RANGE for -trace-range, unless it has an alias.
+func envName(flagName string) string {
+	if alias, ok := envAliases[flagName]; ok {
+		return alias
+	}
+
+	return "GOCHIP8_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets the flags of fs which weren't given on the command line, as
+// listed by givenFlags, from the environment variables named after them.
+// They override the config file, so the flags they set are added to given.
+func applyEnv(fs *flag.FlagSet, given map[string]bool) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || given[f.Name] || err != nil {
+			return
+		}
+		if err = fs.Set(f.Name, value); err != nil {
+			err = fmt.Errorf("%s=%q: %v", envName(f.Name), value, err)
+			return
+		}
+		given[f.Name] = true
+	})
+
+	return err
+}
+
+// givenFlags returns the names of the flags of fs given on the command line.
+func givenFlags(fs *flag.FlagSet) map[string]bool {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	return given
+}
+
+// applySettings sets the flags of fs which weren't given on the command
+// line, as listed by givenFlags, to the settings of the named section of the
+// config file, which are named after them, e.g.
+//
+//	speed = 1000
+//	quirks = ["keyrelease"]
+//	palette = "ffffff,000000"
+//	volume = 50
+//
+// Settings for flags fs doesn't have, such as those of the debug command
+// when running the run command, are ignored.
+func (cfg config) applySettings(fs *flag.FlagSet, section string, given map[string]bool) error {
+	for name := range cfg[section] {
+		if given[name] || name == "config" || fs.Lookup(name) == nil {
+			continue
+		}
+		value := cfg.value(section, name)
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("[%s] %s = %q: %v", section, name, value, err)
+		}
+	}
+
+	return nil
+}
+
+// parseSpeed parses the speed of the emulator, given as instructions a
+// second or, as in "20/frame", a frame, and returns the instructions a frame.
+func parseSpeed(s string) (int, error) {
+	perFrame := strings.HasSuffix(s, "/frame")
+	n, err := strconv.ParseFloat(strings.TrimSuffix(s, "/frame"), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid speed %q, expected instructions a second, or a frame as in 20/frame", s)
+	}
+	if !perFrame {
+		n /= core.VBlankFreq
+	}
+
+	return int(math.Max(1, math.Round(n))), nil
+}
+
+// parsePalette parses the foreground and background colors of the display,
+// as hex RGB separated by a comma, e.g. "00ffc8,000000".
+func parsePalette(s string) (fg, bg color.RGBA, err error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 2 {
+		return fg, bg, fmt.Errorf("invalid palette %q, expected FOREGROUND,BACKGROUND", s)
+	}
+	if fg, err = parseColor(parts[0]); err == nil {
+		bg, err = parseColor(parts[1])
+	}
+
+	return fg, bg, err
+}
+
+// parseColor parses a color written as hex RGB, optionally prefixed by #.
+func parseColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	rgb, err := strconv.ParseUint(hex, 16, 24)
+	if err != nil || len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("%q is not a color, expected hex RGB such as 00ffc8", s)
+	}
+
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 255}, nil
+}
+
+// writeConfigSection replaces the settings of the named section in the config
+// file at path with values, creating the section, or the file, if needed.
+// Comments and other sections are left as they are.
+func writeConfigSection(path, name string, values map[string]string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var settings []string
+	for _, key := range keys {
+		settings = append(settings, strconv.Quote(key)+" = "+strconv.Quote(values[key]))
+	}
+
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+
+	var out []string
+	found, inSection := false, false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(stripComment(line))
+		if strings.HasPrefix(trimmed, "[") {
+			inSection = trimmed == "["+name+"]"
+			if inSection && !found {
+				found = true
+				out = append(out, line)
+				out = append(out, settings...)
+				continue
+			}
+		}
+		if inSection && trimmed != "" {
+			continue
+		}
+		out = append(out, line)
+	}
+	if !found {
+		if len(out) > 0 {
+			out = append(out, "")
+		}
+		out = append(out, "["+name+"]")
+		out = append(out, settings...)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, []byte(strings.Join(out, "\n")+"\n"), 0644)
+}
+
+// stripComment removes a trailing # comment from line, ignoring any # inside
+// a quoted string.
+func stripComment(line string) string {
+	if i := indexUnquoted(line, '#'); i >= 0 {
+		return line[:i]
+	}
+
+	return line
+}
+
+// indexUnquoted returns the index of the first c in s that isn't inside a
+// quoted string, or -1.
+func indexUnquoted(s string, c byte) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == c && !quoted:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// unquote returns s without its surrounding double quotes, if it has them.
+func unquote(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+
+	return strconv.Unquote(s)
+}
+
+// keymap returns the bindings from the named section, mapping the names of
+// keys or buttons to the Chip-8 keys (0-F) they press, or nil if there are
+// none. The [keys] section binds SDL key names and [gamepad] SDL game
+// controller button names.
+func (cfg config) keymap(name string) (map[string]uint8, error) {
+	section := cfg[name]
+	if len(section) == 0 {
+		return nil, nil
+	}
+
+	keys := make(map[string]uint8, len(section))
+	for k, value := range section {
+		key, ok := keyValue(value)
+		if !ok {
+			return nil, fmt.Errorf("[%s] %s: %q is not a Chip-8 key (0-F)", name, k, valueString(value))
+		}
+		keys[k] = key
+	}
+
+	return keys, nil
+}
+
+// turboKeys returns the Chip-8 keys listed by the keys setting of the named
+// section, normally [turbo], as an array or a string separated by commas or
+// spaces.
+func (cfg config) turboKeys(name string) ([]uint8, error) {
+	values, ok := cfg[name]["keys"].([]interface{})
+	if !ok {
+		for _, value := range strings.FieldsFunc(cfg.value(name, "keys"), func(r rune) bool {
+			return r == ',' || r == ' '
+		}) {
+			values = append(values, value)
+		}
+	}
+
+	var keys []uint8
+	for _, value := range values {
+		key, ok := keyValue(value)
+		if !ok {
+			return nil, fmt.Errorf("[%s] keys: %q is not a Chip-8 key (0-F)", name, valueString(value))
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// keyValue returns the Chip-8 key a setting names, as a number or a hex
+// digit string, as parseKey parses.
+func keyValue(v interface{}) (uint8, bool) {
+	switch v := v.(type) {
+	case int64:
+		return uint8(v), v >= 0 && v <= 0xf
+	case string:
+		return parseKey(v)
+	}
+
+	return 0, false
+}
+
+// gameSection returns the name of the section overriding the named one for a
+// single ROM, such as [game."TETRIS".keys], or [game."TETRIS"] for the
+// settings before the first section, named "", if there is one. ROMs are
+// matched by file name, with or without its extension, or by SHA-1 hash; a
+// match by hash wins.
+func (cfg config) gameSection(name, romName, romHash string) (string, bool) {
+	found, ok := "", false
+	for section := range cfg {
+		parts := splitDotted(section)
+		if parts[0] != "game" {
+			continue
+		}
+		if name == "" && len(parts) != 2 || name != "" && (len(parts) != 3 || parts[2] != name) {
+			continue
+		}
+		game := parts[1]
+		switch {
+		case strings.EqualFold(game, romHash):
+			return section, true
+		case game == romName || game == strings.TrimSuffix(romName, filepath.Ext(romName)):
+			found, ok = section, true
+		}
+	}
+
+	return found, ok
+}
+
+// joinDotted returns the name of the section at the path of tables, e.g.
+// game."pong.ch8".keys, quoting the keys which aren't bare TOML keys.
+func joinDotted(path []string) string {
+	parts := make([]string, len(path))
+	for i, key := range path {
+		parts[i] = key
+		if key == "" || strings.TrimFunc(key, isBareKeyRune) != "" {
+			parts[i] = strconv.Quote(key)
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// isBareKeyRune reports whether r can be in a TOML key without quotes.
+func isBareKeyRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-'
+}
+
+// splitDotted splits a dotted section name, like game."pong.ch8".keys, into
+// its parts, removing any quotes.
+func splitDotted(s string) []string {
+	var parts []string
+	for {
+		i := indexUnquoted(s, '.')
+		if i < 0 {
+			break
+		}
+		part, _ := unquote(strings.TrimSpace(s[:i]))
+		parts = append(parts, part)
+		s = s[i+1:]
+	}
+	part, _ := unquote(strings.TrimSpace(s))
+
+	return append(parts, part)
+}
+
+// parseAddrs parses a list of hex addresses, optionally prefixed by 0x and
+// separated by commas or spaces.
+func parseAddrs(s string) ([]uint16, error) {
+	var addrs []uint16
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' '
+	}) {
+		hex := strings.TrimPrefix(strings.ToLower(field), "0x")
+		addr, err := strconv.ParseUint(hex, 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address", field)
+		}
+		addrs = append(addrs, uint16(addr))
+	}
+
+	return addrs, nil
+}
+
+// parseBreakpoints parses a comma separated list of breakpoints: hex
+// addresses, as parseAddrs does, and conditions, which core.ParseCondition
+// parses.
+func parseBreakpoints(s string) ([]uint16, []core.Condition, error) {
+	var addrs []uint16
+	var conds []core.Condition
+	for _, field := range strings.Split(s, ",") {
+		if !strings.ContainsAny(field, "=<>!") {
+			more, err := parseAddrs(field)
+			if err != nil {
+				return nil, nil, err
+			}
+			addrs = append(addrs, more...)
+			continue
+		}
+
+		cond, err := core.ParseCondition(field)
+		if err != nil {
+			return nil, nil, err
+		}
+		conds = append(conds, cond)
+	}
+
+	return addrs, conds, nil
+}
+
+// parseKey parses the hex digit of a Chip-8 key, optionally prefixed by 0x.
+func parseKey(s string) (uint8, bool) {
+	hex := strings.TrimPrefix(strings.ToLower(s), "0x")
+	key, err := strconv.ParseUint(hex, 16, 8)
+	if err != nil || key > 0xf {
+		return 0, false
+	}
+
+	return uint8(key), true
+}
+
+// saveKeymap writes bindings, as returned by keymap, to the named section of
+// the config file at path.
+func saveKeymap(path, name string, keys map[string]uint8) error {
+	values := make(map[string]string, len(keys))
+	for k, key := range keys {
+		values[k] = fmt.Sprintf("%X", key)
+	}
+
+	return writeConfigSection(path, name, values)
+}
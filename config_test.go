@@ -0,0 +1,222 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	src := `# top level settings
+speed = 700
+palette = "00ffc8,000000" # trailing comment
+quirks = ["keyrelease"]
+deterministic = true
+volume = 50
+tone = 523.25
+
+[keys]
+Q = 4
+"Keypad 1" = 0xC
+"#" = "F" # a quoted # isn't a comment
+
+[ game."pong.ch8".keys ]
+W = 1
+
+[game.TETRIS]
+speed = """
+20/frame"""
+turbo = { keys = [5, "6"] }
+`
+	got, err := parseConfig([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := config{
+		"":                     {"speed": int64(700), "palette": "00ffc8,000000", "quirks": []interface{}{"keyrelease"}, "deterministic": true, "volume": int64(50), "tone": 523.25},
+		"keys":                 {"Q": int64(4), "Keypad 1": int64(0xC), "#": "F"},
+		`game."pong.ch8".keys`: {"W": int64(1)},
+		"game.TETRIS":          {"speed": "20/frame"},
+		"game.TETRIS.turbo":    {"keys": []interface{}{int64(5), "6"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseConfig = %v, want %v", got, want)
+	}
+
+	for _, tt := range []struct{ section, key, want string }{
+		{"", "speed", "700"},
+		{"", "quirks", "keyrelease"},
+		{"", "deterministic", "true"},
+		{"", "tone", "523.25"},
+		{"", "missing", ""},
+	} {
+		if got := got.value(tt.section, tt.key); got != tt.want {
+			t.Errorf("value(%q, %q) = %q, want %q", tt.section, tt.key, got, tt.want)
+		}
+	}
+	keys, err := got.keymap("keys")
+	if want := map[string]uint8{"Q": 4, "Keypad 1": 0xC, "#": 0xF}; err != nil || !reflect.DeepEqual(keys, want) {
+		t.Errorf("keymap = %v, %v, want %v", keys, err, want)
+	}
+	turbo, err := got.turboKeys("game.TETRIS.turbo")
+	if want := []uint8{5, 6}; err != nil || !reflect.DeepEqual(turbo, want) {
+		t.Errorf("turboKeys = %v, %v, want %v", turbo, err, want)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"[keys\nQ = 4", "line 2"},
+		{"speed = 1\nspeed", "expected key separator"},
+		{"= 4", "key name appears blank"},
+		{`palette = "00ffc8`, "unexpected EOF"},
+		{"[[keys]]\nQ = 4", "keys: arrays of tables aren't supported"},
+	}
+	for _, tt := range tests {
+		_, err := parseConfig([]byte(tt.src))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseConfig(%q) = %v, want error %q", tt.src, err, tt.want)
+		}
+	}
+
+	for _, src := range []string{"[keys]\nQ = 16", "[keys]\nQ = -1", "[keys]\nQ = \"G\"", "[keys]\nQ = [1]"} {
+		cfg, err := parseConfig([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cfg.keymap("keys"); err == nil {
+			t.Errorf("keymap accepted %q", src)
+		}
+	}
+}
+
+func TestGameSection(t *testing.T) {
+	const hash = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	cfg := config{
+		"":                          {},
+		"keys":                      {},
+		`game."pong.ch8"`:           {},
+		`game."pong.ch8".keys`:      {},
+		`game.TETRIS.keys`:          {},
+		`game."` + hash + `".keys`:  {},
+		`game."BLINKY.ch8".gamepad`: {},
+	}
+	tests := []struct {
+		name, rom, hash string
+		want            string
+		ok              bool
+	}{
+		{"", "pong.ch8", "", `game."pong.ch8"`, true},
+		{"keys", "pong.ch8", "", `game."pong.ch8".keys`, true},
+		{"keys", "TETRIS.ch8", "", "game.TETRIS.keys", true},
+		{"keys", "pong.ch8", strings.ToUpper(hash), `game."` + hash + `".keys`, true},
+		{"gamepad", "pong.ch8", "", "", false},
+		{"keys", "BLINKY.ch8", "", "", false},
+		{"", "TETRIS.ch8", "", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := cfg.gameSection(tt.name, tt.rom, tt.hash)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("gameSection(%q, %q, %q) = %q, %v, want %q, %v", tt.name, tt.rom, tt.hash, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	speed := fs.String("speed", "480", "")
+	palette := fs.String("palette", "", "")
+	scale := fs.Int("scale", 0, "")
+	traceRange := fs.String("trace-range", "", "")
+	if err := fs.Parse([]string{"-scale", "4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv("GOCHIP8_TRACE_RANGE", "200-2ff")
+	os.Setenv("GOCHIP8_PALETTE", "ffffff,000000")
+	defer os.Unsetenv("GOCHIP8_TRACE_RANGE")
+	defer os.Unsetenv("GOCHIP8_PALETTE")
+	given := givenFlags(fs)
+	if err := applyEnv(fs, given); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config{
+		"":                {"speed": int64(700), "palette": "00ffc8,000000", "scale": int64(8), "unknown": int64(1)},
+		`game."pong.ch8"`: {"speed": "20/frame"},
+	}
+	if err := cfg.applySettings(fs, "", given); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.applySettings(fs, `game."pong.ch8"`, given); err != nil {
+		t.Fatal(err)
+	}
+
+	if *scale != 4 {
+		t.Errorf("scale = %d, want 4 from the command line", *scale)
+	}
+	if *traceRange != "200-2ff" || *palette != "ffffff,000000" {
+		t.Errorf("trace-range, palette = %q, %q, want those of the environment", *traceRange, *palette)
+	}
+	if *speed != "20/frame" {
+		t.Errorf("speed = %q, want 20/frame from the game section", *speed)
+	}
+
+	bad := config{"": {"scale": "big"}}
+	if err := bad.applySettings(fs, "", map[string]bool{}); err == nil {
+		t.Error("applySettings accepted scale = big")
+	}
+}
+
+func TestWriteConfigSection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	old := `# settings
+speed = 700
+
+[keys] # keyboard
+Q = 4
+W = 5
+
+[gamepad]
+a = 5
+`
+	if err := ioutil.WriteFile(path, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeConfigSection(path, "keys", map[string]string{"Keypad 1": "C"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeConfigSection(path, "turbo", map[string]string{"keys": "5"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# settings
+speed = 700
+
+[keys] # keyboard
+"Keypad 1" = "C"
+
+[gamepad]
+a = 5
+
+[turbo]
+"keys" = "5"
+`
+	if string(data) != want {
+		t.Errorf("config file is\n%s\nwant\n%s", data, want)
+	}
+	if _, err := loadConfig(path); err != nil {
+		t.Errorf("written config doesn't parse: %v", err)
+	}
+}
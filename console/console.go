@@ -0,0 +1,320 @@
+// Package console implements a command line debugger for the emulator, a
+// monitor reading commands such as "break 2a4" or "mem 300 32" while the
+// emulator runs.
+package console
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+const prompt = "(chip8) "
+
+// pollInterval is how often a step is checked for having finished.
+const pollInterval = 10 * time.Millisecond
+
+// help lists the commands.
+const help = `Commands (addresses are hex, counts decimal or 0x hex):
+  break ADDR        pause before executing the instruction at ADDR
+  break COND        pause when COND, e.g. V3 == 0x1f or 2a4 if I >= 0x400,
+                    becomes true
+  delete ADDR       remove the breakpoint at ADDR
+  breaks            list breakpoints
+  continue          resume execution
+  pause             pause execution
+  step              execute one instruction
+  next              execute one instruction, stepping over CALLs
+  back              undo the last instruction executed
+  skip              move past the instruction at PC without executing it
+  regs              show the CPU registers
+  mem ADDR [N]      dump N bytes of RAM from ADDR (default 64)
+  disas [ADDR] [N]  disassemble N instructions from ADDR (default PC, 10)
+  profile [N]       show the N hottest addresses (default 20), with -profile
+  dump [FILE]       write the state of the machine as JSON to FILE, or show it
+  restore FILE      load the state of the machine from JSON written by dump
+  detach            end the console, leaving the emulator running
+  quit              stop the emulator
+`
+
+// Run reads commands from in and writes their results to out until in
+// ends, the detach command ends the console or the quit command stops the
+// emulator.
+func Run(in io.Reader, out io.Writer, c *core.Chip8) {
+	con := &console{out: out, c: c}
+
+	scanner := bufio.NewScanner(in)
+	fmt.Fprint(out, prompt)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 {
+			if err := con.exec(fields[0], fields[1:]); err == errQuit || err == errDetach {
+				return
+			} else if err != nil {
+				fmt.Fprintln(out, "Error:", err)
+			}
+		}
+		fmt.Fprint(out, prompt)
+	}
+}
+
+// errQuit is returned by the quit command, and errDetach by detach.
+var (
+	errQuit   = fmt.Errorf("quit")
+	errDetach = fmt.Errorf("detach")
+)
+
+// console executes commands on an emulator.
+type console struct {
+	out io.Writer
+	c   *core.Chip8
+}
+
+// exec executes the command cmd with the arguments args.
+func (con *console) exec(cmd string, args []string) error {
+	c := con.c
+
+	switch cmd {
+	case "help", "h", "?":
+		fmt.Fprint(con.out, help)
+	case "break", "b":
+		if len(args) > 1 {
+			cond, err := core.ParseCondition(strings.Join(args, " "))
+			if err != nil {
+				return err
+			}
+			c.Do(func() { c.AddCondition(cond) })
+			fmt.Fprintf(con.out, "Breakpoint on %s\n", cond)
+			break
+		}
+		addr, err := parseAddr(args, 0)
+		if err != nil {
+			return err
+		}
+		c.Do(func() { c.SetBreakpoint(addr) })
+		fmt.Fprintf(con.out, "Breakpoint at %03X\n", addr)
+	case "delete", "d":
+		addr, err := parseAddr(args, 0)
+		if err != nil {
+			return err
+		}
+		c.Do(func() { c.ClearBreakpoint(addr) })
+	case "breaks":
+		var addrs []uint16
+		var conds []core.Condition
+		c.Do(func() { addrs, conds = c.Breakpoints(), c.Conditions() })
+		for _, addr := range addrs {
+			fmt.Fprintf(con.out, "%03X\n", addr)
+		}
+		for _, cond := range conds {
+			fmt.Fprintln(con.out, cond)
+		}
+	case "continue", "c":
+		c.Do(func() { c.SetPaused(false) })
+	case "pause", "p":
+		c.Do(func() { c.SetPaused(true) })
+		con.where()
+	case "step", "s":
+		con.step(c.Step)
+	case "next", "n":
+		con.step(c.StepOver)
+	case "back", "rs":
+		var ok bool
+		c.Do(func() {
+			c.SetPaused(true)
+			ok = c.StepBack()
+		})
+		if !ok {
+			return fmt.Errorf("no instruction to step back over")
+		}
+		con.where()
+	case "skip":
+		c.Do(func() {
+			c.SetPaused(true)
+			c.SkipInstruction()
+		})
+		con.where()
+	case "regs", "r":
+		var r core.Registers
+		c.Do(func() { r = c.Registers() })
+		printRegisters(con.out, r)
+	case "mem", "m", "x":
+		addr, err := parseAddr(args, 0)
+		if err != nil {
+			return err
+		}
+		n, err := parseCount(args, 1, 64)
+		if err != nil {
+			return err
+		}
+		var mem []byte
+		c.Do(func() { mem = c.Memory(addr, n) })
+		printMemory(con.out, addr, mem)
+	case "disas", "dis":
+		var addr uint16
+		c.Do(func() { addr = c.Registers().PC })
+		if len(args) > 0 {
+			var err error
+			if addr, err = parseAddr(args, 0); err != nil {
+				return err
+			}
+		}
+		n, err := parseCount(args, 1, 10)
+		if err != nil {
+			return err
+		}
+		con.disassemble(addr, n)
+	case "profile":
+		n, err := parseCount(args, 0, 20)
+		if err != nil {
+			return err
+		}
+		c.Do(func() { err = c.WriteProfile(con.out, n) })
+		return err
+	case "dump":
+		var data []byte
+		var err error
+		c.Do(func() { data, err = c.DumpStateJSON() })
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			fmt.Fprintf(con.out, "%s\n", data)
+			return nil
+		}
+		return ioutil.WriteFile(args[0], data, 0644)
+	case "restore":
+		if len(args) == 0 {
+			return fmt.Errorf("expected the file to restore")
+		}
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		c.Do(func() { err = c.LoadStateJSON(data) })
+		if err != nil {
+			return err
+		}
+		con.where()
+	case "detach":
+		return errDetach
+	case "quit", "q":
+		c.Do(c.Stop)
+		return errQuit
+	default:
+		return fmt.Errorf("unknown command %q, try help", cmd)
+	}
+
+	return nil
+}
+
+// step runs a step started by fn to completion, then shows where it
+// stopped. Steps need execution to be paused, so it is paused first.
+func (con *console) step(fn func()) {
+	c := con.c
+	c.Do(func() {
+		c.SetPaused(true)
+		fn()
+	})
+
+	var halted bool
+	for !halted {
+		time.Sleep(pollInterval)
+		c.Do(func() { halted = c.Halted() })
+	}
+	con.where()
+}
+
+// where shows the instruction at PC.
+func (con *console) where() {
+	var pc uint16
+	con.c.Do(func() { pc = con.c.Registers().PC })
+	con.disassemble(pc, 1)
+}
+
+// disassemble prints n instructions starting at addr.
+func (con *console) disassemble(addr uint16, n int) {
+	type line struct {
+		addr uint16
+		op   uint16
+		text string
+	}
+	var lines []line
+	var pc uint16
+	con.c.Do(func() {
+		pc = con.c.Registers().PC
+		for i := 0; i < n && int(addr)+2*i < 0xFFF; i++ {
+			at := addr + uint16(2*i)
+			op, text := con.c.DisassembleAt(at)
+			lines = append(lines, line{at, op, text})
+		}
+	})
+
+	for _, l := range lines {
+		marker := " "
+		if l.addr == pc {
+			marker = ">"
+		}
+		fmt.Fprintf(con.out, "%s %03X  %04X  %s\n", marker, l.addr, l.op, l.text)
+	}
+}
+
+// printRegisters writes the registers of r.
+func printRegisters(w io.Writer, r core.Registers) {
+	fmt.Fprintf(w, "PC %03X  I %03X  SP %d  DT %d  ST %d\n", r.PC, r.I, r.SP, r.DT, r.ST)
+	for i, v := range r.V {
+		fmt.Fprintf(w, "V%X %02X", i, v)
+		if i%8 == 7 {
+			fmt.Fprintln(w)
+		} else {
+			fmt.Fprint(w, "  ")
+		}
+	}
+}
+
+// printMemory writes a hex dump of mem, which starts at addr.
+func printMemory(w io.Writer, addr uint16, mem []byte) {
+	for row := 0; row < len(mem); row += 16 {
+		end := row + 16
+		if end > len(mem) {
+			end = len(mem)
+		}
+		fmt.Fprintf(w, "%03X ", int(addr)+row)
+		for _, b := range mem[row:end] {
+			fmt.Fprintf(w, " %02X", b)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// parseAddr parses the hex address args[i].
+func parseAddr(args []string, i int) (uint16, error) {
+	if i >= len(args) {
+		return 0, fmt.Errorf("missing address")
+	}
+	addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(args[i]), "0x"), 16, 16)
+	if err != nil || addr > 0xFFF {
+		return 0, fmt.Errorf("invalid address %q", args[i])
+	}
+
+	return uint16(addr), nil
+}
+
+// parseCount parses the count args[i], or returns def if there is none.
+func parseCount(args []string, i, def int) (int, error) {
+	if i >= len(args) {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(args[i], 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid count %q", args[i])
+	}
+
+	return int(n), nil
+}
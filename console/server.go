@@ -0,0 +1,33 @@
+package console
+
+import (
+	"net"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// ListenAndServe listens on the TCP address addr and runs the console for
+// clients connecting to it, one at a time, so an emulator on another
+// machine can be debugged with chip8 attach, or with netcat. The protocol is
+// the console's own: a command per line, each answered with its output and
+// the prompt. Files named by dump and restore are those of the machine
+// running the emulator.
+func ListenAndServe(addr string, c *core.Chip8) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	c.Logger().Infof("Waiting for debugger consoles on %s", ln.Addr())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		c.Logger().Infof("Debugger console attached from %s", conn.RemoteAddr())
+		Run(conn, conn, c)
+		conn.Close()
+		c.Logger().Infof("Debugger console detached")
+	}
+}
@@ -0,0 +1,207 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ROMInfo describes a ROM, as found by following its code from the entry
+// point without running it.
+type ROMInfo struct {
+	CodeBytes  int            // bytes of instructions reachable
+	Ops        map[string]int // instructions reachable, by pattern, e.g. "8XY4"
+	Extensions []Extension    // SCHIP and XO-CHIP instructions reachable
+	StackDepth int            // deepest nesting of calls, -1 if recursive
+	Memory     []MemRange     // RAM pointed at by I and accessed, merged
+}
+
+// Extension is an instruction from an extension of Chip-8.
+type Extension struct {
+	Addr uint16
+	Op   uint16
+	Name string // e.g. "SCHIP hires"
+}
+
+// MemRange is a range of RAM.
+type MemRange struct {
+	Start, End uint16 // first and last address
+}
+
+// String formats the range like 0x300-0x30f.
+func (r MemRange) String() string {
+	return fmt.Sprintf("%#03x-%#03x", r.Start, r.End)
+}
+
+// AnalyzeROM describes the ROM as loaded at 0x200.
+func AnalyzeROM(rom []byte) ROMInfo {
+	w := codeWalker{rom: rom, extensions: true}
+	code, _, _ := w.walk(int(programEntryOffset), true)
+
+	info := ROMInfo{Ops: make(map[string]int)}
+	addrs := make([]int, 0, len(code))
+	for addr := range code {
+		addrs = append(addrs, addr)
+	}
+	sort.Ints(addrs)
+
+	for _, addr := range addrs {
+		op := code[addr]
+		info.CodeBytes += 2
+		info.Ops[OpPattern(op)]++
+		if name := extensionName(op); name != "" {
+			info.Extensions = append(info.Extensions, Extension{Addr: uint16(addr), Op: op, Name: name})
+		}
+		if op&0xF000 == 0xA000 {
+			info.Memory = append(info.Memory, accessAfter(code, addr))
+		}
+	}
+	info.Memory = mergeRanges(info.Memory)
+	info.StackDepth = callDepth(w, int(programEntryOffset), make(map[int]int))
+
+	return info
+}
+
+// OpPattern returns the pattern of the instructions op belongs to, e.g.
+// "8XY4" for 0x8124.
+func OpPattern(op uint16) string {
+	switch op & 0xF000 {
+	case 0x0000:
+		if op == 0x00E0 || op == 0x00EE || op >= 0x00FB && op <= 0x00FF {
+			return fmt.Sprintf("%04X", op)
+		}
+		if op&0xFFE0 == 0x00C0 {
+			return fmt.Sprintf("00%XN", op>>4&0xF)
+		}
+		return "0NNN"
+	case 0x1000, 0x2000, 0xA000, 0xB000:
+		return fmt.Sprintf("%XNNN", op>>12)
+	case 0x3000, 0x4000, 0x6000, 0x7000, 0xC000:
+		return fmt.Sprintf("%XXNN", op>>12)
+	case 0x5000, 0x8000, 0x9000:
+		return fmt.Sprintf("%XXY%X", op>>12, op&0xF)
+	case 0xD000:
+		if op&0xF == 0 {
+			return "DXY0"
+		}
+		return "DXYN"
+	}
+	if op == 0xF000 || op == 0xF002 {
+		return fmt.Sprintf("%04X", op)
+	}
+
+	return fmt.Sprintf("%XX%02X", op>>12, op&0xFF)
+}
+
+// extensionName names the SCHIP or XO-CHIP instruction op, or returns "" if
+// it isn't one.
+func extensionName(op uint16) string {
+	switch {
+	case op&0xFFF0 == 0x00C0:
+		return "SCHIP scroll down"
+	case op&0xFFF0 == 0x00D0:
+		return "XO-CHIP scroll up"
+	case op == 0x00FB:
+		return "SCHIP scroll right"
+	case op == 0x00FC:
+		return "SCHIP scroll left"
+	case op == 0x00FD:
+		return "SCHIP exit"
+	case op == 0x00FE:
+		return "SCHIP lores"
+	case op == 0x00FF:
+		return "SCHIP hires"
+	case op&0xF00F == 0x5002:
+		return "XO-CHIP save range"
+	case op&0xF00F == 0x5003:
+		return "XO-CHIP load range"
+	case op&0xF00F == 0xD000:
+		return "SCHIP 16x16 sprite"
+	case op == 0xF000:
+		return "XO-CHIP long I"
+	case op == 0xF002:
+		return "XO-CHIP audio"
+	case op&0xF0FF == 0xF001:
+		return "XO-CHIP plane"
+	case op&0xF0FF == 0xF030:
+		return "SCHIP large font"
+	case op&0xF0FF == 0xF03A:
+		return "XO-CHIP pitch"
+	case op&0xF0FF == 0xF075:
+		return "SCHIP save flags"
+	case op&0xF0FF == 0xF085:
+		return "SCHIP load flags"
+	}
+
+	return ""
+}
+
+// accessAfter returns the RAM accessed through I after the ANNN instruction
+// at addr sets it, found in the instructions which follow up to the next
+// change of I or of the flow of control. The range is a single byte if none
+// access it.
+func accessAfter(code map[int]uint16, addr int) MemRange {
+	i := code[addr] & 0x0FFF
+	size := uint16(1)
+
+scan:
+	for next := addr + 2; ; next += 2 {
+		op, ok := code[next]
+		if !ok {
+			break
+		}
+		if access, ok := instructionAccess(Opcode(op), i); ok && access.end-i+1 > size {
+			size = access.end - i + 1
+		}
+		switch {
+		case op&0xF000 == 0xA000, op&0xF0FF == 0xF01E, op&0xF0FF == 0xF029, op == 0xF000:
+			break scan
+		case op == 0x00EE, op&0xF000 == 0x1000, op&0xF000 == 0x2000, op&0xF000 == 0xB000:
+			break scan
+		}
+	}
+
+	return MemRange{Start: i, End: i + size - 1}
+}
+
+// mergeRanges sorts ranges and merges those which overlap or touch.
+func mergeRanges(ranges []MemRange) []MemRange {
+	sort.Slice(ranges, func(a, b int) bool { return ranges[a].Start < ranges[b].Start })
+
+	var merged []MemRange
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && int(r.Start) <= int(merged[n-1].End)+1 {
+			if r.End > merged[n-1].End {
+				merged[n-1].End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	return merged
+}
+
+// callDepth returns the deepest nesting of calls made by the code at entry,
+// or -1 if it can recurse. depths holds the depths found so far, by entry,
+// and -1 for the subroutines being followed.
+func callDepth(w codeWalker, entry int, depths map[int]int) int {
+	if d, ok := depths[entry]; ok {
+		return d
+	}
+	depths[entry] = -1
+
+	deepest := 0
+	_, calls, _ := w.walk(entry, false)
+	for _, callee := range calls {
+		d := callDepth(w, callee, depths)
+		if d < 0 {
+			return -1
+		}
+		if d+1 > deepest {
+			deepest = d + 1
+		}
+	}
+	depths[entry] = deepest
+
+	return deepest
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Cheat sets bytes of RAM or V registers every frame while enabled, e.g.
+// freezing the lives counter of a game.
+type Cheat struct {
+	Name    string
+	Enabled bool
+	Pokes   []Poke
+}
+
+// Poke is a value a cheat keeps a byte of RAM or a V register at.
+type Poke struct {
+	Addr     uint16 // address of the byte of RAM, unless Register is set
+	Register int    // number of the V register plus 1, 0 for RAM
+	Value    uint8
+}
+
+// ParseCheats parses a cheat file, which has a cheat on each line: a name,
+// then a colon and a comma separated list of pokes, TARGET=VALUE, where the
+// target is a hex address or a V register and the value a hex byte, e.g.
+//
+//	Infinite lives: 2f0=03
+//	+Invincible: V5=00, 301=ff
+//
+// Cheats are disabled until toggled on, except those whose name starts with
+// a +. Lines starting with # are comments.
+func ParseCheats(data []byte) ([]Cheat, error) {
+	var cheats []Cheat
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		colon := strings.LastIndex(line, ":")
+		if colon < 0 {
+			return nil, fmt.Errorf("line %d: expected NAME: TARGET=VALUE, ...", n)
+		}
+		cheat := Cheat{Name: strings.TrimSpace(line[:colon])}
+		if strings.HasPrefix(cheat.Name, "+") {
+			cheat.Enabled = true
+			cheat.Name = strings.TrimSpace(cheat.Name[1:])
+		}
+		if cheat.Name == "" {
+			return nil, fmt.Errorf("line %d: cheat without a name", n)
+		}
+
+		for _, spec := range strings.Split(line[colon+1:], ",") {
+			poke, err := parsePoke(spec)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			cheat.Pokes = append(cheat.Pokes, poke)
+		}
+		cheats = append(cheats, cheat)
+	}
+
+	return cheats, nil
+}
+
+// parsePoke parses a poke written as TARGET=VALUE.
+func parsePoke(s string) (Poke, error) {
+	var p Poke
+
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return p, fmt.Errorf("invalid poke %q, expected TARGET=VALUE", strings.TrimSpace(s))
+	}
+	target := strings.ToUpper(strings.TrimSpace(parts[0]))
+	if len(target) == 2 && target[0] == 'V' {
+		r, err := strconv.ParseUint(target[1:], 16, 4)
+		if err != nil {
+			return p, fmt.Errorf("invalid poke %q: %q is not a register", strings.TrimSpace(s), target)
+		}
+		p.Register = int(r) + 1
+	} else {
+		addr, err := parseHexAddr(target)
+		if err != nil || addr >= memorySize {
+			return p, fmt.Errorf("invalid poke %q: %q is not an address", strings.TrimSpace(s), target)
+		}
+		p.Addr = addr
+	}
+
+	value := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(parts[1])), "0x")
+	v, err := strconv.ParseUint(value, 16, 8)
+	if err != nil {
+		return p, fmt.Errorf("invalid poke %q: %q is not a byte", strings.TrimSpace(s), parts[1])
+	}
+	p.Value = uint8(v)
+
+	return p, nil
+}
+
+// SetCheats replaces the cheats applied to the emulator.
+func (c *Chip8) SetCheats(cheats []Cheat) {
+	c.cheats = append([]Cheat(nil), cheats...)
+	c.applyCheats()
+}
+
+// Cheats returns the cheats, in the order they were set.
+func (c *Chip8) Cheats() []Cheat {
+	return append([]Cheat(nil), c.cheats...)
+}
+
+// SetCheatEnabled turns the i-th cheat on or off.
+func (c *Chip8) SetCheatEnabled(i int, enabled bool) {
+	if i >= 0 && i < len(c.cheats) {
+		c.cheats[i].Enabled = enabled
+		c.applyCheats()
+	}
+}
+
+// applyCheats sets the bytes the enabled cheats poke.
+func (c *Chip8) applyCheats() {
+	for _, cheat := range c.cheats {
+		if !cheat.Enabled {
+			continue
+		}
+		for _, p := range cheat.Pokes {
+			if p.Register > 0 {
+				c.cpu.v[p.Register-1] = p.Value
+			} else {
+				c.mem[p.Addr] = p.Value
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCheats(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []Cheat
+	}{
+		{"empty", "", nil},
+		{"comments and blank lines", "# lives\n\n   \n\t# more\n", nil},
+		{"address", "Infinite lives: 2f0=03",
+			[]Cheat{{Name: "Infinite lives", Pokes: []Poke{{Addr: 0x2F0, Value: 0x03}}}}},
+		{"enabled", "+Invincible: V5=00, 301=ff",
+			[]Cheat{{Name: "Invincible", Enabled: true, Pokes: []Poke{{Register: 6, Value: 0}, {Addr: 0x301, Value: 0xFF}}}}},
+		{"hex prefixes and case", "Max: 0X2F0=0xAB, vf=0x1",
+			[]Cheat{{Name: "Max", Pokes: []Poke{{Addr: 0x2F0, Value: 0xAB}, {Register: 16, Value: 1}}}}},
+		{"colon in the name", "Level: 2: 300=02",
+			[]Cheat{{Name: "Level: 2", Pokes: []Poke{{Addr: 0x300, Value: 2}}}}},
+		{"last address", "Top: fff=01",
+			[]Cheat{{Name: "Top", Pokes: []Poke{{Addr: 0xFFF, Value: 1}}}}},
+		{"several", "A: 300=01\r\n+ B : V0=2\n",
+			[]Cheat{{Name: "A", Pokes: []Poke{{Addr: 0x300, Value: 1}}}, {Name: "B", Enabled: true, Pokes: []Poke{{Register: 1, Value: 2}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cheats, err := ParseCheats([]byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cheats, tt.want) {
+				t.Errorf("ParseCheats(%q) = %+v, want %+v", tt.src, cheats, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCheatsErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // the error
+	}{
+		{"Lives 2f0=03", "line 1: expected NAME: TARGET=VALUE, ..."},
+		{"# lives\nLives", "line 2: expected NAME: TARGET=VALUE, ..."},
+		{": 2f0=03", "line 1: cheat without a name"},
+		{"+: 2f0=03", "line 1: cheat without a name"},
+		{"Lives:", `line 1: invalid poke "", expected TARGET=VALUE`},
+		{"Lives: 2f0=03,", `line 1: invalid poke "", expected TARGET=VALUE`},
+		{"Lives: 2f0", `line 1: invalid poke "2f0", expected TARGET=VALUE`},
+		{"Lives: =03", `line 1: invalid poke "=03": "" is not an address`},
+		{"Lives: 2f0=", `line 1: invalid poke "2f0=": "" is not a byte`},
+		{"Lives: 1000=03", `line 1: invalid poke "1000=03": "1000" is not an address`},
+		{"Lives: 10000=03", `line 1: invalid poke "10000=03": "10000" is not an address`},
+		{"Lives: zz=03", `line 1: invalid poke "zz=03": "ZZ" is not an address`},
+		{"Lives: VG=03", `line 1: invalid poke "VG=03": "VG" is not a register`},
+		{"Lives: V10=03", `line 1: invalid poke "V10=03": "V10" is not an address`},
+		{"Lives: 2f0=100", `line 1: invalid poke "2f0=100": "100" is not a byte`},
+		{"Lives: 2f0=-1", `line 1: invalid poke "2f0=-1": "-1" is not a byte`},
+		{"Lives: 2f0=03=04", `line 1: invalid poke "2f0=03=04": "03=04" is not a byte`},
+	}
+	for _, tt := range tests {
+		_, err := ParseCheats([]byte(tt.src))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("ParseCheats(%q) = %v, want error %q", tt.src, err, tt.want)
+		}
+	}
+}
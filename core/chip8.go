@@ -1,25 +1,27 @@
 package core
 
 import (
+	"crypto/sha1"
 	"encoding/binary"
 	"fmt"
+	"image/color"
 	"io/ioutil"
-	"log"
+	"math"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/veandco/go-sdl2/sdl"
-	"github.com/veandco/go-sdl2/ttf"
+	"github.com/n-ulricksen/chip8/asm"
 )
 
 const (
 	memorySize             uint16 = 4096
+	extendedMemorySize            = 0x10000
 	programEntryOffset     uint16 = 0x200
 	characterSpritesOffset uint16 = 0x100
 	characterSpriteBytes          = 5
 	chip8frequency                = 60 * 8
-	fontpath                      = "./fonts/DotGothic16-Regular.ttf"
-	fontsize                      = 12
 	ophistorysize                 = 100
 )
 
@@ -27,207 +29,857 @@ const (
 type Chip8 struct {
 	mem       []byte // RAM
 	cpu       *CPU
-	display   []uint8 // emulator display
-	keys      []uint8 // current state of each key
-	renderer  *sdl.Renderer
-	font      *ttf.Font
+	display   displayBuffer // emulator display
+	prevframe []uint8       // display as of the previous frame, for blending
+	keys      []uint8       // current state of each key
+	romName   string        // file name of the loaded ROM
+	unpaced   bool          // frames are not paced by sleeping, see Options
+	paused    bool          // no instructions are executed until resumed
+	speed     float64       // multiplier of the emulation speed
+	perFrame  int           // instructions executed each frame, at normal speed
 	isRunning bool
-	isDebug   bool
-	ophistory []string // history of cpu ops: `address: op, mneumonic`
-	opindex   int      // ophistory index: current op
+	stats     perfStats       // frame and instruction rates
+	filters   map[string]bool // enabled display filters
+	quirks    Quirks          // interpreter behaviors emulated
+	fg, bg    color.RGBA      // colors of lit and unlit pixels
+	levels    []uint8         // brightness of each display pixel
+	pixels    []byte          // RGBA color of each display pixel
+	fading    bool            // some pixels are still fading out
+	changed   bool            // the frame being rendered differs from the last
+	repaint   bool            // the colors of the pixels need updating
+	drawn     bool            // CLS or DXYN ran since the last frame
+	ophistory []historyOp     // history of cpu ops, formatted by OpHistory
+	opindex   int             // ophistory index: current op
+
+	recorder  *gifRecorder   // GIF recording in progress, if any
+	videoPath string         // file the session is recorded to, if any
+	video     *videoRecorder // ffmpeg process recording the session
+
+	rom       []byte         // the loaded ROM image
+	romCheck  ROMCheck       // what is done about problems found in ROMs loaded
+	seed      int64          // seed of the CXNN random number generator
+	frame     uint64         // frames presented since the emulator started
+	cycles    uint64         // instructions executed since the emulator started
+	moviePath string         // file keypad input is recorded to, if any
+	movie     *movieRecorder // keypad input recording in progress
+	playPath  string         // movie file keypad input is replayed from, if any
+	playback  *moviePlayer   // keypad input replay in progress
+
+	tracePath   string      // file executed instructions are logged to, if any
+	trace       *tracer     // instruction trace in progress
+	traceFilter TraceFilter // instructions traced
+	profilePath string      // file the profile report is written to, if any
+	profile     *profiler   // executed instruction counts, when profiling
+
+	hashesPath string       // file the state hash of every frame is written to, if any
+	hashes     *frameHashes // frame hashes being written, if any
+
+	turbo [16]bool // keys pressed and released every frame while held
+	held  [16]bool // turbo keys currently held down
+
+	breakpoints map[uint16]bool // addresses execution pauses at
+	skipBreak   bool            // the breakpoint at PC was hit, don't stop again
+	stepping    bool            // execute one instruction, then stay paused
+	watchpoints []Watchpoint    // RAM accesses execution pauses after
+	conditions  []Condition     // states execution pauses on reaching
+	condsMet    []bool          // which conditions held after the last instruction
+	stopReason  string          // why the debugger paused execution, if it did
+	stepOver    bool            // run until the CALL being stepped over or out of returns
+	stepOverPC  uint16          // address that CALL returns to
+	stepOverSP  uint8           // stack depth that CALL returns to
+	frameStep   bool            // run until the next frame, then pause
+	lastDraw    DrawRegion      // display area the last DXYN drew to
+
+	calls chan func() // functions passed to Do, waiting to run
+
+	lock   *sync.Mutex   // held by the goroutine using the emulator, if run by RunConcurrently
+	frames chan struct{} // signals RunConcurrently's frontend of frames to render
+	unseen bool          // a frame changed since the frontend last rendered one
+
+	log      Logger // receives the messages of the emulator
+	crashDir string // directory crash dumps are written to, if any
+
+	undo *undoHistory // undo records of recent instructions, to step back
+
+	rewind    *rewindBuffer // recent frames, to rewind gameplay
+	rewinding bool          // frames are being rewound rather than executed
+
+	frameHooks       []func()                // called after each frame
+	instructionHooks []func(addr, op uint16) // called before each instruction
+	overlay          string                  // text shown over the display
+
+	cheats []Cheat // applied every frame while enabled
+
+	flags     [numFlags]uint8 // RPL user flags, see SetFlagsFile
+	flagsPath string          // file the flags are kept in, if any
+
+	deterministic bool        // keypad changes wait for the next frame
+	keyQueue      []keyChange // keypad changes waiting for the next frame
+
+	lockstep   Lockstep     // shares the keypad with other machines, if any
+	localKeys  uint16       // keys held on this machine, for the lockstep
+	syncedKeys uint16       // keys held on all machines, as last applied
+	hasher     *stateHasher // hashes the state sent to the lockstep
+
+	timers timerClock // paces the delay and sound timers
+
+	// renders is how many times the frame is due to be presented, when the
+	// frontend paces execution: less than once a frame when sped up, more
+	// when slowed down.
+	renders float64
 }
 
-// NewChip8 creates a new Chip8 emulator with 4KB RAM.
-func NewChip8(debug bool) *Chip8 {
+// keyChange is a keypad key being pressed or released.
+type keyChange struct {
+	key     uint8
+	pressed bool
+}
+
+// Options configures the optional features of the emulator.
+type Options struct {
+	Filters   []string // display filters to apply, see the Filter* constants
+	VideoPath string   // record the whole session to this video file, via ffmpeg
+	Unpaced   bool     // don't sleep between frames, leaving pacing to Render
+	Seed      int64    // seed for CXNN's random numbers, 0 picks one at random
+	PerFrame  int      // instructions executed each frame, 0 for the default of 8
+	MoviePath string   // record keypad input to this movie file
+	PlayPath  string   // replay keypad input from this movie file
+	Turbo     []uint8  // keys pressed and released every frame while held
+	Quirks    Quirks   // interpreter behaviors to emulate
+	ROMCheck  ROMCheck // what to do about problems found in ROMs loaded
+
+	// Foreground and Background are the colors of lit and unlit pixels. The
+	// default colors are used for those left unset, with an alpha of 0.
+	Foreground color.RGBA
+	Background color.RGBA
+
+	Breakpoints []uint16     // addresses to pause execution at
+	Watchpoints []Watchpoint // RAM accesses to pause execution after
+	Conditions  []Condition  // register states to pause execution on
+
+	TracePath   string      // log every instruction executed to this file
+	TraceFilter TraceFilter // which instructions are logged, and how
+	ProfilePath string      // count executed instructions, reporting to this file
+	HashesPath  string      // write the StateHash of every frame to this file
+
+	// StepBackDepth is how many of the last instructions executed can be
+	// undone by stepping back. 0 disables stepping back.
+	StepBackDepth int
+
+	// RewindSeconds is how many seconds of gameplay can be rewound, see
+	// SetRewinding. 0 disables rewinding.
+	RewindSeconds int
+
+	// Deterministic makes runs with the same seed and input go through the
+	// same states: keypad changes take effect at the start of the next
+	// frame, one per key a frame, rather than at whichever instruction they
+	// arrive during, and a Seed of 0 is taken as 1 rather than a random one.
+	Deterministic bool
+
+	// ExtendedMemory gives the machine the 64KB of RAM of XO-CHIP rather
+	// than 4KB, so ROMs larger than the 3584 bytes from 0x200 to 0xFFF can
+	// be loaded.
+	ExtendedMemory bool
+
+	// Logger receives the messages of the emulator, such as files saved and
+	// breakpoints hit. They are written to stderr, from the info level up,
+	// if it is nil.
+	Logger Logger
+
+	// CrashDir is the directory a crash dump, see WriteCrashDump, is written
+	// to if the emulator panics. No dump is written if it is empty.
+	CrashDir string
+
+	// Lockstep shares the keypad with emulators on other machines, for
+	// netplay. Their keys are combined with those set through SetKey at
+	// the end of every frame. It is closed when Run returns.
+	Lockstep Lockstep
+}
+
+// Frontend presents the emulator to the user and feeds it their input.
+type Frontend interface {
+	// Render draws the current frame.
+	Render(c *Chip8)
+
+	// PollEvents processes pending user input, updating the keypad through
+	// SetKey and ending the emulation through Stop.
+	PollEvents(c *Chip8)
+
+	// Close releases the frontend's resources once the emulation has ended.
+	Close()
+}
+
+// NewChip8 creates a new Chip8 emulator with 4KB RAM, or 64KB with
+// Options.ExtendedMemory.
+func NewChip8(opts Options) (*Chip8, error) {
 	w, h := Chip8Width, Chip8Height
 
+	logger := opts.Logger
+	if logger == nil {
+		logger = defaultLogger
+	}
+	filters, err := parseFilters(opts.Filters)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize memory.
 	memory := make([]byte, memorySize)
-	copy(memory[characterSpritesOffset:], characterSprites)
-
-	// Initialize SDL.
-	if err := sdl.Init(sdl.INIT_EVERYTHING); err != nil {
-		log.Fatal("Unable to initialize SDL\n", err)
-	}
-	if err := ttf.Init(); err != nil {
-		log.Fatal("Unable to initialize TTF\n", err)
+	if opts.ExtendedMemory {
+		memory = make([]byte, extendedMemorySize)
 	}
+	copy(memory[characterSpritesOffset:], characterSprites)
 
-	// Load font.
-	font, err := ttf.OpenFont(fontpath, fontsize)
-	if err != nil {
-		log.Fatal("Unable to load font\n", err)
+	seed := opts.Seed
+	if seed == 0 && opts.Deterministic {
+		seed = 1
+	} else if seed == 0 {
+		seed = time.Now().UnixNano()
 	}
 
-	return &Chip8{
+	c := &Chip8{
 		mem:       memory,
-		cpu:       NewCPU(),
-		display:   make([]uint8, w*h),
+		cpu:       NewCPU(seed),
+		prevframe: make([]uint8, w*h),
 		keys:      make([]uint8, 16),
-		renderer:  NewDisplayRenderer(debug),
-		font:      font,
 		isRunning: true,
-		isDebug:   debug,
-		ophistory: make([]string, ophistorysize),
+		filters:   filters,
+		quirks:    opts.Quirks,
+		romCheck:  opts.ROMCheck,
+		unpaced:   opts.Unpaced,
+		speed:     1,
+		perFrame:  chip8frequency / VBlankFreq,
+		changed:   true,
+		drawn:     true,
+		levels:    make([]uint8, w*h),
+		pixels:    make([]byte, w*h*4),
+		ophistory: make([]historyOp, ophistorysize),
 		opindex:   0,
+
+		videoPath: opts.VideoPath,
+
+		seed:      seed,
+		moviePath: opts.MoviePath,
+		playPath:  opts.PlayPath,
+
+		tracePath:   opts.TracePath,
+		traceFilter: opts.TraceFilter,
+		profilePath: opts.ProfilePath,
+		hashesPath:  opts.HashesPath,
+
+		breakpoints: make(map[uint16]bool),
+
+		calls: make(chan func()),
+		log:   logger,
+
+		crashDir: opts.CrashDir,
+
+		deterministic: opts.Deterministic,
+
+		lockstep: opts.Lockstep,
 	}
+	for _, addr := range opts.Breakpoints {
+		c.SetBreakpoint(addr)
+	}
+	for _, w := range opts.Watchpoints {
+		c.AddWatchpoint(w)
+	}
+	for _, cond := range opts.Conditions {
+		c.AddCondition(cond)
+	}
+	c.SetTurbo(opts.Turbo)
+	if c.profilePath != "" {
+		c.profile = &profiler{addrs: make([]uint64, len(c.mem))}
+	}
+	if opts.StepBackDepth > 0 {
+		c.undo = newUndoHistory(opts.StepBackDepth)
+	}
+	if opts.PerFrame > 0 {
+		c.perFrame = opts.PerFrame
+	}
+	c.SetPalette(opts.Foreground, opts.Background)
+	if opts.RewindSeconds > 0 {
+		c.rewind = newRewindBuffer(opts.RewindSeconds * VBlankFreq)
+	}
+	if c.lockstep != nil {
+		c.hasher = newStateHasher()
+	}
+
+	return c, nil
 }
 
 // LoadRom loads a Chip-8 ROM from the specified path into the Chip-8 RAM.
-func (c *Chip8) LoadRom(path string) {
-	// Load rom from file
+// Octo source, with a .8o extension, is assembled into a ROM first.
+func (c *Chip8) LoadRom(path string) error {
+	romdata, err := ReadRom(path)
+	if err == nil {
+		err = c.LoadRomData(romdata)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	c.log.Debugf("Loaded ROM from %s", path)
+	c.romName = filepath.Base(path)
+	return nil
+}
+
+// SwapRom loads the ROM at path in place of the one loaded and resets the
+// machine, as when a new ROM is chosen while running. Cheats, RPL user flags
+// and the frames which could be rewound or stepped back over go with the old
+// ROM. ROMs can't be swapped while keypad input is recorded to or replayed
+// from a movie.
+func (c *Chip8) SwapRom(path string) error {
+	romdata, err := ReadRom(path)
+	if err != nil {
+		return err
+	}
+	if err := c.swapRom(filepath.Base(path), romdata); err != nil {
+		return err
+	}
+
+	c.log.Infof("Loaded ROM from %s", path)
+	return nil
+}
+
+// SwapRomData is SwapRom for a ROM image which isn't in a file, named name.
+func (c *Chip8) SwapRomData(name string, romdata []byte) error {
+	if err := c.swapRom(name, romdata); err != nil {
+		return err
+	}
+
+	c.log.Infof("Loaded ROM %s", name)
+	return nil
+}
+
+// swapRom loads romdata in place of the ROM loaded, for SwapRom.
+func (c *Chip8) swapRom(name string, romdata []byte) error {
+	if c.movie != nil || c.playback != nil {
+		return fmt.Errorf("can't change ROM while a movie is recorded or played back")
+	}
+	if err := c.LoadRomData(romdata); err != nil {
+		return err
+	}
+	c.romName = name
+	c.cheats = nil
+	c.flags = [numFlags]uint8{}
+	c.flagsPath = ""
+	if c.rewind != nil {
+		c.rewind = newRewindBuffer(len(c.rewind.frames))
+	}
+	if c.undo != nil {
+		c.undo.len = 0
+	}
+	c.Reset()
+
+	return nil
+}
+
+// ReadRom reads the ROM at path, assembling it first if it is Octo source,
+// with a .8o extension.
+func ReadRom(path string) ([]byte, error) {
 	romdata, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatalf("Error opening ROM file %s\n%v\n", path, err)
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".8o") {
+		if romdata, _, err = asm.Assemble(romdata); err != nil {
+			return nil, fmt.Errorf("assembling: %v", err)
+		}
 	}
 
-	fmt.Println("ROM loading...")
+	return romdata, nil
+}
+
+// RomName returns the file name of the loaded ROM, or an empty string if it
+// was not loaded from a file.
+func (c *Chip8) RomName() string {
+	return c.romName
+}
+
+// LoadRomData loads a Chip-8 ROM image into the Chip-8 RAM, checking it
+// first as Options.ROMCheck says. ROMs too large for RAM are refused.
+func (c *Chip8) LoadRomData(romdata []byte) error {
+	if err := c.checkRom(romdata); err != nil {
+		return err
+	}
 
 	// Load rom data into RAM
 	for i, data := range romdata {
 		c.mem[int(programEntryOffset)+i] = data
 	}
+	c.rom = append([]byte(nil), romdata...)
+
+	return nil
 }
 
-// Run begins execution of program instructions.
-func (c *Chip8) Run() {
-	defer c.renderer.Destroy()
-	defer c.font.Close()
-	defer ttf.Quit()
-	defer sdl.Quit()
+// RomHash returns the SHA-1 hash of the loaded ROM image, in hex.
+func (c *Chip8) RomHash() string {
+	return fmt.Sprintf("%x", sha1.Sum(c.rom))
+}
+
+// Run begins execution of program instructions, presenting them through the
+// frontend until it stops the emulator. It returns an error if the files
+// the options ask to record to or replay from can't be opened.
+func (c *Chip8) Run(fe Frontend) error {
+	defer fe.Close()
+	c.acquire()
+	defer c.release()
+	defer c.recoverCrash()
+
+	if err := c.openOutputs(); err != nil {
+		c.closeOutputs()
+		return err
+	}
 
-	lastDrawTime := time.Now()
-	vBlankTime := chip8frequency / VBlankFreq
+	start := time.Now()
 	cycles := 0
+	c.stats.since = start
+	c.timers.reset(start)
+	var pacer framePacer
+	pacer.reset(start)
 
 	for c.isRunning {
+		if c.paused && !c.stepping {
+			// Keep the frontend responsive without executing anything.
+			fe.Render(c)
+			fe.PollEvents(c)
+			c.runCalls()
+			c.release()
+			time.Sleep(time.Second / VBlankFreq)
+			c.acquire()
+			pacer.reset(time.Now())
+			c.timers.reset(time.Now())
+			continue
+		}
+		if c.rewinding {
+			c.rewindFrame()
+			fe.Render(c)
+			fe.PollEvents(c)
+			c.runCalls()
+			c.release()
+			pacer.wait(c.speed)
+			c.acquire()
+			c.timers.reset(time.Now())
+			continue
+		}
+
+		if c.hitBreakpoint() {
+			continue
+		}
+
 		cycles++
 
+		if c.playback != nil {
+			c.replayInput()
+		}
+
+		c.stopReason = ""
 		c.cycle()
+		c.cycles++
+		c.stats.instructions++
+		c.stepping = false
 
-		if cycles >= vBlankTime {
+		if cycles >= c.perFrame {
 			cycles = 0
-			c.renderDisplay()
+			c.updateScreen()
+			if c.unpaced {
+				c.renders += 1 / c.speed
+				for ; c.renders >= 1; c.renders-- {
+					fe.Render(c)
+				}
+			} else {
+				fe.Render(c)
+			}
+			c.frame++
+			c.stats.frames++
+			c.stats.update(time.Now())
+			if c.hashes != nil {
+				if err := c.hashes.write(c); err != nil {
+					c.log.Errorf("Frame hashes stopped: %v", err)
+					c.hashes.close()
+					c.hashes = nil
+				}
+			}
+			for _, fn := range c.frameHooks {
+				fn()
+			}
+
+			// Wait for the next frame to keep the CPU steady.
+			if !c.unpaced {
+				c.release()
+				pacer.wait(c.speed)
+				c.acquire()
+			}
+
+			c.tickTimers()
+			if c.lockstep != nil {
+				c.syncKeys()
+			} else {
+				c.applyKeyQueue()
+			}
+			c.updateTurbo()
+			c.applyCheats()
+			if c.rewind != nil {
+				c.rewind.record(c)
+			}
+
+			if c.frameStep {
+				c.frameStep = false
+				c.paused = true
+			}
+		}
+
+		fe.PollEvents(c)
+		c.runCalls()
+	}
+
+	c.closeOutputs()
+
+	return nil
+}
+
+// openOutputs opens the files the options ask Run to record to or replay
+// from.
+func (c *Chip8) openOutputs() error {
+	if c.videoPath != "" {
+		video, err := newVideoRecorder(c.videoPath)
+		if err != nil {
+			return err
+		}
+		c.video = video
+		c.log.Infof("Recording video to %s", c.videoPath)
+	}
+	if c.playPath != "" {
+		playback, err := loadMovie(c.playPath)
+		if err != nil {
+			return err
+		}
+		if playback.romHash != c.RomHash() {
+			return fmt.Errorf("%s was recorded with a different ROM", c.playPath)
+		}
+		c.playback = playback
+		c.seed = playback.seed
+		c.cpu.rng = newPCG(c.seed)
+		c.log.Infof("Replaying input from %s", c.playPath)
+	}
+	if c.moviePath != "" {
+		movie, err := newMovieRecorder(c.moviePath, c.RomHash(), c.seed)
+		if err != nil {
+			return err
+		}
+		c.movie = movie
+		c.log.Infof("Recording input to %s", c.moviePath)
+	}
+	if c.tracePath != "" {
+		trace, err := newTracer(c.tracePath, c.traceFilter)
+		if err != nil {
+			return err
+		}
+		c.trace = trace
+		c.log.Infof("Tracing instructions to %s", c.tracePath)
+	}
+	if c.hashesPath != "" {
+		hashes, err := newFrameHashes(c.hashesPath)
+		if err != nil {
+			return err
+		}
+		c.hashes = hashes
+		c.log.Infof("Writing frame hashes to %s", c.hashesPath)
+	}
 
-			// delay every few to keep CPU steady
-			elapsed := time.Now().Sub(lastDrawTime)
-			timePerCycles := (time.Duration(vBlankTime) * time.Second / time.Duration(chip8frequency))
-			time.Sleep(timePerCycles - elapsed)
-			lastDrawTime = time.Now()
+	return nil
+}
 
-			c.cpu.decrementTimers()
+// closeOutputs finishes the recordings, traces and profile of a run, and
+// ends any lockstep.
+func (c *Chip8) closeOutputs() {
+	if c.recorder != nil {
+		if err := c.stopRecording(); err != nil {
+			c.log.Errorf("Unable to save recording: %v", err)
+		}
+	}
+	if c.video != nil {
+		if err := c.video.close(); err != nil {
+			c.log.Errorf("Unable to finish video: %v", err)
 		}
+	}
+	if c.movie != nil {
+		if err := c.movie.close(); err != nil {
+			c.log.Errorf("Unable to save input recording: %v", err)
+		}
+	}
+	if c.trace != nil {
+		if err := c.trace.close(); err != nil {
+			c.log.Errorf("Unable to save instruction trace: %v", err)
+		}
+	}
+	if c.hashes != nil {
+		if err := c.hashes.close(); err != nil {
+			c.log.Errorf("Unable to save frame hashes: %v", err)
+		}
+	}
+	if c.lockstep != nil {
+		c.lockstep.Close()
+	}
+	if c.profile != nil {
+		if err := c.saveProfile(c.profilePath); err != nil {
+			c.log.Errorf("Unable to save profile: %v", err)
+		} else {
+			c.log.Infof("Saved profile to %s", c.profilePath)
+		}
+	}
+}
+
+// Stop ends the emulation started by Run.
+func (c *Chip8) Stop() {
+	c.isRunning = false
+}
+
+// SetPaused pauses or resumes execution. While paused, the frontend keeps
+// being polled and asked to render. Any step over a CALL or to the next frame
+// in progress is abandoned.
+func (c *Chip8) SetPaused(paused bool) {
+	c.paused = paused
+	c.stepOver = false
+	c.frameStep = false
+}
 
-		c.pollSdlEvents()
+// Paused reports whether execution is paused.
+func (c *Chip8) Paused() bool {
+	return c.paused
+}
+
+// Reset restarts the loaded ROM from a freshly powered on machine.
+func (c *Chip8) Reset() {
+	for i := range c.mem {
+		c.mem[i] = 0
+	}
+	copy(c.mem[characterSpritesOffset:], characterSprites)
+	copy(c.mem[programEntryOffset:], c.rom)
+
+	c.cpu = NewCPU(c.seed)
+	for i := range c.display {
+		c.display[i] = 0
+	}
+	c.drawn = true
+	c.lastDraw = DrawRegion{}
+}
+
+// SetSpeed sets the emulation speed as a multiple of the normal speed,
+// between 1/8 and 8. Instructions and timers are sped up alike. When the
+// frontend paces execution, frames are presented less or more often to
+// match, several being executed for each one presented or each presented
+// several times.
+func (c *Chip8) SetSpeed(speed float64) {
+	c.speed = math.Max(1.0/8, math.Min(speed, 8))
+}
+
+// SetCyclesPerFrame sets the number of instructions executed each frame at
+// normal speed, 8 by default, which is 480 a second.
+func (c *Chip8) SetCyclesPerFrame(n int) {
+	if n > 0 {
+		c.perFrame = n
 	}
 }
 
-// renderDisplay presents the current display to the screen via the SDL2 renderer.
-func (c *Chip8) renderDisplay() {
-	c.renderer.SetDrawColor(0, 0, 0, 255)
-	c.renderer.Clear()
+// CyclesPerFrame returns the number of instructions executed each frame at
+// normal speed.
+func (c *Chip8) CyclesPerFrame() int {
+	return c.perFrame
+}
 
-	c.renderer.SetDrawColor(0, 255, 200, 255)
+// Speed returns the emulation speed as a multiple of the normal speed.
+func (c *Chip8) Speed() float64 {
+	return c.speed
+}
 
-	for y := int32(0); y < Chip8Height; y++ {
-		for x := int32(0); x < Chip8Width; x++ {
-			if c.display[y*Chip8Width+x] != 0 {
-				c.renderer.FillRect(&sdl.Rect{
-					X: x * DisplayScale,
-					Y: y * DisplayScale,
-					W: DisplayScale,
-					H: DisplayScale,
-				})
-			}
+// SetKey sets whether the Chip-8 keypad key (0x0-0xF) is held down. It has no
+// effect while input is being replayed from a movie. In deterministic mode
+// and netplay the change waits for the next frame.
+func (c *Chip8) SetKey(key uint8, pressed bool) {
+	if c.playback != nil {
+		return
+	}
+	if c.lockstep != nil {
+		c.setLocalKey(key, pressed)
+		return
+	}
+	if c.deterministic {
+		c.keyQueue = append(c.keyQueue, keyChange{key: key, pressed: pressed})
+		return
+	}
+	c.pressKey(key, pressed)
+}
+
+// pressKey presses or releases a key of the keypad, as SetKey.
+func (c *Chip8) pressKey(key uint8, pressed bool) {
+	if c.turbo[key] {
+		c.held[key] = pressed
+	}
+	c.setKey(key, pressed)
+}
+
+// applyKeyQueue makes the first keypad change waiting for each key, leaving
+// the rest for the following frames, so the program sees even a press and
+// release arriving during the same frame.
+func (c *Chip8) applyKeyQueue() {
+	var applied [16]bool
+	waiting := c.keyQueue[:0]
+	for _, k := range c.keyQueue {
+		if applied[k.key] {
+			waiting = append(waiting, k)
+			continue
+		}
+		applied[k.key] = true
+		c.pressKey(k.key, k.pressed)
+	}
+	c.keyQueue = waiting
+}
+
+// KeyDown reports whether the Chip-8 key is held down, as the ROM sees it.
+func (c *Chip8) KeyDown(key uint8) bool {
+	return key < 16 && c.keys[key] != 0
+}
+
+// SetTurbo sets the keys which are pressed and released every frame while
+// held, replacing any set before.
+func (c *Chip8) SetTurbo(keys []uint8) {
+	c.turbo, c.held = [16]bool{}, [16]bool{}
+	for _, key := range keys {
+		c.turbo[key&0xf] = true
+	}
+}
+
+// updateTurbo toggles the turbo keys being held, so the program sees them
+// pressed and released on alternate frames.
+func (c *Chip8) updateTurbo() {
+	for key, held := range c.held {
+		if held {
+			c.setKey(uint8(key), c.keys[key] == 0)
 		}
 	}
+}
 
-	if c.isDebug {
-		c.renderDebugDisplay()
+// setKey sets the state of a keypad key, recording the change if a movie is
+// being recorded.
+func (c *Chip8) setKey(key uint8, pressed bool) {
+	if c.movie != nil && (c.keys[key] != 0) != pressed {
+		c.movie.keyChanged(c.frame, c.cycles, key, pressed)
 	}
 
-	c.renderer.Present()
+	if pressed {
+		c.keys[key] = 1
+	} else {
+		c.keys[key] = 0
+	}
 }
 
-func (c *Chip8) renderDebugDisplay() {
-	c.renderer.SetDrawColor(50, 50, 50, 255)
-	debugRect := &sdl.Rect{X: 0, Y: EmulatorHeight, W: EmulatorWidth, H: DebugHeight}
-	c.renderer.FillRect(debugRect)
+// Stats returns the frames and instructions executed per second, averaged
+// over the last second.
+func (c *Chip8) Stats() (fps, ips int) {
+	return c.stats.fps, c.stats.ips
+}
+
+// Counters returns the frames presented and instructions executed since the
+// emulator started.
+func (c *Chip8) Counters() (frames, instructions uint64) {
+	return c.frame, c.cycles
+}
 
-	// Get the most recent operations
-	opcount := 14
-	ops := make([]string, opcount)
-	for i := 0; i < opcount; i++ {
+// historyOp is an operation in the op history. Only the address and opcode
+// are kept as instructions execute; they are formatted when asked for.
+type historyOp struct {
+	pc     uint16
+	opcode Opcode
+	valid  bool // an operation has been executed into this slot
+}
+
+// OpHistory returns the n most recently executed operations, oldest first,
+// as `address: opcode mnemonic`. Fewer are returned until n operations have
+// been executed.
+func (c *Chip8) OpHistory(n int) []string {
+	if n > len(c.ophistory) {
+		n = len(c.ophistory)
+	}
+	ops := make([]string, n)
+	for i := 0; i < n; i++ {
 		index := c.opindex - i
 		if index < 0 {
 			index += len(c.ophistory)
 		}
-		ops[len(ops)-i-1] = c.ophistory[index]
+		op := c.ophistory[index]
+		if !op.valid {
+			return ops[len(ops)-i:]
+		}
+		ops[len(ops)-i-1] = fmt.Sprintf("%#x: %#04x %s", op.pc, uint16(op.opcode), Disassemble(uint16(op.opcode)))
 	}
 
-	opswrapped := strings.Join(ops, "\n")
+	return ops
+}
 
-	drawcolor := sdl.Color{R: 255, G: 0, B: 180, A: 255}
-	//surface, err := c.font.RenderUTF8Solid(ops, drawcolor)
-	surface, err := c.font.RenderUTF8BlendedWrapped(opswrapped, drawcolor, EmulatorWidth)
-	if err != nil {
-		log.Fatal(err)
+// updateScreen computes the colors of the display pixels for the frame about
+// to be rendered, and passes the frame on to any recordings in progress.
+func (c *Chip8) updateScreen() {
+	c.changed = c.updatePixelLevels()
+	if c.changed || c.repaint {
+		c.updatePixels()
+		c.changed, c.repaint = true, false
 	}
-	defer surface.Free()
-
-	texture, err := c.renderer.CreateTextureFromSurface(surface)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer texture.Destroy()
-
-	x := int32(0)
-	y := int32(EmulatorHeight)
-	w := surface.W
-	h := surface.H
-	c.renderer.Copy(texture, nil, &sdl.Rect{X: x, Y: y, W: w, H: h})
-}
-
-// pollSdlEvents checks for keyboard events.
-func (c *Chip8) pollSdlEvents() {
-	for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
-		switch t := event.(type) {
-		case *sdl.QuitEvent:
-			c.isRunning = false
-		case *sdl.KeyboardEvent:
-			scancode := t.Keysym.Scancode
-			switch t.Type {
-			case sdl.KEYDOWN:
-				if i, ok := keybinds[int(scancode)]; ok {
-					c.keys[i] = 1
-				}
-			case sdl.KEYUP:
-				if i, ok := keybinds[int(scancode)]; ok {
-					c.keys[i] = 0
-				}
-			}
+	if c.recorder != nil {
+		c.recorder.addFrame(c.levels)
+	}
+	if c.video != nil {
+		if err := c.video.writeFrame(c.pixels); err != nil {
+			c.log.Errorf("Video recording stopped: %v", err)
+			c.video.close()
+			c.video = nil
 		}
 	}
 }
 
 // cycle spins the CPU, executing instructions from RAM.
 func (c *Chip8) cycle() {
+	if reason, ok := c.checkBounds(); ok {
+		c.fault(c.cpu.pc, reason)
+		return
+	}
+	if c.undo != nil {
+		c.recordUndo()
+	}
 	c.getNextInstruction()
+	pc, i := c.cpu.pc, c.cpu.i
+
+	if c.profile != nil {
+		c.profile.count(pc, c.cpu.opcode)
+	}
+	for _, fn := range c.instructionHooks {
+		fn(pc, uint16(c.cpu.opcode))
+	}
+
+	traced := c.trace != nil && c.traceFilter.traces(pc, c.cpu.opcode)
+	var before traceRegisters
+	if traced && c.traceFilter.Registers {
+		before = c.trace.registers(c.cpu)
+	}
 
 	// Increment the program counter
 	c.cpu.pc += 2
 
 	// Execute the instruction
 	c.executeInstruction()
+	c.addOpHistoryItem(pc, c.cpu.opcode)
+
+	if traced {
+		c.trace.log(pc, c.cpu.opcode, c.cpu, before)
+	}
 
-	// Debug: print mem
-	//for i, b := range c.mem {
-	//fmt.Printf("%#x: %#x\t", i, b)
-	//if i%8 == 0 {
-	//fmt.Println()
-	//}
-	//}
-	//fmt.Println()
+	if len(c.watchpoints) > 0 {
+		c.checkWatchpoints(pc, c.cpu.opcode, i)
+	}
+	if len(c.conditions) > 0 {
+		c.checkConditions(pc)
+	}
 }
 
 // getNextInstruction loads the next 2 byte instruction into the CPU from memory.
@@ -236,154 +888,61 @@ func (c *Chip8) getNextInstruction() {
 	c.cpu.opcode = Opcode(binary.BigEndian.Uint16(bx))
 }
 
-// addOpHistoryItem adds an operation string to the Chip-8 ophistory slice at
-// at the appropriate index.
-func (c *Chip8) addOpHistoryItem(op string) {
-	//fmt.Print(op)
+// addOpHistoryItem adds the operation at pc to the Chip-8 ophistory slice at
+// the appropriate index.
+func (c *Chip8) addOpHistoryItem(pc uint16, opcode Opcode) {
 	c.opindex = (c.opindex + 1) % len(c.ophistory)
-	c.ophistory[c.opindex] = op
+	c.ophistory[c.opindex] = historyOp{pc: pc, opcode: opcode, valid: true}
 }
 
 // executeInstruction executes the appropriate instruction based on the opcode
 // currently loaded into the CPU.
 func (c *Chip8) executeInstruction() {
-	var op string
-
-	x := c.cpu.opcode.x()
-	y := c.cpu.opcode.y()
-	n := c.cpu.opcode.n()
-	nn := c.cpu.opcode.nn()
-	nnn := c.cpu.opcode.nnn()
-
-	switch c.cpu.opcode & 0xF000 {
-	case 0x0000:
-		switch nnn {
-		case 0x0E0:
-			op = fmt.Sprintf("%#x: %#x CLS", c.cpu.pc-2, c.cpu.opcode)
-			c.cpu.Exec00E0(&c.display)
-		case 0x0EE:
-			op = fmt.Sprintf("%#x: %#x RET", c.cpu.pc-2, c.cpu.opcode)
-			c.cpu.Exec00EE()
-		default:
-			c.invalidOpcode()
-		}
-	case 0x1000:
-		op = fmt.Sprintf("%#x: %#x JP %#v", c.cpu.pc-2, c.cpu.opcode, nnn)
-		c.cpu.Exec1NNN()
-	case 0x2000:
-		op = fmt.Sprintf("%#x: %#x CALL %#v", c.cpu.pc-2, c.cpu.opcode, nnn)
-		c.cpu.Exec2NNN()
-	case 0x3000:
-		op = fmt.Sprintf("%#x: %#x SE V%d, %#v", c.cpu.pc-2, c.cpu.opcode, x, nn)
-		c.cpu.Exec3XNN()
-	case 0x4000:
-		op = fmt.Sprintf("%#x: %#x SNE V%d, %#v", c.cpu.pc-2, c.cpu.opcode, x, nn)
-		c.cpu.Exec4XNN()
-	case 0x5000:
-		op = fmt.Sprintf("%#x: %#x SE V%d, V%d", c.cpu.pc-2, c.cpu.opcode, x, y)
-		c.cpu.Exec5XY0()
-	case 0x6000:
-		op = fmt.Sprintf("%#x: %#x LD V%d, %#v", c.cpu.pc-2, c.cpu.opcode, x, nn)
-		c.cpu.Exec6XNN()
-	case 0x7000:
-		op = fmt.Sprintf("%#x: %#x ADD V%d, %#v", c.cpu.pc-2, c.cpu.opcode, x, nn)
-		c.cpu.Exec7XNN()
-	case 0x8000:
-		switch n {
-		case 0x0:
-			op = fmt.Sprintf("%#x: %#x LD V%d, V%d", c.cpu.pc-2, c.cpu.opcode, x, y)
-			c.cpu.Exec8XY0()
-		case 0x1:
-			op = fmt.Sprintf("%#x: %#x OR V%d, V%d", c.cpu.pc-2, c.cpu.opcode, x, y)
-			c.cpu.Exec8XY1()
-		case 0x2:
-			op = fmt.Sprintf("%#x: %#x AND V%d, V%d", c.cpu.pc-2, c.cpu.opcode, x, y)
-			c.cpu.Exec8XY2()
-		case 0x3:
-			op = fmt.Sprintf("%#x: %#x XOR V%d, V%d", c.cpu.pc-2, c.cpu.opcode, x, y)
-			c.cpu.Exec8XY3()
-		case 0x4:
-			op = fmt.Sprintf("%#x: %#x ADD V%d, V%d", c.cpu.pc-2, c.cpu.opcode, x, y)
-			c.cpu.Exec8XY4()
-		case 0x5:
-			op = fmt.Sprintf("%#x: %#x SUB V%d, V%d", c.cpu.pc-2, c.cpu.opcode, x, y)
-			c.cpu.Exec8XY5()
-		case 0x6:
-			op = fmt.Sprintf("%#x: %#x SHR V%d {, V%d}", c.cpu.pc-2, c.cpu.opcode, x, y)
-			c.cpu.Exec8XY6()
-		case 0x7:
-			op = fmt.Sprintf("%#x: %#x SUBN V%d, V%d", c.cpu.pc-2, c.cpu.opcode, x, y)
-			c.cpu.Exec8XY7()
-		case 0xE:
-			op = fmt.Sprintf("%#x: %#x SHL V%d {, V%d}", c.cpu.pc-2, c.cpu.opcode, x, y)
-			c.cpu.Exec8XYE()
-		default:
-			c.invalidOpcode()
-		}
-	case 0x9000:
-		op = fmt.Sprintf("%#x: %#x SNE V%d, V%d", c.cpu.pc-2, c.cpu.opcode, x, y)
-		c.cpu.Exec9XY0()
-	case 0xA000:
-		op = fmt.Sprintf("%#x: %#x LD I, %#x", c.cpu.pc-2, c.cpu.opcode, nnn)
-		c.cpu.ExecANNN()
-	case 0xC000:
-		op = fmt.Sprintf("%#x: %#x RND V%d, byte", c.cpu.pc-2, c.cpu.opcode, x)
-		c.cpu.ExecCXNN()
-	case 0xD000:
-		op = fmt.Sprintf("%#x: %#x DRW V%d, V%d, %#x", c.cpu.pc-2, c.cpu.opcode, x, y, n)
-		c.cpu.ExecDXYN(&c.mem, &c.display)
-	case 0xE000:
-		switch nn {
-		case 0x9E:
-			op = fmt.Sprintf("%#x: %#x SKP V%d", c.cpu.pc-2, c.cpu.opcode, x)
-			c.cpu.ExecEX9E(c.keys)
-		case 0xA1:
-			op = fmt.Sprintf("%#x: %#x SKNP V%d", c.cpu.pc-2, c.cpu.opcode, x)
-			c.cpu.ExecEXA1(c.keys)
-		default:
-			c.invalidOpcode()
-		}
-	case 0xF000:
-		switch nn {
-		case 0x07:
-			op = fmt.Sprintf("%#x: %#x LD V%d, DT", c.cpu.pc-2, c.cpu.opcode, x)
-			c.cpu.ExecFX07()
-		case 0x0A:
-			op = fmt.Sprintf("%#x: %#x LD V%d, key", c.cpu.pc-2, c.cpu.opcode, x)
-			c.cpu.ExecFX0A(c.keys)
-		case 0x15:
-			op = fmt.Sprintf("%#x: %#x LD DT, V%d", c.cpu.pc-2, c.cpu.opcode, x)
-			c.cpu.ExecFX15()
-		case 0x18:
-			op = fmt.Sprintf("%#x: %#x LD ST, V%d", c.cpu.pc-2, c.cpu.opcode, x)
-			c.cpu.ExecFX18()
-		case 0x1E:
-			op = fmt.Sprintf("%#x: %#x ADD I, V%d", c.cpu.pc-2, c.cpu.opcode, x)
-			c.cpu.ExecFX1E()
-		case 0x29:
-			op = fmt.Sprintf("%#x: %#x LD F, V%d", c.cpu.pc-2, c.cpu.opcode, x)
-			c.cpu.ExecFX29(&c.mem)
-		case 0x33:
-			op = fmt.Sprintf("%#x: %#x LD B, V%d", c.cpu.pc-2, c.cpu.opcode, x)
-			c.cpu.ExecFX33(&c.mem)
-		case 0x55:
-			op = fmt.Sprintf("%#x: %#x LD [I], V%d", c.cpu.pc-2, c.cpu.opcode, x)
-			c.cpu.ExecFX55(&c.mem)
-		case 0x65:
-			op = fmt.Sprintf("%#x: %#x LD V%d, [I]", c.cpu.pc-2, c.cpu.opcode, x)
-			c.cpu.ExecFX65(&c.mem)
-		default:
-			c.invalidOpcode()
-		}
-	default:
-		c.invalidOpcode()
-	}
-
-	c.addOpHistoryItem(op)
+	instructions[opClasses[c.cpu.opcode]].exec(c)
 }
 
-// invalidOpcode prints an error message displaying the invalid opcode held in
-// the cpu, and then terminates execution of the emulator.
+// invalidOpcode pauses execution at the instruction held in the cpu, which
+// isn't a valid one.
 func (c *Chip8) invalidOpcode() {
-	log.Fatalf("Invalid opcode: %#v\n", c.cpu.opcode)
+	c.fault(c.cpu.pc-2, fmt.Sprintf("Invalid opcode %04X", uint16(c.cpu.opcode)))
+}
+
+// fault pauses execution at the instruction at pc, which can't be executed
+// for reason, so the machine can be inspected and the instruction skipped
+// with SkipInstruction. Reasons start with "Invalid".
+func (c *Chip8) fault(pc uint16, reason string) {
+	c.cpu.pc = pc
+	c.paused = true
+	c.stepOver = false
+	c.frameStep = false
+	c.stopReason = fmt.Sprintf("%s at %#04x", reason, pc)
+	c.log.Warnf("%s", c.stopReason)
+}
+
+// checkBounds returns why the instruction at PC can't be executed, if it
+// would be fetched from or access RAM past its end, overflow or underflow
+// the stack, or check a key past F.
+func (c *Chip8) checkBounds() (string, bool) {
+	if int(c.cpu.pc)+2 > len(c.mem) {
+		return "Invalid fetch past the end of RAM", true
+	}
+
+	op := c.instructionAt(c.cpu.pc)
+	if access, ok := instructionAccess(op, c.cpu.i); ok {
+		if end := int(c.cpu.i) + int(access.end-access.start); end >= len(c.mem) {
+			return fmt.Sprintf("Invalid access to %#04x-%#04x, past the end of RAM", c.cpu.i, end), true
+		}
+	}
+	switch {
+	case opClasses[op] == opCALL && int(c.cpu.sp) >= len(c.cpu.stack):
+		return "Invalid CALL with the stack full", true
+	case opClasses[op] == opRET && c.cpu.sp == 0:
+		return "Invalid RET with the stack empty", true
+	case (opClasses[op] == opSKP || opClasses[op] == opSKNP) && c.cpu.v[op.x()] > 0xF:
+		return fmt.Sprintf("Invalid key %#02x in V%X", c.cpu.v[op.x()], op.x()), true
+	case opClasses[op] == opLDK && c.cpu.keyWait != noKey && c.cpu.keyWait > 0xF:
+		return fmt.Sprintf("Invalid key %#02x awaiting release", c.cpu.keyWait), true
+	}
+
+	return "", false
 }
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// RunConcurrently is Run with the emulator on a goroutine of its own. The
+// frontend is driven from the calling goroutine, rendering frames as the
+// emulator signals them and polling for input at least every 60th of a
+// second, so it stays responsive while the emulator is busy. The emulator
+// is locked while the frontend uses it, which releases it while waiting for
+// the next frame and between frames. Frontends pacing the emulator by
+// blocking in Render, such as ones waiting for vsync, need Run. It returns
+// the error Run does.
+func (c *Chip8) RunConcurrently(fe Frontend) error {
+	defer fe.Close()
+	defer c.recoverCrash()
+
+	c.lock = new(sync.Mutex)
+	c.frames = make(chan struct{}, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(frameSignal{})
+	}()
+
+	const pollPeriod = time.Second / VBlankFreq
+	poll := time.NewTicker(pollPeriod)
+	defer poll.Stop()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-c.frames:
+			poll.Reset(pollPeriod)
+		case <-poll.C:
+		}
+
+		c.lock.Lock()
+		fe.PollEvents(c)
+		fe.Render(c)
+		c.unseen = false
+		c.lock.Unlock()
+	}
+}
+
+// frameSignal is the frontend the emulator runs with under
+// RunConcurrently, telling the real one of each frame rendered.
+type frameSignal struct{}
+
+// Render signals a frame to the frontend without waiting for it to be
+// rendered, and lets the frontend use the emulator if it is waiting to.
+func (frameSignal) Render(c *Chip8) {
+	c.unseen = c.unseen || c.changed
+	select {
+	case c.frames <- struct{}{}:
+	default:
+	}
+	c.release()
+	c.acquire()
+}
+
+func (frameSignal) PollEvents(c *Chip8) {}
+
+func (frameSignal) Close() {}
+
+// acquire locks the emulator for the goroutine running it, if it is run by
+// RunConcurrently.
+func (c *Chip8) acquire() {
+	if c.lock != nil {
+		c.lock.Lock()
+	}
+}
+
+// release unlocks the emulator locked by acquire.
+func (c *Chip8) release() {
+	if c.lock != nil {
+		c.lock.Unlock()
+	}
+}
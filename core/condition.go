@@ -0,0 +1,192 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Condition is a comparison of CPU registers, such as "V3 == 0x1f" or
+// "I >= 0x400", pausing execution when it becomes true. A condition given an
+// address, "2a4 if V3 == 0x1f", is a conditional breakpoint instead: it is
+// only tested when the instruction at the address is about to be executed.
+type Condition struct {
+	Addr   uint16 // address of a conditional breakpoint
+	AtAddr bool   // the condition is a conditional breakpoint at Addr
+
+	left, right operand
+	op          string
+}
+
+// operand is a register, by name, or a constant.
+type operand struct {
+	reg   string
+	value int
+}
+
+// conditionPattern matches conditions: an optional address and "if", then
+// two operands compared.
+var conditionPattern = regexp.MustCompile(`^(?:([0-9a-fA-F]+|0[xX][0-9a-fA-F]+)\s+if\s+)?(\w+)\s*(==|!=|<=|>=|<|>)\s*(\w+)$`)
+
+// ParseCondition parses a condition, "[ADDR if ]A OP B", where A and B are
+// registers (V0-VF, I, PC, SP, DT, ST) or numbers, decimal or hex with 0x,
+// and OP is one of == != < <= > >=. The address is hex.
+func ParseCondition(s string) (Condition, error) {
+	m := conditionPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Condition{}, fmt.Errorf("invalid condition %q", s)
+	}
+
+	var cond Condition
+	if m[1] != "" {
+		addr, err := parseHexAddr(m[1])
+		if err != nil {
+			return Condition{}, fmt.Errorf("invalid condition %q: %v", s, err)
+		}
+		cond.Addr, cond.AtAddr = addr, true
+	}
+
+	var err error
+	if cond.left, err = parseOperand(m[2]); err != nil {
+		return Condition{}, fmt.Errorf("invalid condition %q: %v", s, err)
+	}
+	if cond.right, err = parseOperand(m[4]); err != nil {
+		return Condition{}, fmt.Errorf("invalid condition %q: %v", s, err)
+	}
+	cond.op = m[3]
+
+	return cond, nil
+}
+
+// parseOperand parses a register name or a number.
+func parseOperand(s string) (operand, error) {
+	reg := strings.ToUpper(s)
+	switch reg {
+	case "I", "PC", "SP", "DT", "ST":
+		return operand{reg: reg}, nil
+	}
+	if len(reg) == 2 && reg[0] == 'V' && strings.ContainsRune("0123456789ABCDEF", rune(reg[1])) {
+		return operand{reg: reg}, nil
+	}
+
+	value, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return operand{}, fmt.Errorf("%q is not a register or number", s)
+	}
+
+	return operand{value: int(value)}, nil
+}
+
+// String formats the condition as ParseCondition accepts it.
+func (cond Condition) String() string {
+	if cond.AtAddr {
+		return fmt.Sprintf("%03x if %s", cond.Addr, cond.expr())
+	}
+
+	return cond.expr()
+}
+
+// expr formats the comparison of the condition.
+func (cond Condition) expr() string {
+	return fmt.Sprintf("%s %s %s", cond.left, cond.op, cond.right)
+}
+
+func (o operand) String() string {
+	if o.reg != "" {
+		return o.reg
+	}
+
+	return fmt.Sprintf("%#x", o.value)
+}
+
+// value returns the current value of the operand o.
+func (c *Chip8) value(o operand) int {
+	switch o.reg {
+	case "":
+		return o.value
+	case "I":
+		return int(c.cpu.i)
+	case "PC":
+		return int(c.cpu.pc)
+	case "SP":
+		return int(c.cpu.sp)
+	case "DT":
+		return int(c.cpu.dt)
+	case "ST":
+		return int(c.cpu.st)
+	}
+
+	n, _ := strconv.ParseUint(o.reg[1:], 16, 8)
+	return int(c.cpu.v[n])
+}
+
+// holds reports whether cond is true.
+func (c *Chip8) holds(cond Condition) bool {
+	left, right := c.value(cond.left), c.value(cond.right)
+	switch cond.op {
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	case ">":
+		return left > right
+	}
+
+	return left >= right
+}
+
+// AddCondition makes execution pause when cond becomes true, or, if it has
+// an address, when the instruction there is about to be executed with cond
+// true.
+func (c *Chip8) AddCondition(cond Condition) {
+	c.conditions = append(c.conditions, cond)
+	c.condsMet = append(c.condsMet, false)
+}
+
+// Conditions returns the conditions execution pauses on.
+func (c *Chip8) Conditions() []Condition {
+	return append([]Condition(nil), c.conditions...)
+}
+
+// ClearConditions removes all conditions.
+func (c *Chip8) ClearConditions() {
+	c.conditions = nil
+	c.condsMet = nil
+}
+
+// hitConditionalBreakpoint reports whether a conditional breakpoint at PC has
+// its condition true.
+func (c *Chip8) hitConditionalBreakpoint() (Condition, bool) {
+	for _, cond := range c.conditions {
+		if cond.AtAddr && cond.Addr == c.cpu.pc && c.holds(cond) {
+			return cond, true
+		}
+	}
+
+	return Condition{}, false
+}
+
+// checkConditions pauses execution when a condition without an address has
+// become true with the instruction at pc just executed. Conditions stopping
+// execution don't stop it again until they have been false.
+func (c *Chip8) checkConditions(pc uint16) {
+	for i, cond := range c.conditions {
+		if cond.AtAddr {
+			continue
+		}
+		met := c.holds(cond)
+		if met && !c.condsMet[i] {
+			c.paused = true
+			c.stepOver = false
+			c.frameStep = false
+			c.stopReason = fmt.Sprintf("%s after %#04x", cond.expr(), pc)
+			c.log.Infof("Condition met: %s", c.stopReason)
+		}
+		c.condsMet[i] = met
+	}
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string // the condition formatted by String
+	}{
+		{"V3 == 0x1f", "V3 == 0x1f"},
+		{"v3==31", "V3 == 0x1f"},
+		{"  VF != 0  ", "VF != 0x0"},
+		{"I >= 0x400", "I >= 0x400"},
+		{"pc < 0x300", "PC < 0x300"},
+		{"SP <= 2", "SP <= 0x2"},
+		{"dt > st", "DT > ST"},
+		{"V0 == V1", "V0 == V1"},
+		{"5 == VA", "0x5 == VA"},
+		{"0xffff == I", "0xffff == I"},
+		{"2a4 if V3 == 0x1f", "2a4 if V3 == 0x1f"},
+		{"0x2A4 if V3 == 0x1f", "2a4 if V3 == 0x1f"},
+		{"ffff if I != 0", "ffff if I != 0x0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			cond, err := ParseCondition(tt.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cond.String(); got != tt.want {
+				t.Errorf("ParseCondition(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string // end of the error
+	}{
+		{"", `invalid condition ""`},
+		{"   ", `invalid condition "   "`},
+		{"V3", `invalid condition "V3"`},
+		{"V3 = 1", `invalid condition "V3 = 1"`},
+		{"V3 === 1", `invalid condition "V3 === 1"`},
+		{"== 1", `invalid condition "== 1"`},
+		{"V3 ==", `invalid condition "V3 =="`},
+		{"V3 == 1 == 2", `invalid condition "V3 == 1 == 2"`},
+		{"V3 + 1 == 2", `invalid condition "V3 + 1 == 2"`},
+		{"V16 == 1", `"V16" is not a register or number`},
+		{"VG == 1", `"VG" is not a register or number`},
+		{"V3 == X", `"X" is not a register or number`},
+		{"V3 == 0x10000", `"0x10000" is not a register or number`},
+		{"V3 == 65536", `"65536" is not a register or number`},
+		{"V3 == -1", `invalid condition "V3 == -1"`},
+		{"10000 if V3 == 1", `"10000" is not an address`},
+		{"2g4 if V3 == 1", `invalid condition "2g4 if V3 == 1"`},
+		{"if V3 == 1", `invalid condition "if V3 == 1"`},
+		{"2a4 V3 == 1", `invalid condition "2a4 V3 == 1"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseCondition(tt.s)
+		if err == nil || !strings.HasSuffix(err.Error(), tt.want) {
+			t.Errorf("ParseCondition(%q) = %v, want error %q", tt.s, err, tt.want)
+		}
+	}
+}
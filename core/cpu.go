@@ -1,10 +1,5 @@
 package core
 
-import (
-	"math/rand"
-	"time"
-)
-
 // CPU used by the Chip-8 emulator
 type CPU struct {
 	v      []uint8  // V registers - general purpose
@@ -15,16 +10,20 @@ type CPU struct {
 	dt     uint8    // delay timer
 	st     uint8    // sound timer
 	opcode Opcode   // 2 bytes representing current opcode
+
+	rng     pcg   // "random" numbers needed by 0xCXNN instruction
+	keyWait uint8 // key pressed during FX0A, awaiting release (noKey: none)
 }
 
 const (
 	numRegisters = 16
 	stackDepth   = 16
+	noKey        = 0xFF
 )
 
 // NewCPU returns a Chip-8 CPU with cleared registers, and initialized program
-// counter.
-func NewCPU() *CPU {
+// counter. Its random numbers are generated from seed.
+func NewCPU(seed int64) *CPU {
 	return &CPU{
 		v:      make([]uint8, numRegisters),
 		i:      0,
@@ -34,12 +33,10 @@ func NewCPU() *CPU {
 		dt:     0,
 		st:     0,
 		opcode: 0x0000,
-	}
-}
 
-func init() {
-	// "random" numbers needed by 0xCXNN instruction.
-	rand.Seed(time.Now().UnixNano())
+		rng:     newPCG(seed),
+		keyWait: noKey,
+	}
 }
 
 func (cpu *CPU) decrementTimers() {
@@ -56,10 +53,8 @@ func (cpu *CPU) decrementTimers() {
 
 // 00E0 - CLS
 // Clear the display.
-func (cpu *CPU) Exec00E0(disp *[]uint8) {
-	for i := range *disp {
-		(*disp)[i] = 0
-	}
+func (cpu *CPU) Exec00E0(disp *displayBuffer) {
+	*disp = displayBuffer{}
 }
 
 // 00EE - RET
@@ -174,19 +169,15 @@ func (cpu *CPU) Exec8XY3() {
 }
 
 // 8XY4 - ADD VX, VY
-// Set VX to result of VX + VY. Set VF = 1 if carry (result > 255).
+// Set VX to result of VX + VY. Set VF = 1 if carry (result > 255). VF is set
+// after VX, so the flag is kept when X is F.
 func (cpu *CPU) Exec8XY4() {
 	x := cpu.opcode.x()
 	y := cpu.opcode.y()
 
 	sum16 := uint16(cpu.v[x]) + uint16(cpu.v[y])
-	if sum16 > 0xFF {
-		cpu.v[0xF] = 1
-	} else {
-		cpu.v[0xF] = 0
-	}
-
 	cpu.v[x] = uint8(sum16)
+	cpu.v[0xF] = uint8(sum16 >> 8)
 }
 
 // 8XY5 - SUB VX, VY
@@ -195,29 +186,24 @@ func (cpu *CPU) Exec8XY5() {
 	x := cpu.opcode.x()
 	y := cpu.opcode.y()
 
-	if cpu.v[y] > cpu.v[x] {
-		cpu.v[0xF] = 0
-	} else {
-		cpu.v[0xF] = 1
-	}
-
+	noBorrow := cpu.v[x] >= cpu.v[y]
 	cpu.v[x] -= cpu.v[y]
+	cpu.v[0xF] = bit(noBorrow)
 }
 
 // 8XY6 - SHR VX {, VY}
 // Store the value of VY shifted right one bit in register VX. Set register VF to
-// the least significant bit prior to shift.
-func (cpu *CPU) Exec8XY6() {
+// the least significant bit prior to shift. With inPlace, VX is shifted instead.
+func (cpu *CPU) Exec8XY6(inPlace bool) {
 	x := cpu.opcode.x()
 	y := cpu.opcode.y()
-
-	// Set carry flag if needed.
-	if cpu.v[x]%2 == 1 {
-		cpu.v[0xF] = 1
-	} else {
-		cpu.v[0xF] = 0
+	if inPlace {
+		y = x
 	}
+
+	shifted := cpu.v[y] & 0x01
 	cpu.v[x] = cpu.v[y] >> 1
+	cpu.v[0xF] = shifted
 }
 
 // 8XY7 - SUBN VX, VY
@@ -226,29 +212,33 @@ func (cpu *CPU) Exec8XY7() {
 	x := cpu.opcode.x()
 	y := cpu.opcode.y()
 
-	// Set carry flag if needed.
-	if cpu.v[x] > cpu.v[y] {
-		cpu.v[0xF] = 0
-	} else {
-		cpu.v[0xF] = 1
-	}
+	noBorrow := cpu.v[y] >= cpu.v[x]
 	cpu.v[x] = cpu.v[y] - cpu.v[x]
+	cpu.v[0xF] = bit(noBorrow)
 }
 
 // 8XYE - SHL VX {, VY}
 // Store the value of VY shifted left one bit in register VX. Set register VF to
-// the most significant bit prior to shift.
-func (cpu *CPU) Exec8XYE() {
+// the most significant bit prior to shift. With inPlace, VX is shifted instead.
+func (cpu *CPU) Exec8XYE(inPlace bool) {
 	x := cpu.opcode.x()
 	y := cpu.opcode.y()
-
-	// Set carry flag if needed.
-	if cpu.v[x] >= 128 {
-		cpu.v[0xF] = 1
-	} else {
-		cpu.v[0xF] = 0
+	if inPlace {
+		y = x
 	}
+
+	shifted := cpu.v[y] >> 7
 	cpu.v[x] = cpu.v[y] << 1
+	cpu.v[0xF] = shifted
+}
+
+// bit returns the value of VF for a condition.
+func bit(set bool) uint8 {
+	if set {
+		return 1
+	}
+
+	return 0
 }
 
 // 9XY0 - SNE VX, VY
@@ -270,6 +260,19 @@ func (cpu *CPU) ExecANNN() {
 	cpu.i = nnn
 }
 
+// BNNN - JP V0, addr
+// Jump to location NNN + V0. With byX, the jump is to NNN + VX, X being the
+// top digit of NNN.
+func (cpu *CPU) ExecBNNN(byX bool) {
+	nnn := cpu.opcode.nnn()
+
+	var x uint8
+	if byX {
+		x = cpu.opcode.x()
+	}
+	cpu.pc = nnn + uint16(cpu.v[x])
+}
+
 // CXNN - RND VX, byte
 // Set VX to the result of (rand(0-255) AND NN)
 func (cpu *CPU) ExecCXNN() {
@@ -277,19 +280,19 @@ func (cpu *CPU) ExecCXNN() {
 	nn := cpu.opcode.nn()
 
 	// set v[x] to (rand(0xFF) & NN)
-	cpu.v[x] = uint8(rand.Intn(256)) & nn
+	cpu.v[x] = cpu.rng.byte() & nn
 }
 
 // DXYN - DRW VX, VY, nibble
 // Display an n-byte sprite starting at memory location I, at display location
 // (VX, VY). Set VF if collision occurs. Sprites are XORed into the existing
 // display.
-func (cpu *CPU) ExecDXYN(memory *[]uint8, display *[]uint8) {
+func (cpu *CPU) ExecDXYN(memory []uint8, display *displayBuffer) {
 	x := cpu.opcode.x()
 	y := cpu.opcode.y()
 	n := cpu.opcode.n()
 
-	spriteMem := (*memory)[cpu.i:]
+	spriteMem := memory[cpu.i:]
 	flipped := uint8(0)
 
 	var xpos, ypos int
@@ -307,9 +310,9 @@ func (cpu *CPU) ExecDXYN(memory *[]uint8, display *[]uint8) {
 			}
 
 			// XOR sprite to the display.
-			oldpixel = (*display)[ypos*Chip8Width+xpos]
+			oldpixel = display[ypos*Chip8Width+xpos]
 			newpixel = (spriteMem[iy] >> (7 - ix)) & 0x01
-			(*display)[ypos*Chip8Width+xpos] ^= newpixel
+			display[ypos*Chip8Width+xpos] ^= newpixel
 
 			// Keep track if any pixels are unset.
 			if oldpixel == 1 && newpixel == 1 {
@@ -351,11 +354,22 @@ func (cpu *CPU) ExecFX07() {
 }
 
 // FX0A - LD VX, key
-// Wait for a key press, store the value of the key in VX.
-func (cpu *CPU) ExecFX0A(keys []uint8) {
+// Wait for a key press, store the value of the key in VX. With waitRelease,
+// the key must also be released again before execution continues.
+func (cpu *CPU) ExecFX0A(keys []uint8, waitRelease bool) {
 	x := cpu.opcode.x()
 
-	var pressed uint8 = 0xFF
+	if cpu.keyWait != noKey {
+		if keys[cpu.keyWait] == 0 {
+			cpu.v[x] = cpu.keyWait
+			cpu.keyWait = noKey
+		} else {
+			cpu.pc -= 2
+		}
+		return
+	}
+
+	var pressed uint8 = noKey
 	for i, keystate := range keys {
 		if keystate == 1 {
 			pressed = uint8(i)
@@ -363,9 +377,12 @@ func (cpu *CPU) ExecFX0A(keys []uint8) {
 		}
 	}
 
-	if pressed == 0xFF {
+	if pressed == noKey {
 		// Block by decrementing the program counter.
 		cpu.pc -= 2
+	} else if waitRelease {
+		cpu.keyWait = pressed
+		cpu.pc -= 2
 	} else {
 		cpu.v[x] = pressed
 	}
@@ -397,7 +414,7 @@ func (cpu *CPU) ExecFX1E() {
 
 // FX29 - LD F, VX
 // Set I to the location of the sprite data corresponding to value of VX.
-func (cpu *CPU) ExecFX29(memory *[]uint8) {
+func (cpu *CPU) ExecFX29() {
 	x := cpu.opcode.x()
 
 	cpu.i = characterSpritesOffset + uint16(cpu.v[x])*characterSpriteBytes
@@ -405,30 +422,58 @@ func (cpu *CPU) ExecFX29(memory *[]uint8) {
 
 // FX33 - LD B, VX
 // Store the binary representation of VX in memory at I, I+1, I+2 (hunreds, tens, ones).
-func (cpu *CPU) ExecFX33(memory *[]uint8) {
+func (cpu *CPU) ExecFX33(memory []uint8) {
 	x := cpu.opcode.x()
 
-	(*memory)[cpu.i] = cpu.v[x] / 100
-	(*memory)[cpu.i+1] = (cpu.v[x] % 100) / 10
-	(*memory)[cpu.i+2] = cpu.v[x] % 10
+	memory[cpu.i] = cpu.v[x] / 100
+	memory[cpu.i+1] = (cpu.v[x] % 100) / 10
+	memory[cpu.i+2] = cpu.v[x] % 10
 }
 
 // FX55 - LD [I], VX
 // Store registers V0 through VX in memory starting at location I.
-func (cpu *CPU) ExecFX55(memory *[]uint8) {
+// With advance, I is left past the last register stored.
+func (cpu *CPU) ExecFX55(memory []uint8, advance bool) {
 	x := cpu.opcode.x()
 
 	for i := 0; i <= int(x); i++ {
-		(*memory)[int(cpu.i)+i] = cpu.v[i]
+		memory[int(cpu.i)+i] = cpu.v[i]
+	}
+	if advance {
+		cpu.i += uint16(x) + 1
 	}
 }
 
 // FX65 - LD VX, [I]
 // Load values from memory starting at location I into registers V0 through VX.
-func (cpu *CPU) ExecFX65(memory *[]uint8) {
+// With advance, I is left past the last register loaded.
+func (cpu *CPU) ExecFX65(memory []uint8, advance bool) {
+	x := cpu.opcode.x()
+
+	for i := 0; i <= int(x); i++ {
+		cpu.v[i] = memory[int(cpu.i)+i]
+	}
+	if advance {
+		cpu.i += uint16(x) + 1
+	}
+}
+
+// FX75 - LD R, VX
+// Store registers V0 through VX in the RPL user flags (SUPER-CHIP).
+func (cpu *CPU) ExecFX75(flags *[numFlags]uint8) {
+	x := cpu.opcode.x()
+
+	for i := 0; i <= int(x); i++ {
+		flags[i] = cpu.v[i]
+	}
+}
+
+// FX85 - LD VX, R
+// Load the RPL user flags into registers V0 through VX (SUPER-CHIP).
+func (cpu *CPU) ExecFX85(flags *[numFlags]uint8) {
 	x := cpu.opcode.x()
 
 	for i := 0; i <= int(x); i++ {
-		cpu.v[i] = (*memory)[int(cpu.i)+i]
+		cpu.v[i] = flags[i]
 	}
 }
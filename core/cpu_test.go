@@ -0,0 +1,442 @@
+package core
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// regs are values of V registers, by number.
+type regs map[int]uint8
+
+// newTestChip8 returns an emulator with a fixed seed, logging nothing.
+func newTestChip8(quirks Quirks) *Chip8 {
+	c, err := NewChip8(Options{Seed: 1, Quirks: quirks, Logger: NewLogger(ioutil.Discard, LogError)})
+	if err != nil {
+		panic(err)
+	}
+
+	return c
+}
+
+// execute writes ops to RAM at PC and executes them.
+func execute(c *Chip8, ops ...uint16) {
+	for n, op := range ops {
+		addr := int(c.cpu.pc) + n*2
+		c.mem[addr], c.mem[addr+1] = uint8(op>>8), uint8(op)
+	}
+	for range ops {
+		c.cycle()
+	}
+}
+
+// checkRegs reports the V registers of c which don't have the values in
+// want.
+func checkRegs(t *testing.T, c *Chip8, want regs) {
+	t.Helper()
+	for x, v := range want {
+		if c.cpu.v[x] != v {
+			t.Errorf("V%X = %#02x, want %#02x", x, c.cpu.v[x], v)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		op   uint16
+		v    regs // before
+		want regs // after
+	}{
+		{"LD byte", 0x61AB, regs{1: 0}, regs{1: 0xAB}},
+		{"ADD byte", 0x7105, regs{1: 0x10}, regs{1: 0x15}},
+		{"ADD byte wraps without carry", 0x7102, regs{1: 0xFF, 0xF: 0x07}, regs{1: 0x01, 0xF: 0x07}},
+		{"LD reg", 0x8120, regs{1: 0x00, 2: 0x42}, regs{1: 0x42, 2: 0x42}},
+		{"OR", 0x8121, regs{1: 0xF0, 2: 0x0F}, regs{1: 0xFF}},
+		{"AND", 0x8122, regs{1: 0xF0, 2: 0x3C}, regs{1: 0x30}},
+		{"XOR", 0x8123, regs{1: 0xF0, 2: 0x3C}, regs{1: 0xCC}},
+		{"ADD", 0x8124, regs{1: 0x10, 2: 0x20, 0xF: 1}, regs{1: 0x30, 0xF: 0}},
+		{"ADD carry", 0x8124, regs{1: 0xFF, 2: 0x01}, regs{1: 0x00, 0xF: 1}},
+		{"ADD to VF keeps the carry", 0x8F14, regs{1: 0xFF, 0xF: 0x02}, regs{0xF: 1}},
+		{"SUB", 0x8125, regs{1: 0x30, 2: 0x10}, regs{1: 0x20, 0xF: 1}},
+		{"SUB equal has no borrow", 0x8125, regs{1: 0x30, 2: 0x30}, regs{1: 0x00, 0xF: 1}},
+		{"SUB borrow", 0x8125, regs{1: 0x10, 2: 0x30, 0xF: 1}, regs{1: 0xE0, 0xF: 0}},
+		{"SUB from VF keeps the flag", 0x8F15, regs{1: 0x01, 0xF: 0x05}, regs{0xF: 1}},
+		{"SHR", 0x8126, regs{1: 0x00, 2: 0x05}, regs{1: 0x02, 2: 0x05, 0xF: 1}},
+		{"SHR shifts VY", 0x8126, regs{1: 0x01, 2: 0x04}, regs{1: 0x02, 0xF: 0}},
+		{"SHR in place", 0x8116, regs{1: 0x81}, regs{1: 0x40, 0xF: 1}},
+		{"SHR into VF keeps the flag", 0x8FF6, regs{0xF: 0x03}, regs{0xF: 1}},
+		{"SUBN", 0x8127, regs{1: 0x10, 2: 0x30}, regs{1: 0x20, 0xF: 1}},
+		{"SUBN borrow", 0x8127, regs{1: 0x30, 2: 0x10, 0xF: 1}, regs{1: 0xE0, 0xF: 0}},
+		{"SHL", 0x812E, regs{1: 0x00, 2: 0x81}, regs{1: 0x02, 2: 0x81, 0xF: 1}},
+		{"SHL shifts VY", 0x812E, regs{1: 0x80, 2: 0x01}, regs{1: 0x02, 0xF: 0}},
+		{"SHL into VF keeps the flag", 0x8FFE, regs{0xF: 0x40}, regs{0xF: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestChip8(Quirks{})
+			for x, v := range tt.v {
+				c.cpu.v[x] = v
+			}
+			execute(c, tt.op)
+			checkRegs(t, c, tt.want)
+			if c.cpu.pc != 0x202 {
+				t.Errorf("PC = %#04x, want 0x202", c.cpu.pc)
+			}
+		})
+	}
+}
+
+func TestSkips(t *testing.T) {
+	tests := []struct {
+		name string
+		op   uint16
+		v    regs
+		keys []uint8 // keys held
+		skip bool
+	}{
+		{"SE byte equal", 0x3142, regs{1: 0x42}, nil, true},
+		{"SE byte different", 0x3142, regs{1: 0x41}, nil, false},
+		{"SNE byte equal", 0x4142, regs{1: 0x42}, nil, false},
+		{"SNE byte different", 0x4142, regs{1: 0x41}, nil, true},
+		{"SE reg equal", 0x5120, regs{1: 7, 2: 7}, nil, true},
+		{"SE reg different", 0x5120, regs{1: 7, 2: 8}, nil, false},
+		{"SNE reg equal", 0x9120, regs{1: 7, 2: 7}, nil, false},
+		{"SNE reg different", 0x9120, regs{1: 7, 2: 8}, nil, true},
+		{"SKP held", 0xE19E, regs{1: 0xA}, []uint8{0xA}, true},
+		{"SKP other key held", 0xE19E, regs{1: 0xA}, []uint8{0xB}, false},
+		{"SKNP held", 0xE1A1, regs{1: 0xA}, []uint8{0xA}, false},
+		{"SKNP not held", 0xE1A1, regs{1: 0xA}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestChip8(Quirks{})
+			for x, v := range tt.v {
+				c.cpu.v[x] = v
+			}
+			for _, key := range tt.keys {
+				c.SetKey(key, true)
+			}
+			execute(c, tt.op)
+			want := uint16(0x202)
+			if tt.skip {
+				want = 0x204
+			}
+			if c.cpu.pc != want {
+				t.Errorf("PC = %#04x, want %#04x", c.cpu.pc, want)
+			}
+		})
+	}
+}
+
+func TestFlow(t *testing.T) {
+	c := newTestChip8(Quirks{})
+
+	execute(c, 0x1300) // JP 300
+	if c.cpu.pc != 0x300 {
+		t.Fatalf("JP: PC = %#04x, want 0x300", c.cpu.pc)
+	}
+
+	execute(c, 0x2400) // CALL 400
+	if c.cpu.pc != 0x400 || c.cpu.sp != 1 || c.cpu.stack[0] != 0x302 {
+		t.Fatalf("CALL: PC = %#04x, SP = %d, stack[0] = %#04x, want 0x400, 1, 0x302", c.cpu.pc, c.cpu.sp, c.cpu.stack[0])
+	}
+
+	execute(c, 0x00EE) // RET
+	if c.cpu.pc != 0x302 || c.cpu.sp != 0 {
+		t.Fatalf("RET: PC = %#04x, SP = %d, want 0x302, 0", c.cpu.pc, c.cpu.sp)
+	}
+
+	c.cpu.v[0] = 0x24
+	execute(c, 0xB500) // JP V0, 500
+	if c.cpu.pc != 0x524 {
+		t.Fatalf("JP V0: PC = %#04x, want 0x524", c.cpu.pc)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     []uint16
+		v       regs
+		i       uint16
+		mem     []uint8 // RAM at I before
+		want    regs
+		wantI   uint16
+		wantMem []uint8 // RAM at wantI after
+	}{
+		{"LD I", []uint16{0xA123}, nil, 0, nil, nil, 0x123, nil},
+		{"ADD I", []uint16{0xF11E}, regs{1: 0x10}, 0x300, nil, nil, 0x310, nil},
+		{"ADD I past 0xFFF", []uint16{0xF11E}, regs{1: 0x02}, 0xFFF, nil, nil, 0x1001, nil},
+		{"LD F", []uint16{0xF129}, regs{1: 0xA}, 0, nil, nil, characterSpritesOffset + 0xA*characterSpriteBytes, nil},
+		{"LD B", []uint16{0xF133}, regs{1: 254}, 0x300, nil, nil, 0x300, []uint8{2, 5, 4}},
+		{"LD B zero", []uint16{0xF133}, regs{1: 0}, 0x300, []uint8{9, 9, 9}, nil, 0x300, []uint8{0, 0, 0}},
+		{"LD [I]", []uint16{0xF255}, regs{0: 1, 1: 2, 2: 3, 3: 4}, 0x300, nil, nil, 0x300, []uint8{1, 2, 3, 0}},
+		{"LD V [I]", []uint16{0xF265}, regs{3: 9}, 0x300, []uint8{5, 6, 7, 8}, regs{0: 5, 1: 6, 2: 7, 3: 9}, 0x300, nil},
+		{"LD R and back", []uint16{0xF175, 0x6000, 0x6100, 0xF185}, regs{0: 0x11, 1: 0x22}, 0, nil, regs{0: 0x11, 1: 0x22}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestChip8(Quirks{})
+			for x, v := range tt.v {
+				c.cpu.v[x] = v
+			}
+			c.cpu.i = tt.i
+			copy(c.mem[tt.i:], tt.mem)
+			execute(c, tt.ops...)
+
+			checkRegs(t, c, tt.want)
+			if c.cpu.i != tt.wantI {
+				t.Errorf("I = %#04x, want %#04x", c.cpu.i, tt.wantI)
+			}
+			if len(tt.wantMem) > 0 {
+				if got := c.mem[tt.wantI : int(tt.wantI)+len(tt.wantMem)]; string(got) != string(tt.wantMem) {
+					t.Errorf("RAM at %#04x = % x, want % x", tt.wantI, got, tt.wantMem)
+				}
+			}
+		})
+	}
+}
+
+func TestTimers(t *testing.T) {
+	c := newTestChip8(Quirks{})
+	c.cpu.v[1], c.cpu.v[2] = 30, 40
+
+	execute(c, 0xF115, 0xF218, 0xF307) // LD DT, V1; LD ST, V2; LD V3, DT
+	if c.cpu.dt != 30 || c.cpu.st != 40 || c.cpu.v[3] != 30 {
+		t.Errorf("DT = %d, ST = %d, V3 = %d, want 30, 40, 30", c.cpu.dt, c.cpu.st, c.cpu.v[3])
+	}
+}
+
+func TestRandom(t *testing.T) {
+	c := newTestChip8(Quirks{})
+	for n := 0; n < 100; n++ {
+		c.cpu.pc = 0x200
+		execute(c, 0xC10F) // RND V1, 0x0F
+		if c.cpu.v[1]&0xF0 != 0 {
+			t.Fatalf("RND V1, 0x0F = %#02x, has bits outside the mask", c.cpu.v[1])
+		}
+	}
+
+	// The same seed draws the same numbers.
+	a, b := newTestChip8(Quirks{}), newTestChip8(Quirks{})
+	execute(a, 0xC1FF, 0xC2FF)
+	execute(b, 0xC1FF, 0xC2FF)
+	checkRegs(t, b, regs{1: a.cpu.v[1], 2: a.cpu.v[2]})
+}
+
+func TestWaitKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		quirks Quirks
+		press  bool // hold key 7 before the first FX0A
+		resume bool // FX0A returns on the first execution
+	}{
+		{"no key", Quirks{}, false, false},
+		{"key held", Quirks{}, true, true},
+		{"keyrelease key held", Quirks{KeyRelease: true}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestChip8(tt.quirks)
+			c.SetKey(7, tt.press)
+			execute(c, 0xF30A) // LD V3, K
+
+			if resumed := c.cpu.pc == 0x202; resumed != tt.resume {
+				t.Fatalf("PC = %#04x, want resumed %v", c.cpu.pc, tt.resume)
+			}
+			if tt.resume && c.cpu.v[3] != 7 {
+				t.Errorf("V3 = %d, want 7", c.cpu.v[3])
+			}
+		})
+	}
+
+	// With keyrelease, the key is returned once released.
+	c := newTestChip8(Quirks{KeyRelease: true})
+	c.SetKey(7, true)
+	execute(c, 0xF30A)
+	c.cycle()
+	if c.cpu.pc != 0x200 {
+		t.Fatalf("keyrelease: PC = %#04x while the key is held, want 0x200", c.cpu.pc)
+	}
+	c.SetKey(7, false)
+	c.cycle()
+	if c.cpu.pc != 0x202 || c.cpu.v[3] != 7 {
+		t.Errorf("keyrelease: PC = %#04x, V3 = %d after release, want 0x202, 7", c.cpu.pc, c.cpu.v[3])
+	}
+}
+
+// TestQuirks runs the instructions whose behavior a quirk changes, with and
+// without it.
+func TestQuirks(t *testing.T) {
+	tests := []struct {
+		name   string
+		quirks Quirks
+		op     uint16
+		v      regs
+		i      uint16
+		want   regs
+		wantPC uint16
+		wantI  uint16
+	}{
+		{"SHR", Quirks{}, 0x8126, regs{1: 0x10, 2: 0x05}, 0x300, regs{1: 0x02, 2: 0x05, 0xF: 1}, 0x202, 0x300},
+		{"SHR shift", Quirks{Shift: true}, 0x8126, regs{1: 0x10, 2: 0x05}, 0x300, regs{1: 0x08, 2: 0x05, 0xF: 0}, 0x202, 0x300},
+		{"SHL", Quirks{}, 0x812E, regs{1: 0x01, 2: 0x81}, 0x300, regs{1: 0x02, 2: 0x81, 0xF: 1}, 0x202, 0x300},
+		{"SHL shift", Quirks{Shift: true}, 0x812E, regs{1: 0x01, 2: 0x81}, 0x300, regs{1: 0x02, 2: 0x81, 0xF: 0}, 0x202, 0x300},
+		{"JP V0", Quirks{}, 0xB320, regs{0: 0x04, 3: 0x10}, 0x300, nil, 0x324, 0x300},
+		{"JP V0 jump", Quirks{Jump: true}, 0xB320, regs{0: 0x04, 3: 0x10}, 0x300, nil, 0x330, 0x300},
+		{"JP V0 jump by V0", Quirks{Jump: true}, 0xB020, regs{0: 0x04}, 0x300, nil, 0x024, 0x300},
+		{"LD [I]", Quirks{}, 0xF255, regs{0: 1, 1: 2, 2: 3}, 0x300, nil, 0x202, 0x300},
+		{"LD [I] loadstore", Quirks{LoadStore: true}, 0xF255, regs{0: 1, 1: 2, 2: 3}, 0x300, nil, 0x202, 0x303},
+		{"LD [I] V0 loadstore", Quirks{LoadStore: true}, 0xF055, regs{0: 1}, 0x300, nil, 0x202, 0x301},
+		{"LD V [I]", Quirks{}, 0xF165, nil, 0x300, regs{0: 0xAA, 1: 0xBB}, 0x202, 0x300},
+		{"LD V [I] loadstore", Quirks{LoadStore: true}, 0xF165, nil, 0x300, regs{0: 0xAA, 1: 0xBB}, 0x202, 0x302},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestChip8(tt.quirks)
+			for x, v := range tt.v {
+				c.cpu.v[x] = v
+			}
+			c.cpu.i = tt.i
+			copy(c.mem[tt.i:], []uint8{0xAA, 0xBB})
+			execute(c, tt.op)
+
+			checkRegs(t, c, tt.want)
+			if c.cpu.pc != tt.wantPC {
+				t.Errorf("PC = %#04x, want %#04x", c.cpu.pc, tt.wantPC)
+			}
+			if c.cpu.i != tt.wantI {
+				t.Errorf("I = %#04x, want %#04x", c.cpu.i, tt.wantI)
+			}
+		})
+	}
+}
+
+func TestParseQuirks(t *testing.T) {
+	q, err := ParseQuirks([]string{"keyrelease", " Shift", "JUMP", "loadstore"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Quirks{KeyRelease: true, Shift: true, Jump: true, LoadStore: true}); q != want {
+		t.Errorf("ParseQuirks = %+v, want %+v", q, want)
+	}
+	if _, err := ParseQuirks([]string{"vfreset"}); err == nil {
+		t.Error("ParseQuirks accepted an unknown quirk")
+	}
+}
+
+func TestDraw(t *testing.T) {
+	c := newTestChip8(Quirks{})
+	c.cpu.v[1], c.cpu.v[2] = 62, 31 // wraps to the left and top edges
+	c.cpu.i = 0x300
+	c.mem[0x300], c.mem[0x301] = 0xC0, 0x81
+
+	execute(c, 0xD122) // DRW V1, V2, 2
+	lit := map[[2]int]bool{{62, 31}: true, {63, 31}: true, {62, 0}: true, {5, 0}: true}
+	for y := 0; y < Chip8Height; y++ {
+		for x := 0; x < Chip8Width; x++ {
+			want := lit[[2]int{x, y}]
+			if got := c.display[y*Chip8Width+x] != 0; got != want {
+				t.Errorf("pixel %d,%d lit = %v, want %v", x, y, got, want)
+			}
+		}
+	}
+	if c.cpu.v[0xF] != 0 {
+		t.Errorf("VF = %d after drawing on a clear display, want 0", c.cpu.v[0xF])
+	}
+
+	execute(c, 0xD122) // erases the sprite
+	if c.cpu.v[0xF] != 1 {
+		t.Errorf("VF = %d after erasing pixels, want 1", c.cpu.v[0xF])
+	}
+	if c.display != (displayBuffer{}) {
+		t.Error("display not clear after drawing the sprite twice")
+	}
+
+	execute(c, 0xD122, 0x00E0) // CLS
+	if c.display != (displayBuffer{}) {
+		t.Error("display not clear after CLS")
+	}
+}
+
+func TestInvalidOpcodes(t *testing.T) {
+	for _, op := range []uint16{0x0123, 0x5121, 0x912F, 0xE1FF, 0xF1FF, 0x812F} {
+		c := newTestChip8(Quirks{})
+		execute(c, op)
+		if c.cpu.pc != 0x200 || !c.paused || c.StopReason() == "" {
+			t.Errorf("%04X: PC = %#04x, paused %v, stop reason %q, want execution paused at 0x200", op, c.cpu.pc, c.paused, c.StopReason())
+		}
+	}
+}
+
+func TestOutOfBounds(t *testing.T) {
+	tests := []struct {
+		name   string
+		extmem bool
+		pc     uint16
+		op     uint16 // written at pc, unless it is the last byte of RAM
+		i      uint16
+		sp     uint8
+		v1     uint8
+		fault  bool
+	}{
+		{"fetch from the last byte", false, 0xFFF, 0, 0, 0, 0, true},
+		{"fetch from the last byte of extended RAM", true, 0xFFFF, 0, 0, 0, 0, true},
+		{"fetch the last instruction", false, 0xFFE, 0x6000, 0, 0, 0, false},
+		{"LD B to the end", false, 0x200, 0xF033, 0xFFD, 0, 0, false},
+		{"LD B past the end", false, 0x200, 0xF033, 0xFFE, 0, 0, true},
+		{"LD B past the end of extended RAM", true, 0x200, 0xF033, 0xFFFF, 0, 0, true},
+		{"LD [I] past the end", false, 0x200, 0xF555, 0xFFC, 0, 0, true},
+		{"LD V, [I] past the end", false, 0x200, 0xF165, 0xFFF, 0, 0, true},
+		{"LD V, [I] after ADD I", false, 0x200, 0xF065, 0x1001, 0, 0, true},
+		{"DRW past the end", false, 0x200, 0xD012, 0xFFF, 0, 0, true},
+		{"DRW to the end", false, 0x200, 0xD011, 0xFFF, 0, 0, false},
+		{"CALL with the stack full", false, 0x200, 0x2300, 0, stackDepth, 0, true},
+		{"CALL to fill the stack", false, 0x200, 0x2300, 0, stackDepth - 1, 0, false},
+		{"RET with the stack empty", false, 0x200, 0x00EE, 0, 0, 0, true},
+		{"SKP past key F", false, 0x200, 0xE19E, 0, 0, 0x10, true},
+		{"SKNP past key F", false, 0x200, 0xE1A1, 0, 0, 0xFF, true},
+		{"SKP key F", false, 0x200, 0xE19E, 0, 0, 0xF, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewChip8(Options{ExtendedMemory: tt.extmem, Logger: NewLogger(ioutil.Discard, LogError)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.cpu.pc, c.cpu.i, c.cpu.sp, c.cpu.v[1] = tt.pc, tt.i, tt.sp, tt.v1
+			if int(tt.pc)+1 < len(c.mem) {
+				c.mem[tt.pc], c.mem[tt.pc+1] = uint8(tt.op>>8), uint8(tt.op)
+			}
+			c.cycle()
+
+			if faulted := c.paused && strings.HasPrefix(c.StopReason(), "Invalid"); faulted != tt.fault {
+				t.Fatalf("paused %v, stop reason %q, want fault %v", c.paused, c.StopReason(), tt.fault)
+			}
+			if tt.fault && c.cpu.pc != tt.pc {
+				t.Errorf("PC = %#04x, want %#04x", c.cpu.pc, tt.pc)
+			}
+		})
+	}
+}
+
+func TestKeyWaitOutOfBounds(t *testing.T) {
+	// Restored states can have LD K awaiting the release of any key.
+	for _, tt := range []struct {
+		keyWait uint8
+		fault   bool
+	}{{0xF, false}, {0x10, true}, {noKey - 1, true}} {
+		c, err := NewChip8(Options{Quirks: Quirks{KeyRelease: true}, Logger: NewLogger(ioutil.Discard, LogError)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.mem[0x200], c.mem[0x201] = 0xF1, 0x0A
+		c.cpu.keyWait = tt.keyWait
+		c.cycle()
+
+		if faulted := c.paused && strings.HasPrefix(c.StopReason(), "Invalid"); faulted != tt.fault {
+			t.Errorf("awaiting key %#02x: paused %v, stop reason %q, want fault %v", tt.keyWait, c.paused, c.StopReason(), tt.fault)
+		}
+	}
+}
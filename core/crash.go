@@ -0,0 +1,142 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// crashContext is how many bytes of RAM before and after PC and I a crash
+// dump shows.
+const crashContext = 32
+
+// WriteCrashDump writes a report of the state of the machine to w, for
+// attaching to bug reports: why it crashed, the registers and stack, the
+// operations executed last, the RAM around PC and I and the display.
+func (c *Chip8) WriteCrashDump(w io.Writer, cause string) error {
+	var b strings.Builder
+	r := c.Registers()
+
+	fmt.Fprintf(&b, "Chip-8 crash dump, %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&b, "ROM: %s (sha1 %s)\n", c.romName, c.RomHash())
+	fmt.Fprintf(&b, "Quirks: %+v\n", c.quirks)
+	fmt.Fprintf(&b, "Frame %d, instruction %d\n", c.frame, c.cycles)
+	fmt.Fprintf(&b, "\nCause:\n%s\n", strings.TrimSpace(cause))
+
+	fmt.Fprintf(&b, "\nRegisters:\n")
+	fmt.Fprintf(&b, "PC %#04x  I %#04x  SP %d  DT %d  ST %d  opcode %04X\n", r.PC, r.I, r.SP, r.DT, r.ST, r.Opcode)
+	for i, v := range r.V {
+		fmt.Fprintf(&b, "V%X %02x", i, v)
+		if i%8 == 7 {
+			b.WriteString("\n")
+		} else {
+			b.WriteString("  ")
+		}
+	}
+	b.WriteString("Stack:")
+	for i := 0; i < int(r.SP) && i < len(r.Stack); i++ {
+		fmt.Fprintf(&b, " %#04x", r.Stack[i])
+	}
+	b.WriteString("\n")
+
+	fmt.Fprintf(&b, "\nLast operations, oldest first:\n")
+	for _, op := range c.OpHistory(len(c.ophistory)) {
+		fmt.Fprintln(&b, op)
+	}
+
+	c.writeMemoryAround(&b, "PC", r.PC)
+	c.writeMemoryAround(&b, "I", r.I)
+
+	fmt.Fprintf(&b, "\nDisplay:\n")
+	for y := 0; y < Chip8Height; y++ {
+		row := make([]byte, Chip8Width)
+		for x := range row {
+			row[x] = '.'
+			if c.display[y*Chip8Width+x] != 0 {
+				row[x] = '#'
+			}
+		}
+		fmt.Fprintf(&b, "%s\n", row)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMemoryAround hex dumps the RAM around addr, the value of the register
+// called name, 16 bytes a row.
+func (c *Chip8) writeMemoryAround(b *strings.Builder, name string, addr uint16) {
+	start, end := int(addr)-crashContext, int(addr)+crashContext
+	start -= start % 16
+	end += (16 - end%16) % 16
+	if start < 0 {
+		start = 0
+	}
+	if end > len(c.mem) {
+		end = len(c.mem)
+	}
+
+	fmt.Fprintf(b, "\nMemory around %s (%#04x):\n", name, addr)
+	for row := start; row < end; row += 16 {
+		rowEnd := row + 16
+		if rowEnd > end {
+			rowEnd = end
+		}
+		fmt.Fprintf(b, "%#04x: % x\n", row, c.mem[row:rowEnd])
+	}
+}
+
+// SaveCrashDump writes a crash dump to a new file in Options.CrashDir,
+// returning its path, for errors the emulator can't go on from, such as Run
+// failing.
+func (c *Chip8) SaveCrashDump(cause string) (string, error) {
+	return c.saveCrashDump(cause, nil)
+}
+
+// saveCrashDump writes a crash dump to a new file in the crash dump
+// directory, followed by the stack trace of the goroutine which crashed, if
+// any, returning its path.
+func (c *Chip8) saveCrashDump(cause string, stack []byte) (string, error) {
+	if err := os.MkdirAll(c.crashDir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(c.crashDir, fmt.Sprintf("chip8-crash-%s.txt", time.Now().Format("20060102-150405")))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := c.WriteCrashDump(f, cause); err != nil {
+		f.Close()
+		return "", err
+	}
+	if len(stack) > 0 {
+		if _, err := fmt.Fprintf(f, "\nStack trace:\n%s", stack); err != nil {
+			f.Close()
+			return "", err
+		}
+	}
+
+	return path, f.Close()
+}
+
+// recoverCrash, deferred while the emulator runs, writes a crash dump if it
+// panics, when crash dumps are enabled, then lets the panic carry on.
+func (c *Chip8) recoverCrash() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if c.crashDir != "" {
+		path, err := c.saveCrashDump(fmt.Sprintf("panic: %v", r), debug.Stack())
+		if err != nil {
+			c.log.Errorf("Unable to write crash dump: %v", err)
+		} else {
+			c.log.Errorf("The emulator crashed, its state was written to %s", path)
+		}
+	}
+	panic(r)
+}
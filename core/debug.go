@@ -0,0 +1,262 @@
+package core
+
+import "fmt"
+
+// Registers is a snapshot of the CPU state, for debuggers.
+type Registers struct {
+	V      [numRegisters]uint8 // V0-VF
+	I      uint16
+	PC     uint16 // address of the next instruction
+	SP     uint8
+	DT     uint8
+	ST     uint8
+	Opcode uint16 // the last instruction executed
+	Stack  [stackDepth]uint16
+}
+
+// Registers returns the current state of the CPU.
+func (c *Chip8) Registers() Registers {
+	r := Registers{
+		I:      c.cpu.i,
+		PC:     c.cpu.pc,
+		SP:     c.cpu.sp,
+		DT:     c.cpu.dt,
+		ST:     c.cpu.st,
+		Opcode: uint16(c.cpu.opcode),
+	}
+	copy(r.V[:], c.cpu.v)
+	copy(r.Stack[:], c.cpu.stack)
+
+	return r
+}
+
+// SetRegisters replaces the state of the CPU with r. The opcode of the last
+// instruction executed is left alone.
+func (c *Chip8) SetRegisters(r Registers) {
+	copy(c.cpu.v, r.V[:])
+	c.cpu.i = r.I
+	c.cpu.pc = r.PC
+	c.cpu.sp = r.SP
+	if c.cpu.sp > stackDepth {
+		c.cpu.sp = stackDepth
+	}
+	c.cpu.dt = r.DT
+	c.cpu.st = r.ST
+	copy(c.cpu.stack, r.Stack[:])
+}
+
+// WriteMemory copies data into RAM starting at addr, stopping at the end of
+// RAM.
+func (c *Chip8) WriteMemory(addr uint16, data []byte) {
+	if int(addr) < len(c.mem) {
+		copy(c.mem[addr:], data)
+	}
+}
+
+// Memory returns a copy of the n bytes of RAM starting at addr, stopping at
+// the end of RAM.
+func (c *Chip8) Memory(addr uint16, n int) []byte {
+	if int(addr) >= len(c.mem) {
+		return nil
+	}
+	end := int(addr) + n
+	if end > len(c.mem) {
+		end = len(c.mem)
+	}
+
+	return append([]byte(nil), c.mem[addr:end]...)
+}
+
+// DrawRegion is an area of the display, in Chip-8 pixels. Sprites wrap
+// around the edges of the display, and so can their regions.
+type DrawRegion struct {
+	X, Y int
+	W, H int
+}
+
+// LastDraw returns the area of the display the last DXYN drew its sprite to,
+// if any was drawn since the ROM started.
+func (c *Chip8) LastDraw() (DrawRegion, bool) {
+	return c.lastDraw, c.lastDraw.H > 0
+}
+
+// PixelOn reports whether the display pixel at x, y is set, regardless of
+// how filters show it.
+func (c *Chip8) PixelOn(x, y int) bool {
+	if x < 0 || x >= Chip8Width || y < 0 || y >= Chip8Height {
+		return false
+	}
+
+	return c.display[y*Chip8Width+x] != 0
+}
+
+// SetBreakpoint makes execution pause when the instruction at addr is about
+// to be executed.
+func (c *Chip8) SetBreakpoint(addr uint16) {
+	c.breakpoints[addr] = true
+}
+
+// ClearBreakpoint removes the breakpoint at addr, if any.
+func (c *Chip8) ClearBreakpoint(addr uint16) {
+	delete(c.breakpoints, addr)
+}
+
+// HasBreakpoint reports whether there is a breakpoint at addr.
+func (c *Chip8) HasBreakpoint(addr uint16) bool {
+	return c.breakpoints[addr]
+}
+
+// Breakpoints returns the addresses of all breakpoints, in no particular
+// order.
+func (c *Chip8) Breakpoints() []uint16 {
+	addrs := make([]uint16, 0, len(c.breakpoints))
+	for addr := range c.breakpoints {
+		addrs = append(addrs, addr)
+	}
+
+	return addrs
+}
+
+// StopReason describes why execution is paused when it was paused by a
+// breakpoint or watchpoint, and is empty otherwise.
+func (c *Chip8) StopReason() string {
+	if !c.paused {
+		return ""
+	}
+
+	return c.stopReason
+}
+
+// Halted reports whether execution is paused with no step in progress.
+func (c *Chip8) Halted() bool {
+	return c.paused && !c.stepping
+}
+
+// Do runs fn on the goroutine running the emulator, between instructions,
+// and waits for it to return. Debuggers on other goroutines use it to
+// inspect and control the emulator safely while it runs.
+func (c *Chip8) Do(fn func()) {
+	done := make(chan struct{})
+	c.calls <- func() {
+		fn()
+		close(done)
+	}
+	<-done
+}
+
+// runCalls runs the functions passed to Do since it was last called.
+func (c *Chip8) runCalls() {
+	for {
+		select {
+		case fn := <-c.calls:
+			fn()
+		default:
+			return
+		}
+	}
+}
+
+// Step executes a single instruction while paused.
+func (c *Chip8) Step() {
+	if c.paused {
+		c.stepping = true
+	}
+}
+
+// StepOver executes a single instruction while paused, unless it is a CALL,
+// in which case execution continues until the subroutine returns.
+func (c *Chip8) StepOver() {
+	if !c.paused {
+		return
+	}
+	op := c.instructionAt(c.cpu.pc)
+	if op&0xF000 != 0x2000 {
+		c.Step()
+		return
+	}
+
+	c.stepOver = true
+	c.stepOverPC = c.cpu.pc + 2
+	c.stepOverSP = c.cpu.sp
+	c.paused = false
+}
+
+// StepOut continues execution while paused until the subroutine being
+// executed returns, and reports whether one is: at the top level, with an
+// empty stack, there is nothing to step out of.
+func (c *Chip8) StepOut() bool {
+	if !c.paused || c.cpu.sp == 0 {
+		return false
+	}
+
+	c.stepOver = true
+	c.stepOverPC = c.cpu.stack[c.cpu.sp-1]
+	c.stepOverSP = c.cpu.sp - 1
+	c.paused = false
+
+	return true
+}
+
+// SkipInstruction moves PC past the instruction at PC without executing it,
+// while paused. It gets execution past an invalid opcode.
+func (c *Chip8) SkipInstruction() {
+	if c.paused {
+		c.cpu.pc += 2
+		c.skipBreak = false
+		c.stopReason = ""
+	}
+}
+
+// AdvanceFrame runs until the next frame is presented while paused.
+func (c *Chip8) AdvanceFrame() {
+	if c.paused {
+		c.paused = false
+		c.frameStep = true
+	}
+}
+
+// instructionAt returns the instruction stored at addr.
+func (c *Chip8) instructionAt(addr uint16) Opcode {
+	if int(addr)+1 >= len(c.mem) {
+		return 0
+	}
+
+	return Opcode(uint16(c.mem[addr])<<8 | uint16(c.mem[addr+1]))
+}
+
+// hitBreakpoint pauses execution if there is a breakpoint at PC, or a
+// conditional one whose condition is true, or a CALL being stepped over has
+// returned, and reports whether it did. Resuming, or stepping, from a
+// breakpoint executes its instruction rather than stopping there again.
+func (c *Chip8) hitBreakpoint() bool {
+	if c.skipBreak {
+		c.skipBreak = false
+		return false
+	}
+	if c.stepOver && c.cpu.pc == c.stepOverPC && c.cpu.sp == c.stepOverSP {
+		c.stepOver = false
+		c.paused = true
+		return true
+	}
+	var cond Condition
+	hit := c.breakpoints[c.cpu.pc]
+	if !hit && len(c.conditions) > 0 {
+		cond, hit = c.hitConditionalBreakpoint()
+	}
+	if !hit {
+		return false
+	}
+
+	c.paused = true
+	c.stepping = false
+	c.stepOver = false
+	c.frameStep = false
+	c.skipBreak = true
+	c.stopReason = fmt.Sprintf("Breakpoint at %#04x", c.cpu.pc)
+	if cond.AtAddr {
+		c.stopReason += " if " + cond.expr()
+	}
+	c.log.Infof("Breakpoint hit: %s", c.stopReason)
+
+	return true
+}
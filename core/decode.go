@@ -0,0 +1,252 @@
+package core
+
+import "fmt"
+
+// opClass is the instruction an opcode decodes to.
+type opClass uint8
+
+const (
+	opInvalid opClass = iota
+	opCLS
+	opRET
+	opSYS
+	opJP
+	opCALL
+	opSEByte
+	opSNEByte
+	opSEReg
+	opLDByte
+	opADDByte
+	opLDReg
+	opOR
+	opAND
+	opXOR
+	opADDReg
+	opSUB
+	opSHR
+	opSUBN
+	opSHL
+	opSNEReg
+	opLDI
+	opJPV0
+	opRND
+	opDRW
+	opSKP
+	opSKNP
+	opLDVDT
+	opLDK
+	opLDDTV
+	opLDSTV
+	opADDI
+	opLDF
+	opLDB
+	opLDIV
+	opLDVI
+	opLDRV
+	opLDVR
+	numOpClasses
+)
+
+// instruction is how an opClass is executed and written in assembly.
+type instruction struct {
+	exec   func(c *Chip8)         // invalidOpcode for instructions the CPU doesn't execute
+	format func(oc Opcode) string // the assembly of the instruction
+}
+
+// opClasses is the opClass of every opcode, so instructions are decoded by a
+// single lookup.
+var opClasses [0x10000]opClass
+
+// instructions is the dispatch table of the CPU and the disassembler, by
+// opClass.
+var instructions [numOpClasses]instruction
+
+func init() {
+	for op := range opClasses {
+		opClasses[op] = decodeOp(Opcode(op))
+	}
+
+	instructions = [numOpClasses]instruction{
+		opInvalid: {(*Chip8).invalidOpcode, func(oc Opcode) string { return fmt.Sprintf("DW %#04x", uint16(oc)) }},
+		opCLS: {func(c *Chip8) {
+			c.cpu.Exec00E0(&c.display)
+			c.drawn = true
+		}, plain("CLS")},
+		opRET:     {func(c *Chip8) { c.cpu.Exec00EE() }, plain("RET")},
+		opSYS:     {(*Chip8).invalidOpcode, addrOperand("SYS")},
+		opJP:      {func(c *Chip8) { c.cpu.Exec1NNN() }, addrOperand("JP")},
+		opCALL:    {func(c *Chip8) { c.cpu.Exec2NNN() }, addrOperand("CALL")},
+		opSEByte:  {func(c *Chip8) { c.cpu.Exec3XNN() }, regByte("SE")},
+		opSNEByte: {func(c *Chip8) { c.cpu.Exec4XNN() }, regByte("SNE")},
+		opSEReg:   {func(c *Chip8) { c.cpu.Exec5XY0() }, regReg("SE")},
+		opLDByte:  {func(c *Chip8) { c.cpu.Exec6XNN() }, regByte("LD")},
+		opADDByte: {func(c *Chip8) { c.cpu.Exec7XNN() }, regByte("ADD")},
+		opLDReg:   {func(c *Chip8) { c.cpu.Exec8XY0() }, regReg("LD")},
+		opOR:      {func(c *Chip8) { c.cpu.Exec8XY1() }, regReg("OR")},
+		opAND:     {func(c *Chip8) { c.cpu.Exec8XY2() }, regReg("AND")},
+		opXOR:     {func(c *Chip8) { c.cpu.Exec8XY3() }, regReg("XOR")},
+		opADDReg:  {func(c *Chip8) { c.cpu.Exec8XY4() }, regReg("ADD")},
+		opSUB:     {func(c *Chip8) { c.cpu.Exec8XY5() }, regReg("SUB")},
+		opSHR:     {func(c *Chip8) { c.cpu.Exec8XY6(c.quirks.Shift) }, regReg("SHR")},
+		opSUBN:    {func(c *Chip8) { c.cpu.Exec8XY7() }, regReg("SUBN")},
+		opSHL:     {func(c *Chip8) { c.cpu.Exec8XYE(c.quirks.Shift) }, regReg("SHL")},
+		opSNEReg:  {func(c *Chip8) { c.cpu.Exec9XY0() }, regReg("SNE")},
+		opLDI:     {func(c *Chip8) { c.cpu.ExecANNN() }, addrOperand("LD I,")},
+		opJPV0:    {func(c *Chip8) { c.cpu.ExecBNNN(c.quirks.Jump) }, addrOperand("JP V0,")},
+		opRND:     {func(c *Chip8) { c.cpu.ExecCXNN() }, regByte("RND")},
+		opDRW: {execDRW, func(oc Opcode) string {
+			return fmt.Sprintf("DRW V%X, V%X, %d", oc.x(), oc.y(), oc.n())
+		}},
+		opSKP:   {func(c *Chip8) { c.cpu.ExecEX9E(c.keys) }, reg("SKP V%X")},
+		opSKNP:  {func(c *Chip8) { c.cpu.ExecEXA1(c.keys) }, reg("SKNP V%X")},
+		opLDVDT: {func(c *Chip8) { c.cpu.ExecFX07() }, reg("LD V%X, DT")},
+		opLDK:   {func(c *Chip8) { c.cpu.ExecFX0A(c.keys, c.quirks.KeyRelease) }, reg("LD V%X, K")},
+		opLDDTV: {func(c *Chip8) { c.cpu.ExecFX15() }, reg("LD DT, V%X")},
+		opLDSTV: {func(c *Chip8) { c.cpu.ExecFX18() }, reg("LD ST, V%X")},
+		opADDI:  {func(c *Chip8) { c.cpu.ExecFX1E() }, reg("ADD I, V%X")},
+		opLDF:   {func(c *Chip8) { c.cpu.ExecFX29() }, reg("LD F, V%X")},
+		opLDB:   {func(c *Chip8) { c.cpu.ExecFX33(c.mem) }, reg("LD B, V%X")},
+		opLDIV:  {func(c *Chip8) { c.cpu.ExecFX55(c.mem, c.quirks.LoadStore) }, reg("LD [I], V%X")},
+		opLDVI:  {func(c *Chip8) { c.cpu.ExecFX65(c.mem, c.quirks.LoadStore) }, reg("LD V%X, [I]")},
+		opLDRV: {func(c *Chip8) {
+			c.cpu.ExecFX75(&c.flags)
+			c.saveFlags()
+		}, reg("LD R, V%X")},
+		opLDVR: {func(c *Chip8) { c.cpu.ExecFX85(&c.flags) }, reg("LD V%X, R")},
+	}
+}
+
+// decodeOp returns the instruction oc is, or opInvalid if it isn't one.
+func decodeOp(oc Opcode) opClass {
+	switch oc & 0xF000 {
+	case 0x0000:
+		switch oc {
+		case 0x00E0:
+			return opCLS
+		case 0x00EE:
+			return opRET
+		}
+		return opSYS
+	case 0x1000:
+		return opJP
+	case 0x2000:
+		return opCALL
+	case 0x3000:
+		return opSEByte
+	case 0x4000:
+		return opSNEByte
+	case 0x5000:
+		if oc.n() == 0 {
+			return opSEReg
+		}
+	case 0x6000:
+		return opLDByte
+	case 0x7000:
+		return opADDByte
+	case 0x8000:
+		switch oc.n() {
+		case 0x0:
+			return opLDReg
+		case 0x1:
+			return opOR
+		case 0x2:
+			return opAND
+		case 0x3:
+			return opXOR
+		case 0x4:
+			return opADDReg
+		case 0x5:
+			return opSUB
+		case 0x6:
+			return opSHR
+		case 0x7:
+			return opSUBN
+		case 0xE:
+			return opSHL
+		}
+	case 0x9000:
+		if oc.n() == 0 {
+			return opSNEReg
+		}
+	case 0xA000:
+		return opLDI
+	case 0xB000:
+		return opJPV0
+	case 0xC000:
+		return opRND
+	case 0xD000:
+		return opDRW
+	case 0xE000:
+		switch oc.nn() {
+		case 0x9E:
+			return opSKP
+		case 0xA1:
+			return opSKNP
+		}
+	case 0xF000:
+		switch oc.nn() {
+		case 0x07:
+			return opLDVDT
+		case 0x0A:
+			return opLDK
+		case 0x15:
+			return opLDDTV
+		case 0x18:
+			return opLDSTV
+		case 0x1E:
+			return opADDI
+		case 0x29:
+			return opLDF
+		case 0x33:
+			return opLDB
+		case 0x55:
+			return opLDIV
+		case 0x65:
+			return opLDVI
+		case 0x75:
+			return opLDRV
+		case 0x85:
+			return opLDVR
+		}
+	}
+
+	return opInvalid
+}
+
+// execDRW draws the sprite of a DXYN, noting the region drawn.
+func execDRW(c *Chip8) {
+	x, y := c.cpu.opcode.x(), c.cpu.opcode.y()
+	c.lastDraw = DrawRegion{
+		X: int(c.cpu.v[x]) % Chip8Width,
+		Y: int(c.cpu.v[y]) % Chip8Height,
+		W: 8,
+		H: int(c.cpu.opcode.n()),
+	}
+	c.cpu.ExecDXYN(c.mem, &c.display)
+	c.drawn = true
+}
+
+// plain formats instructions without operands.
+func plain(mnemonic string) func(Opcode) string {
+	return func(Opcode) string { return mnemonic }
+}
+
+// addrOperand formats instructions taking the address NNN.
+func addrOperand(mnemonic string) func(Opcode) string {
+	return func(oc Opcode) string { return fmt.Sprintf("%s %#03x", mnemonic, oc.nnn()) }
+}
+
+// regByte formats instructions taking VX and the byte NN.
+func regByte(mnemonic string) func(Opcode) string {
+	return func(oc Opcode) string { return fmt.Sprintf("%s V%X, %#02x", mnemonic, oc.x(), oc.nn()) }
+}
+
+// regReg formats instructions taking VX and VY.
+func regReg(mnemonic string) func(Opcode) string {
+	return func(oc Opcode) string { return fmt.Sprintf("%s V%X, V%X", mnemonic, oc.x(), oc.y()) }
+}
+
+// reg formats instructions taking VX, with format taking X.
+func reg(format string) func(Opcode) string {
+	return func(oc Opcode) string { return fmt.Sprintf(format, oc.x()) }
+}
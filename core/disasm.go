@@ -0,0 +1,230 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Disassemble returns the assembly of a Chip-8 instruction, e.g.
+// "LD V1, 0x0a", or a DW directive for words which aren't instructions.
+func Disassemble(op uint16) string {
+	return instructions[opClasses[op]].format(Opcode(op))
+}
+
+// DisassembleAt returns the instruction stored at addr in RAM and its
+// assembly.
+func (c *Chip8) DisassembleAt(addr uint16) (uint16, string) {
+	op := uint16(c.instructionAt(addr))
+	return op, Disassemble(op)
+}
+
+// ListingLine is a line of the listing of a ROM: an instruction, or data
+// bytes.
+type ListingLine struct {
+	Addr   uint16
+	Bytes  []byte
+	Labels []string // names of the address, if it is a label
+	Text   string   // the assembly of an instruction, or .db for data
+}
+
+// ListingOptions configures the listing written by DisassembleROM.
+type ListingOptions struct {
+	Linear  bool              // list every word as an instruction, in order
+	Octo    bool              // write Octo source, which the asm command reassembles
+	Symbols map[uint16]string // names of addresses, instead of generated labels
+}
+
+// DisassembleROM lists the ROM as loaded at 0x200. Instructions are found by
+// following jumps, calls and skips from the entry point; bytes which are
+// never reached are listed as .db data. The targets of jumps and calls are
+// labelled, e.g. L_0x23A, or by their names in opts.Symbols, and referred to
+// by label.
+func DisassembleROM(rom []byte, opts ListingOptions) []ListingLine {
+	start, end := int(programEntryOffset), int(programEntryOffset)+len(rom)
+	w := codeWalker{rom: rom}
+
+	code := make(map[int]uint16)
+	if opts.Linear {
+		for addr := start; addr+1 < end; addr += 2 {
+			code[addr], _ = w.word(addr)
+		}
+	} else {
+		code, _, _ = w.walk(start, true)
+	}
+
+	labels := make(map[int][]string)
+	for _, op := range code {
+		switch op & 0xF000 {
+		case 0x1000, 0x2000, 0xB000:
+			addr := int(op & 0x0FFF)
+			if addr >= start && addr < end && labels[addr] == nil {
+				labels[addr] = []string{fmt.Sprintf("L_0x%03X", addr)}
+			}
+		}
+	}
+	for addr, name := range opts.Symbols {
+		if int(addr) >= start && int(addr) < end {
+			labels[int(addr)] = []string{name}
+		}
+	}
+	if opts.Octo {
+		// Octo starts at main, which must be the entry point.
+		for addr, l := range labels {
+			if addr != start && len(l) > 0 && l[0] == "main" {
+				labels[addr] = []string{fmt.Sprintf("L_0x%03X", addr)}
+			}
+		}
+		if len(labels[start]) == 0 || labels[start][0] != "main" {
+			labels[start] = append([]string{"main"}, labels[start]...)
+		}
+	}
+
+	// Lay the lines out, then refer to the labels which start one.
+	var lines []ListingLine
+	for addr := start; addr < end; {
+		if op, ok := code[addr]; ok {
+			lines = append(lines, ListingLine{Addr: uint16(addr), Bytes: []byte{byte(op >> 8), byte(op)}})
+			addr += 2
+			continue
+		}
+
+		// Data runs until the next instruction or label, 8 bytes a line.
+		from := addr
+		for addr < end && addr-from < 8 {
+			if _, ok := code[addr]; ok || (addr > from && labels[addr] != nil) {
+				break
+			}
+			addr++
+		}
+		lines = append(lines, ListingLine{Addr: uint16(from), Bytes: rom[from-start : addr-start]})
+	}
+
+	names := make(map[uint16]string)
+	for i := range lines {
+		line := &lines[i]
+		if l := labels[int(line.Addr)]; len(l) > 0 {
+			line.Labels = l
+			names[line.Addr] = l[len(l)-1]
+		}
+	}
+	for i := range lines {
+		line := &lines[i]
+		_, isCode := code[int(line.Addr)]
+		switch {
+		case isCode && opts.Octo:
+			line.Text = octoStatement(uint16(line.Bytes[0])<<8|uint16(line.Bytes[1]), names)
+		case isCode:
+			line.Text = disassembleNamed(uint16(line.Bytes[0])<<8|uint16(line.Bytes[1]), names)
+		default:
+			hex := make([]string, len(line.Bytes))
+			for i, b := range line.Bytes {
+				hex[i] = fmt.Sprintf("%#02x", b)
+			}
+			if opts.Octo {
+				line.Text = strings.Join(hex, " ")
+			} else {
+				line.Text = ".db " + strings.Join(hex, ", ")
+			}
+		}
+	}
+
+	return lines
+}
+
+// disassembleNamed returns the assembly of op, referring to its address by
+// name if names has one for it.
+func disassembleNamed(op uint16, names map[uint16]string) string {
+	text := Disassemble(op)
+	switch op & 0xF000 {
+	case 0x1000, 0x2000, 0xA000, 0xB000:
+		if name, ok := names[op&0x0FFF]; ok {
+			return strings.TrimSuffix(text, fmt.Sprintf("%#03x", op&0x0FFF)) + name
+		}
+	}
+
+	return text
+}
+
+// codeWalker follows the control flow of a ROM loaded at 0x200.
+type codeWalker struct {
+	rom        []byte
+	extensions bool // SCHIP and XO-CHIP instructions are code too
+}
+
+// word returns the instruction stored at addr, if it is within the ROM.
+func (w codeWalker) word(addr int) (uint16, bool) {
+	i := addr - int(programEntryOffset)
+	if i < 0 || i+1 >= len(w.rom) {
+		return 0, false
+	}
+
+	return uint16(w.rom[i])<<8 | uint16(w.rom[i+1]), true
+}
+
+// walk returns the instructions reachable from entry, by address, the
+// targets of the calls among them, and the addresses reached which don't hold
+// an instruction. With follow set, the instructions of the subroutines called
+// are included; otherwise only those of the code at entry up to its returns
+// are.
+func (w codeWalker) walk(entry int, follow bool) (code map[int]uint16, calls, invalid []int) {
+	code = make(map[int]uint16)
+
+	pending := []int{entry}
+	for len(pending) > 0 {
+		addr := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for {
+			if _, ok := code[addr]; ok {
+				break
+			}
+			op, ok := w.word(addr)
+			if !ok {
+				break
+			}
+			ext := w.extensions && extensionName(op) != ""
+			if !ext && strings.HasPrefix(Disassemble(op), "DW ") {
+				invalid = append(invalid, addr)
+				break
+			}
+			code[addr] = op
+
+			nnn := int(op & 0x0FFF)
+			switch {
+			case op == 0x00EE, ext && op == 0x00FD:
+				addr = -1 // return, or exit
+			case op&0xF000 == 0x1000:
+				addr = nnn
+			case op&0xF000 == 0x2000:
+				calls = append(calls, nnn)
+				if follow {
+					pending = append(pending, nnn)
+				}
+				addr += 2
+			case op&0xF000 == 0xB000:
+				addr = -1 // the target depends on V0
+			case isSkip(op):
+				pending = append(pending, addr+4)
+				addr += 2
+			case ext && op == 0xF000:
+				addr += 4 // the address loaded follows
+			default:
+				addr += 2
+			}
+		}
+	}
+
+	return code, calls, invalid
+}
+
+// isSkip reports whether op conditionally skips the next instruction.
+func isSkip(op uint16) bool {
+	switch op & 0xF000 {
+	case 0x3000, 0x4000, 0x5000, 0x9000:
+		return true
+	case 0xE000:
+		return op&0xFF == 0x9E || op&0xFF == 0xA1
+	}
+
+	return false
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/n-ulricksen/chip8/asm"
+)
+
+// disasmRom counts V0 up to 5 in a subroutine, then draws a sprite. Between
+// the code and the sprite are bytes never executed, which read as CLS and
+// JP, and as no instruction at all.
+var disasmRom = []byte{
+	0x00, 0xE0, // 200: CLS
+	0xA2, 0x1C, // 202: LD I, 21C
+	0x60, 0x00, // 204: LD V0, 0
+	0x22, 0x14, // 206: CALL 214
+	0x30, 0x05, // 208: SE V0, 5
+	0x12, 0x06, // 20A: JP 206
+	0xD0, 0x15, // 20C: DRW V0, V1, 5
+	0x12, 0x0E, // 20E: JP 20E
+	0x00, 0xE0, // 210: data
+	0x12, 0x34, // 212: data
+	0x70, 0x01, // 214: ADD V0, 1
+	0x00, 0xEE, // 216: RET
+	0xFF, 0xFF, 0x00, 0x00, // 218: data
+	0xF0, 0x90, 0x90, 0x90, 0xF0, // 21C: sprite
+}
+
+// listing formats lines the way the disasm command does.
+func listing(lines []ListingLine) string {
+	var b strings.Builder
+	for _, line := range lines {
+		for _, label := range line.Labels {
+			fmt.Fprintf(&b, "%s:\n", label)
+		}
+		fmt.Fprintf(&b, "%04X  % X  %s\n", line.Addr, line.Bytes, line.Text)
+	}
+
+	return b.String()
+}
+
+func TestDisassembleROM(t *testing.T) {
+	lines := DisassembleROM(disasmRom, ListingOptions{})
+
+	golden := filepath.Join("testdata", "golden", "disasm.txt")
+	got := listing(lines)
+	if *update {
+		if err := ioutil.WriteFile(golden, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v; run go test -run TestDisassembleROM -update to write it", err)
+	}
+	if got != string(want) {
+		t.Errorf("listing differs from %s:\n%s\nwant:\n%s", golden, got, want)
+	}
+
+	byAddr := make(map[uint16]ListingLine)
+	for _, line := range lines {
+		byAddr[line.Addr] = line
+	}
+	// Jump and call targets are labelled, and referred to by label.
+	for addr, text := range map[uint16]string{0x206: "CALL L_0x214", 0x20A: "JP L_0x206", 0x20E: "JP L_0x20E"} {
+		if line := byAddr[addr]; line.Text != text {
+			t.Errorf("%#04x: %q, want %q", addr, line.Text, text)
+		}
+	}
+	for _, addr := range []uint16{0x206, 0x20E, 0x214} {
+		if line := byAddr[addr]; len(line.Labels) != 1 || line.Labels[0] != fmt.Sprintf("L_0x%03X", addr) {
+			t.Errorf("%#04x: labels %q, want L_0x%03X", addr, line.Labels, addr)
+		}
+	}
+	// Bytes never reached aren't decoded, however they read.
+	for _, addr := range []uint16{0x210, 0x218, 0x220} {
+		if line := byAddr[addr]; !strings.HasPrefix(line.Text, ".db ") {
+			t.Errorf("%#04x: %q, want data", addr, line.Text)
+		}
+	}
+	if line, ok := byAddr[0x212]; ok {
+		t.Errorf("%#04x: %q, want it within the data at 0x210", line.Addr, line.Text)
+	}
+}
+
+func TestDisassembleROMSymbols(t *testing.T) {
+	lines := DisassembleROM(disasmRom, ListingOptions{Symbols: map[uint16]string{0x214: "count", 0x21C: "digit"}})
+
+	var text []string
+	for _, line := range lines {
+		text = append(text, line.Text)
+	}
+	got := strings.Join(text, "\n")
+	for _, want := range []string{"CALL count", "LD I, digit"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("listing lacks %q:\n%s", want, listing(lines))
+		}
+	}
+}
+
+// TestDisassembleROMOcto checks the Octo listing reassembles into the ROM.
+func TestDisassembleROMOcto(t *testing.T) {
+	var src strings.Builder
+	for _, line := range DisassembleROM(disasmRom, ListingOptions{Octo: true}) {
+		for _, label := range line.Labels {
+			fmt.Fprintf(&src, ": %s\n", label)
+		}
+		fmt.Fprintf(&src, "\t%s\n", line.Text)
+	}
+
+	rom, _, err := asm.Assemble([]byte(src.String()))
+	if err != nil {
+		t.Fatalf("%v, assembling:\n%s", err, src.String())
+	}
+	if !bytes.Equal(rom, disasmRom) {
+		t.Errorf("reassembled % X, want % X, from:\n%s", rom, disasmRom, src.String())
+	}
+}
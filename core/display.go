@@ -1,36 +1,92 @@
 package core
 
 import (
-	"log"
-
-	"github.com/veandco/go-sdl2/sdl"
+	"image"
+	"image/color"
 )
 
 const (
-	VBlankFreq     = 60
-	Chip8Width     = 64
-	Chip8Height    = 32
-	DisplayScale   = 10
-	EmulatorWidth  = Chip8Width * DisplayScale
-	EmulatorHeight = Chip8Height * DisplayScale
-	DebugHeight    = 256
+	VBlankFreq  = 60
+	Chip8Width  = 64
+	Chip8Height = 32
 )
 
-func NewDisplayRenderer(debug bool) *sdl.Renderer {
-	height := int32(EmulatorHeight)
-	if debug {
-		height += DebugHeight
+// displayBuffer holds whether each display pixel is lit, row by row.
+type displayBuffer [Chip8Width * Chip8Height]uint8
+
+// Colors used to draw lit and unlit display pixels, unless others are set
+// through Options.
+var (
+	foreground = color.RGBA{R: 0, G: 255, B: 200, A: 255}
+	background = color.RGBA{R: 0, G: 0, B: 0, A: 255}
+)
+
+// SetPalette sets the colors lit and unlit pixels are drawn with from the
+// next frame. The default colors are used for those left unset, with an
+// alpha of 0.
+func (c *Chip8) SetPalette(fg, bg color.RGBA) {
+	c.fg, c.bg = foreground, background
+	if fg.A != 0 {
+		c.fg = fg
+	}
+	if bg.A != 0 {
+		c.bg = bg
 	}
+	c.repaint = true
+}
+
+// Palette returns the colors lit and unlit display pixels are drawn with.
+func (c *Chip8) Palette() (fg, bg color.RGBA) {
+	return c.fg, c.bg
+}
 
-	window, err := sdl.CreateWindow("Chip-8 Emulator", sdl.WINDOWPOS_UNDEFINED,
-		sdl.WINDOWPOS_UNDEFINED, EmulatorWidth, height, sdl.WINDOW_SHOWN)
-	if err != nil {
-		log.Fatal("NewDisplayRenderer error:", err)
+// Pixels returns the RGBA color of each display pixel for the frame being
+// rendered, row by row. The slice is reused for every frame, so it must not
+// be modified or kept; use Frame or FrameRGBA to hold on to a frame.
+func (c *Chip8) Pixels() []byte {
+	return c.pixels
+}
+
+// FrameChanged reports whether the frame being rendered differs from the
+// previous one, so frontends can skip redrawing an unchanged display. Run
+// by RunConcurrently, it reports whether any frame since the frontend last
+// rendered did.
+func (c *Chip8) FrameChanged() bool {
+	return c.changed || c.unseen
+}
+
+// Frame returns a copy of the last rendered frame, with one image pixel per
+// Chip-8 pixel, for programs embedding the emulator to draw in their own UI.
+func (c *Chip8) Frame() image.Image {
+	return c.displayImage(1)
+}
+
+// FrameRGBA copies the RGBA pixels of the last rendered frame into dst,
+// reallocating it if it is too small, and returns it. Passing the previous
+// result back in avoids allocating a buffer per frame.
+func (c *Chip8) FrameRGBA(dst []byte) []byte {
+	if cap(dst) < len(c.pixels) {
+		dst = make([]byte, len(c.pixels))
 	}
+	dst = dst[:len(c.pixels)]
+	copy(dst, c.pixels)
 
-	renderer, err := sdl.CreateRenderer(window, -1, sdl.RENDERER_PRESENTVSYNC)
+	return dst
+}
 
-	window.Show()
+// updatePixels converts the brightness of each display pixel into its RGBA
+// color in the pixels buffer.
+func (c *Chip8) updatePixels() {
+	for i, level := range c.levels {
+		c.pixels[i*4+0] = blend(c.bg.R, c.fg.R, level)
+		c.pixels[i*4+1] = blend(c.bg.G, c.fg.G, level)
+		c.pixels[i*4+2] = blend(c.bg.B, c.fg.B, level)
+		c.pixels[i*4+3] = 255
+	}
+}
 
-	return renderer
+// blend mixes the from and to color components, where a level of 0 gives
+// from and 255 gives to.
+func blend(from, to, level uint8) uint8 {
+	return uint8((int(from)*(255-int(level)) + int(to)*int(level)) / 255)
 }
@@ -0,0 +1,105 @@
+package core
+
+import "fmt"
+
+// Display filters which can be enabled through Options.Filters.
+const (
+	// FilterPhosphor fades pixels out over a few frames instead of snapping
+	// them off, like the persistence of a CRT's phosphor coating. This hides
+	// most of the flicker caused by games erasing and redrawing sprites.
+	FilterPhosphor = "phosphor"
+
+	// FilterCRT darkens alternate scanlines, shades the edges of the screen
+	// and rounds its corners for the look of an old CRT television. It is
+	// drawn by frontends which scale the display, such as the SDL window.
+	FilterCRT = "crt"
+
+	// FilterBlend mixes each frame with the previous one, so sprites that
+	// games draw only every other frame show steadily at partial brightness
+	// instead of flickering.
+	FilterBlend = "blend"
+)
+
+var knownFilters = map[string]bool{
+	FilterPhosphor: true,
+	FilterCRT:      true,
+	FilterBlend:    true,
+}
+
+const (
+	// phosphorDecay is how much a pixel's brightness drops each frame after
+	// it has been turned off.
+	phosphorDecay = 96
+
+	// blendWeight is the brightness (0-255) contributed by a pixel lit in
+	// the previous frame when blending; the current frame contributes the
+	// rest.
+	blendWeight = 128
+)
+
+// parseFilters validates the filter names and returns them as a set.
+func parseFilters(names []string) (map[string]bool, error) {
+	filters := make(map[string]bool)
+	for _, name := range names {
+		if !knownFilters[name] {
+			return nil, fmt.Errorf("unknown display filter %q", name)
+		}
+		filters[name] = true
+	}
+
+	return filters, nil
+}
+
+// HasFilter reports whether the named display filter is enabled.
+func (c *Chip8) HasFilter(name string) bool {
+	return c.filters[name]
+}
+
+// updatePixelLevels computes the brightness (0-255) each display pixel is
+// drawn with in the current frame, and reports whether any of them changed.
+// Only CLS and DXYN modify the display, so the work is skipped on frames
+// without them unless pixels are still fading out or being blended.
+func (c *Chip8) updatePixelLevels() bool {
+	if !c.drawn && !c.fading {
+		return false
+	}
+	c.drawn = false
+
+	changed, fading := false, false
+	for i, px := range c.display {
+		level := c.levels[i]
+		switch {
+		case px != 0:
+			level = 255
+		case c.filters[FilterPhosphor] && level > phosphorDecay:
+			level -= phosphorDecay
+		default:
+			level = 0
+		}
+
+		if c.filters[FilterBlend] {
+			var blended uint8
+			if px != 0 {
+				blended += 255 - blendWeight
+			}
+			if c.prevframe[i] != 0 {
+				blended += blendWeight
+			}
+			if !c.filters[FilterPhosphor] || blended > level {
+				level = blended
+			}
+		}
+
+		if level != c.levels[i] {
+			c.levels[i] = level
+			changed = true
+		}
+		if level != 0 && level != 255 {
+			fading = true
+		}
+	}
+	c.fading = fading
+	copy(c.prevframe, c.display[:])
+
+	return changed
+}
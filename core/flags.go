@@ -0,0 +1,44 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// numFlags is the number of RPL user flags saved and loaded by FX75 and
+// FX85: 8 on the HP48 calculators SUPER-CHIP ran on, 16 with XO-CHIP.
+const numFlags = 16
+
+// SetFlagsFile keeps the RPL user flags in the file at path, loading those
+// saved to it before and saving them again whenever FX75 changes them, so
+// games saving high scores in them keep them across sessions.
+func (c *Chip8) SetFlagsFile(path string) error {
+	c.flagsPath = path
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	copy(c.flags[:], data)
+
+	return nil
+}
+
+// saveFlags writes the RPL user flags to their file, if they have one.
+func (c *Chip8) saveFlags() {
+	if c.flagsPath == "" {
+		return
+	}
+
+	err := os.MkdirAll(filepath.Dir(c.flagsPath), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(c.flagsPath, c.flags[:], 0644)
+	}
+	if err != nil {
+		c.log.Errorf("Unable to save flags: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// gifRecorder collects display frames into an animated GIF. Consecutive
+// identical frames are merged into one longer frame.
+type gifRecorder struct {
+	path   string // file the recording is saved to
+	scale  int
+	anim   gif.GIF
+	starts []int   // frame number each GIF frame started at
+	frames int     // number of display frames recorded
+	last   []uint8 // pixel levels of the last GIF frame
+
+	palette color.Palette // color of each pixel brightness level
+}
+
+// newGifRecorder starts a recording, to be saved to path, where each Chip-8
+// pixel is drawn as a scale*scale square in the colors fg and bg.
+func newGifRecorder(path string, scale int, fg, bg color.RGBA) *gifRecorder {
+	return &gifRecorder{path: path, scale: scale, palette: gifPalette(fg, bg), last: make([]uint8, Chip8Width*Chip8Height)}
+}
+
+// gifPalette maps each pixel brightness level to its color, blending bg
+// into fg, so filtered frames are recorded exactly as they were displayed.
+func gifPalette(fg, bg color.RGBA) color.Palette {
+	palette := make(color.Palette, 256)
+	for level := range palette {
+		l := uint8(level)
+		palette[level] = color.RGBA{
+			R: blend(bg.R, fg.R, l),
+			G: blend(bg.G, fg.G, l),
+			B: blend(bg.B, fg.B, l),
+			A: 255,
+		}
+	}
+
+	return palette
+}
+
+// addFrame records a display frame, given as the brightness of each pixel.
+func (r *gifRecorder) addFrame(levels []uint8) {
+	r.frames++
+	if len(r.anim.Image) > 0 && bytes.Equal(levels, r.last) {
+		return
+	}
+	copy(r.last, levels)
+
+	if r.anim.Config.ColorModel == nil {
+		r.anim.Config = image.Config{
+			ColorModel: r.palette,
+			Width:      Chip8Width * r.scale,
+			Height:     Chip8Height * r.scale,
+		}
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, Chip8Width*r.scale, Chip8Height*r.scale),
+		r.anim.Config.ColorModel.(color.Palette))
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			img.Pix[img.PixOffset(x, y)] = levels[(y/r.scale)*Chip8Width+x/r.scale]
+		}
+	}
+
+	r.anim.Image = append(r.anim.Image, img)
+	r.starts = append(r.starts, r.frames-1)
+}
+
+// save writes the recording to its file. Frame delays are computed from the
+// frame numbers, as GIF delays are in hundredths of a second.
+func (r *gifRecorder) save() error {
+	if len(r.anim.Image) == 0 {
+		return fmt.Errorf("no frames recorded")
+	}
+
+	centis := func(frame int) int { return frame * 100 / VBlankFreq }
+	r.anim.Delay = make([]int, len(r.anim.Image))
+	for i, start := range r.starts {
+		end := r.frames
+		if i+1 < len(r.starts) {
+			end = r.starts[i+1]
+		}
+		r.anim.Delay[i] = centis(end) - centis(start)
+	}
+
+	f, err := os.Create(r.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return gif.EncodeAll(f, &r.anim)
+}
+
+// ToggleRecording starts recording the display to a timestamped GIF in dir,
+// with each Chip-8 pixel drawn as a scale*scale square, or stops and saves the
+// recording in progress.
+func (c *Chip8) ToggleRecording(dir string, scale int) error {
+	if c.recorder != nil {
+		return c.stopRecording()
+	}
+
+	if scale < 1 {
+		scale = 1
+	}
+	name := fmt.Sprintf("chip8-%s.gif", time.Now().Format("20060102-150405.000"))
+	c.recorder = newGifRecorder(filepath.Join(dir, name), scale, c.fg, c.bg)
+	c.log.Infof("Recording started")
+
+	return nil
+}
+
+// stopRecording saves the GIF recording in progress.
+func (c *Chip8) stopRecording() error {
+	rec := c.recorder
+	c.recorder = nil
+
+	if err := rec.save(); err != nil {
+		return err
+	}
+
+	c.log.Infof("Saved recording to %s", rec.path)
+	return nil
+}
@@ -0,0 +1,296 @@
+package core
+
+import (
+	"crypto/sha1"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "Rewrite the golden images of TestGolden with the displays of this run")
+
+// timendusURL is where the ROMs of Timendus' test suite are fetched from.
+// They are GPLv3 licensed, so rather than committed here they are fetched
+// when the tests run, and cached in timendusCache.
+const timendusURL = "https://raw.githubusercontent.com/Timendus/chip8-test-suite/v4.1/bin/"
+
+// goldenTests are the ROMs which are run headlessly, and whose displays are
+// compared against the images of the same name in testdata/golden. ROMs
+// ending in .8o are in testdata/roms, and assembled first. Those in timendus/
+// are fetched from timendusURL, and checked against their sha1.
+//
+// Run go test -run TestGolden -update to rewrite the golden images.
+var goldenTests = []struct {
+	rom    string
+	sha1   string
+	frames uint64
+	keys   map[uint64]uint8 // keys pressed at frames, released the next
+
+	// known are the parts of the display showing tests known to fail, by
+	// test. They are left out of the golden image and the comparison, so
+	// fixing them doesn't need the image rewritten.
+	known map[string]image.Rectangle
+}{
+	{rom: "font.8o", frames: 120},
+	{rom: "flags.8o", frames: 120},
+	{rom: "timendus/1-chip8-logo.ch8", sha1: "30f27e5cee5b325fd1681ee98a14de60bfbe951f", frames: 60},
+	{rom: "timendus/2-ibm-logo.ch8", sha1: "b9bbc12cee3f7b9d3b1f69161f7d7a2d86953379", frames: 60},
+	{rom: "timendus/3-corax+.ch8", sha1: "b2dacf6d85785d6c2315ce449912c8a8a5954e2e", frames: 120},
+	{rom: "timendus/4-flags.ch8", sha1: "55a6716dacc2f93dce3d39fb8d231083016a1cc0", frames: 120},
+	{
+		rom: "timendus/5-quirks.ch8", sha1: "e2149cb836131a142ca7e2dc2f2283381ae5faaa", frames: 600,
+		keys: map[uint64]uint8{60: 0x1}, // CHIP-8
+		known: map[string]image.Rectangle{
+			"vF reset":     image.Rect(0, 0, Chip8Width, 5),
+			"memory":       image.Rect(0, 5, Chip8Width, 10),
+			"display wait": image.Rect(0, 10, Chip8Width, 15),
+			"clipping":     image.Rect(0, 15, Chip8Width, 20),
+		},
+	},
+}
+
+// timendusCache is the directory the ROMs of Timendus' test suite are cached
+// in, $CHIP8_TEST_ROMS if set.
+func timendusCache() (string, error) {
+	if dir := os.Getenv("CHIP8_TEST_ROMS"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "gochip8", "timendus-v4.1"), nil
+}
+
+// fetchTimendus returns the ROM of Timendus' test suite named name, from
+// the cache or else timendusURL. The test is skipped if it can't be
+// fetched, as when offline or run with -short.
+func fetchTimendus(t *testing.T, name, sum string) []byte {
+	dir, err := timendusCache()
+	if err != nil {
+		t.Skipf("no cache directory for the test suite: %v", err)
+	}
+	path := filepath.Join(dir, name)
+
+	rom, err := ioutil.ReadFile(path)
+	if err == nil {
+		if got := fmt.Sprintf("%x", sha1.Sum(rom)); got != sum {
+			t.Fatalf("%s has sha1 %s, expected %s; delete it to fetch it again", path, got, sum)
+		}
+		return rom
+	}
+	if testing.Short() {
+		t.Skipf("%s isn't cached, and -short doesn't fetch it", name)
+	}
+
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(timendusURL + name)
+	if err != nil {
+		t.Skipf("unable to fetch %s: %v", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Skipf("unable to fetch %s: %s", name, resp.Status)
+	}
+	if rom, err = ioutil.ReadAll(resp.Body); err != nil {
+		t.Skipf("unable to fetch %s: %v", name, err)
+	}
+	if got := fmt.Sprintf("%x", sha1.Sum(rom)); got != sum {
+		t.Fatalf("%s fetched with sha1 %s, expected %s", timendusURL+name, got, sum)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return rom
+}
+
+// mask unlights the pixels of display within the rectangles.
+func mask(display *displayBuffer, rects map[string]image.Rectangle) {
+	for _, r := range rects {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				display[y*Chip8Width+x] = 0
+			}
+		}
+	}
+}
+
+// goldenFrontend stops the emulator after a number of frames, pressing keys
+// along the way.
+type goldenFrontend struct {
+	frames uint64
+	keys   map[uint64]uint8
+}
+
+func (fe *goldenFrontend) Render(c *Chip8) {
+	if frames, _ := c.Counters(); frames+1 >= fe.frames || c.Halted() {
+		c.Stop()
+	}
+}
+
+func (fe *goldenFrontend) PollEvents(c *Chip8) {
+	frames, _ := c.Counters()
+	if key, ok := fe.keys[frames]; ok {
+		c.SetKey(key, true)
+	}
+	if key, ok := fe.keys[frames-1]; ok && frames > 0 {
+		c.SetKey(key, false)
+	}
+}
+
+func (fe *goldenFrontend) Close() {}
+
+func TestGolden(t *testing.T) {
+	for _, tt := range goldenTests {
+		tt := tt
+		t.Run(tt.rom, func(t *testing.T) {
+			var rom []byte
+			if name := strings.TrimPrefix(tt.rom, "timendus/"); name != tt.rom {
+				rom = fetchTimendus(t, name, tt.sha1)
+			} else {
+				var err error
+				if rom, err = ReadRom(filepath.Join("testdata", "roms", tt.rom)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c, err := NewChip8(Options{Seed: 1, Unpaced: true, Deterministic: true, Logger: NewLogger(ioutil.Discard, LogError)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.LoadRomData(rom); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Run(&goldenFrontend{frames: tt.frames, keys: tt.keys}); err != nil {
+				t.Fatal(err)
+			}
+			if c.Halted() {
+				t.Errorf("stopped early: %s", c.StopReason())
+			}
+
+			var known []string
+			for test := range tt.known {
+				known = append(known, test)
+			}
+			sort.Strings(known)
+			for _, test := range known {
+				t.Logf("%s is known to fail, and left out of the comparison", test)
+			}
+			mask(&c.display, tt.known)
+
+			golden := filepath.Join("testdata", "golden", strings.TrimSuffix(tt.rom, filepath.Ext(tt.rom))+".png")
+			if *update {
+				if err := writeGolden(golden, &c.display); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := readGolden(golden)
+			if err != nil {
+				t.Fatalf("%v; run go test -run TestGolden -update to write it", err)
+			}
+			mask(want, tt.known)
+			if diff := displayDiff(&c.display, want); diff != "" {
+				t.Errorf("display after %d frames differs from %s (+ lit only now, - lit only in the golden image):\n%s", tt.frames, golden, diff)
+			}
+		})
+	}
+}
+
+// writeGolden writes display to path as a PNG, a pixel per Chip-8 pixel.
+func writeGolden(path string, display *displayBuffer) error {
+	img := image.NewGray(image.Rect(0, 0, Chip8Width, Chip8Height))
+	for i, lit := range display {
+		if lit != 0 {
+			img.Pix[i] = 0xFF
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// readGolden reads the display written to path by writeGolden.
+func readGolden(path string) (*displayBuffer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if b := img.Bounds(); b.Dx() != Chip8Width || b.Dy() != Chip8Height {
+		return nil, fmt.Errorf("%s is %dx%d, not %dx%d", path, b.Dx(), b.Dy(), Chip8Width, Chip8Height)
+	}
+
+	var display displayBuffer
+	b := img.Bounds()
+	for y := 0; y < Chip8Height; y++ {
+		for x := 0; x < Chip8Width; x++ {
+			if color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray).Y >= 0x80 {
+				display[y*Chip8Width+x] = 1
+			}
+		}
+	}
+
+	return &display, nil
+}
+
+// displayDiff renders the differences between the displays got and want,
+// a character per pixel, or returns "" if they are the same.
+func displayDiff(got, want *displayBuffer) string {
+	var sb strings.Builder
+	differ := false
+	for y := 0; y < Chip8Height; y++ {
+		for x := 0; x < Chip8Width; x++ {
+			g, w := got[y*Chip8Width+x] != 0, want[y*Chip8Width+x] != 0
+			switch {
+			case g && w:
+				sb.WriteByte('#')
+			case g:
+				sb.WriteByte('+')
+				differ = true
+			case w:
+				sb.WriteByte('-')
+				differ = true
+			default:
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	if !differ {
+		return ""
+	}
+
+	return sb.String()
+}
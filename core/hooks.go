@@ -0,0 +1,25 @@
+package core
+
+// OnFrame makes fn be called after each frame is presented, on the
+// goroutine running the emulator, where it may freely inspect and change
+// it. Scripts use it to drive input and overlays frame by frame.
+func (c *Chip8) OnFrame(fn func()) {
+	c.frameHooks = append(c.frameHooks, fn)
+}
+
+// OnInstruction makes fn be called with the address and opcode of each
+// instruction about to be executed, on the goroutine running the emulator.
+func (c *Chip8) OnInstruction(fn func(addr, op uint16)) {
+	c.instructionHooks = append(c.instructionHooks, fn)
+}
+
+// SetOverlay sets text for frontends to show over the display, or hides it
+// when empty.
+func (c *Chip8) SetOverlay(text string) {
+	c.overlay = text
+}
+
+// Overlay returns the text set to be shown over the display.
+func (c *Chip8) Overlay() string {
+	return c.overlay
+}
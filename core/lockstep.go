@@ -0,0 +1,49 @@
+package core
+
+// Lockstep keeps the keypads of emulators running the same ROM on several
+// machines in step, so two players can play a game together over a
+// network. Every frame each machine sends the keys held on it and the others
+// wait for them, so as long as the emulators start from the same state with
+// the same seed, they go through the same states.
+type Lockstep interface {
+	// Exchange sends the keys held on this machine, a bit each, and the
+	// StateHash of the frame just ended, and returns the keys to be held
+	// during the next frame, those held on every machine combined.
+	Exchange(keys uint16, hash uint64) (uint16, error)
+
+	// Close ends the lockstep, letting the other machines go on alone.
+	Close() error
+}
+
+// syncKeys exchanges the keypad with the other machines of the lockstep at
+// the end of a frame, and applies the keys they hold together. If the
+// exchange fails, the emulator carries on with the local keypad alone.
+func (c *Chip8) syncKeys() {
+	c.release()
+	keys, err := c.lockstep.Exchange(c.localKeys, c.hasher.sum(c))
+	c.acquire()
+	if err != nil {
+		c.log.Errorf("Netplay ended: %v", err)
+		c.lockstep.Close()
+		c.lockstep = nil
+		keys = c.localKeys
+	}
+
+	for key := uint8(0); key < 16; key++ {
+		pressed := keys&(1<<key) != 0
+		if pressed != (c.syncedKeys&(1<<key) != 0) {
+			c.pressKey(key, pressed)
+		}
+	}
+	c.syncedKeys = keys
+}
+
+// setLocalKey records a key pressed or released on this machine, to be sent
+// to the others of the lockstep at the end of the frame.
+func (c *Chip8) setLocalKey(key uint8, pressed bool) {
+	if pressed {
+		c.localKeys |= 1 << key
+	} else {
+		c.localKeys &^= 1 << key
+	}
+}
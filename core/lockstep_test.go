@@ -0,0 +1,107 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+// pipeLockstep is one end of a Lockstep between two emulators in the same
+// process, made by newPipeLocksteps.
+type pipeLockstep struct {
+	out       chan<- [2]uint64 // keys and hash sent to the other end
+	in        <-chan [2]uint64
+	closeOnce sync.Once
+	err       error // the states of the two ends first differing
+}
+
+// newPipeLocksteps returns the two ends of a Lockstep without any delay.
+func newPipeLocksteps() (*pipeLockstep, *pipeLockstep) {
+	ab, ba := make(chan [2]uint64, 1), make(chan [2]uint64, 1)
+	return &pipeLockstep{out: ab, in: ba}, &pipeLockstep{out: ba, in: ab}
+}
+
+func (l *pipeLockstep) Exchange(keys uint16, hash uint64) (uint16, error) {
+	l.out <- [2]uint64{uint64(keys), hash}
+	m, ok := <-l.in
+	if !ok {
+		return 0, errors.New("the other side left")
+	}
+	if m[1] != hash {
+		l.err = fmt.Errorf("state hash %016x, the other side %016x", hash, m[1])
+		return 0, l.err
+	}
+
+	return keys | uint16(m[0]), nil
+}
+
+func (l *pipeLockstep) Close() error {
+	l.closeOnce.Do(func() { close(l.out) })
+	return nil
+}
+
+// lockstepRom starts the delay timer, then loops reading it, drawing random
+// numbers and counting in V4 the instructions run while key 5 is held.
+var lockstepRom = []byte{
+	0x60, 0xFF, // LD V0, 0xFF
+	0xF0, 0x15, // LD DT, V0
+	0xF1, 0x07, // LD V1, DT
+	0xC2, 0xFF, // RND V2, 0xFF
+	0x63, 0x05, // LD V3, 5
+	0xE3, 0x9E, // SKP V3
+	0x12, 0x10, // JP 0x210
+	0x74, 0x01, // ADD V4, 1
+	0x12, 0x04, // JP 0x204
+}
+
+func TestLockstep(t *testing.T) {
+	const frames = 30
+	ends := [2]*pipeLockstep{}
+	ends[0], ends[1] = newPipeLocksteps()
+	keys := [2]map[uint64]uint8{{10: 0x5}, {20: 0x5}}
+
+	var machines [2]*Chip8
+	var errs [2]error
+	var wg sync.WaitGroup
+	for n := range machines {
+		c, err := NewChip8(Options{Seed: 3, Unpaced: true, Lockstep: ends[n], Logger: NewLogger(ioutil.Discard, LogError)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.LoadRomData(lockstepRom); err != nil {
+			t.Fatal(err)
+		}
+		machines[n] = c
+
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			errs[n] = machines[n].Run(&goldenFrontend{frames: frames, keys: keys[n]})
+		}(n)
+	}
+	wg.Wait()
+
+	for n, end := range ends {
+		if errs[n] != nil {
+			t.Fatalf("machine %d: %v", n, errs[n])
+		}
+		if end.err != nil {
+			t.Errorf("machine %d went out of step: %v", n, end.err)
+		}
+	}
+	a, b := machines[0], machines[1]
+	if a.StateHash() != b.StateHash() {
+		t.Errorf("state hashes differ after %d frames: %016x and %016x", frames, a.StateHash(), b.StateHash())
+	}
+	for n, c := range machines {
+		// The timers tick once a frame, not by the clock.
+		if want := uint8(0xFF - frames); c.cpu.dt != want {
+			t.Errorf("machine %d: DT = %d, want %d", n, c.cpu.dt, want)
+		}
+		if c.cpu.v[4] == 0 {
+			t.Errorf("machine %d: key 5 was never seen held", n)
+		}
+	}
+}
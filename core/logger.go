@@ -0,0 +1,95 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// Logger receives the messages the emulator logs, by level. Applications
+// embedding the emulator pass their own through Options.Logger.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// LogLevel is how important a logged message is.
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota // detail only useful when looking into a problem
+	LogInfo                  // what the emulator is doing, such as files saved
+	LogWarn                  // something may not work as expected
+	LogError                 // something failed
+)
+
+var logLevelNames = map[LogLevel]string{
+	LogDebug: "debug",
+	LogInfo:  "info",
+	LogWarn:  "warn",
+	LogError: "error",
+}
+
+func (l LogLevel) String() string {
+	return logLevelNames[l]
+}
+
+// ParseLogLevel returns the log level called name: debug, info, warn or
+// error.
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range logLevelNames {
+		if name == levelName {
+			return level, nil
+		}
+	}
+
+	return LogInfo, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", name)
+}
+
+// writerLogger is the Logger returned by NewLogger.
+type writerLogger struct {
+	out   *log.Logger
+	level LogLevel
+}
+
+// NewLogger returns a Logger writing the messages at level and above to w,
+// a line each, timestamped and marked with their level. Writes to w are
+// serialized, so it can be shared by goroutines.
+func NewLogger(w io.Writer, level LogLevel) Logger {
+	return &writerLogger{out: log.New(w, "", log.LstdFlags), level: level}
+}
+
+// defaultLogger is used by emulators not given a Logger.
+var defaultLogger = NewLogger(os.Stderr, LogInfo)
+
+func (l *writerLogger) logf(level LogLevel, format string, args []interface{}) {
+	if level < l.level {
+		return
+	}
+	l.out.Printf("%-5s %s", level, fmt.Sprintf(format, args...))
+}
+
+func (l *writerLogger) Debugf(format string, args ...interface{}) {
+	l.logf(LogDebug, format, args)
+}
+
+func (l *writerLogger) Infof(format string, args ...interface{}) {
+	l.logf(LogInfo, format, args)
+}
+
+func (l *writerLogger) Warnf(format string, args ...interface{}) {
+	l.logf(LogWarn, format, args)
+}
+
+func (l *writerLogger) Errorf(format string, args ...interface{}) {
+	l.logf(LogError, format, args)
+}
+
+// Logger returns the Logger the emulator logs to, for the servers and
+// frontends driving it to log to as well.
+func (c *Chip8) Logger() Logger {
+	return c.log
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+)
+
+// movieHeader starts every movie file, followed by its format version.
+const movieHeader = "chip8-movie"
+
+// movieVersion is the version of the movie format written.
+const movieVersion = 1
+
+// movieRecorder writes every keypad change to a movie file, along with what
+// is needed to replay it deterministically: the hash of the ROM and the seed
+// of the random number generator. The file is plain text:
+//
+//	chip8-movie 1
+//	rom <sha1 of the ROM>
+//	seed <seed>
+//	<frame> <cycle> <key> <1 pressed, 0 released>
+//	...
+//
+// cycle counts the instructions executed before the change.
+type movieRecorder struct {
+	file *os.File
+	w    *bufio.Writer
+}
+
+// newMovieRecorder creates the movie file at path and writes its header.
+func newMovieRecorder(path, romHash string, seed int64) (*movieRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &movieRecorder{file: file, w: bufio.NewWriter(file)}
+	fmt.Fprintf(m.w, "%s %d\n", movieHeader, movieVersion)
+	fmt.Fprintf(m.w, "rom %s\n", romHash)
+	fmt.Fprintf(m.w, "seed %d\n", seed)
+
+	return m, nil
+}
+
+// keyChanged records key being pressed or released.
+func (m *movieRecorder) keyChanged(frame, cycle uint64, key uint8, pressed bool) {
+	state := 0
+	if pressed {
+		state = 1
+	}
+	fmt.Fprintf(m.w, "%d %d %X %d\n", frame, cycle, key, state)
+}
+
+// close flushes the recording to disk.
+func (m *movieRecorder) close() error {
+	if err := m.w.Flush(); err != nil {
+		m.file.Close()
+		return err
+	}
+
+	return m.file.Close()
+}
+
+// movieEvent is a keypad change read from a movie file.
+type movieEvent struct {
+	cycle   uint64
+	key     uint8
+	pressed bool
+}
+
+// moviePlayer replays the keypad changes of a movie file.
+type moviePlayer struct {
+	romHash string
+	seed    int64
+	events  []movieEvent
+	next    int // index of the next event to replay
+}
+
+// loadMovie reads the movie file at path, as written by movieRecorder.
+func loadMovie(path string) (*moviePlayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	m := &moviePlayer{}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+
+		var err error
+		switch n {
+		case 1:
+			var version int
+			if _, err = fmt.Sscanf(line, movieHeader+" %d", &version); err != nil {
+				err = fmt.Errorf("not a movie, expected %q", movieHeader+" VERSION")
+			} else if version != movieVersion {
+				err = fmt.Errorf("unsupported version %d", version)
+			}
+		case 2:
+			if _, err = fmt.Sscanf(line, "rom %s", &m.romHash); err != nil {
+				err = fmt.Errorf("expected %q", "rom SHA1")
+			}
+		case 3:
+			if _, err = fmt.Sscanf(line, "seed %d", &m.seed); err != nil {
+				err = fmt.Errorf("expected %q", "seed SEED")
+			}
+		default:
+			var frame uint64
+			var e movieEvent
+			var state int
+			_, err = fmt.Sscanf(line, "%d %d %X %d", &frame, &e.cycle, &e.key, &state)
+			if err != nil || e.key > 0xf || state > 1 {
+				err = fmt.Errorf("invalid key change %q", line)
+			}
+			e.pressed = state == 1
+			m.events = append(m.events, e)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %v", path, n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if m.romHash == "" {
+		return nil, fmt.Errorf("%s: not a movie, the header is missing", path)
+	}
+
+	return m, nil
+}
+
+// replayInput applies the movie's keypad changes due before the next
+// instruction. Once all have been replayed, the keypad is handed back to the
+// frontend.
+func (c *Chip8) replayInput() {
+	m := c.playback
+	for m.next < len(m.events) && m.events[m.next].cycle <= c.cycles {
+		e := m.events[m.next]
+		c.setKey(e.key, e.pressed)
+		m.next++
+	}
+
+	if m.next == len(m.events) {
+		c.playback = nil
+		c.log.Infof("Input replay finished")
+	}
+}
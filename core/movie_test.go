@@ -0,0 +1,160 @@
+package core
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// movieRom counts while key 3 isn't held, and while it is draws the digit
+// of the count across the display, at a random height. What it draws
+// depends on the very instruction the key is pressed at.
+var movieRom = []byte{
+	0x66, 0x03, // 200: LD V6, 3
+	0x75, 0x01, // 202: ADD V5, 1
+	0xE6, 0xA1, // 204: SKNP V6
+	0x12, 0x0A, // 206: JP 20A
+	0x12, 0x02, // 208: JP 202
+	0xF5, 0x29, // 20A: LD F, V5
+	0x87, 0x50, // 20C: LD V7, V5
+	0xD7, 0x85, // 20E: DRW V7, V8, 5
+	0xC8, 0x1F, // 210: RND V8, 0x1F
+	0x12, 0x02, // 212: JP 202
+}
+
+// movieKeys are the keys pressed while recording, by frame.
+var movieKeys = map[uint64]uint8{5: 0x3, 10: 0x3, 21: 0x3}
+
+// recordMovie runs movieRom for frames, pressing movieKeys, and records the
+// input to a movie file in dir. It returns the path of the movie and the
+// emulator, stopped.
+func recordMovie(t *testing.T, dir string, frames uint64) (string, *Chip8) {
+	t.Helper()
+	path := filepath.Join(dir, "test.c8m")
+	c, err := NewChip8(Options{Seed: 5, Unpaced: true, MoviePath: path, Logger: NewLogger(ioutil.Discard, LogError)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadRomData(movieRom); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(&goldenFrontend{frames: frames, keys: movieKeys}); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, c
+}
+
+func TestMovieRecord(t *testing.T) {
+	path, c := recordMovie(t, t.TempDir(), 40)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	header := []string{"chip8-movie 1", "rom " + c.RomHash(), "seed 5"}
+	if len(lines) != len(header)+2*len(movieKeys) || !reflect.DeepEqual(lines[:len(header)], header) {
+		t.Fatalf("recorded:\n%s\nwant the header %q and %d key changes", data, header, 2*len(movieKeys))
+	}
+
+	// The recording reads back as it was written.
+	m, err := loadMovie(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.romHash != c.RomHash() || m.seed != 5 {
+		t.Errorf("loaded rom %s, seed %d, want %s, 5", m.romHash, m.seed, c.RomHash())
+	}
+	var keys []uint8
+	var cycle uint64
+	for i, e := range m.events {
+		if e.pressed != (i%2 == 0) || e.cycle < cycle {
+			t.Errorf("event %d = %+v, want presses and releases alternating, in order", i, e)
+		}
+		if e.pressed {
+			keys = append(keys, e.key)
+		}
+		cycle = e.cycle
+	}
+	if want := []uint8{0x3, 0x3, 0x3}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys pressed %X, want %X", keys, want)
+	}
+}
+
+func TestMoviePlayback(t *testing.T) {
+	dir := t.TempDir()
+	path, recorded := recordMovie(t, dir, 40)
+
+	// The seed is the movie's, and keys pressed by the frontend are ignored.
+	c, err := NewChip8(Options{Seed: 9, Unpaced: true, PlayPath: path, Logger: NewLogger(ioutil.Discard, LogError)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadRomData(movieRom); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(&goldenFrontend{frames: 40, keys: map[uint64]uint8{15: 0x1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.display == (displayBuffer{}) {
+		t.Fatal("nothing drawn replaying the movie")
+	}
+	if diff := displayDiff(&c.display, &recorded.display); diff != "" {
+		t.Errorf("replayed display differs from the recorded one (+ lit only replayed, - lit only recorded):\n%s", diff)
+	}
+	if want, got := recorded.snapshot(), c.snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed state %+v, want %+v", got, want)
+	}
+}
+
+func TestMovieOtherRom(t *testing.T) {
+	path, _ := recordMovie(t, t.TempDir(), 10)
+
+	c, err := NewChip8(Options{Unpaced: true, PlayPath: path, Logger: NewLogger(ioutil.Discard, LogError)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadRomData(append([]byte{0x00, 0xE0}, movieRom...)); err != nil {
+		t.Fatal(err)
+	}
+	err = c.Run(&goldenFrontend{frames: 10})
+	if err == nil || !strings.HasSuffix(err.Error(), "was recorded with a different ROM") {
+		t.Errorf("playing a movie of another ROM: %v, want it refused", err)
+	}
+}
+
+func TestLoadMovieErrors(t *testing.T) {
+	hash := "rom 0123456789abcdef0123456789abcdef01234567\n"
+	tests := []struct {
+		name string
+		data string
+		want string // end of the error
+	}{
+		{"empty", "", "not a movie, the header is missing"},
+		{"header only", "chip8-movie 1\n", "not a movie, the header is missing"},
+		{"other file", "chip8-state 1\n" + hash + "seed 1\n", `line 1: not a movie, expected "chip8-movie VERSION"`},
+		{"no version", "chip8-movie\n" + hash + "seed 1\n", `line 1: not a movie, expected "chip8-movie VERSION"`},
+		{"newer version", "chip8-movie 2\n" + hash + "seed 1\n", "line 1: unsupported version 2"},
+		{"no rom", "chip8-movie 1\nseed 1\n", `line 2: expected "rom SHA1"`},
+		{"bad seed", "chip8-movie 1\n" + hash + "seed x\n", `line 3: expected "seed SEED"`},
+		{"key past F", "chip8-movie 1\n" + hash + "seed 1\n5 40 10 1\n", `line 4: invalid key change "5 40 10 1"`},
+		{"bad state", "chip8-movie 1\n" + hash + "seed 1\n5 40 A 2\n", `line 4: invalid key change "5 40 A 2"`},
+		{"short change", "chip8-movie 1\n" + hash + "seed 1\n5 40\n", `line 4: invalid key change "5 40"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "test.c8m")
+			if err := ioutil.WriteFile(path, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadMovie(path)
+			if err == nil || !strings.HasSuffix(err.Error(), tt.want) {
+				t.Errorf("loadMovie(%q) = %v, want error %q", tt.data, err, tt.want)
+			}
+		})
+	}
+}
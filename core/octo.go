@@ -0,0 +1,104 @@
+package core
+
+import "fmt"
+
+// octoOperators are the Octo operators of the 8XYN instructions, by N.
+var octoOperators = map[uint16]string{
+	0x0: ":=",
+	0x1: "|=",
+	0x2: "&=",
+	0x3: "^=",
+	0x4: "+=",
+	0x5: "-=",
+	0x6: ">>=",
+	0x7: "=-",
+	0xE: "<<=",
+}
+
+// octoFormats are the Octo statements of the FXNN instructions, by NN,
+// taking X.
+var octoFormats = map[uint16]string{
+	0x07: "v%x := delay",
+	0x0A: "v%x := key",
+	0x15: "delay := v%x",
+	0x18: "buzzer := v%x",
+	0x1E: "i += v%x",
+	0x29: "i := hex v%x",
+	0x33: "bcd v%x",
+	0x55: "save v%x",
+	0x65: "load v%x",
+	0x75: "saveflags v%x",
+	0x85: "loadflags v%x",
+}
+
+// octoStatement returns the Octo statement assembling to the instruction op,
+// referring to addresses by name if names has one for them. Skips are
+// written as "if ... then", the statement following them being the next
+// line. Words which aren't instructions are written as bytes.
+func octoStatement(op uint16, names map[uint16]string) string {
+	x, y, n := op>>8&0xF, op>>4&0xF, op&0xF
+	nn, nnn := op&0xFF, op&0x0FFF
+	addr := fmt.Sprintf("%#03x", nnn)
+	if name, ok := names[nnn]; ok {
+		addr = name
+	}
+
+	switch op & 0xF000 {
+	case 0x0000:
+		switch op {
+		case 0x00E0:
+			return "clear"
+		case 0x00EE:
+			return "return"
+		}
+		return "native " + addr
+	case 0x1000:
+		return "jump " + addr
+	case 0x2000:
+		if _, ok := names[nnn]; ok {
+			return addr
+		}
+		return ":call " + addr
+	case 0x3000:
+		return fmt.Sprintf("if v%x != %#02x then", x, nn)
+	case 0x4000:
+		return fmt.Sprintf("if v%x == %#02x then", x, nn)
+	case 0x5000:
+		if n == 0 {
+			return fmt.Sprintf("if v%x != v%x then", x, y)
+		}
+	case 0x6000:
+		return fmt.Sprintf("v%x := %#02x", x, nn)
+	case 0x7000:
+		return fmt.Sprintf("v%x += %#02x", x, nn)
+	case 0x8000:
+		if operator, ok := octoOperators[n]; ok {
+			return fmt.Sprintf("v%x %s v%x", x, operator, y)
+		}
+	case 0x9000:
+		if n == 0 {
+			return fmt.Sprintf("if v%x == v%x then", x, y)
+		}
+	case 0xA000:
+		return "i := " + addr
+	case 0xB000:
+		return "jump0 " + addr
+	case 0xC000:
+		return fmt.Sprintf("v%x := random %#02x", x, nn)
+	case 0xD000:
+		return fmt.Sprintf("sprite v%x v%x %d", x, y, n)
+	case 0xE000:
+		switch nn {
+		case 0x9E:
+			return fmt.Sprintf("if v%x -key then", x)
+		case 0xA1:
+			return fmt.Sprintf("if v%x key then", x)
+		}
+	case 0xF000:
+		if format, ok := octoFormats[nn]; ok {
+			return fmt.Sprintf(format, x)
+		}
+	}
+
+	return fmt.Sprintf("%#02x %#02x", op>>8, nn)
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// profileTop is how many of the hottest addresses a profile report lists.
+const profileTop = 20
+
+// classNames describes each class of instructions, by first hex digit.
+var classNames = [16]string{
+	"CLS/RET/SYS", "JP", "CALL", "SE", "SNE", "SE", "LD", "ADD",
+	"ALU", "SNE", "LD I", "JP V0", "RND", "DRW", "SKP/SKNP", "F misc",
+}
+
+// profiler counts the instructions executed at each address and of each
+// class.
+type profiler struct {
+	addrs   []uint64 // by address, as many as there are bytes of RAM
+	classes [16]uint64
+	total   uint64
+}
+
+// count records the instruction op being executed at addr.
+func (p *profiler) count(addr uint16, op Opcode) {
+	p.addrs[addr]++
+	p.classes[op>>12]++
+	p.total++
+}
+
+// Profiling reports whether executed instructions are being counted.
+func (c *Chip8) Profiling() bool {
+	return c.profile != nil
+}
+
+// WriteProfile writes a report of where execution spent its time: the
+// instructions executed of each class and the top most executed addresses.
+func (c *Chip8) WriteProfile(w io.Writer, top int) error {
+	p := c.profile
+	if p == nil {
+		return fmt.Errorf("profiling is not enabled")
+	}
+	percent := func(n uint64) float64 {
+		if p.total == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(p.total)
+	}
+
+	fmt.Fprintf(w, "Instructions executed: %d\n\nBy class:\n", p.total)
+	for class, n := range p.classes {
+		if n > 0 {
+			fmt.Fprintf(w, "  %XNNN %-12s %12d %6.2f%%\n", class, classNames[class], n, percent(n))
+		}
+	}
+
+	var addrs []uint16
+	for addr, n := range p.addrs {
+		if n > 0 {
+			addrs = append(addrs, uint16(addr))
+		}
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return p.addrs[addrs[i]] > p.addrs[addrs[j]]
+	})
+	if len(addrs) > top {
+		addrs = addrs[:top]
+	}
+
+	fmt.Fprintf(w, "\nHottest addresses:\n")
+	for _, addr := range addrs {
+		n := p.addrs[addr]
+		op, text := c.DisassembleAt(addr)
+		_, err := fmt.Fprintf(w, "  %03X  %04X  %-20s %12d %6.2f%%\n", addr, op, text, n, percent(n))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveProfile writes the profile report to the file at path.
+func (c *Chip8) saveProfile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := c.WriteProfile(file, profileTop); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
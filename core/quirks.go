@@ -0,0 +1,51 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Quirks selects between behaviors that differ among Chip-8 interpreters,
+// which games written for one of them may depend on.
+type Quirks struct {
+	// KeyRelease makes FX0A wait for a key to be pressed and then released,
+	// like the original COSMAC VIP interpreter, instead of returning as soon
+	// as any key is held. Games reading input with FX0A in a loop otherwise
+	// register a single press several times.
+	KeyRelease bool `json:"keyrelease"`
+
+	// Shift makes 8XY6 and 8XYE shift VX in place, ignoring VY, like the
+	// SUPER-CHIP interpreter, instead of storing VY shifted in VX.
+	Shift bool `json:"shift"`
+
+	// Jump makes BNNN jump to NNN plus VX, X being the top digit of NNN,
+	// like the SUPER-CHIP interpreter, instead of NNN plus V0.
+	Jump bool `json:"jump"`
+
+	// LoadStore makes FX55 and FX65 leave I past the last register stored
+	// or loaded, like the original COSMAC VIP interpreter, instead of
+	// leaving it unchanged.
+	LoadStore bool `json:"loadstore"`
+}
+
+// quirkFields maps the names accepted by ParseQuirks to the quirk they set.
+var quirkFields = map[string]func(q *Quirks) *bool{
+	"keyrelease": func(q *Quirks) *bool { return &q.KeyRelease },
+	"shift":      func(q *Quirks) *bool { return &q.Shift },
+	"jump":       func(q *Quirks) *bool { return &q.Jump },
+	"loadstore":  func(q *Quirks) *bool { return &q.LoadStore },
+}
+
+// ParseQuirks returns the Quirks with each of the named quirks enabled.
+func ParseQuirks(names []string) (Quirks, error) {
+	var q Quirks
+	for _, name := range names {
+		field, ok := quirkFields[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return q, fmt.Errorf("unknown quirk %q", name)
+		}
+		*field(&q) = true
+	}
+
+	return q, nil
+}
@@ -0,0 +1,112 @@
+package core
+
+// rewindFrame is a frame recorded for rewinding: the registers as of the
+// frame, and how RAM and the display differed the frame before.
+type rewindFrame struct {
+	cpu   cpuState
+	delta []rewindPatch
+	bytes []byte // holds the old bytes of delta, reused when the frame is recorded over
+}
+
+// rewindPatch is a run of bytes of RAM and the display, addressed as one
+// with the display following RAM, and the values they had the frame before.
+type rewindPatch struct {
+	offset int
+	old    []byte
+}
+
+// rewindBuffer is a ring buffer of the frames most recently executed, each
+// holding only the bytes it changed, so several seconds fit in little
+// memory. Recording reuses the buffers of the frame it replaces, so it
+// allocates nothing once the buffer is full.
+type rewindBuffer struct {
+	frames []rewindFrame
+	start  int // index of the oldest frame
+	len    int
+	last   []byte // RAM and display as of the newest frame
+	next   []byte // RAM and display being recorded, swapped with last
+}
+
+func newRewindBuffer(frames int) *rewindBuffer {
+	return &rewindBuffer{frames: make([]rewindFrame, frames)}
+}
+
+// record adds the state of the machine at the end of a frame, replacing the
+// oldest frame once the buffer is full.
+func (b *rewindBuffer) record(c *Chip8) {
+	now := append(append(b.next[:0], c.mem...), c.display[:]...)
+
+	slot := (b.start + b.len) % len(b.frames)
+	frame := &b.frames[slot]
+	delta, bytes := frame.delta[:0], frame.bytes[:0]
+	if b.last != nil {
+		for i := 0; i < len(now); i++ {
+			if now[i] == b.last[i] {
+				continue
+			}
+			end := i + 1
+			for end < len(now) && now[end] != b.last[end] {
+				end++
+			}
+			bytes = append(bytes, b.last[i:end]...)
+			delta = append(delta, rewindPatch{offset: i, old: bytes[len(bytes)-(end-i):]})
+			i = end
+		}
+	}
+	b.next, b.last = b.last, now
+
+	if b.len < len(b.frames) {
+		b.len++
+	} else {
+		b.start = (b.start + 1) % len(b.frames)
+	}
+	frame.cpu.save(c.cpu)
+	frame.delta, frame.bytes = delta, bytes
+}
+
+// back drops the newest frame and puts the machine in the state of the one
+// before it. It returns false, leaving the machine as it is, once only the
+// oldest frame is left.
+func (b *rewindBuffer) back(c *Chip8) bool {
+	if b.len < 2 {
+		return false
+	}
+	b.len--
+	for _, p := range b.frames[(b.start+b.len)%len(b.frames)].delta {
+		copy(b.last[p.offset:], p.old)
+	}
+
+	b.frames[(b.start+b.len-1)%len(b.frames)].cpu.restore(c.cpu)
+	copy(c.mem, b.last)
+	copy(c.display[:], b.last[len(c.mem):])
+
+	return true
+}
+
+// SetRewinding starts or stops rewinding. While rewinding, execution runs
+// backwards a frame at a time through the last frames recorded, for as long
+// as the emulator was started with Options.RewindSeconds. Rewinding is
+// ignored while keypad input is recorded to or replayed from a movie, which
+// it would throw out of sync.
+func (c *Chip8) SetRewinding(rewinding bool) {
+	c.rewinding = rewinding && c.rewind != nil && c.movie == nil && c.playback == nil
+}
+
+// Rewinding reports whether execution is being rewound.
+func (c *Chip8) Rewinding() bool {
+	return c.rewinding
+}
+
+// rewindFrame steps back a frame while rewinding, showing the display as it
+// was then.
+func (c *Chip8) rewindFrame() {
+	if !c.rewind.back(c) {
+		return
+	}
+	c.drawn = true
+	c.lastDraw = DrawRegion{}
+	if c.undo != nil {
+		c.undo.len = 0
+	}
+	c.updateScreen()
+}
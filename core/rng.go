@@ -0,0 +1,37 @@
+package core
+
+import "math/bits"
+
+// pcg is a PCG32 (XSH RR) random number generator, drawing the numbers of
+// CXNN. Its whole state is one number, saved along with the rest of the
+// machine's so save states, rewinding and stepping back restore it as it was.
+type pcg uint64
+
+const (
+	pcgMultiplier = 6364136223846793005
+	pcgIncrement  = 1442695040888963407
+)
+
+// newPCG returns a generator seeded with seed.
+func newPCG(seed int64) pcg {
+	var p pcg
+	p.next()
+	p += pcg(seed)
+	p.next()
+
+	return p
+}
+
+// next returns the next 32-bit number drawn.
+func (p *pcg) next() uint32 {
+	old := uint64(*p)
+	*p = pcg(old*pcgMultiplier + pcgIncrement)
+	xorshifted := uint32(((old >> 18) ^ old) >> 27)
+
+	return bits.RotateLeft32(xorshifted, -int(old>>59))
+}
+
+// byte returns the next number drawn, from 0 to 255.
+func (p *pcg) byte() uint8 {
+	return uint8(p.next() >> 24)
+}
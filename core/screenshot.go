@@ -0,0 +1,48 @@
+package core
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// displayImage returns the display as it was last rendered, with each Chip-8
+// pixel drawn as a scale*scale square.
+func (c *Chip8) displayImage(scale int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, Chip8Width*scale, Chip8Height*scale))
+	for y := 0; y < img.Rect.Dy(); y++ {
+		row := c.pixels[(y/scale)*Chip8Width*4:]
+		for x := 0; x < img.Rect.Dx(); x++ {
+			copy(img.Pix[img.PixOffset(x, y):], row[(x/scale)*4:(x/scale)*4+4])
+		}
+	}
+
+	return img
+}
+
+// SaveScreenshot writes the display to a timestamped PNG in dir, with each
+// Chip-8 pixel drawn as a scale*scale square.
+func (c *Chip8) SaveScreenshot(dir string, scale int) error {
+	if scale < 1 {
+		scale = 1
+	}
+
+	name := fmt.Sprintf("chip8-%s.png", time.Now().Format("20060102-150405.000"))
+	path := filepath.Join(dir, name)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, c.displayImage(scale)); err != nil {
+		return err
+	}
+
+	c.log.Infof("Saved screenshot to %s", path)
+	return nil
+}
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+)
+
+// stateMagic starts every state file, followed by its format version.
+const stateMagic = "chip8-state"
+
+// stateVersion is the version of the state format written. Version 1 files
+// are a bare machineState, without the magic line or header. Files before
+// version 3 have no RNG, only how many numbers were drawn from a generator
+// since replaced.
+const stateVersion = 3
+
+// stateHeader follows the magic line of a state file, identifying the
+// machine it was saved from. The file is:
+//
+//	chip8-state <version>
+//	<gob of stateHeader>
+//	<gob of machineState>
+type stateHeader struct {
+	RomHash string // sha1 of the ROM loaded
+	Quirks  Quirks // interpreter behaviors emulated
+}
+
+// machineState is the state of the whole machine, as saved to state files.
+type machineState struct {
+	Mem     []byte
+	V       [numRegisters]uint8
+	Stack   [stackDepth]uint16
+	I, PC   uint16
+	SP      uint8
+	DT, ST  uint8
+	Opcode  uint16
+	KeyWait uint8
+	Display []uint8
+	Keys    []uint8
+	Seed    int64  // seed of the CXNN random number generator
+	RNG     uint64 // state of the generator
+}
+
+// snapshot returns a copy of the state of the machine.
+func (c *Chip8) snapshot() machineState {
+	s := machineState{
+		Mem:     append([]byte(nil), c.mem...),
+		I:       c.cpu.i,
+		PC:      c.cpu.pc,
+		SP:      c.cpu.sp,
+		DT:      c.cpu.dt,
+		ST:      c.cpu.st,
+		Opcode:  uint16(c.cpu.opcode),
+		KeyWait: c.cpu.keyWait,
+		Display: append([]uint8(nil), c.display[:]...),
+		Keys:    append([]uint8(nil), c.keys...),
+		Seed:    c.seed,
+		RNG:     uint64(c.cpu.rng),
+	}
+	copy(s.V[:], c.cpu.v)
+	copy(s.Stack[:], c.cpu.stack)
+
+	return s
+}
+
+// restore puts the machine in the state s. Instructions executed before can
+// no longer be stepped back over.
+func (c *Chip8) restore(s machineState) {
+	copy(c.mem, s.Mem)
+	copy(c.cpu.v, s.V[:])
+	copy(c.cpu.stack, s.Stack[:])
+	c.cpu.i, c.cpu.pc = s.I, s.PC
+	c.cpu.sp, c.cpu.dt, c.cpu.st = s.SP, s.DT, s.ST
+	if c.cpu.sp > stackDepth {
+		c.cpu.sp = stackDepth
+	}
+	c.cpu.opcode = Opcode(s.Opcode)
+	c.cpu.keyWait = s.KeyWait
+	copy(c.display[:], s.Display)
+	copy(c.keys, s.Keys)
+	c.seed, c.cpu.rng = s.Seed, pcg(s.RNG)
+
+	c.drawn = true
+	c.lastDraw = DrawRegion{}
+	if c.undo != nil {
+		c.undo.len = 0
+	}
+}
+
+// SaveState writes the state of the whole machine to the file at path.
+func (c *Chip8) SaveState(path string) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %d\n", stateMagic, stateVersion)
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(stateHeader{RomHash: c.RomHash(), Quirks: c.quirks}); err != nil {
+		return err
+	}
+	if err := enc.Encode(c.snapshot()); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	c.log.Infof("Saved state to %s", path)
+	return nil
+}
+
+// LoadState restores the state of the machine saved to the file at path by
+// SaveState. States saved from another ROM, or by a newer version of the
+// emulator, are refused. Quirks are switched to those the state was saved
+// with, which its execution may depend on.
+func (c *Chip8) LoadState(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s, err := c.decodeState(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	c.restore(s)
+
+	c.log.Infof("Loaded state from %s", path)
+	return nil
+}
+
+// decodeState decodes the contents of a state file, checking its header
+// against the machine.
+func (c *Chip8) decodeState(data []byte) (machineState, error) {
+	var s machineState
+
+	r := bufio.NewReader(bytes.NewReader(data))
+	var version int
+	if _, err := fmt.Fscanf(r, stateMagic+" %d\n", &version); err != nil {
+		// Version 1 files start with the gob straight away, and don't say
+		// which ROM they were saved from.
+		if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s); err != nil {
+			return s, fmt.Errorf("not a state file")
+		}
+		c.log.Warnf("State file has no header, assuming it was saved from this ROM")
+		return c.reseedState(s), nil
+	}
+	if version > stateVersion {
+		return s, fmt.Errorf("saved by a newer version of the emulator (state format %d)", version)
+	}
+
+	var header stateHeader
+	dec := gob.NewDecoder(r)
+	if err := dec.Decode(&header); err != nil {
+		return s, err
+	}
+	if header.RomHash != c.RomHash() {
+		return s, fmt.Errorf("saved from another ROM (sha1 %s)", header.RomHash)
+	}
+	if err := dec.Decode(&s); err != nil {
+		return s, err
+	}
+	if header.Quirks != c.quirks {
+		c.log.Infof("Switching to the quirks the state was saved with")
+		c.quirks = header.Quirks
+	}
+	if version < 3 {
+		return c.reseedState(s), nil
+	}
+
+	return s, nil
+}
+
+// reseedState starts the random number generator of s, saved before the
+// state of the generator was, over from its seed.
+func (c *Chip8) reseedState(s machineState) machineState {
+	c.log.Warnf("State file predates saving the random number generator, which starts over from its seed")
+	s.RNG = uint64(newPCG(s.Seed))
+
+	return s
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// stateRom draws a random sprite in a loop.
+var stateRom = []byte{
+	0xC0, 0x3F, // RND V0, 0x3F
+	0xC1, 0x1F, // RND V1, 0x1F
+	0xF2, 0x29, // LD F, V2
+	0xD0, 0x15, // DRW V0, V1, 5
+	0x72, 0x01, // ADD V2, 1
+	0x12, 0x00, // JP 0x200
+}
+
+// newStateChip8 returns an emulator running rom, with quirks.
+func newStateChip8(t *testing.T, rom []byte, quirks Quirks) *Chip8 {
+	t.Helper()
+	c, err := NewChip8(Options{Seed: 7, Quirks: quirks, Logger: NewLogger(ioutil.Discard, LogError)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadRomData(rom); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state")
+	c := newStateChip8(t, stateRom, Quirks{KeyRelease: true})
+	for n := 0; n < 100; n++ {
+		c.cycle()
+	}
+	c.cpu.dt, c.cpu.st = 30, 20
+	c.SetKey(0xA, true)
+	if err := c.SaveState(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newStateChip8(t, stateRom, Quirks{})
+	if err := loaded.LoadState(path); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := c.snapshot(), loaded.snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded state differs from the one saved:\ngot  %+v\nwant %+v", got, want)
+	}
+	if loaded.quirks != c.quirks {
+		t.Errorf("quirks = %+v, want those saved, %+v", loaded.quirks, c.quirks)
+	}
+
+	// Both go on drawing the same random numbers.
+	for n := 0; n < 100; n++ {
+		c.cycle()
+		loaded.cycle()
+	}
+	if want, got := c.snapshot(), loaded.snapshot(); !reflect.DeepEqual(got, want) {
+		t.Error("loaded state diverged from the one saved after running")
+	}
+}
+
+func TestLoadStateRefused(t *testing.T) {
+	saved := newStateChip8(t, stateRom, Quirks{})
+	var state bytes.Buffer
+	enc := gob.NewEncoder(&state)
+	enc.Encode(stateHeader{RomHash: saved.RomHash()})
+	enc.Encode(saved.snapshot())
+
+	tests := []struct {
+		name string
+		data []byte
+		rom  []byte // loaded when the state is
+		want string // error
+	}{
+		{"newer version", append([]byte(fmt.Sprintf("%s %d\n", stateMagic, stateVersion+1)), state.Bytes()...), stateRom, "saved by a newer version"},
+		{"other ROM", append([]byte(fmt.Sprintf("%s %d\n", stateMagic, stateVersion)), state.Bytes()...), []byte{0x12, 0x00}, "saved from another ROM"},
+		{"not a state", []byte("hello"), stateRom, "not a state file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state")
+			if err := ioutil.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			c := newStateChip8(t, tt.rom, Quirks{})
+			before := c.snapshot()
+
+			err := c.LoadState(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("LoadState = %v, want error %q", err, tt.want)
+			}
+			if !reflect.DeepEqual(c.snapshot(), before) {
+				t.Error("state changed by a refused load")
+			}
+		})
+	}
+}
+
+func TestLoadStateVersion1(t *testing.T) {
+	saved := newStateChip8(t, stateRom, Quirks{})
+	for n := 0; n < 50; n++ {
+		saved.cycle()
+	}
+
+	// Version 1 files are a bare gob of the machine state.
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(saved.snapshot()); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "state")
+	if err := ioutil.WriteFile(path, data.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newStateChip8(t, stateRom, Quirks{})
+	if err := c.LoadState(path); err != nil {
+		t.Fatal(err)
+	}
+	// The generator, not saved then, starts over from its seed.
+	want := saved.snapshot()
+	want.RNG = uint64(newPCG(want.Seed))
+	if !reflect.DeepEqual(c.snapshot(), want) {
+		t.Error("loaded state differs from the one saved")
+	}
+}
+
+func TestRewindRNG(t *testing.T) {
+	c := newStateChip8(t, stateRom, Quirks{})
+	b := newRewindBuffer(4)
+	b.record(c)
+	before := c.snapshot()
+	for n := 0; n < 100; n++ {
+		c.cycle()
+	}
+	b.record(c)
+	after := c.snapshot()
+
+	// Rewinding puts the generator back too, so the same numbers are drawn
+	// again.
+	if !b.back(c) {
+		t.Fatal("no frame to rewind to")
+	}
+	if !reflect.DeepEqual(c.snapshot(), before) {
+		t.Fatal("rewound state differs from the one recorded")
+	}
+	for n := 0; n < 100; n++ {
+		c.cycle()
+	}
+	if !reflect.DeepEqual(c.snapshot(), after) {
+		t.Error("state after rewinding and running again differs")
+	}
+}
+
+func TestStateJSON(t *testing.T) {
+	c := newStateChip8(t, stateRom, Quirks{})
+	for n := 0; n < 100; n++ {
+		c.cycle()
+	}
+	data, err := c.DumpStateJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := newStateChip8(t, stateRom, Quirks{})
+	if err := loaded.LoadStateJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.snapshot(), c.snapshot()) {
+		t.Error("loaded JSON state differs from the one dumped")
+	}
+
+	// Written by hand, the generator starts from the seed given.
+	seeded := fmt.Sprintf(`{"rom": %q, "seed": 42}`, c.RomHash())
+	if err := loaded.LoadStateJSON([]byte(seeded)); err != nil {
+		t.Fatal(err)
+	}
+	if want := newPCG(42); loaded.cpu.rng != want {
+		t.Errorf("RNG = %#x, want %#x, seeded with 42", uint64(loaded.cpu.rng), uint64(want))
+	}
+
+	// Older versions wrote the numbers drawn, which took as long to draw
+	// again.
+	draws := fmt.Sprintf(`{"rom": %q, "rng_draws": 1e18}`, c.RomHash())
+	if err := loaded.LoadStateJSON([]byte(draws)); err == nil || !strings.Contains(err.Error(), "rng_draws") {
+		t.Errorf("LoadStateJSON(%s) = %v, want it refused", draws, err)
+	}
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"bufio"
+	"hash"
+	"hash/fnv"
+	"os"
+	"strconv"
+)
+
+// stateHasher hashes the display, registers and RAM, reusing its buffers so
+// hashing every frame allocates nothing.
+type stateHasher struct {
+	h    hash.Hash64
+	regs []byte
+}
+
+func newStateHasher() *stateHasher {
+	return &stateHasher{h: fnv.New64a()}
+}
+
+// sum returns the hash of the state of c.
+func (s *stateHasher) sum(c *Chip8) uint64 {
+	cpu := c.cpu
+	regs := append(s.regs[:0], cpu.v...)
+	regs = append(regs, byte(cpu.i>>8), byte(cpu.i), byte(cpu.pc>>8), byte(cpu.pc), cpu.sp, cpu.dt, cpu.st)
+	for _, addr := range cpu.stack {
+		regs = append(regs, byte(addr>>8), byte(addr))
+	}
+	s.regs = regs
+
+	s.h.Reset()
+	s.h.Write(c.display[:])
+	s.h.Write(regs)
+	s.h.Write(c.mem)
+
+	return s.h.Sum64()
+}
+
+// StateHash returns a 64-bit FNV-1a hash of the display, registers and RAM,
+// which runs going through the same states share.
+func (c *Chip8) StateHash() uint64 {
+	return newStateHasher().sum(c)
+}
+
+// frameHashes writes the StateHash of the machine at the end of every frame
+// to a file, a line each:
+//
+//	42 5f1b2c3d4e5f6a7b
+//
+// Runs with Options.Deterministic and the same input write the same file,
+// so two of them can be diffed to find the first frame a change to the
+// emulator made a difference to.
+type frameHashes struct {
+	file   *os.File
+	w      *bufio.Writer
+	hasher *stateHasher
+	line   []byte
+}
+
+// newFrameHashes creates the file of frame hashes at path.
+func newFrameHashes(path string) (*frameHashes, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &frameHashes{file: file, w: bufio.NewWriter(file), hasher: newStateHasher()}, nil
+}
+
+// write writes the hash of the state of c, as of the end of the frame.
+func (f *frameHashes) write(c *Chip8) error {
+	const hexDigits = "0123456789abcdef"
+
+	line := strconv.AppendUint(f.line[:0], c.frame, 10)
+	line = append(line, ' ')
+	sum := f.hasher.sum(c)
+	for shift := 60; shift >= 0; shift -= 4 {
+		line = append(line, hexDigits[sum>>uint(shift)&0xf])
+	}
+	line = append(line, '\n')
+	f.line = line
+
+	_, err := f.w.Write(line)
+	return err
+}
+
+// close flushes the hashes to disk.
+func (f *frameHashes) close() error {
+	if err := f.w.Flush(); err != nil {
+		f.file.Close()
+		return err
+	}
+
+	return f.file.Close()
+}
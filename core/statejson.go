@@ -0,0 +1,211 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonRowBytes is the number of bytes of RAM on each row of a JSON state.
+const jsonRowBytes = 32
+
+// jsonState is the state of the machine as written by DumpStateJSON, for
+// people to read and write. Numbers are hex strings, RAM is hex dumped by row
+// and the display drawn with # for lit pixels and . for unlit ones.
+type jsonState struct {
+	Rom     string            `json:"rom"` // sha1 of the ROM
+	Quirks  Quirks            `json:"quirks"`
+	PC      jsonHex           `json:"pc"`
+	I       jsonHex           `json:"i"`
+	SP      jsonHex           `json:"sp"`
+	DT      jsonHex           `json:"dt"`
+	ST      jsonHex           `json:"st"`
+	V       []jsonHex         `json:"v"`
+	Stack   []jsonHex         `json:"stack"`
+	Opcode  jsonHex           `json:"opcode"`
+	KeyWait jsonHex           `json:"key_wait"` // key FX0A waits on being released, 0xff for none
+	Keys    string            `json:"keys"`     // keys held, as hex digits
+	Seed    int64             `json:"seed"`
+	RNG     *jsonHex64        `json:"rng"`                 // state of the random number generator, started from seed if left out
+	Draws   json.RawMessage   `json:"rng_draws,omitempty"` // refused, written by older versions
+	Memory  map[string]string `json:"memory"`              // rows of RAM, by address
+	Display []string          `json:"display"`
+}
+
+// jsonHex is a number written as a hex string. Plain numbers are accepted
+// too.
+type jsonHex uint16
+
+func (h jsonHex) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%#x", uint16(h)))
+}
+
+func (h *jsonHex) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	v, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return fmt.Errorf("%s is not a 16-bit number", data)
+	}
+	*h = jsonHex(v)
+
+	return nil
+}
+
+// jsonHex64 is a 64-bit jsonHex.
+type jsonHex64 uint64
+
+func (h jsonHex64) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%#x", uint64(h)))
+}
+
+func (h *jsonHex64) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return fmt.Errorf("%s is not a 64-bit number", data)
+	}
+	*h = jsonHex64(v)
+
+	return nil
+}
+
+// DumpStateJSON returns the state of the whole machine as indented JSON,
+// e.g. to attach to bug reports or compare against in tests.
+func (c *Chip8) DumpStateJSON() ([]byte, error) {
+	s := c.snapshot()
+	js := jsonState{
+		Rom:     c.RomHash(),
+		Quirks:  c.quirks,
+		PC:      jsonHex(s.PC),
+		I:       jsonHex(s.I),
+		SP:      jsonHex(s.SP),
+		DT:      jsonHex(s.DT),
+		ST:      jsonHex(s.ST),
+		Opcode:  jsonHex(s.Opcode),
+		KeyWait: jsonHex(s.KeyWait),
+		Seed:    s.Seed,
+		RNG:     (*jsonHex64)(&s.RNG),
+		Memory:  make(map[string]string),
+	}
+	for _, v := range s.V {
+		js.V = append(js.V, jsonHex(v))
+	}
+	for _, addr := range s.Stack {
+		js.Stack = append(js.Stack, jsonHex(addr))
+	}
+	for key, held := range s.Keys {
+		if held != 0 {
+			js.Keys += fmt.Sprintf("%X", key)
+		}
+	}
+	for addr := 0; addr < len(s.Mem); addr += jsonRowBytes {
+		js.Memory[fmt.Sprintf("%#03x", addr)] = fmt.Sprintf("% x", s.Mem[addr:addr+jsonRowBytes])
+	}
+	for y := 0; y < Chip8Height; y++ {
+		row := make([]byte, Chip8Width)
+		for x := range row {
+			row[x] = '.'
+			if s.Display[y*Chip8Width+x] != 0 {
+				row[x] = '#'
+			}
+		}
+		js.Display = append(js.Display, string(row))
+	}
+
+	return json.MarshalIndent(js, "", "  ")
+}
+
+// LoadStateJSON puts the machine in the state written by DumpStateJSON.
+// Anything left out, such as rows of RAM, is as the machine is powered on
+// with the ROM loaded, so states can be written by hand naming only what
+// matters. States of another ROM are refused.
+func (c *Chip8) LoadStateJSON(data []byte) error {
+	s := c.powerOnState()
+
+	js := jsonState{Rom: c.RomHash(), Quirks: c.quirks, PC: jsonHex(s.PC), KeyWait: jsonHex(s.KeyWait), Seed: s.Seed}
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	if js.Rom != c.RomHash() {
+		return fmt.Errorf("state of another ROM (sha1 %s)", js.Rom)
+	}
+	if js.Draws != nil {
+		// Replaying them took as long as drawing them had.
+		return fmt.Errorf("rng_draws is no longer read, rng holds the state of the random number generator")
+	}
+
+	if len(js.V) > len(s.V) || len(js.Stack) > len(s.Stack) {
+		return fmt.Errorf("%d V registers and %d stack entries, expected at most %d and %d", len(js.V), len(js.Stack), len(s.V), len(s.Stack))
+	}
+	for i, v := range js.V {
+		s.V[i] = uint8(v)
+	}
+	for i, addr := range js.Stack {
+		s.Stack[i] = uint16(addr)
+	}
+	s.PC, s.I = uint16(js.PC), uint16(js.I)
+	s.SP, s.DT, s.ST = uint8(js.SP), uint8(js.DT), uint8(js.ST)
+	s.Opcode, s.KeyWait = uint16(js.Opcode), uint8(js.KeyWait)
+	s.Seed, s.RNG = js.Seed, uint64(newPCG(js.Seed))
+	if js.RNG != nil {
+		s.RNG = uint64(*js.RNG)
+	}
+
+	for _, key := range js.Keys {
+		k, err := strconv.ParseUint(string(key), 16, 4)
+		if err != nil {
+			return fmt.Errorf("keys: %q is not a key", key)
+		}
+		s.Keys[k] = 1
+	}
+	for row, dump := range js.Memory {
+		addr, err := strconv.ParseUint(row, 0, 16)
+		if err != nil || addr >= uint64(len(s.Mem)) {
+			return fmt.Errorf("memory: %q is not an address", row)
+		}
+		for i, field := range strings.Fields(dump) {
+			b, err := strconv.ParseUint(field, 16, 8)
+			if err != nil || int(addr)+i >= len(s.Mem) {
+				return fmt.Errorf("memory: row %s: %q is not a byte of RAM", row, field)
+			}
+			s.Mem[int(addr)+i] = uint8(b)
+		}
+	}
+	if len(js.Display) > Chip8Height {
+		return fmt.Errorf("display: %d rows, expected %d", len(js.Display), Chip8Height)
+	}
+	for y, row := range js.Display {
+		if len(row) > Chip8Width {
+			return fmt.Errorf("display: row %d is %d pixels, expected %d", y, len(row), Chip8Width)
+		}
+		for x, pixel := range row {
+			if pixel == '#' {
+				s.Display[y*Chip8Width+x] = 1
+			}
+		}
+	}
+
+	c.quirks = js.Quirks
+	c.restore(s)
+
+	return nil
+}
+
+// powerOnState returns the state of the machine as powered on with the ROM
+// loaded.
+func (c *Chip8) powerOnState() machineState {
+	s := machineState{
+		Mem:     make([]byte, len(c.mem)),
+		PC:      programEntryOffset,
+		KeyWait: noKey,
+		Display: make([]uint8, len(c.display)),
+		Keys:    make([]uint8, len(c.keys)),
+		Seed:    c.seed,
+		RNG:     uint64(newPCG(c.seed)),
+	}
+	copy(s.Mem[characterSpritesOffset:], characterSprites)
+	copy(s.Mem[programEntryOffset:], c.rom)
+
+	return s
+}
@@ -0,0 +1,27 @@
+package core
+
+import "time"
+
+// perfStats counts frames and instructions to report the rates they are
+// running at, averaged over each second.
+type perfStats struct {
+	frames       int
+	instructions int
+	fps          int // frames per second over the last full second
+	ips          int // instructions per second over the last full second
+	since        time.Time
+}
+
+// update recomputes the rates once a full second has passed.
+func (s *perfStats) update(now time.Time) {
+	elapsed := now.Sub(s.since)
+	if elapsed < time.Second {
+		return
+	}
+
+	s.fps = int(float64(s.frames) / elapsed.Seconds())
+	s.ips = int(float64(s.instructions) / elapsed.Seconds())
+	s.frames = 0
+	s.instructions = 0
+	s.since = now
+}
@@ -0,0 +1,94 @@
+package core
+
+import "time"
+
+// timerPeriod is how often the delay and sound timers tick: 60 times a
+// second.
+const timerPeriod = time.Second / 60
+
+// maxTimerCatchUp is the most ticks made up for at once, after the emulator
+// stalled, so a long stall doesn't run the timers down in one go.
+const maxTimerCatchUp = 4
+
+// timerClock paces the delay and sound timers by the clock, accumulating
+// the time since they last ticked, so they tick at 60Hz however many
+// instructions are executed a second.
+type timerClock struct {
+	last time.Time     // when ticks was last called
+	acc  time.Duration // time the timers are behind by
+}
+
+// reset starts accumulating time afresh from now, e.g. after being paused.
+func (t *timerClock) reset(now time.Time) {
+	t.last = now
+	t.acc = 0
+}
+
+// ticks returns how many times the timers are due to tick by now, running at
+// speed times real time.
+func (t *timerClock) ticks(now time.Time, speed float64) int {
+	t.acc += time.Duration(float64(now.Sub(t.last)) * speed)
+	t.last = now
+
+	n := int(t.acc / timerPeriod)
+	t.acc -= time.Duration(n) * timerPeriod
+	if n > maxTimerCatchUp {
+		n = maxTimerCatchUp
+	}
+
+	return n
+}
+
+// tickTimers decrements the delay and sound timers at the end of a frame,
+// as often as they are due by the clock. Where runs must be repeatable, in
+// deterministic mode, netplay and while recording or replaying a movie, and
+// when stepping through frames while paused, they tick once a frame instead.
+func (c *Chip8) tickTimers() {
+	if c.deterministic || c.lockstep != nil || c.movie != nil || c.playback != nil || c.paused || c.frameStep {
+		c.cpu.decrementTimers()
+		c.timers.reset(time.Now())
+		return
+	}
+
+	for n := c.timers.ticks(time.Now(), c.speed); n > 0; n-- {
+		c.cpu.decrementTimers()
+	}
+}
+
+// maxFrameLag is how many frames execution may fall behind by, e.g. after
+// the host stalled, and still catch up by running them without waiting.
+const maxFrameLag = 6
+
+// framePacer paces frames at VBlankFreq a second. Each frame is due a frame
+// period after the one before, rather than after the last one ended, so
+// frames which run or wake late are made up for without drifting.
+type framePacer struct {
+	next time.Time // when the next frame is due
+}
+
+// reset makes the next frame due a frame period from now, forgetting any
+// frames execution is behind by, e.g. after being paused.
+func (p *framePacer) reset(now time.Time) {
+	p.next = now
+}
+
+// wait waits until the next frame is due, at speed times the normal speed.
+// Frames execution is behind on are run without waiting, unless it has
+// fallen more than maxFrameLag behind, when they are dropped.
+func (p *framePacer) wait(speed float64) {
+	period := time.Duration(float64(time.Second/VBlankFreq) / speed)
+	p.next = p.next.Add(period)
+
+	now := time.Now()
+	if d := p.next.Sub(now); d > 0 {
+		time.Sleep(d)
+	} else if -d > maxFrameLag*period {
+		p.next = now
+	}
+}
+
+// Beeping reports whether the buzzer sounds, which it does while the sound
+// timer is running.
+func (c *Chip8) Beeping() bool {
+	return c.cpu.st > 0
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TraceFilter selects the instructions written to the trace, and how.
+type TraceFilter struct {
+	Start, End uint16 // range of addresses traced, all when both are 0
+	Classes    uint16 // bit N set traces instructions NXXX, all when 0
+	Registers  bool   // also log the registers each instruction changed
+}
+
+// ParseTraceRange parses the range of addresses to trace, "START-END" in hex.
+func (f *TraceFilter) ParseTraceRange(s string) error {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid trace range %q, expected START-END", s)
+	}
+	start, err := parseHexAddr(parts[0])
+	if err != nil {
+		return err
+	}
+	end, err := parseHexAddr(parts[1])
+	if err != nil {
+		return err
+	}
+	if end < start {
+		return fmt.Errorf("invalid trace range %q, END is before START", s)
+	}
+
+	f.Start, f.End = start, end
+	return nil
+}
+
+// ParseTraceClasses parses the classes of instructions to trace, by their
+// first hex digit, e.g. "1,2,D" for jumps, calls and draws.
+func (f *TraceFilter) ParseTraceClasses(classes []string) error {
+	for _, class := range classes {
+		n, err := strconv.ParseUint(strings.TrimSpace(class), 16, 4)
+		if err != nil {
+			return fmt.Errorf("invalid instruction class %q, expected a hex digit", class)
+		}
+		f.Classes |= 1 << n
+	}
+
+	return nil
+}
+
+// traces reports whether the instruction op at addr is traced.
+func (f TraceFilter) traces(addr uint16, op Opcode) bool {
+	if (f.Start != 0 || f.End != 0) && (addr < f.Start || addr > f.End) {
+		return false
+	}
+
+	return f.Classes == 0 || f.Classes&(1<<(op>>12)) != 0
+}
+
+// traceRegisters is the CPU state compared to log register changes.
+type traceRegisters struct {
+	v          [numRegisters]uint8
+	i          uint16
+	sp, dt, st uint8
+}
+
+// tracer writes the instructions executed to a trace file, a line each:
+//
+//	0200  600A  LD V0, 0x0a  V0=0a
+type tracer struct {
+	file   *os.File
+	w      *bufio.Writer
+	filter TraceFilter
+}
+
+// newTracer creates the trace file at path.
+func newTracer(path string, filter TraceFilter) (*tracer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tracer{file: file, w: bufio.NewWriter(file), filter: filter}, nil
+}
+
+// registers returns the state of the CPU to compare against after the next
+// instruction.
+func (t *tracer) registers(cpu *CPU) traceRegisters {
+	r := traceRegisters{i: cpu.i, sp: cpu.sp, dt: cpu.dt, st: cpu.st}
+	copy(r.v[:], cpu.v)
+	return r
+}
+
+// log writes the instruction op executed at addr, and the registers it
+// changed from before if registers are traced.
+func (t *tracer) log(addr uint16, op Opcode, cpu *CPU, before traceRegisters) {
+	fmt.Fprintf(t.w, "%04X  %04X  %s", addr, uint16(op), Disassemble(uint16(op)))
+	if t.filter.Registers {
+		for n, v := range cpu.v {
+			if v != before.v[n] {
+				fmt.Fprintf(t.w, "  V%X=%02x", n, v)
+			}
+		}
+		if cpu.i != before.i {
+			fmt.Fprintf(t.w, "  I=%03x", cpu.i)
+		}
+		if cpu.sp != before.sp {
+			fmt.Fprintf(t.w, "  SP=%d", cpu.sp)
+		}
+		if cpu.dt != before.dt {
+			fmt.Fprintf(t.w, "  DT=%d", cpu.dt)
+		}
+		if cpu.st != before.st {
+			fmt.Fprintf(t.w, "  ST=%d", cpu.st)
+		}
+	}
+	t.w.WriteByte('\n')
+}
+
+// close flushes the trace to disk.
+func (t *tracer) close() error {
+	if err := t.w.Flush(); err != nil {
+		t.file.Close()
+		return err
+	}
+
+	return t.file.Close()
+}
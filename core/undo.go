@@ -0,0 +1,144 @@
+package core
+
+// undoRecord holds what an instruction changed, to undo it when stepping
+// back: the CPU state before it, the RAM it overwrote and, for CLS, the
+// display it cleared. DXYN is undone by drawing the same sprite again.
+type undoRecord struct {
+	op      Opcode // the instruction undone
+	cpu     cpuState
+	memAddr uint16
+	memLen  int
+	mem     [numRegisters]byte
+	display []uint8
+}
+
+// cpuState is a copy of the registers of a CPU, and of its random number
+// generator.
+type cpuState struct {
+	v          [numRegisters]uint8
+	stack      [stackDepth]uint16
+	i, pc      uint16
+	sp, dt, st uint8
+	opcode     Opcode
+	keyWait    uint8
+	rng        pcg
+}
+
+// save copies the registers of cpu into s.
+func (s *cpuState) save(cpu *CPU) {
+	copy(s.v[:], cpu.v)
+	copy(s.stack[:], cpu.stack)
+	s.i, s.pc = cpu.i, cpu.pc
+	s.sp, s.dt, s.st = cpu.sp, cpu.dt, cpu.st
+	s.opcode = cpu.opcode
+	s.keyWait = cpu.keyWait
+	s.rng = cpu.rng
+}
+
+// restore copies the registers in s back into cpu.
+func (s *cpuState) restore(cpu *CPU) {
+	copy(cpu.v, s.v[:])
+	copy(cpu.stack, s.stack[:])
+	cpu.i, cpu.pc = s.i, s.pc
+	cpu.sp, cpu.dt, cpu.st = s.sp, s.dt, s.st
+	cpu.opcode = s.opcode
+	cpu.keyWait = s.keyWait
+	cpu.rng = s.rng
+}
+
+// undoHistory is a ring buffer of the records of the instructions most
+// recently executed.
+type undoHistory struct {
+	records []undoRecord
+	start   int // index of the oldest record
+	len     int
+}
+
+func newUndoHistory(depth int) *undoHistory {
+	return &undoHistory{records: make([]undoRecord, depth)}
+}
+
+// push returns the record to fill in for the next instruction, replacing
+// the oldest once the buffer is full.
+func (h *undoHistory) push() *undoRecord {
+	i := (h.start + h.len) % len(h.records)
+	if h.len < len(h.records) {
+		h.len++
+	} else {
+		h.start = (h.start + 1) % len(h.records)
+	}
+
+	return &h.records[i]
+}
+
+// pop removes and returns the record of the last instruction executed.
+func (h *undoHistory) pop() (*undoRecord, bool) {
+	if h.len == 0 {
+		return nil, false
+	}
+	h.len--
+
+	return &h.records[(h.start+h.len)%len(h.records)], true
+}
+
+// recordUndo saves what the instruction about to be fetched from PC and
+// executed may change.
+func (c *Chip8) recordUndo() {
+	op := c.instructionAt(c.cpu.pc)
+
+	r := c.undo.push()
+	r.op = op
+	r.cpu.save(c.cpu)
+	r.memLen = 0
+	r.display = nil
+
+	if access, ok := instructionAccess(op, c.cpu.i); ok && access.write {
+		end := int(access.end) + 1
+		if end > len(c.mem) {
+			end = len(c.mem)
+		}
+		r.memAddr = access.start
+		r.memLen = copy(r.mem[:], c.mem[access.start:end])
+	}
+	if op == 0x00E0 {
+		r.display = append([]uint8(nil), c.display[:]...)
+	}
+}
+
+// StepBack undoes the last instruction executed while paused, and reports
+// whether there was one to undo. Only the most recent instructions, since
+// the emulator started or stepping back became possible, can be undone. The
+// keypad isn't rewound.
+func (c *Chip8) StepBack() bool {
+	if !c.paused || c.undo == nil {
+		return false
+	}
+	r, ok := c.undo.pop()
+	if !ok {
+		return false
+	}
+
+	// RAM is restored first, so a sprite is drawn again from the same data.
+	copy(c.mem[r.memAddr:], r.mem[:r.memLen])
+	r.cpu.restore(c.cpu)
+	if r.display != nil {
+		copy(c.display[:], r.display)
+	}
+	if r.op&0xF000 == 0xD000 {
+		// Drawing the sprite again erases it, but sets VF, restored above.
+		vf, prev := c.cpu.v[0xF], c.cpu.opcode
+		c.cpu.opcode = r.op
+		c.cpu.ExecDXYN(c.mem, &c.display)
+		c.cpu.v[0xF], c.cpu.opcode = vf, prev
+	}
+	c.drawn = true
+	c.skipBreak = c.breakpoints[c.cpu.pc]
+	c.stopReason = ""
+
+	return true
+}
+
+// CanStepBack reports whether there is an instruction StepBack can undo.
+func (c *Chip8) CanStepBack() bool {
+	return c.undo != nil && c.undo.len > 0
+}
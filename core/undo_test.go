@@ -0,0 +1,123 @@
+package core
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// undoRom draws, sets the timers, draws random numbers, writes RAM, calls a
+// subroutine and clears the display, in a loop.
+var undoRom = []byte{
+	0x60, 0x05, // 200: LD V0, 5
+	0xF0, 0x15, // 202: LD DT, V0
+	0xF0, 0x18, // 204: LD ST, V0
+	0xF0, 0x29, // 206: LD F, V0
+	0xD0, 0x15, // 208: DRW V0, V1, 5
+	0xC1, 0xFF, // 20A: RND V1, 0xFF
+	0xA3, 0x00, // 20C: LD I, 300
+	0xF1, 0x55, // 20E: LD [I], V1
+	0xD1, 0x02, // 210: DRW V1, V0, 2
+	0x22, 0x20, // 212: CALL 220
+	0x00, 0xE0, // 214: CLS
+	0xD0, 0x15, // 216: DRW V0, V1, 5
+	0x12, 0x02, // 218: JP 202
+	0x00, 0x00,
+	0x00, 0x00,
+	0x00, 0x00,
+	0x70, 0x03, // 220: ADD V0, 3
+	0x00, 0xEE, // 222: RET
+}
+
+// snapshotFrontend takes a snapshot of the machine after each instruction,
+// and stops the emulator after n of them.
+type snapshotFrontend struct {
+	n         uint64
+	snapshots []machineState
+}
+
+func (fe *snapshotFrontend) Render(c *Chip8) {}
+
+func (fe *snapshotFrontend) PollEvents(c *Chip8) {
+	if _, instructions := c.Counters(); instructions > uint64(len(fe.snapshots)) {
+		fe.snapshots = append(fe.snapshots, c.snapshot())
+		if instructions >= fe.n {
+			c.Stop()
+		}
+	}
+}
+
+func (fe *snapshotFrontend) Close() {}
+
+// TestStepBack runs instructions over several frames, so the timers tick
+// and the display is drawn to and cleared, then steps back over all of them,
+// checking the machine is as it was before each.
+func TestStepBack(t *testing.T) {
+	const steps = 60
+
+	c, err := NewChip8(Options{Seed: 3, Unpaced: true, Deterministic: true, PerFrame: 8, StepBackDepth: steps, Logger: NewLogger(ioutil.Discard, LogError)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadRomData(undoRom); err != nil {
+		t.Fatal(err)
+	}
+	start := c.snapshot()
+	fe := &snapshotFrontend{n: steps}
+	if err := c.Run(fe); err != nil {
+		t.Fatal(err)
+	}
+	if frames, _ := c.Counters(); frames < 5 {
+		t.Fatalf("ran %d frames, want several", frames)
+	}
+	states := append([]machineState{start}, fe.snapshots...)
+
+	// The run must have exercised what is undone.
+	var ticked, drawn bool
+	for n := 1; n < len(states); n++ {
+		ticked = ticked || states[n].DT < states[n-1].DT
+		drawn = drawn || !reflect.DeepEqual(states[n].Display, start.Display)
+	}
+	if !ticked || !drawn {
+		t.Fatalf("timers ticked %v, display drawn %v, want both", ticked, drawn)
+	}
+
+	c.paused = true
+	for n := steps; n > 0; n-- {
+		if !c.StepBack() {
+			t.Fatalf("StepBack failed with %d instructions left to undo", n)
+		}
+		if got := c.snapshot(); !reflect.DeepEqual(got, states[n-1]) {
+			t.Fatalf("stepping back over instruction %d at %#04x, the state differs from before it: %+v, want %+v", n, got.PC, got, states[n-1])
+		}
+	}
+	if c.StepBack() {
+		t.Error("StepBack undid an instruction before the first")
+	}
+}
+
+func TestStepBackDepth(t *testing.T) {
+	c, err := NewChip8(Options{Seed: 3, StepBackDepth: 4, Logger: NewLogger(ioutil.Discard, LogError)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadRomData(undoRom); err != nil {
+		t.Fatal(err)
+	}
+	if c.StepBack() {
+		t.Error("StepBack undid an instruction while running")
+	}
+
+	c.paused = true
+	for n := 0; n < 10; n++ {
+		c.cycle()
+	}
+	for n := 0; n < 4; n++ {
+		if !c.StepBack() {
+			t.Fatalf("StepBack %d failed, want 4 to succeed", n+1)
+		}
+	}
+	if c.StepBack() || c.CanStepBack() {
+		t.Error("stepped back further than StepBackDepth")
+	}
+}
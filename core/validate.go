@@ -0,0 +1,76 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ROMCheck is what is done about problems found in ROMs as they are loaded.
+type ROMCheck int
+
+const (
+	ROMCheckWarn   ROMCheck = iota // log the problems and load the ROM anyway
+	ROMCheckStrict                 // refuse to load ROMs with problems
+	ROMCheckOff                    // don't check ROMs
+)
+
+// ParseROMCheck returns the ROMCheck named warn, strict or off.
+func ParseROMCheck(name string) (ROMCheck, error) {
+	switch strings.ToLower(name) {
+	case "warn", "":
+		return ROMCheckWarn, nil
+	case "strict":
+		return ROMCheckStrict, nil
+	case "off":
+		return ROMCheckOff, nil
+	}
+
+	return ROMCheckWarn, fmt.Errorf("unknown ROM check %q, expected warn, strict or off", name)
+}
+
+// ValidateROM returns the problems found in rom without running it: words
+// which aren't instructions in the code reachable from the entry point.
+// Whether it fits in RAM depends on the machine, see LoadRomData.
+func ValidateROM(rom []byte) []string {
+	var problems []string
+	_, _, invalid := codeWalker{rom: rom}.walk(int(programEntryOffset), true)
+	sort.Ints(invalid)
+	for i, addr := range invalid {
+		if i > 0 && invalid[i-1] == addr {
+			continue
+		}
+		op, _ := codeWalker{rom: rom}.word(addr)
+		problem := fmt.Sprintf("invalid opcode %04X at %#03x", op, addr)
+		if name := extensionName(op); name != "" {
+			problem += fmt.Sprintf(" (%s, not supported)", name)
+		}
+		problems = append(problems, problem)
+	}
+
+	return problems
+}
+
+// checkRom checks the ROM being loaded fits in RAM, and has no problems if
+// c's ROMCheck is strict, logging any it has unless the check is off.
+func (c *Chip8) checkRom(rom []byte) error {
+	if max := len(c.mem) - int(programEntryOffset); len(rom) > max {
+		err := fmt.Errorf("ROM is %d bytes, more than the %d bytes of RAM from %#03x to %#03x", len(rom), max, programEntryOffset, len(c.mem)-1)
+		if len(c.mem) < extendedMemorySize {
+			err = fmt.Errorf("%v; XO-CHIP ROMs this large need extended memory", err)
+		}
+		return err
+	}
+
+	if c.romCheck != ROMCheckOff {
+		problems := ValidateROM(rom)
+		for _, problem := range problems {
+			c.log.Warnf("ROM check: %s", problem)
+		}
+		if len(problems) > 0 && c.romCheck == ROMCheckStrict {
+			return fmt.Errorf("refusing to load a ROM with problems")
+		}
+	}
+
+	return nil
+}
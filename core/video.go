@@ -0,0 +1,57 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// videoScale is how much frames are enlarged before encoding, since most
+// codecs handle a 64x32 video poorly.
+const videoScale = 10
+
+// videoRecorder pipes raw RGBA display frames to an ffmpeg process, which
+// encodes them into a video file.
+type videoRecorder struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+// newVideoRecorder starts ffmpeg encoding a video to path. The container and
+// codec are chosen by ffmpeg from the file extension.
+func newVideoRecorder(path string) (*videoRecorder, error) {
+	cmd := exec.Command("ffmpeg", "-y", "-loglevel", "error",
+		"-f", "rawvideo",
+		"-pixel_format", "rgba",
+		"-video_size", fmt.Sprintf("%dx%d", Chip8Width, Chip8Height),
+		"-framerate", fmt.Sprint(VBlankFreq),
+		"-i", "-",
+		"-vf", fmt.Sprintf("scale=iw*%d:ih*%d:flags=neighbor", videoScale, videoScale),
+		"-pix_fmt", "yuv420p",
+		path)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("unable to start ffmpeg: %v", err)
+	}
+
+	return &videoRecorder{cmd: cmd, stdin: stdin}, nil
+}
+
+// writeFrame sends one frame of RGBA pixels to ffmpeg.
+func (v *videoRecorder) writeFrame(pixels []byte) error {
+	_, err := v.stdin.Write(pixels)
+	return err
+}
+
+// close ends the stream and waits for ffmpeg to finish writing the video.
+func (v *videoRecorder) close() error {
+	v.stdin.Close()
+	return v.cmd.Wait()
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Watchpoint pauses execution after an instruction reads or writes RAM in
+// the range it covers.
+type Watchpoint struct {
+	Start, End  uint16 // first and last address watched
+	Relative    bool   // Start and End are offsets from the I register
+	Read, Write bool   // the kinds of access watched
+}
+
+// ParseWatchpoint parses a watchpoint written as START[-END][:r|w|rw], where
+// the addresses are hex, optionally prefixed by 0x, e.g. "300-30f:w". Writing
+// the start as I or I+N watches addresses relative to the I register, e.g.
+// "I+0-2:r". Both reads and writes are watched unless specified otherwise.
+func ParseWatchpoint(s string) (Watchpoint, error) {
+	w := Watchpoint{Read: true, Write: true}
+
+	spec, mode := s, "rw"
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		spec, mode = s[:i], strings.ToLower(s[i+1:])
+	}
+	switch mode {
+	case "rw", "wr":
+	case "r":
+		w.Write = false
+	case "w":
+		w.Read = false
+	default:
+		return w, fmt.Errorf("invalid watchpoint %q: unknown access %q", s, mode)
+	}
+
+	spec = strings.TrimSpace(spec)
+	if upper := strings.ToUpper(spec); strings.HasPrefix(upper, "I") {
+		w.Relative = true
+		spec = strings.TrimPrefix(spec[1:], "+")
+		if spec == "" || strings.HasPrefix(spec, "-") {
+			spec = "0" + spec
+		}
+	}
+
+	start, end := spec, spec
+	if i := strings.Index(spec, "-"); i >= 0 {
+		start, end = spec[:i], spec[i+1:]
+	}
+	var err error
+	if w.Start, err = parseHexAddr(start); err != nil {
+		return w, fmt.Errorf("invalid watchpoint %q: %v", s, err)
+	}
+	if w.End, err = parseHexAddr(end); err != nil {
+		return w, fmt.Errorf("invalid watchpoint %q: %v", s, err)
+	}
+	if w.End < w.Start {
+		return w, fmt.Errorf("invalid watchpoint %q: range ends before it starts", s)
+	}
+
+	return w, nil
+}
+
+// parseHexAddr parses a hex address, optionally prefixed by 0x.
+func parseHexAddr(s string) (uint16, error) {
+	hex := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "0x")
+	addr, err := strconv.ParseUint(hex, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an address", s)
+	}
+
+	return uint16(addr), nil
+}
+
+// String formats the watchpoint the way ParseWatchpoint reads it.
+func (w Watchpoint) String() string {
+	mode := "rw"
+	if !w.Write {
+		mode = "r"
+	} else if !w.Read {
+		mode = "w"
+	}
+	if w.Relative {
+		return fmt.Sprintf("I+%x-%x:%s", w.Start, w.End, mode)
+	}
+
+	return fmt.Sprintf("%x-%x:%s", w.Start, w.End, mode)
+}
+
+// memAccess is the range of RAM an instruction reads or writes.
+type memAccess struct {
+	start, end uint16 // first and last address accessed
+	write      bool
+}
+
+// instructionAccess returns the RAM the instruction op accesses, other than
+// its own fetch, when executed with the I register set to i.
+func instructionAccess(op Opcode, i uint16) (memAccess, bool) {
+	switch {
+	case op&0xF000 == 0xD000 && op.n() > 0:
+		return memAccess{start: i, end: i + uint16(op.n()) - 1}, true
+	case op&0xF0FF == 0xF033:
+		return memAccess{start: i, end: i + 2, write: true}, true
+	case op&0xF0FF == 0xF055:
+		return memAccess{start: i, end: i + uint16(op.x()), write: true}, true
+	case op&0xF0FF == 0xF065:
+		return memAccess{start: i, end: i + uint16(op.x())}, true
+	}
+
+	return memAccess{}, false
+}
+
+// AddWatchpoint starts watching RAM for the accesses described by w.
+func (c *Chip8) AddWatchpoint(w Watchpoint) {
+	c.watchpoints = append(c.watchpoints, w)
+}
+
+// Watchpoints returns the watchpoints set, in the order they were added.
+func (c *Chip8) Watchpoints() []Watchpoint {
+	return append([]Watchpoint(nil), c.watchpoints...)
+}
+
+// ClearWatchpoints removes all watchpoints.
+func (c *Chip8) ClearWatchpoints() {
+	c.watchpoints = nil
+}
+
+// checkWatchpoints pauses execution if the instruction at pc, just executed
+// with the I register set to i, accessed RAM being watched.
+func (c *Chip8) checkWatchpoints(pc uint16, op Opcode, i uint16) {
+	access, ok := instructionAccess(op, i)
+	if !ok {
+		return
+	}
+
+	for _, w := range c.watchpoints {
+		if (access.write && !w.Write) || (!access.write && !w.Read) {
+			continue
+		}
+		start, end := w.Start, w.End
+		if w.Relative {
+			start, end = i+start, i+end
+		}
+		if access.end < start || access.start > end {
+			continue
+		}
+
+		kind := "Read of"
+		if access.write {
+			kind = "Write to"
+		}
+		c.paused = true
+		c.stepping = false
+		c.stepOver = false
+		c.frameStep = false
+		c.stopReason = fmt.Sprintf("%s %#04x-%#04x by %#04x (%04X)", kind, access.start, access.end, pc, uint16(op))
+		c.log.Infof("Watchpoint hit: %s", c.stopReason)
+		return
+	}
+}
@@ -0,0 +1,69 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseWatchpoint(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Watchpoint
+	}{
+		{"300", Watchpoint{Start: 0x300, End: 0x300, Read: true, Write: true}},
+		{"300-30f", Watchpoint{Start: 0x300, End: 0x30F, Read: true, Write: true}},
+		{"0x300-0x30F:w", Watchpoint{Start: 0x300, End: 0x30F, Write: true}},
+		{"300:R", Watchpoint{Start: 0x300, End: 0x300, Read: true}},
+		{"300:rw", Watchpoint{Start: 0x300, End: 0x300, Read: true, Write: true}},
+		{"300:wr", Watchpoint{Start: 0x300, End: 0x300, Read: true, Write: true}},
+		{" 300 :r", Watchpoint{Start: 0x300, End: 0x300, Read: true}},
+		{"0-ffff", Watchpoint{Start: 0, End: 0xFFFF, Read: true, Write: true}},
+		{"I", Watchpoint{Relative: true, Read: true, Write: true}},
+		{"i+4", Watchpoint{Start: 4, End: 4, Relative: true, Read: true, Write: true}},
+		{"I+0-2:r", Watchpoint{Start: 0, End: 2, Relative: true, Read: true}},
+		{"I-2:w", Watchpoint{Start: 0, End: 2, Relative: true, Write: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			w, err := ParseWatchpoint(tt.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w != tt.want {
+				t.Errorf("ParseWatchpoint(%q) = %+v, want %+v", tt.s, w, tt.want)
+			}
+			// String writes it back the way it is read.
+			if back, err := ParseWatchpoint(w.String()); err != nil || back != w {
+				t.Errorf("ParseWatchpoint(%q) = %+v, %v, want %+v", w.String(), back, err, w)
+			}
+		})
+	}
+}
+
+func TestParseWatchpointErrors(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string // end of the error
+	}{
+		{"", `"" is not an address`},
+		{":r", `"" is not an address`},
+		{"300:x", `unknown access "x"`},
+		{"300:", `unknown access ""`},
+		{"300:rwx", `unknown access "rwx"`},
+		{"zz", `"zz" is not an address`},
+		{"300-", `"" is not an address`},
+		{"-300", `"" is not an address`},
+		{"300-301-302", `"301-302" is not an address`},
+		{"10000", `"10000" is not an address`},
+		{"300-10000", `"10000" is not an address`},
+		{"I+10000", `"10000" is not an address`},
+		{"30f-300", "range ends before it starts"},
+		{"I+4-2", "range ends before it starts"},
+	}
+	for _, tt := range tests {
+		_, err := ParseWatchpoint(tt.s)
+		if err == nil || !strings.HasSuffix(err.Error(), tt.want) {
+			t.Errorf("ParseWatchpoint(%q) = %v, want error %q", tt.s, err, tt.want)
+		}
+	}
+}
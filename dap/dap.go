@@ -0,0 +1,659 @@
+// Package dap serves the Debug Adapter Protocol, letting editors such as VS
+// Code attach to the emulator over TCP to set breakpoints, step and inspect
+// the registers, timers and memory.
+//
+// The emulator is a single thread whose call stack is the Chip-8 stack.
+// Breakpoints are set by address, as instruction breakpoints, or by line of
+// the ROM's Octo source, which is assembled to find the address of each
+// line. Sources which don't assemble to the ROM being run are refused.
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/n-ulricksen/chip8/asm"
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// programStart is the address ROMs are loaded at.
+const programStart = 0x200
+
+// threadID is the ID of the only thread, the Chip-8 CPU.
+const threadID = 1
+
+// Variable references of the scopes.
+const (
+	registersRef = 1 + iota
+	timersRef
+)
+
+// pollInterval is how often the emulator is checked for having stopped.
+const pollInterval = 10 * time.Millisecond
+
+// ListenAndServe listens on the TCP address addr and serves debug clients
+// connecting to it, one at a time.
+func ListenAndServe(addr string, c *core.Chip8) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	c.Logger().Infof("Waiting for debug adapter clients on %s", ln.Addr())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		c.Logger().Infof("Debug client attached from %s", conn.RemoteAddr())
+		newSession(conn, c).serve()
+		c.Logger().Infof("Debug client detached")
+	}
+}
+
+// message is the part of a DAP request the session needs.
+type message struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// session is a debug client connected to the emulator.
+type session struct {
+	conn net.Conn
+	c    *core.Chip8
+
+	mu  sync.Mutex // serializes writes to conn
+	seq int        // sequence number of the last message sent
+
+	breakpoints     map[uint16]bool // instruction breakpoints set by the client
+	lineBreakpoints map[uint16]bool // addresses of its source line breakpoints
+	source          *source         // the ROM's source, once breakpoints are set in it
+	done            chan struct{}   // closed when the session ends
+
+	// Set on the emulator's goroutine when the client resumes execution.
+	resumed  bool // resumed since the emulator was last checked
+	stepping bool // resumed by a step
+}
+
+func newSession(conn net.Conn, c *core.Chip8) *session {
+	return &session{
+		conn:            conn,
+		c:               c,
+		breakpoints:     make(map[uint16]bool),
+		lineBreakpoints: make(map[uint16]bool),
+		done:            make(chan struct{}),
+	}
+}
+
+// source is the Octo source of the ROM being debugged.
+type source struct {
+	path  string
+	lines map[int]int // address of each line with code, by line number
+}
+
+// loadSource assembles the Octo source at path, which must assemble to the
+// ROM being run.
+func (s *session) loadSource(path string) (*source, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rom, lines, err := asm.Assemble(src)
+	if err != nil {
+		return nil, fmt.Errorf("assembling %s: %v", filepath.Base(path), err)
+	}
+
+	var mem []byte
+	s.c.Do(func() { mem = s.c.Memory(programStart, len(rom)) })
+	if !bytes.Equal(mem, rom) {
+		return nil, fmt.Errorf("%s does not assemble to the ROM being run", filepath.Base(path))
+	}
+
+	return &source{path: path, lines: lines}, nil
+}
+
+// resolve returns the first line with code from line on, and its address.
+func (src *source) resolve(line int) (int, uint16, bool) {
+	best := 0
+	for l := range src.lines {
+		if l >= line && (best == 0 || l < best) {
+			best = l
+		}
+	}
+
+	return best, uint16(src.lines[best]), best != 0
+}
+
+// lineAt returns the line the instruction at addr was assembled from: the
+// line starting closest before it.
+func (src *source) lineAt(addr uint16) (int, bool) {
+	line, start := 0, -1
+	for l, a := range src.lines {
+		if a <= int(addr) && a > start {
+			line, start = l, a
+		}
+	}
+
+	return line, line != 0
+}
+
+// serve answers the client's requests until it disconnects.
+func (s *session) serve() {
+	defer s.conn.Close()
+	defer close(s.done)
+	go s.watch()
+
+	r := bufio.NewReader(s.conn)
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			if err != io.EOF {
+				s.c.Logger().Errorf("Debug adapter connection: %v", err)
+			}
+			return
+		}
+		if msg.Type != "request" {
+			continue
+		}
+
+		body, err := s.handle(msg)
+		s.respond(msg, body, err)
+		if msg.Command == "initialize" {
+			s.event("initialized", nil)
+		}
+		if msg.Command == "disconnect" {
+			return
+		}
+	}
+}
+
+// readMessage reads a message framed with a Content-Length header.
+func readMessage(r *bufio.Reader) (*message, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %v", err)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	msg := &message{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// send writes a message to the client.
+func (s *session) send(msg map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	msg["seq"] = s.seq
+	data, err := json.Marshal(msg)
+	if err != nil {
+		s.c.Logger().Errorf("Debug adapter: %v", err)
+		return
+	}
+	fmt.Fprintf(s.conn, "Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+// respond answers the request msg with body, or the error err.
+func (s *session) respond(msg *message, body interface{}, err error) {
+	resp := map[string]interface{}{
+		"type":        "response",
+		"request_seq": msg.Seq,
+		"command":     msg.Command,
+		"success":     err == nil,
+	}
+	if err != nil {
+		resp["message"] = err.Error()
+	}
+	if body != nil {
+		resp["body"] = body
+	}
+	s.send(resp)
+}
+
+// event sends the event named event to the client.
+func (s *session) event(event string, body interface{}) {
+	msg := map[string]interface{}{"type": "event", "event": event}
+	if body != nil {
+		msg["body"] = body
+	}
+	s.send(msg)
+}
+
+// watch tells the client whenever execution stops, until the session ends.
+func (s *session) watch() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	wasHalted := true
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		// Execution may have been resumed and stopped again since the
+		// last check, and is then reported as stopped again.
+		var halted, resumed, stepping, atLine bool
+		var reason string
+		s.c.Do(func() {
+			halted, reason = s.c.Halted(), s.c.StopReason()
+			resumed, stepping = s.resumed, s.stepping
+			atLine = s.lineBreakpoints[s.c.Registers().PC]
+			s.resumed = false
+		})
+		if halted && (!wasHalted || resumed) {
+			s.event("stopped", map[string]interface{}{
+				"reason":            stopReason(reason, stepping, atLine),
+				"description":       reason,
+				"threadId":          threadID,
+				"allThreadsStopped": true,
+			})
+		}
+		wasHalted = halted
+	}
+}
+
+// stopReason returns the DAP reason for stopping, given the emulator's,
+// whether execution was resumed by a step and whether it stopped at a line
+// breakpoint.
+func stopReason(reason string, stepping, atLine bool) string {
+	switch {
+	case strings.HasPrefix(reason, "Breakpoint") && atLine:
+		return "breakpoint"
+	case strings.HasPrefix(reason, "Breakpoint"):
+		return "instruction breakpoint"
+	case strings.HasPrefix(reason, "Invalid"):
+		return "exception"
+	case reason != "":
+		return "data breakpoint"
+	case stepping:
+		return "step"
+	}
+
+	return "pause"
+}
+
+// resume runs fn to resume execution, recording whether it is a step.
+func (s *session) resume(fn func(), step bool) {
+	s.c.Do(func() {
+		fn()
+		s.resumed = true
+		s.stepping = step
+	})
+}
+
+// handle executes a request and returns the body of its response.
+func (s *session) handle(msg *message) (interface{}, error) {
+	switch msg.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsInstructionBreakpoints":   true,
+			"supportsDisassembleRequest":       true,
+			"supportsReadMemoryRequest":        true,
+			"supportsSteppingGranularity":      true,
+			"supportsTerminateRequest":         true,
+			"supportsStepBack":                 true,
+		}, nil
+	case "launch", "attach":
+		var args struct {
+			StopOnEntry bool `json:"stopOnEntry"`
+		}
+		json.Unmarshal(msg.Arguments, &args)
+		if args.StopOnEntry {
+			s.c.Do(func() { s.c.SetPaused(true) })
+		}
+		return nil, nil
+	case "configurationDone":
+		return nil, nil
+	case "setBreakpoints":
+		return s.setSourceBreakpoints(msg.Arguments)
+	case "setInstructionBreakpoints":
+		return s.setInstructionBreakpoints(msg.Arguments)
+	case "threads":
+		return map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": threadID, "name": "Chip-8"}},
+		}, nil
+	case "stackTrace":
+		return s.stackTrace(), nil
+	case "scopes":
+		return map[string]interface{}{
+			"scopes": []map[string]interface{}{
+				{"name": "Registers", "variablesReference": registersRef, "expensive": false},
+				{"name": "Timers", "variablesReference": timersRef, "expensive": false},
+			},
+		}, nil
+	case "variables":
+		return s.variables(msg.Arguments)
+	case "continue":
+		s.resume(func() { s.c.SetPaused(false) }, false)
+		return map[string]interface{}{"allThreadsContinued": true}, nil
+	case "next":
+		s.resume(s.c.StepOver, true)
+		return nil, nil
+	case "stepIn":
+		s.resume(s.c.Step, true)
+		return nil, nil
+	case "stepOut":
+		var ok bool
+		s.resume(func() { ok = s.c.StepOut() }, true)
+		if !ok {
+			return nil, fmt.Errorf("not in a subroutine")
+		}
+		return nil, nil
+	case "pause":
+		s.c.Do(func() { s.c.SetPaused(true) })
+		return nil, nil
+	case "stepBack":
+		var ok bool
+		s.resume(func() { ok = s.c.StepBack() }, true)
+		if !ok {
+			return nil, fmt.Errorf("no instruction to step back over")
+		}
+		return nil, nil
+	case "disassemble":
+		return s.disassemble(msg.Arguments)
+	case "readMemory":
+		return s.readMemory(msg.Arguments)
+	case "disconnect":
+		s.replaceBreakpoints(&s.breakpoints, nil)
+		s.replaceBreakpoints(&s.lineBreakpoints, nil)
+		s.c.Do(func() { s.c.SetPaused(false) })
+		return nil, nil
+	case "terminate":
+		s.c.Do(s.c.Stop)
+		s.event("terminated", nil)
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported request %q", msg.Command)
+}
+
+// setSourceBreakpoints answers setBreakpoints, replacing the client's line
+// breakpoints with those given, in the Octo source of the ROM. Each is moved
+// to the first line with code from its own on.
+func (s *session) setSourceBreakpoints(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Source struct {
+			Path string `json:"path"`
+		} `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	src, err := s.loadSource(args.Source.Path)
+	if err == nil {
+		s.source = src
+	}
+	addrs := make(map[uint16]bool)
+	bps := make([]map[string]interface{}, len(args.Breakpoints))
+	for i, bp := range args.Breakpoints {
+		bps[i] = map[string]interface{}{"verified": false, "line": bp.Line}
+		if err != nil {
+			bps[i]["message"] = err.Error()
+			continue
+		}
+		line, addr, ok := src.resolve(bp.Line)
+		if !ok {
+			bps[i]["message"] = "No code at or after this line"
+			continue
+		}
+		addrs[addr] = true
+		bps[i] = map[string]interface{}{
+			"verified":             true,
+			"line":                 line,
+			"instructionReference": reference(addr),
+		}
+	}
+	s.replaceBreakpoints(&s.lineBreakpoints, addrs)
+
+	return map[string]interface{}{"breakpoints": bps}, nil
+}
+
+// setInstructionBreakpoints replaces the client's instruction breakpoints
+// with those at the addresses given.
+func (s *session) setInstructionBreakpoints(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		Breakpoints []struct {
+			InstructionReference string `json:"instructionReference"`
+			Offset               int    `json:"offset"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	addrs := make(map[uint16]bool)
+	bps := make([]map[string]interface{}, len(args.Breakpoints))
+	for i, bp := range args.Breakpoints {
+		addr, err := parseReference(bp.InstructionReference, bp.Offset)
+		if err != nil {
+			bps[i] = map[string]interface{}{"verified": false, "message": err.Error()}
+			continue
+		}
+		addrs[addr] = true
+		bps[i] = map[string]interface{}{
+			"verified":             true,
+			"instructionReference": reference(addr),
+		}
+	}
+	s.replaceBreakpoints(&s.breakpoints, addrs)
+
+	return map[string]interface{}{"breakpoints": bps}, nil
+}
+
+// replaceBreakpoints replaces the breakpoints in *set, the client's
+// instruction or line breakpoints, with those at addrs, leaving those the
+// other set has at the same addresses.
+func (s *session) replaceBreakpoints(set *map[uint16]bool, addrs map[uint16]bool) {
+	if addrs == nil {
+		addrs = make(map[uint16]bool)
+	}
+
+	// The sets are read by watch, on the emulator's goroutine.
+	s.c.Do(func() {
+		old := *set
+		*set = addrs
+		for addr := range old {
+			if !s.breakpoints[addr] && !s.lineBreakpoints[addr] {
+				s.c.ClearBreakpoint(addr)
+			}
+		}
+		for addr := range addrs {
+			s.c.SetBreakpoint(addr)
+		}
+	})
+}
+
+// stackTrace returns the frame at PC followed by one for each CALL on the
+// stack, innermost first.
+func (s *session) stackTrace() interface{} {
+	var r core.Registers
+	s.c.Do(func() { r = s.c.Registers() })
+
+	frames := []map[string]interface{}{s.frame(0, r.PC)}
+	for i := int(r.SP) - 1; i >= 0; i-- {
+		// Stack entries hold return addresses, just past the CALL.
+		frames = append(frames, s.frame(len(frames), r.Stack[i]-2))
+	}
+
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+// frame describes the stack frame id, stopped at addr, at its line of the
+// source if breakpoints were set in it.
+func (s *session) frame(id int, addr uint16) map[string]interface{} {
+	var text string
+	s.c.Do(func() { _, text = s.c.DisassembleAt(addr) })
+
+	frame := map[string]interface{}{
+		"id":                          id,
+		"name":                        fmt.Sprintf("%03X: %s", addr, text),
+		"line":                        0,
+		"column":                      0,
+		"instructionPointerReference": reference(addr),
+	}
+	if s.source != nil {
+		if line, ok := s.source.lineAt(addr); ok {
+			frame["source"] = map[string]interface{}{"name": filepath.Base(s.source.path), "path": s.source.path}
+			frame["line"] = line
+			frame["column"] = 1
+		}
+	}
+
+	return frame
+}
+
+// variables lists the registers or the timers.
+func (s *session) variables(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+
+	var r core.Registers
+	s.c.Do(func() { r = s.c.Registers() })
+
+	var vars []map[string]interface{}
+	add := func(name string, value interface{}, format string) {
+		vars = append(vars, map[string]interface{}{
+			"name":               name,
+			"value":              fmt.Sprintf(format, value),
+			"variablesReference": 0,
+		})
+	}
+	switch args.VariablesReference {
+	case registersRef:
+		for i, v := range r.V {
+			add(fmt.Sprintf("V%X", i), v, "%#02x")
+		}
+		add("I", r.I, "%#03x")
+		add("PC", r.PC, "%#03x")
+		add("SP", r.SP, "%d")
+	case timersRef:
+		add("DT", r.DT, "%d")
+		add("ST", r.ST, "%d")
+	default:
+		return nil, fmt.Errorf("unknown variables reference %d", args.VariablesReference)
+	}
+
+	return map[string]interface{}{"variables": vars}, nil
+}
+
+// disassemble disassembles instructions around a memory reference.
+func (s *session) disassemble(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference   string `json:"memoryReference"`
+		Offset            int    `json:"offset"`
+		InstructionOffset int    `json:"instructionOffset"`
+		InstructionCount  int    `json:"instructionCount"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	base, err := parseReference(args.MemoryReference, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	insts := make([]map[string]interface{}, 0, args.InstructionCount)
+	s.c.Do(func() {
+		for i := 0; i < args.InstructionCount; i++ {
+			addr := int(base) + 2*(args.InstructionOffset+i)
+			if addr < 0 || addr > 0xFFE {
+				// Outside RAM, which the protocol still wants a
+				// placeholder for.
+				insts = append(insts, map[string]interface{}{
+					"address":     reference(uint16(addr & 0xFFFF)),
+					"instruction": "??",
+				})
+				continue
+			}
+			op, text := s.c.DisassembleAt(uint16(addr))
+			insts = append(insts, map[string]interface{}{
+				"address":          reference(uint16(addr)),
+				"instructionBytes": fmt.Sprintf("%04X", op),
+				"instruction":      text,
+			})
+		}
+	})
+
+	return map[string]interface{}{"instructions": insts}, nil
+}
+
+// readMemory reads RAM, base64 encoded.
+func (s *session) readMemory(raw json.RawMessage) (interface{}, error) {
+	var args struct {
+		MemoryReference string `json:"memoryReference"`
+		Offset          int    `json:"offset"`
+		Count           int    `json:"count"`
+	}
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	addr, err := parseReference(args.MemoryReference, args.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	var mem []byte
+	s.c.Do(func() { mem = s.c.Memory(addr, args.Count) })
+	return map[string]interface{}{
+		"address":         reference(addr),
+		"data":            base64.StdEncoding.EncodeToString(mem),
+		"unreadableBytes": args.Count - len(mem),
+	}, nil
+}
+
+// reference formats addr as a memory reference.
+func reference(addr uint16) string {
+	return fmt.Sprintf("0x%03X", addr)
+}
+
+// parseReference parses a memory reference, in hex, plus a byte offset.
+func parseReference(ref string, offset int) (uint16, error) {
+	addr, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(ref), "0x"), 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory reference %q", ref)
+	}
+	addr += uint64(offset)
+	if addr > 0xFFF {
+		return 0, fmt.Errorf("address %#x outside RAM", addr)
+	}
+
+	return uint16(addr), nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// runDiff implements the diff command, listing the differences between two
+// ROMs by address:
+//
+//	chip8 diff [-bytes] a.ch8 b.ch8
+func runDiff(args []string) {
+	fs := newCommandFlags("diff")
+	bytewise := fs.Bool("bytes", false, "List each differing byte, rather than the differing instructions and data")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	pathA, pathB := fs.Arg(0), fs.Arg(1)
+	a, err := ioutil.ReadFile(pathA)
+	if err != nil {
+		log.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(pathB)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("--- %s (%d bytes)\n+++ %s (%d bytes)\n", pathA, len(a), pathB, len(b))
+	common := len(a)
+	if len(b) < common {
+		common = len(b)
+	}
+
+	differ := 0
+	for i := 0; i < common; i++ {
+		if a[i] != b[i] {
+			differ++
+		}
+	}
+
+	if *bytewise {
+		for i := 0; i < common; i++ {
+			if a[i] != b[i] {
+				fmt.Printf("%#03x  %02X  %02X\n", 0x200+i, a[i], b[i])
+			}
+		}
+	} else {
+		textA, textB := wordTexts(a), wordTexts(b)
+		for i := 0; i < common; i += 2 {
+			end := i + 2
+			if end > common {
+				end = common
+			}
+			if string(a[i:end]) == string(b[i:end]) {
+				continue
+			}
+			fmt.Printf("%#03x  %-28s  %s\n", 0x200+i, textA[i], textB[i])
+		}
+	}
+
+	switch {
+	case len(a) > common:
+		fmt.Printf("Only in %s: %#03x-%#03x\n", pathA, 0x200+common, 0x200+len(a)-1)
+	case len(b) > common:
+		fmt.Printf("Only in %s: %#03x-%#03x\n", pathB, 0x200+common, 0x200+len(b)-1)
+	}
+	fmt.Printf("%d of %d bytes differ\n", differ, common)
+}
+
+// wordTexts returns the raw bytes and assembly of each word of rom, by its
+// offset: the instruction when the word is code, and .db data otherwise.
+func wordTexts(rom []byte) map[int]string {
+	code := make(map[int]string)
+	for _, line := range core.DisassembleROM(rom, core.ListingOptions{}) {
+		if len(line.Bytes) == 2 && line.Text[0] != '.' {
+			code[int(line.Addr)-0x200] = line.Text
+		}
+	}
+
+	texts := make(map[int]string)
+	for i := 0; i < len(rom); i += 2 {
+		if i+1 == len(rom) {
+			texts[i] = fmt.Sprintf("%02X    .db %#02x", rom[i], rom[i])
+		} else if text, ok := code[i]; ok {
+			texts[i] = fmt.Sprintf("%02X%02X  %s", rom[i], rom[i+1], text)
+		} else {
+			texts[i] = fmt.Sprintf("%02X%02X  .db %#02x, %#02x", rom[i], rom[i+1], rom[i], rom[i+1])
+		}
+	}
+
+	return texts
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// runDisasm implements the disasm subcommand, printing the listing of a ROM:
+//
+//	chip8 disasm [-o listing.txt] [-linear] [-octo] [-sym game.sym] game.ch8
+func runDisasm(args []string) {
+	fs := newCommandFlags("disasm")
+	out := fs.String("o", "", "Write the listing to this file instead of stdout")
+	linear := fs.Bool("linear", false, "Disassemble every word in order, rather than following the code from the entry point")
+	octo := fs.Bool("octo", false, "Write Octo source, which the asm command reassembles into the same ROM")
+	sympath := fs.String("sym", "", "Name addresses after the symbols in this file, with a NAME ADDRESS pair a line")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	rom, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	opts := core.ListingOptions{Linear: *linear, Octo: *octo}
+	if *sympath != "" {
+		if opts.Symbols, err = loadSymbols(*sympath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	for _, line := range core.DisassembleROM(rom, opts) {
+		if *octo {
+			for _, label := range line.Labels {
+				fmt.Fprintf(w, ": %s\n", label)
+			}
+			fmt.Fprintf(w, "\t%s\n", line.Text)
+			continue
+		}
+
+		for _, label := range line.Labels {
+			fmt.Fprintf(w, "%s:\n", label)
+		}
+		if len(line.Bytes) == 2 && line.Text[0] != '.' {
+			fmt.Fprintf(w, "%04X  %02X%02X  %s\n", line.Addr, line.Bytes[0], line.Bytes[1], line.Text)
+		} else {
+			fmt.Fprintf(w, "%04X        %s\n", line.Addr, line.Text)
+		}
+	}
+}
+
+// loadSymbols reads a symbol file, such as one listing the labels of an Octo
+// program: a name and an address, in either order, on each line, e.g.
+// "main 0x200" or "0x200 = main". Lines starting with # are comments.
+func loadSymbols(path string) (map[uint16]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := make(map[uint16]string)
+	for n, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(strings.ReplaceAll(line, "=", " "))
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a name and an address", path, n+1)
+		}
+
+		name, addr := fields[0], fields[1]
+		if _, err := strconv.ParseUint(name, 0, 16); err == nil {
+			name, addr = addr, name
+		}
+		v, err := strconv.ParseUint(addr, 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %q is not an address", path, n+1, addr)
+		}
+		symbols[uint16(v)] = name
+	}
+
+	return symbols, nil
+}
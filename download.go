@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// maxDownloadSize is the largest ROM, or Octo source, downloaded or
+	// extracted from an archive.
+	maxDownloadSize = 1 << 20
+
+	downloadTimeout = 30 * time.Second
+)
+
+// isURL reports whether the ROM given is an http(s) URL to download rather
+// than a path.
+func isURL(rom string) bool {
+	return strings.HasPrefix(rom, "http://") || strings.HasPrefix(rom, "https://")
+}
+
+// downloadRom downloads the ROM at rawurl, checking it has the sha1 sum if
+// one is given, and returns the path it was saved to by cacheRom, named
+// after the URL.
+func downloadRom(rawurl, sum string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+
+	logger.Infof("Downloading ROM from %s", rawurl)
+	client := http.Client{Timeout: downloadTimeout}
+	resp, err := client.Get(rawurl)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", rawurl, resp.Status)
+	}
+	if resp.ContentLength > maxDownloadSize {
+		return "", fmt.Errorf("%s: %d bytes, larger than the %d bytes a ROM may be", rawurl, resp.ContentLength, maxDownloadSize)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", rawurl, err)
+	}
+	if len(data) > maxDownloadSize {
+		return "", fmt.Errorf("%s: larger than the %d bytes a ROM may be", rawurl, maxDownloadSize)
+	}
+
+	hash := fmt.Sprintf("%x", sha1.Sum(data))
+	if sum != "" && !strings.EqualFold(sum, hash) {
+		return "", fmt.Errorf("%s: sha1 is %s, expected %s", rawurl, hash, sum)
+	}
+
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		name = "rom.ch8"
+	}
+
+	return cacheRom(name, data)
+}
+
+// cacheRom saves a ROM which isn't a file of its own, such as one downloaded
+// or extracted from an archive, to the user's cache directory, and returns
+// its path. The file is called name, which names the ROM and tells Octo
+// source apart.
+func cacheRom(name string, data []byte) (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(cache, "gochip8", "roms", fmt.Sprintf("%x", sha1.Sum(data)))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	saved := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(saved, data, 0644); err != nil {
+		return "", err
+	}
+
+	return saved, nil
+}
@@ -0,0 +1,158 @@
+//go:build ebiten
+// +build ebiten
+
+// Package ebitenui implements a frontend for the Chip-8 emulator on top of
+// Ebitengine, which unlike SDL2 needs no C libraries on most platforms.
+//
+// It is only built with the ebiten build tag:
+//
+//	go build -tags "ebiten nosdl"
+package ebitenui
+
+import (
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/n-ulricksen/chip8/core"
+)
+
+const (
+	windowScale = 10
+	windowTitle = "Chip-8 Emulator"
+)
+
+// errFinished ends the game loop once the emulator has stopped.
+var errFinished = errors.New("emulator finished")
+
+// Frontend is an Ebitengine game showing the emulator display. Ebitengine
+// must own the main goroutine, so the emulator runs on its own goroutine and
+// the two exchange frames and key states under a mutex.
+type Frontend struct {
+	mu       sync.Mutex
+	pixels   []byte        // RGBA pixels of the latest frame
+	keys     [16]bool      // keypad state read by the game loop
+	held     [16]bool      // keypad state last passed to the emulator
+	closed   bool          // the window has been closed
+	finished bool          // the emulator has stopped
+	screen   *ebiten.Image // the display, at its native resolution
+	keybinds map[ebiten.Key]uint8
+}
+
+// New returns an Ebitengine frontend reading the keypad using the named
+// keyboard layout, "standard" or "classic". The window opens when Run is
+// called.
+func New(layout string) *Frontend {
+	binds, ok := layouts[layout]
+	if !ok {
+		log.Fatalf("Unknown keyboard layout %q\n", layout)
+	}
+
+	return &Frontend{
+		pixels:   make([]byte, core.Chip8Width*core.Chip8Height*4),
+		keybinds: binds,
+	}
+}
+
+// Run opens the window and calls run, which should run the emulator with f as
+// its frontend, on a separate goroutine. It returns once both have finished.
+func (f *Frontend) Run(run func()) error {
+	ebiten.SetWindowSize(core.Chip8Width*windowScale, core.Chip8Height*windowScale)
+	ebiten.SetWindowTitle(windowTitle)
+	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
+
+	done := make(chan struct{})
+	go func() {
+		run()
+		close(done)
+	}()
+
+	err := ebiten.RunGame(f)
+	if err == errFinished {
+		err = nil
+	}
+
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+	<-done
+
+	return err
+}
+
+// Render stores the current frame to be drawn by the game loop.
+func (f *Frontend) Render(c *core.Chip8) {
+	f.mu.Lock()
+	copy(f.pixels, c.Pixels())
+	f.mu.Unlock()
+}
+
+// PollEvents passes keypad changes read by the game loop to the emulator, and
+// stops it once the window has been closed.
+func (f *Frontend) PollEvents(c *core.Chip8) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		c.Stop()
+		return
+	}
+	for key, pressed := range f.keys {
+		if pressed != f.held[key] {
+			c.SetKey(uint8(key), pressed)
+			f.held[key] = pressed
+		}
+	}
+}
+
+// Close ends the game loop.
+func (f *Frontend) Close() {
+	f.mu.Lock()
+	f.finished = true
+	f.mu.Unlock()
+}
+
+// Update reads the keypad state. It implements ebiten.Game.
+func (f *Frontend) Update() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.finished {
+		return errFinished
+	}
+	for k, key := range f.keybinds {
+		f.keys[key] = ebiten.IsKeyPressed(k)
+	}
+
+	return nil
+}
+
+// Draw scales the latest frame to fit the window, keeping its aspect ratio.
+// It implements ebiten.Game.
+func (f *Frontend) Draw(screen *ebiten.Image) {
+	if f.screen == nil {
+		f.screen = ebiten.NewImage(core.Chip8Width, core.Chip8Height)
+	}
+
+	f.mu.Lock()
+	f.screen.ReplacePixels(f.pixels)
+	f.mu.Unlock()
+
+	w, h := screen.Bounds().Dx(), screen.Bounds().Dy()
+	scale := float64(w) / core.Chip8Width
+	if s := float64(h) / core.Chip8Height; s < scale {
+		scale = s
+	}
+
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(scale, scale)
+	op.GeoM.Translate((float64(w)-core.Chip8Width*scale)/2, (float64(h)-core.Chip8Height*scale)/2)
+	screen.DrawImage(f.screen, op)
+}
+
+// Layout uses the window's size as the screen size, so Draw does the scaling.
+// It implements ebiten.Game.
+func (f *Frontend) Layout(outsideWidth, outsideHeight int) (int, int) {
+	return outsideWidth, outsideHeight
+}
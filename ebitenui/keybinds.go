@@ -0,0 +1,47 @@
+//go:build ebiten
+// +build ebiten
+
+package ebitenui
+
+import "github.com/hajimehoshi/ebiten/v2"
+
+// layouts map keyboard keys to Chip-8 keys, by keyboard layout name, using
+// the same layouts as the SDL frontend.
+var layouts = map[string]map[ebiten.Key]uint8{
+	"standard": {
+		ebiten.KeyDigit1: 0x1,
+		ebiten.KeyDigit2: 0x2,
+		ebiten.KeyDigit3: 0x3,
+		ebiten.KeyDigit4: 0xc,
+		ebiten.KeyQ:      0x4,
+		ebiten.KeyW:      0x5,
+		ebiten.KeyE:      0x6,
+		ebiten.KeyR:      0xd,
+		ebiten.KeyA:      0x7,
+		ebiten.KeyS:      0x8,
+		ebiten.KeyD:      0x9,
+		ebiten.KeyF:      0xe,
+		ebiten.KeyZ:      0xa,
+		ebiten.KeyX:      0x0,
+		ebiten.KeyC:      0xb,
+		ebiten.KeyV:      0xf,
+	},
+	"classic": {
+		ebiten.KeyDigit7:    0x1,
+		ebiten.KeyDigit8:    0x2,
+		ebiten.KeyDigit9:    0x3,
+		ebiten.KeyDigit0:    0xc,
+		ebiten.KeyU:         0x4,
+		ebiten.KeyI:         0x5,
+		ebiten.KeyO:         0x6,
+		ebiten.KeyP:         0xd,
+		ebiten.KeyJ:         0x7,
+		ebiten.KeyK:         0x8,
+		ebiten.KeyL:         0x9,
+		ebiten.KeySemicolon: 0xe,
+		ebiten.KeyM:         0xa,
+		ebiten.KeyComma:     0x0,
+		ebiten.KeyPeriod:    0xb,
+		ebiten.KeySlash:     0xf,
+	},
+}
@@ -0,0 +1,10 @@
+// Package fonts holds the fonts built into the emulator, so it runs from any
+// directory.
+package fonts
+
+import _ "embed"
+
+// DotGothic16 is the TrueType font the SDL frontend draws its text with.
+//
+//go:embed DotGothic16-Regular.ttf
+var DotGothic16 []byte
@@ -0,0 +1,521 @@
+// Package gdbstub serves the GDB remote serial protocol, letting GDB and
+// other debuggers speaking it attach to the emulator over TCP.
+//
+// GDB has no Chip-8 architecture, so registers are numbered by this stub:
+// 0-15 are V0-VF, 16 is I, 17 is PC, 18 SP, 19 DT and 20 ST. V registers, SP,
+// DT and ST are a byte each, I and PC two bytes, little endian. The stub
+// describes them to the debugger in target.xml, read with qXfer. Memory
+// addresses are Chip-8 RAM addresses.
+package gdbstub
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// Register numbers of I and the registers following it.
+const (
+	regI = 16 + iota
+	regPC
+	regSP
+	regDT
+	regST
+	numRegs
+)
+
+// Signals reported to the debugger when execution stops.
+const (
+	sigInt  = 2  // interrupted by the debugger
+	sigIll  = 4  // invalid opcode
+	sigTrap = 5  // breakpoint, watchpoint or step
+	sigSegv = 11 // access past the end of RAM or the stack
+)
+
+// pollInterval is how often a running emulator is checked for having
+// stopped.
+const pollInterval = 10 * time.Millisecond
+
+// ListenAndServe listens on the TCP address addr and serves debuggers
+// connecting to it, one at a time. The emulator is paused while a debugger
+// is attached.
+func ListenAndServe(addr string, c *core.Chip8) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	c.Logger().Infof("Waiting for GDB on %s", ln.Addr())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		c.Logger().Infof("GDB attached from %s", conn.RemoteAddr())
+		newSession(conn, c).serve()
+		c.Logger().Infof("GDB detached")
+	}
+}
+
+// session is a debugger connected to the emulator.
+type session struct {
+	conn       net.Conn
+	c          *core.Chip8
+	packets    chan string   // packets received, without framing
+	interrupts chan struct{} // Ctrl-C pressed in the debugger
+	closed     chan struct{} // closed once the connection is
+}
+
+func newSession(conn net.Conn, c *core.Chip8) *session {
+	return &session{
+		conn:       conn,
+		c:          c,
+		packets:    make(chan string),
+		interrupts: make(chan struct{}, 1),
+		closed:     make(chan struct{}),
+	}
+}
+
+// serve answers the debugger's packets until it detaches or disconnects,
+// then resumes the emulator.
+func (s *session) serve() {
+	defer s.conn.Close()
+	go s.read()
+
+	s.c.Do(func() { s.c.SetPaused(true) })
+	defer s.c.Do(func() { s.c.SetPaused(false) })
+
+	for packet := range s.packets {
+		reply, done := s.handle(packet)
+		select {
+		case <-s.closed:
+			return
+		default:
+		}
+		if _, err := fmt.Fprintf(s.conn, "+$%s#%02x", reply, checksum(reply)); err != nil {
+			s.c.Logger().Errorf("GDB connection: %v", err)
+			return
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// read splits what the debugger sends into packets, dropping
+// acknowledgements and checksums, until the connection is closed.
+func (s *session) read() {
+	defer close(s.packets)
+	defer close(s.closed)
+
+	r := bufio.NewReader(s.conn)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		switch b {
+		case 0x03:
+			select {
+			case s.interrupts <- struct{}{}:
+			default:
+			}
+		case '$':
+			packet, err := r.ReadString('#')
+			if err != nil {
+				return
+			}
+			if _, err := r.Discard(2); err != nil {
+				return
+			}
+			s.packets <- strings.TrimSuffix(packet, "#")
+		}
+	}
+}
+
+// checksum returns the checksum of a packet's data.
+func checksum(data string) uint8 {
+	var sum uint8
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+
+	return sum
+}
+
+// handle executes a packet and returns the reply, and whether the session
+// has ended. Unsupported packets get an empty reply, as the protocol asks.
+func (s *session) handle(packet string) (string, bool) {
+	if packet == "" {
+		return "", false
+	}
+
+	args := packet[1:]
+	switch packet[0] {
+	case '?':
+		return stopReply(sigTrap), false
+	case 'g':
+		var regs string
+		s.c.Do(func() { regs = encodeRegisters(s.c.Registers()) })
+		return regs, false
+	case 'G':
+		return s.writeRegisters(args), false
+	case 'p':
+		return s.readRegister(args), false
+	case 'P':
+		return s.writeRegister(args), false
+	case 'm':
+		return s.readMemory(args), false
+	case 'M':
+		return s.writeMemory(args), false
+	case 'Z', 'z':
+		return s.breakpoint(packet[0] == 'Z', args), false
+	case 'c':
+		s.c.Do(func() { s.c.SetPaused(false) })
+		return s.wait(), false
+	case 's':
+		s.c.Do(s.c.Step)
+		return s.wait(), false
+	case 'b':
+		if args != "s" {
+			return "", false
+		}
+		var ok bool
+		s.c.Do(func() { ok = s.c.StepBack() })
+		if !ok {
+			// The start of the recorded history.
+			return "T05replaylog:begin;", false
+		}
+		return stopReply(sigTrap), false
+	case 'H', 'T':
+		return "OK", false
+	case 'D':
+		return "OK", true
+	case 'k':
+		s.c.Do(s.c.Stop)
+		return "OK", true
+	case 'q':
+		return query(args), false
+	}
+
+	return "", false
+}
+
+// query answers the general query q.
+func query(q string) string {
+	switch {
+	case strings.HasPrefix(q, "Supported"):
+		return "PacketSize=1000;ReverseStep+;qXfer:features:read+"
+	case strings.HasPrefix(q, "Xfer:features:read:"):
+		return readFeatures(strings.TrimPrefix(q, "Xfer:features:read:"))
+	case q == "Attached":
+		return "1"
+	case q == "C":
+		return "QC1"
+	case q == "fThreadInfo":
+		return "m1"
+	case q == "sThreadInfo":
+		return "l"
+	}
+
+	return ""
+}
+
+// targetXML describes the registers to the debugger, in the order of their
+// numbers.
+var targetXML = func() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+<feature name="org.gochip8.chip8">
+`)
+	for n := 0; n < regI; n++ {
+		fmt.Fprintf(&b, "<reg name=\"v%x\" bitsize=\"8\" type=\"uint8\" regnum=\"%d\"/>\n", n, n)
+	}
+	for n, name := range []string{"i", "pc", "sp", "dt", "st"} {
+		size := 8
+		if n+regI == regI || n+regI == regPC {
+			size = 16
+		}
+		fmt.Fprintf(&b, "<reg name=%q bitsize=\"%d\" type=\"uint%d\" regnum=\"%d\"/>\n", name, size, size, n+regI)
+	}
+	b.WriteString("</feature>\n</target>\n")
+
+	return b.String()
+}()
+
+// readFeatures answers a qXfer:features:read query, annex:offset,length,
+// with the part of the target description asked for.
+func readFeatures(args string) string {
+	parts := strings.SplitN(args, ":", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	if parts[0] != "target.xml" {
+		return "E00"
+	}
+	offset, length, err := parseRange(parts[1])
+	if err != nil {
+		return "E01"
+	}
+
+	if int(offset) >= len(targetXML) {
+		return "l"
+	}
+	data := targetXML[offset:]
+	if len(data) > length {
+		return "m" + data[:length]
+	}
+
+	return "l" + data
+}
+
+// stopReply reports execution having stopped with signal sig.
+func stopReply(sig int) string {
+	return fmt.Sprintf("S%02x", sig)
+}
+
+// wait waits for execution to stop, and returns the stop reply. Execution
+// is stopped when the debugger interrupts it. If the debugger disconnects
+// meanwhile, it returns at once, with no reply to send.
+func (s *session) wait() string {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closed:
+			return ""
+		case <-s.interrupts:
+			s.c.Do(func() { s.c.SetPaused(true) })
+			return stopReply(sigInt)
+		case <-ticker.C:
+			var halted bool
+			var reason string
+			s.c.Do(func() { halted, reason = s.c.Halted(), s.c.StopReason() })
+			if halted && strings.HasPrefix(reason, "Invalid opcode") {
+				return stopReply(sigIll)
+			}
+			if halted && strings.HasPrefix(reason, "Invalid") {
+				return stopReply(sigSegv)
+			}
+			if halted {
+				return stopReply(sigTrap)
+			}
+		}
+	}
+}
+
+// encodeRegisters encodes all registers in the order of their numbers.
+func encodeRegisters(r core.Registers) string {
+	var b strings.Builder
+	for n := 0; n < numRegs; n++ {
+		b.WriteString(encodeRegister(r, n))
+	}
+
+	return b.String()
+}
+
+// encodeRegister encodes register n, as hex in target byte order.
+func encodeRegister(r core.Registers, n int) string {
+	switch n {
+	case regI:
+		return fmt.Sprintf("%02x%02x", r.I&0xFF, r.I>>8)
+	case regPC:
+		return fmt.Sprintf("%02x%02x", r.PC&0xFF, r.PC>>8)
+	case regSP:
+		return fmt.Sprintf("%02x", r.SP)
+	case regDT:
+		return fmt.Sprintf("%02x", r.DT)
+	case regST:
+		return fmt.Sprintf("%02x", r.ST)
+	}
+
+	return fmt.Sprintf("%02x", r.V[n])
+}
+
+// setRegister sets register n of r to the little endian value in b.
+func setRegister(r *core.Registers, n int, b []byte) bool {
+	size := 1
+	if n == regI || n == regPC {
+		size = 2
+	}
+	if n < 0 || n >= numRegs || len(b) != size {
+		return false
+	}
+
+	switch n {
+	case regI:
+		r.I = uint16(b[0]) | uint16(b[1])<<8
+	case regPC:
+		r.PC = uint16(b[0]) | uint16(b[1])<<8
+	case regSP:
+		r.SP = b[0]
+	case regDT:
+		r.DT = b[0]
+	case regST:
+		r.ST = b[0]
+	default:
+		r.V[n] = b[0]
+	}
+
+	return true
+}
+
+// writeRegisters sets all registers from a G packet.
+func (s *session) writeRegisters(args string) string {
+	data, err := hex.DecodeString(args)
+	if err != nil {
+		return "E01"
+	}
+
+	ok := true
+	s.c.Do(func() {
+		r := s.c.Registers()
+		for n := 0; n < numRegs && ok; n++ {
+			size := 1
+			if n == regI || n == regPC {
+				size = 2
+			}
+			if len(data) < size {
+				ok = false
+				break
+			}
+			ok = setRegister(&r, n, data[:size])
+			data = data[size:]
+		}
+		if ok {
+			s.c.SetRegisters(r)
+		}
+	})
+	if !ok {
+		return "E01"
+	}
+
+	return "OK"
+}
+
+// readRegister answers a p packet reading one register.
+func (s *session) readRegister(args string) string {
+	n, err := strconv.ParseUint(args, 16, 8)
+	if err != nil || n >= numRegs {
+		return "E01"
+	}
+
+	var reg string
+	s.c.Do(func() { reg = encodeRegister(s.c.Registers(), int(n)) })
+	return reg
+}
+
+// writeRegister answers a P packet, n=value, writing one register.
+func (s *session) writeRegister(args string) string {
+	parts := strings.SplitN(args, "=", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	n, err := strconv.ParseUint(parts[0], 16, 8)
+	if err != nil {
+		return "E01"
+	}
+	value, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return "E01"
+	}
+
+	ok := false
+	s.c.Do(func() {
+		r := s.c.Registers()
+		if ok = setRegister(&r, int(n), value); ok {
+			s.c.SetRegisters(r)
+		}
+	})
+	if !ok {
+		return "E01"
+	}
+
+	return "OK"
+}
+
+// parseRange parses the addr,length of memory packets.
+func parseRange(args string) (uint16, int, error) {
+	parts := strings.SplitN(args, ",", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid range %q", args)
+	}
+	addr, err := strconv.ParseUint(parts[0], 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return uint16(addr), int(length), nil
+}
+
+// readMemory answers an m packet, addr,length, reading RAM.
+func (s *session) readMemory(args string) string {
+	addr, length, err := parseRange(args)
+	if err != nil {
+		return "E01"
+	}
+
+	var mem []byte
+	s.c.Do(func() { mem = s.c.Memory(addr, length) })
+	if len(mem) == 0 && length > 0 {
+		return "E14"
+	}
+
+	return hex.EncodeToString(mem)
+}
+
+// writeMemory answers an M packet, addr,length:data, writing RAM.
+func (s *session) writeMemory(args string) string {
+	parts := strings.SplitN(args, ":", 2)
+	if len(parts) != 2 {
+		return "E01"
+	}
+	addr, length, err := parseRange(parts[0])
+	if err != nil {
+		return "E01"
+	}
+	data, err := hex.DecodeString(parts[1])
+	if err != nil || len(data) != length {
+		return "E01"
+	}
+
+	s.c.Do(func() { s.c.WriteMemory(addr, data) })
+	return "OK"
+}
+
+// breakpoint answers Z and z packets, type,addr,kind, inserting or
+// removing a breakpoint. Software and hardware breakpoints are alike here;
+// watchpoints aren't supported.
+func (s *session) breakpoint(insert bool, args string) string {
+	parts := strings.Split(args, ",")
+	if len(parts) != 3 || (parts[0] != "0" && parts[0] != "1") {
+		return ""
+	}
+	addr, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return "E01"
+	}
+
+	s.c.Do(func() {
+		if insert {
+			s.c.SetBreakpoint(uint16(addr))
+		} else {
+			s.c.ClearBreakpoint(uint16(addr))
+		}
+	})
+	return "OK"
+}
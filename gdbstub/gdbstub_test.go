@@ -0,0 +1,117 @@
+package gdbstub
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// runningFrontend runs the emulator until done is closed.
+type runningFrontend struct {
+	done chan struct{}
+}
+
+func (fe runningFrontend) Render(c *core.Chip8) {}
+
+func (fe runningFrontend) PollEvents(c *core.Chip8) {
+	select {
+	case <-fe.done:
+		c.Stop()
+	default:
+	}
+}
+
+func (fe runningFrontend) Close() {}
+
+// TestDisconnectWhileRunning checks the session ends when the debugger
+// disconnects while execution continues, rather than waiting on the ROM to
+// stop, which this one never does.
+func TestDisconnectWhileRunning(t *testing.T) {
+	c, err := core.NewChip8(core.Options{Unpaced: true, Logger: core.NewLogger(ioutil.Discard, core.LogError)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadRomData([]byte{0x12, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := c.Run(runningFrontend{done}); err != nil {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	server, client := net.Pipe()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		newSession(server, c).serve()
+	}()
+
+	if _, err := fmt.Fprintf(client, "$c#%02x", checksum("c")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * pollInterval)
+	client.Close()
+
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Fatal("session still serving after the debugger disconnected")
+	}
+	var paused bool
+	c.Do(func() { paused = c.Paused() })
+	if paused {
+		t.Error("emulator left paused")
+	}
+}
+
+func TestReadFeatures(t *testing.T) {
+	// Read target.xml in chunks, as GDB does.
+	var xml strings.Builder
+	for offset := 0; ; offset += 0x40 {
+		reply := readFeatures(fmt.Sprintf("target.xml:%x,40", offset))
+		if reply == "" || (reply[0] != 'm' && reply[0] != 'l') {
+			t.Fatalf("offset %#x: reply %q", offset, reply)
+		}
+		xml.WriteString(reply[1:])
+		if reply[0] == 'l' {
+			break
+		}
+	}
+	if xml.String() != targetXML {
+		t.Errorf("target.xml read as %q, expected %q", xml.String(), targetXML)
+	}
+	for _, reg := range []string{`name="v0" bitsize="8"`, `name="vf"`, `name="pc" bitsize="16"`, `regnum="20"`} {
+		if !strings.Contains(targetXML, reg) {
+			t.Errorf("target.xml lacks %s", reg)
+		}
+	}
+
+	tests := []struct {
+		args, reply string
+	}{
+		{"other.xml:0,40", "E00"},
+		{"target.xml", "E01"},
+		{"target.xml:zz,40", "E01"},
+		{fmt.Sprintf("target.xml:%x,40", len(targetXML)), "l"},
+	}
+	for _, tt := range tests {
+		if reply := readFeatures(tt.args); reply != tt.reply {
+			t.Errorf("readFeatures(%q) = %q, expected %q", tt.args, reply, tt.reply)
+		}
+	}
+}
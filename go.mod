@@ -1,5 +1,10 @@
 module github.com/n-ulricksen/chip8
 
-go 1.15
+go 1.16
 
-require github.com/veandco/go-sdl2 v0.4.12
+require (
+	github.com/BurntSushi/toml v1.2.1
+	github.com/hajimehoshi/ebiten/v2 v2.4.17
+	github.com/veandco/go-sdl2 v0.4.12
+	github.com/yuin/gopher-lua v0.0.0-20210529063254-f4c35e4016d9
+)
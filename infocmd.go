@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// stackSize is the number of return addresses the Chip-8 stack holds.
+const stackSize = 16
+
+// runInfo implements the info subcommand, describing a ROM:
+//
+//	chip8 info game.ch8
+func runInfo(args []string) {
+	fs := newCommandFlags("info")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	rom, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	info := core.AnalyzeROM(rom)
+
+	fmt.Printf("Size:         %d bytes (0x200-%#03x)\n", len(rom), 0x200+len(rom)-1)
+	fmt.Printf("SHA-1:        %x\n", sha1.Sum(rom))
+	if known, ok := lookupRom(fmt.Sprintf("%x", sha1.Sum(rom))); ok {
+		fmt.Printf("Name:         %s\n", known.Name)
+		if text := known.describe(); text != "" {
+			fmt.Printf("              %s\n", text)
+		}
+	}
+	fmt.Printf("Code:         %d bytes reachable, %d bytes data or unreached\n", info.CodeBytes, len(rom)-info.CodeBytes)
+
+	switch {
+	case info.StackDepth < 0:
+		fmt.Println("Stack depth:  unbounded, subroutines recurse")
+	case info.StackDepth > stackSize:
+		fmt.Printf("Stack depth:  %d, overflowing the stack of %d\n", info.StackDepth, stackSize)
+	default:
+		fmt.Printf("Stack depth:  %d of %d\n", info.StackDepth, stackSize)
+	}
+
+	variants := make(map[string]bool)
+	for _, ext := range info.Extensions {
+		variants[strings.Fields(ext.Name)[0]] = true
+	}
+	switch {
+	case variants["XO-CHIP"]:
+		fmt.Println("Platform:     XO-CHIP")
+	case variants["SCHIP"]:
+		fmt.Println("Platform:     SCHIP")
+	default:
+		fmt.Println("Platform:     Chip-8")
+	}
+	for _, ext := range info.Extensions {
+		fmt.Printf("  %#03x  %04X  %s\n", ext.Addr, ext.Op, ext.Name)
+	}
+
+	fmt.Println("\nMemory accessed through I:")
+	for _, r := range info.Memory {
+		fmt.Printf("  %s  (%d bytes)\n", r, int(r.End)-int(r.Start)+1)
+	}
+
+	fmt.Println("\nInstructions:")
+	patterns := make([]string, 0, len(info.Ops))
+	for pattern := range info.Ops {
+		patterns = append(patterns, pattern)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		a, b := patterns[i], patterns[j]
+		if info.Ops[a] != info.Ops[b] {
+			return info.Ops[a] > info.Ops[b]
+		}
+		return a < b
+	})
+	for _, pattern := range patterns {
+		fmt.Printf("  %-6s %5d\n", pattern, info.Ops[pattern])
+	}
+}
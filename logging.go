@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+var (
+	loglevel string
+	logpath  string
+)
+
+// logger receives the messages of the emulator and of the commands running
+// it, set up by setupLogging.
+var logger = core.NewLogger(os.Stderr, core.LogInfo)
+
+// loggingFlags registers the flags of setupLogging on fs.
+func loggingFlags(fs *flag.FlagSet) {
+	fs.StringVar(&loglevel, "loglevel", "info", "Least important messages logged (debug, info, warn, error)")
+	fs.StringVar(&logpath, "logfile", "", "Append logged messages to this file as well as writing them to stderr")
+}
+
+// setupLogging points logger at stderr, and at -logfile if given, for
+// messages at -loglevel and above. Fatal errors logged through the log
+// package go to the same places.
+func setupLogging() {
+	level, err := core.ParseLogLevel(loglevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var w io.Writer = os.Stderr
+	if logpath != "" {
+		f, err := os.OpenFile(logpath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatal("Unable to open log file: ", err)
+		}
+		w = io.MultiWriter(os.Stderr, f)
+	}
+	log.SetOutput(w)
+	logger = core.NewLogger(w, level)
+}
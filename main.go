@@ -1,43 +1,602 @@
 package main
 
 import (
+	"crypto/sha1"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
 
+	"github.com/n-ulricksen/chip8/api"
+	"github.com/n-ulricksen/chip8/console"
 	"github.com/n-ulricksen/chip8/core"
-)
-
-// The path to the ROM used to test our emulator.
-var (
-	testpath string = "./test/BC_test.ch8"
+	"github.com/n-ulricksen/chip8/dap"
+	"github.com/n-ulricksen/chip8/gdbstub"
+	"github.com/n-ulricksen/chip8/testrom"
 )
 
 var (
+	testpath  string
+	fontpath  string
 	flagtest  bool
 	flagdebug bool
 	rompath   string
+	filters   string
+	shotdir   string
+	crashdir  string
+	videopath string
+	backend   string
+	clock     string
+	cfgpath   string
+	layout    string
+	moviepath string
+	playpath  string
+	quirks    string
+	romcheck  string
+	cheatpath string
+	statesdir string
+	romdirs   string
+	romsum    string
+	zipentry  string
+	recentn   int
+	extmem    bool
+	seed      int64
+	rewind    int
+	speed     string
+	palette   string
+	scale     int
+	volume    int
+	tone      float64
+	determ    bool
+	keypad    bool
+	autosave  bool
+	breaks    string
+	watches   string
+	gdbaddr   string
+	dapaddr   string
+	apiaddr   string
+	conaddr   string
+	serveaddr string
+	mjpegaddr string
+	repl      bool
+
+	tracepath  string
+	tracerange string
+	traceops   string
+	traceregs  bool
+	profpath   string
+	hashpath   string
+	scriptpath string
+)
+
+// Keypad bindings read from the config file, if any.
+var (
+	keymap map[string]uint8 // keyboard keys
+	padmap map[string]uint8 // game controller buttons
+
+	// Overrides for the loaded ROM, bound on top of the above.
+	gamekeys map[string]uint8
+	gamepad  map[string]uint8
 )
 
-func init() {
-	flag.BoolVar(&flagtest, "t", false, "Load the emulator test ROM")
-	flag.BoolVar(&flagdebug, "d", false, "Print debug info to the screen")
-	flag.StringVar(&rompath, "p", "./roms/TETRIS", "Specify the path of the ROM to load")
-	flag.Parse()
+// loadScript runs the script at path, letting it hook the emulator. It is
+// set by the scripting support built in, if any.
+var loadScript func(path string, c *core.Chip8) error
+
+// stepBackDepth is how many instructions can be stepped back over while
+// debugging.
+const stepBackDepth = 4096
+
+// Clocks the emulator's frame timing can be governed by.
+const (
+	clockTimer = "timer" // sleep between frames
+	clockVSync = "vsync" // wait for the display's vertical blank (sdl only)
+	clockNone  = "none"  // run as fast as possible
+)
+
+// emulatorFlags registers the flags of the run and debug commands on fs.
+func emulatorFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&flagtest, "t", false, "Load the emulator test ROM")
+	fs.StringVar(&testpath, "testrom", "", "Path of the emulator test ROM -t loads (default the one built in)")
+	fs.StringVar(&fontpath, "font", "", "Path of a TrueType font to draw text in the window with, instead of the one built in (sdl only)")
+	fs.StringVar(&rompath, "p", "", "Path, name or http(s) URL of the ROM to run, or of Octo source (.8o) to assemble and run, also taken as an argument")
+	fs.IntVar(&recentn, "recent", 0, "Run the ROM played Nth most recently, 1 for the last one")
+	fs.StringVar(&zipentry, "entry", "", "Name of the ROM to run in a .zip given, rather than the first one in it")
+	fs.StringVar(&romsum, "checksum", "", "sha1, in hex, the ROM downloaded from a URL must have")
+	fs.StringVar(&romdirs, "romdir", filepath.Join(configDir(), "roms"), "Directories ROMs given by name are looked up in, separated by "+string(filepath.ListSeparator))
+	fs.StringVar(&speed, "speed", "480", "Instructions executed a second, rounded to a whole number a frame, or a frame, as in 20/frame")
+	fs.StringVar(&palette, "palette", "", "Colors of lit and unlit pixels, as hex RGB, e.g. 00ffc8,000000")
+	fs.IntVar(&scale, "scale", 0, "Pixels per Chip-8 pixel of the window when it opens (sdl only) and of the -stream display (default 10)")
+	fs.IntVar(&volume, "volume", 25, "Volume of the buzzer sounding while the sound timer runs, from 0, which mutes it, to 100 (sdl only)")
+	fs.Float64Var(&tone, "tone", 440, "Frequency of the buzzer in Hz (sdl only)")
+	fs.StringVar(&filters, "filter", "", "Comma separated display filters to apply (phosphor, crt, blend)")
+	fs.StringVar(&cfgpath, "config", "", "Path of the config file, whose settings are the defaults of these flags (default ~/.config/gochip8/config.toml)")
+	fs.StringVar(&quirks, "quirks", "", "Comma separated interpreter quirks to emulate (keyrelease, shift, jump, loadstore)")
+	fs.BoolVar(&extmem, "extmem", false, "Give the machine the 64KB of RAM of XO-CHIP, for ROMs larger than 3584 bytes")
+	fs.StringVar(&romcheck, "romcheck", "warn", "What to do about ROMs with invalid opcodes in their code (warn, strict, off)")
+	fs.StringVar(&cheatpath, "cheats", "", "Cheat file to load (default: the ROM path with a .cht extension, if it exists)")
+	fs.StringVar(&scriptpath, "script", "", "Run a Lua script hooking the emulator (needs a build with -tags lua)")
+	fs.StringVar(&backend, "backend", "", "Frontend to display the emulator with ("+strings.Join(backendNames(), ", ")+")")
+	fs.StringVar(&layout, "layout", "standard", "Keyboard layout of the keypad (standard: 1234/QWER/ASDF/ZXCV, classic: 7890/UIOP/JKL;/M,./)")
+	fs.StringVar(&serveaddr, "serve", "", "Serve a page the emulator is played from in a web browser on this TCP address, e.g. :8080, instead of showing it (selects the remote backend)")
+	fs.StringVar(&mjpegaddr, "stream", "", "Run headless, streaming the display as MJPEG over HTTP on this TCP address, e.g. :8090 (selects the headless backend)")
+	fs.BoolVar(&keypad, "keypad", false, "Show a keypad below the display which can be clicked or tapped")
+	fs.StringVar(&clock, "clock", clockTimer, "Clock governing frame timing (timer, vsync, none)")
+	fs.StringVar(&videopath, "record", "", "Record the session to a video file using ffmpeg")
+	fs.StringVar(&moviepath, "movie", "", "Record keypad input to a movie file (.c8m)")
+	fs.StringVar(&playpath, "playback", "", "Replay keypad input from a movie file instead of the keyboard")
+	fs.Int64Var(&seed, "seed", 0, "Seed for the random number generator (default random)")
+	fs.BoolVar(&determ, "deterministic", false, "Apply keypad input at frame boundaries and default -seed to 1, so runs with the same input go through the same states")
+	fs.StringVar(&shotdir, "screenshots", ".", "Directory screenshots (F12) and GIF recordings (F9) are saved to")
+	fs.StringVar(&crashdir, "crashdumps", filepath.Join(cacheDir(), "crashes"), "Directory a dump of the machine state is written to if the emulator crashes (empty disables)")
+	fs.IntVar(&rewind, "rewind", 10, "Seconds of gameplay which can be rewound by holding ` (0 disables rewinding)")
+	fs.BoolVar(&autosave, "autosave", false, "Save the machine state when the window is closed, offering to resume from it when the ROM is next run (sdl only)")
+	fs.StringVar(&statesdir, "states", filepath.Join(configDir(), "states"), "Directory save states (F5) and SCHIP flags are kept in, in a directory for each ROM")
+	netplayFlags(fs)
+	loggingFlags(fs)
+	profilingFlags(fs)
+}
+
+// debuggerFlags registers the flags of the debug command on fs. The debug
+// panel is shown by default if panel is set.
+func debuggerFlags(fs *flag.FlagSet, panel bool) {
+	fs.BoolVar(&flagdebug, "d", panel, "Print debug info to the screen")
+	fs.StringVar(&breaks, "break", "", "Comma separated hex addresses to pause execution at, or conditions such as 2a4 if V3 == 0x1f or I >= 0x400 (F8 resumes, F10 steps)")
+	fs.StringVar(&watches, "watch", "", "Comma separated RAM ranges to pause execution after accesses to, e.g. 300-30f:w,I+0-2:r")
+	fs.StringVar(&gdbaddr, "gdb", "", "Serve the GDB remote protocol on this TCP address, e.g. localhost:1234")
+	fs.StringVar(&dapaddr, "dap", "", "Serve the Debug Adapter Protocol on this TCP address, e.g. localhost:4711")
+	fs.StringVar(&apiaddr, "api", "", "Serve an HTTP control API for tools and test harnesses on this TCP address, e.g. localhost:8000")
+	fs.BoolVar(&repl, "repl", false, "Read debugger commands (break, step, regs, mem, ...) from stdin while running")
+	fs.StringVar(&conaddr, "console", "", "Serve the -repl debugger console on this TCP address, e.g. localhost:4712, for chip8 attach")
+	fs.StringVar(&tracepath, "trace", "", "Log every instruction executed to this file")
+	fs.StringVar(&tracerange, "trace-range", "", "Only trace instructions at hex addresses START-END")
+	fs.StringVar(&traceops, "trace-ops", "", "Only trace these comma separated instruction classes, by first hex digit, e.g. 1,2,D")
+	fs.BoolVar(&traceregs, "trace-regs", false, "Log the registers each traced instruction changed")
+	fs.StringVar(&profpath, "profile", "", "Count the instructions executed at each address, writing a report to this file on exit")
+	fs.StringVar(&hashpath, "hashes", "", "Write a hash of the display, registers and RAM after every frame to this file, to compare runs with -deterministic")
 }
 
 func main() {
-	chip8 := core.NewChip8(flagdebug)
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if _, ok := findCommand(args[0]); !ok {
+			// A ROM, run as by chip8 run ROM.
+			runRun(args)
+			return
+		}
+		runCommand(args[0], args[1:])
+		return
+	}
 
-	if flagtest {
-		fmt.Printf("Loading test ROM from %s\n", testpath)
-		chip8.LoadRom(testpath)
+	// Flags without a command run the emulator, taking the flags of both run
+	// and debug as before there were commands.
+	fs := flag.NewFlagSet("chip8", flag.ExitOnError)
+	fs.Usage = usage
+	emulatorFlags(fs)
+	debuggerFlags(fs, false)
+	fs.Parse(args)
+	parseRomArg(fs)
+	runEmulator(fs)
+}
+
+// runRun implements the run command.
+func runRun(args []string) {
+	fs := newCommandFlags("run")
+	emulatorFlags(fs)
+	fs.Parse(args)
+	parseRomArg(fs)
+	runEmulator(fs)
+}
+
+// runDebug implements the debug command, running the emulator with the
+// debugger flags and the debug panel shown.
+func runDebug(args []string) {
+	fs := newCommandFlags("debug")
+	emulatorFlags(fs)
+	debuggerFlags(fs, true)
+	fs.Parse(args)
+	parseRomArg(fs)
+	runEmulator(fs)
+}
+
+// runEmulator runs the emulator as configured by the flags of fs, the
+// environment and the config file, in that order of precedence.
+func runEmulator(fs *flag.FlagSet) {
+	given := givenFlags(fs)
+	if err := applyEnv(fs, given); err != nil {
+		log.Fatal("Error in environment: ", err)
+	}
+
+	explicit := cfgpath != ""
+	if !explicit {
+		cfgpath = defaultConfigPath()
+	}
+	cfg, err := loadConfig(cfgpath)
+	if os.IsNotExist(err) && !explicit {
+		cfg, err = config{}, nil
+	}
+	if err == nil {
+		err = cfg.applySettings(fs, "", given)
+	}
+	if err != nil {
+		log.Fatal("Error loading config: ", err)
+	}
+	setupLogging()
+	if serveaddr != "" {
+		backend = "remote"
+	}
+	if mjpegaddr != "" {
+		if serveaddr != "" {
+			log.Fatal("-serve and -stream can't be used together")
+		}
+		backend = "headless"
+	}
+	if backend == "" {
+		backend = backendNames()[0]
+	}
+	if !flagtest {
+		if recentn > 0 {
+			recent := loadRecent()
+			if recentn > len(recent) {
+				log.Fatalf("Only %d ROMs were played recently\n", len(recent))
+			}
+			rompath = recent[recentn-1]
+		}
+		if rompath == "" {
+			rompath = launchRom()
+		}
+		if isURL(rompath) {
+			url := rompath
+			if rompath, err = downloadRom(url, romsum); err != nil {
+				log.Fatal("Error downloading ROM: ", err)
+			}
+			addRecent(url)
+		} else {
+			if rompath, err = findRom(rompath); err != nil {
+				log.Fatal("Error finding ROM: ", err)
+			}
+			addRecent(rompath)
+		}
+		if isZip(rompath) {
+			if rompath, err = extractRom(rompath, zipentry); err != nil {
+				log.Fatal("Error extracting ROM: ", err)
+			}
+		}
+	}
+	if err := applyGameSettings(cfg, fs, given); err != nil {
+		log.Fatal("Error loading config: ", err)
+	}
+	keymap, err = cfg.keymap("keys")
+	if err != nil {
+		log.Fatal("Error loading config: ", err)
+	}
+	padmap, err = cfg.keymap("gamepad")
+	if err != nil {
+		log.Fatal("Error loading config: ", err)
+	}
+	turbo, err := cfg.turboKeys("turbo")
+	if err != nil {
+		log.Fatal("Error loading config: ", err)
+	}
+
+	opts := core.Options{
+		Logger:    logger,
+		CrashDir:  crashdir,
+		VideoPath: videopath,
+		MoviePath: moviepath,
+		PlayPath:  playpath,
+		Seed:      seed,
+		Turbo:     turbo,
+
+		RewindSeconds:  rewind,
+		Deterministic:  determ,
+		ExtendedMemory: extmem,
+	}
+	switch clock {
+	case clockTimer:
+	case clockVSync, clockNone:
+		opts.Unpaced = true
+	default:
+		log.Fatalf("Unknown clock %q\n", clock)
+	}
+	if filters != "" {
+		opts.Filters = strings.Split(filters, ",")
+	}
+	opts.Breakpoints, opts.Conditions, err = parseBreakpoints(cfg.value("debug", "breakpoints") + "," + breaks)
+	if err != nil {
+		log.Fatal("Invalid breakpoint: ", err)
+	}
+	for _, spec := range strings.FieldsFunc(cfg.value("debug", "watchpoints")+","+watches, func(r rune) bool {
+		return r == ',' || r == ' '
+	}) {
+		w, err := core.ParseWatchpoint(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Watchpoints = append(opts.Watchpoints, w)
+	}
+	opts.TracePath = tracepath
+	opts.ProfilePath = profpath
+	opts.HashesPath = hashpath
+	if flagdebug || repl || gdbaddr != "" || dapaddr != "" || conaddr != "" {
+		opts.StepBackDepth = stepBackDepth
+	}
+	opts.TraceFilter.Registers = traceregs
+	if tracerange != "" {
+		if err := opts.TraceFilter.ParseTraceRange(tracerange); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if traceops != "" {
+		if err := opts.TraceFilter.ParseTraceClasses(strings.Split(traceops, ",")); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if quirks != "" {
+		opts.Quirks, err = core.ParseQuirks(strings.Split(quirks, ","))
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	opts.ROMCheck, err = core.ParseROMCheck(romcheck)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if palette != "" {
+		if opts.Foreground, opts.Background, err = parsePalette(palette); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if opts.PerFrame, err = parseSpeed(speed); err != nil {
+		log.Fatal(err)
+	}
+	if volume < 0 || volume > 100 {
+		log.Fatalf("Invalid volume %d, expected 0 to 100\n", volume)
+	}
+	if tone <= 0 {
+		log.Fatalf("Invalid tone %g Hz\n", tone)
+	}
+	startNetplay(&opts)
+	chip8, err := core.NewChip8(opts)
+	if err != nil {
+		log.Fatal("Error starting the emulator: ", err)
+	}
+
+	if flagtest && testpath == "" {
+		logger.Infof("Loading the built in test ROM")
+		if err := chip8.LoadRomData(testrom.Flags); err != nil {
+			log.Fatal("Error loading ROM: ", err)
+		}
 	} else {
-		fmt.Printf("Loading ROM from %s\n", rompath)
-		chip8.LoadRom(rompath)
+		if flagtest {
+			logger.Infof("Loading test ROM from %s", testpath)
+		} else {
+			logger.Infof("Loading ROM from %s", rompath)
+		}
+		if err := chip8.LoadRom(romFile()); err != nil {
+			fatal(chip8, "Error loading ROM: ", err)
+		}
+	}
+	if err := loadGameInput(cfg, chip8); err != nil {
+		log.Fatal("Error loading config: ", err)
+	}
+	if err := loadCheats(chip8); err != nil {
+		log.Fatal("Error loading cheats: ", err)
 	}
+	if err := chip8.SetFlagsFile(filepath.Join(stateDir(chip8), "flags")); err != nil {
+		log.Fatal("Error loading flags: ", err)
+	}
+	if scriptpath != "" {
+		if loadScript == nil {
+			log.Fatal("Scripts need Lua support, built in with -tags lua")
+		}
+		if err := loadScript(scriptpath, chip8); err != nil {
+			log.Fatal("Error loading script: ", err)
+		}
+	}
+
+	logger.Debugf("Starting program")
 
-	fmt.Println("Starting program...")
-	fmt.Println()
+	run, ok := backends[backend]
+	if !ok {
+		log.Fatalf("Unknown backend %q\n", backend)
+	}
+	if clock == clockVSync && backend != "sdl" {
+		log.Fatalf("The %s clock is only supported by the sdl backend\n", clock)
+	}
+	if repl && backend == "terminal" {
+		log.Fatal("The debugger console needs stdin, which the terminal backend reads the keypad from")
+	}
+
+	if gdbaddr != "" {
+		go func() {
+			if err := gdbstub.ListenAndServe(gdbaddr, chip8); err != nil {
+				log.Fatal("GDB server: ", err)
+			}
+		}()
+	}
+
+	if dapaddr != "" {
+		go func() {
+			if err := dap.ListenAndServe(dapaddr, chip8); err != nil {
+				log.Fatal("Debug adapter: ", err)
+			}
+		}()
+	}
+
+	if apiaddr != "" {
+		go func() {
+			if err := api.ListenAndServe(apiaddr, chip8); err != nil {
+				log.Fatal("Control API: ", err)
+			}
+		}()
+	}
+
+	if repl {
+		go console.Run(os.Stdin, os.Stdout, chip8)
+	}
+
+	if conaddr != "" {
+		go func() {
+			if err := console.ListenAndServe(conaddr, chip8); err != nil {
+				log.Fatal("Debugger console: ", err)
+			}
+		}()
+	}
+	go watchConfig(chip8, fs, given)
+	changeRom = func(c *core.Chip8, path string) error {
+		return swapRom(c, fs, given, path)
+	}
+
+	stopProfiling := startProfiling()
+	err = run(chip8)
+	stopProfiling()
+	if err != nil {
+		fatal(chip8, "Error running the emulator: ", err)
+	}
+}
+
+// fatal logs err, prefixed by msg, and exits, first writing a crash dump of
+// the machine to -crashdumps unless it is empty.
+func fatal(c *core.Chip8, msg string, err error) {
+	if crashdir != "" {
+		path, dumpErr := c.SaveCrashDump(msg + err.Error())
+		if dumpErr != nil {
+			logger.Errorf("Unable to write crash dump: %v", dumpErr)
+		} else {
+			logger.Errorf("The machine state was written to %s", path)
+		}
+	}
+	log.Fatal(msg, err)
+}
+
+// romFile returns the path of the ROM run, which is empty for the built in
+// test ROM.
+func romFile() string {
+	if flagtest {
+		return testpath
+	}
+
+	return rompath
+}
+
+// readRomFile reads the ROM run, as core.ReadRom does.
+func readRomFile() ([]byte, error) {
+	if flagtest && testpath == "" {
+		return testrom.Flags, nil
+	}
+
+	return core.ReadRom(romFile())
+}
+
+// stateDir returns the directory the save state slots of the loaded ROM are
+// kept in, named after its hash so they follow the ROM if it is renamed.
+func stateDir(c *core.Chip8) string {
+	return filepath.Join(statesdir, c.RomHash())
+}
+
+// loadCheats loads the cheats of the -cheats file, or of the file named
+// after the ROM with a .cht extension if there is one.
+func loadCheats(c *core.Chip8) error {
+	path := cheatpath
+	if path == "" {
+		if romFile() == "" {
+			return nil
+		}
+		path = strings.TrimSuffix(romFile(), filepath.Ext(romFile())) + ".cht"
+		if _, err := os.Stat(path); err != nil {
+			return nil
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	cheats, err := core.ParseCheats(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	c.SetCheats(cheats)
+	logger.Infof("Loaded %d cheats from %s", len(cheats), path)
+
+	return nil
+}
+
+// applyGameSettings applies the speed and quirks the ROM database
+// recommends for the ROM to be run, and then the settings the config file
+// has for it, if any, over its other settings.
+func applyGameSettings(cfg config, fs *flag.FlagSet, given map[string]bool) error {
+	rom, err := readRomFile()
+	if err != nil {
+		// Loading the ROM reports the error.
+		return nil
+	}
+	hash := fmt.Sprintf("%x", sha1.Sum(rom))
+	if err := applyRomInfo(fs, hash, given); err != nil {
+		return err
+	}
+
+	section, ok := cfg.gameSection("", filepath.Base(romFile()), hash)
+	if !ok {
+		return nil
+	}
+
+	return cfg.applySettings(fs, section, given)
+}
+
+// gameInput holds the input overrides the config file has for a ROM.
+type gameInput struct {
+	keys, pad map[string]uint8
+	turbo     []uint8
+	setTurbo  bool // whether turbo is set
+}
+
+// readGameInput reads the input overrides the config file has for the ROM
+// with the given name and hash, if any.
+func readGameInput(cfg config, name, hash string) (gameInput, error) {
+	var in gameInput
+	var err error
+	if section, ok := cfg.gameSection("keys", name, hash); ok {
+		if in.keys, err = cfg.keymap(section); err != nil {
+			return in, err
+		}
+	}
+	if section, ok := cfg.gameSection("gamepad", name, hash); ok {
+		if in.pad, err = cfg.keymap(section); err != nil {
+			return in, err
+		}
+	}
+	if section, ok := cfg.gameSection("turbo", name, hash); ok {
+		if in.turbo, err = cfg.turboKeys(section); err != nil {
+			return in, err
+		}
+		in.setTurbo = true
+	}
+
+	return in, nil
+}
+
+// apply binds the overrides on top of the keypad bindings, replacing those
+// of the ROM loaded before.
+func (in gameInput) apply(c *core.Chip8) {
+	gamekeys, gamepad = in.keys, in.pad
+	if in.setTurbo {
+		c.SetTurbo(in.turbo)
+	}
+}
+
+// loadGameInput reads and applies the input overrides the config file has
+// for the loaded ROM, if any.
+func loadGameInput(cfg config, c *core.Chip8) error {
+	in, err := readGameInput(cfg, c.RomName(), c.RomHash())
+	if err != nil {
+		return err
+	}
+	in.apply(c)
 
-	chip8.Run()
+	return nil
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/sha1"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/n-ulricksen/chip8/netplay"
+)
+
+// Netplay with an emulator on another machine.
+var (
+	nethost  string
+	netjoin  string
+	netdelay int
+)
+
+// netplayFlags registers the netplay flags on fs.
+func netplayFlags(fs *flag.FlagSet) {
+	fs.StringVar(&nethost, "host", "", "Host a two player game on this TCP address, e.g. :7000, waiting for another emulator to -join")
+	fs.StringVar(&netjoin, "join", "", "Join the two player game hosted by another emulator at this TCP address, e.g. example.com:7000")
+	fs.IntVar(&netdelay, "netdelay", netplay.DefaultDelay, "Frames keys take to reach the game when hosting, hiding up to that much network latency")
+}
+
+// startNetplay hosts or joins the game the netplay flags ask for, if any,
+// setting up opts to play it in lockstep. It exits if the game can't be
+// played.
+func startNetplay(opts *core.Options) {
+	if nethost == "" && netjoin == "" {
+		return
+	}
+	if nethost != "" && netjoin != "" {
+		log.Fatal("-host and -join can't be used together")
+	}
+	if opts.PlayPath != "" {
+		log.Fatal("Input can't be replayed from a movie during netplay")
+	}
+
+	rom, err := readRomFile()
+	if err != nil {
+		log.Fatal("Error loading ROM: ", err)
+	}
+	game := netplay.Game{
+		Rom:      fmt.Sprintf("%x", sha1.Sum(rom)),
+		Settings: fmt.Sprintf("perframe %d quirks %+v extmem %v", opts.PerFrame, opts.Quirks, opts.ExtendedMemory),
+	}
+
+	var session *netplay.Session
+	if nethost != "" {
+		seed := opts.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		session, err = netplay.Host(nethost, game, seed, netdelay, logger)
+	} else {
+		session, err = netplay.Join(netjoin, game, logger)
+	}
+	if err != nil {
+		log.Fatal("Netplay: ", err)
+	}
+
+	opts.Lockstep = session
+	opts.Seed = session.Seed()
+	// Rewinding one side would leave the other behind.
+	opts.RewindSeconds = 0
+}
@@ -0,0 +1,199 @@
+// Package netplay connects two emulators over TCP in lockstep, so two
+// players on different machines can play a game together, such as the two
+// player PONG2, each at their own keypad.
+//
+// One emulator hosts and the other joins it. They first check they are
+// running the same ROM with the same settings, and the joining one takes
+// the seed of the host's random number generator, so both start from the
+// same state. Then, at the end of every frame, each sends the other the keys
+// held on its keypad, and the keys both hold are pressed on both. Keys are
+// sent a few frames ahead of when they take effect, so the network latency
+// is hidden as long as it is shorter than those frames. Each side also sends
+// a hash of its state, to report the emulators going out of step.
+//
+// Pausing or slowing one emulator holds the other back with it.
+package netplay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// protocolVersion is sent in the handshake; both sides must speak the same.
+const protocolVersion = 1
+
+// DefaultDelay is the number of frames keys are sent ahead of when they
+// take effect by default, enough to hide 50ms of latency.
+const DefaultDelay = 3
+
+// messageSize is the size of the message sent every frame: the keys held
+// and the state hash, big endian.
+const messageSize = 2 + 8
+
+// Game describes what an emulator runs, which must match on both sides.
+type Game struct {
+	Rom      string // sha1 of the ROM
+	Settings string // settings affecting emulation, such as quirks and speed
+}
+
+// Session is a connection to the other emulator, to be passed to the
+// emulator as its Options.Lockstep.
+type Session struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	seed  int64
+	delay int
+
+	frame   uint64   // frames exchanged
+	pending []uint16 // local keys sent but not yet in effect, oldest first
+	hashes  []uint64 // local state hashes not yet checked, oldest first
+	buf     [messageSize]byte
+}
+
+// Host waits for an emulator to join on the TCP address addr and returns
+// the session with it, logging its progress to log. The one joining uses the
+// seed and delay of the host.
+func Host(addr string, game Game, seed int64, delay int, log core.Logger) (*Session, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+	log.Infof("Waiting for a player to join on %s", ln.Addr())
+
+	conn, err := ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	s := newSession(conn, seed, delay)
+	if err := s.handshake(game, true); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	log.Infof("Player joined from %s", conn.RemoteAddr())
+
+	return s, nil
+}
+
+// Join connects to an emulator hosting on the TCP address addr and returns
+// the session with it, logging its progress to log.
+func Join(addr string, game Game, log core.Logger) (*Session, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := newSession(conn, 0, 0)
+	if err := s.handshake(game, false); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	log.Infof("Joined the game hosted on %s", addr)
+
+	return s, nil
+}
+
+func newSession(conn net.Conn, seed int64, delay int) *Session {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetNoDelay(true)
+	}
+
+	return &Session{conn: conn, r: bufio.NewReader(conn), seed: seed, delay: delay}
+}
+
+// handshake exchanges what each side runs, refusing to play different
+// games. The host sends its seed and delay, which the other side takes.
+func (s *Session) handshake(game Game, host bool) error {
+	hello := fmt.Sprintf("chip8-netplay %d rom %s settings %q", protocolVersion, game.Rom, game.Settings)
+	if host {
+		hello += fmt.Sprintf(" seed %d delay %d", s.seed, s.delay)
+	}
+	if _, err := fmt.Fprintln(s.conn, hello); err != nil {
+		return err
+	}
+
+	line, err := s.r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("handshake: %v", err)
+	}
+	var version int
+	var peer Game
+	n, err := fmt.Sscanf(line, "chip8-netplay %d rom %s settings %q seed %d delay %d", &version, &peer.Rom, &peer.Settings, &s.seed, &s.delay)
+	switch {
+	case n == 0:
+		return fmt.Errorf("handshake: not a netplay peer")
+	case version != protocolVersion:
+		return fmt.Errorf("the other side speaks netplay version %d, not %d", version, protocolVersion)
+	case n < 3:
+		return fmt.Errorf("handshake: %v", err)
+	case !host && n < 5:
+		return errors.New("handshake: the host sent no seed")
+	case peer.Rom != game.Rom:
+		return fmt.Errorf("the other side runs another ROM (sha1 %s)", peer.Rom)
+	case peer.Settings != game.Settings:
+		return fmt.Errorf("the other side runs with other settings (%s, here %s)", peer.Settings, game.Settings)
+	}
+	if s.delay < 0 {
+		return fmt.Errorf("handshake: invalid delay %d", s.delay)
+	}
+
+	s.pending = make([]uint16, s.delay, s.delay+1)
+	s.hashes = make([]uint64, 0, s.delay+1)
+	return nil
+}
+
+// Seed returns the seed of the random number generator both sides use.
+func (s *Session) Seed() int64 {
+	return s.seed
+}
+
+// Exchange sends the keys held locally, which take effect after the delay,
+// and returns the keys both sides hold for the next frame. It blocks until
+// the other side has sent its keys for that frame.
+func (s *Session) Exchange(keys uint16, hash uint64) (uint16, error) {
+	binary.BigEndian.PutUint16(s.buf[:], keys)
+	binary.BigEndian.PutUint64(s.buf[2:], hash)
+	if _, err := s.conn.Write(s.buf[:]); err != nil {
+		return 0, err
+	}
+	s.pending = append(s.pending, keys)
+	s.hashes = append(s.hashes, hash)
+	s.frame++
+
+	// The first frames of the delay have no keys from the other side.
+	if s.frame <= uint64(s.delay) {
+		local := s.pending[0]
+		s.pending = append(s.pending[:0], s.pending[1:]...)
+		return local, nil
+	}
+
+	if _, err := io.ReadFull(s.r, s.buf[:]); err != nil {
+		if err == io.EOF {
+			err = errors.New("the other side left")
+		}
+		return 0, err
+	}
+	remote := binary.BigEndian.Uint16(s.buf[:])
+	remoteHash := binary.BigEndian.Uint64(s.buf[2:])
+
+	// The message read was sent at the end of the frame the oldest local
+	// hash is of.
+	if remoteHash != s.hashes[0] {
+		return 0, fmt.Errorf("out of step with the other side since frame %d", s.frame-uint64(s.delay))
+	}
+	s.hashes = append(s.hashes[:0], s.hashes[1:]...)
+
+	local := s.pending[0]
+	s.pending = append(s.pending[:0], s.pending[1:]...)
+	return local | remote, nil
+}
+
+// Close disconnects from the other side.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
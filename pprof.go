@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	_ "net/http/pprof" // serves the profiles of -pprof
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// Profiling of the emulator itself, with the go tool's pprof and trace
+// commands.
+var (
+	pprofaddr  string
+	cpuprofile string
+	memprofile string
+	exectrace  string
+)
+
+// profilingFlags registers the flags profiling the emulator on fs.
+func profilingFlags(fs *flag.FlagSet) {
+	fs.StringVar(&pprofaddr, "pprof", "", "Serve net/http/pprof on this TCP address while running, e.g. localhost:6060")
+	fs.StringVar(&cpuprofile, "cpuprofile", "", "Write a CPU profile of the emulator to this file")
+	fs.StringVar(&memprofile, "memprofile", "", "Write a heap profile of the emulator to this file on exit")
+	fs.StringVar(&exectrace, "exectrace", "", "Write a Go execution trace of the emulator to this file, for go tool trace")
+}
+
+// startProfiling starts the profiling asked for by the profiling flags,
+// exiting if it can't be. It returns a function stopping it and writing the
+// profiles, to be called on exit.
+func startProfiling() func() {
+	if pprofaddr != "" {
+		go func() {
+			if err := http.ListenAndServe(pprofaddr, nil); err != nil {
+				log.Fatal("pprof server: ", err)
+			}
+		}()
+		logger.Infof("Serving profiles on http://%s/debug/pprof/", pprofaddr)
+	}
+
+	var stops []func()
+	if cpuprofile != "" {
+		f, err := os.Create(cpuprofile)
+		if err != nil {
+			log.Fatal("Unable to write CPU profile: ", err)
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			log.Fatal("Unable to start CPU profile: ", err)
+		}
+		stops = append(stops, func() {
+			pprof.StopCPUProfile()
+			if err := f.Close(); err != nil {
+				logger.Errorf("Unable to write CPU profile: %v", err)
+			}
+		})
+	}
+	if exectrace != "" {
+		f, err := os.Create(exectrace)
+		if err != nil {
+			log.Fatal("Unable to write execution trace: ", err)
+		}
+		if err := trace.Start(f); err != nil {
+			log.Fatal("Unable to start execution trace: ", err)
+		}
+		stops = append(stops, func() {
+			trace.Stop()
+			if err := f.Close(); err != nil {
+				logger.Errorf("Unable to write execution trace: %v", err)
+			}
+		})
+	}
+
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+		if memprofile != "" {
+			if err := writeHeapProfile(memprofile); err != nil {
+				logger.Errorf("Unable to write heap profile: %v", err)
+			}
+		}
+	}
+}
+
+// writeHeapProfile writes a profile of the memory in use to path.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	runtime.GC() // count only memory still in use
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxRecent is how many of the ROMs played most recently are remembered.
+const maxRecent = 10
+
+// recentPath returns the file listing the ROMs played most recently, a path
+// or URL a line, most recent first.
+func recentPath() string {
+	return filepath.Join(configDir(), "recent")
+}
+
+// loadRecent returns the ROMs played most recently, most recent first,
+// leaving out files since removed.
+func loadRecent() []string {
+	file, err := os.Open(recentPath())
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var recent []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		rom := strings.TrimSpace(scanner.Text())
+		if rom == "" {
+			continue
+		}
+		if !isURL(rom) {
+			if _, err := os.Stat(rom); err != nil {
+				continue
+			}
+		}
+		recent = append(recent, rom)
+	}
+
+	return recent
+}
+
+// addRecent puts the ROM at path, or URL, at the top of the list of ROMs
+// played most recently.
+func addRecent(rom string) {
+	if !isURL(rom) {
+		if abs, err := filepath.Abs(rom); err == nil {
+			rom = abs
+		}
+	}
+
+	recent := []string{rom}
+	for _, other := range loadRecent() {
+		if other != rom && len(recent) < maxRecent {
+			recent = append(recent, other)
+		}
+	}
+
+	err := os.MkdirAll(configDir(), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(recentPath(), []byte(strings.Join(recent, "\n")+"\n"), 0644)
+	}
+	if err != nil {
+		logger.Errorf("Unable to save the list of recent ROMs: %v", err)
+	}
+}
+
+// isRecent reports whether the ROM at path is in recent, the list of ROMs
+// played most recently.
+func isRecent(recent []string, path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, rom := range recent {
+		if rom == abs {
+			return true
+		}
+	}
+
+	return false
+}
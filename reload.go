@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"image/color"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// configPollInterval is how often the config file is checked for changes.
+const configPollInterval = time.Second
+
+// rebind applies the keypad bindings again after the config file is
+// reloaded. It is set by the backends which can rebind the keypad while
+// running, and called on the emulator goroutine.
+var rebind func() error
+
+// changeRom runs the ROM at path in place of the one running, by swapRom
+// with the flags the emulator was started with. It is set before the backend
+// runs, for backends able to load another ROM while running, and called on
+// the emulator goroutine.
+var changeRom func(c *core.Chip8, path string) error
+
+// watchConfig reloads the config file into the running emulator whenever
+// the file changes, or the process receives SIGHUP. Settings given on the
+// command line or in the environment, listed in given, keep their values.
+func watchConfig(c *core.Chip8, fs *flag.FlagSet, given map[string]bool) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	modTime := configModTime()
+	for {
+		select {
+		case <-hup:
+		case <-ticker.C:
+			if t := configModTime(); !t.Equal(modTime) {
+				modTime = t
+			} else {
+				continue
+			}
+		}
+
+		if err := reloadConfig(c, fs, given); err != nil {
+			logger.Errorf("Error reloading config: %v", err)
+			continue
+		}
+		logger.Infof("Reloaded config from %s", cfgpath)
+	}
+}
+
+// configModTime returns when the config file was last modified, or the zero
+// time if it doesn't exist.
+func configModTime() time.Time {
+	info, err := os.Stat(cfgpath)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+// reloadConfig reads the config file again, applying the palette, speed and
+// keypad bindings it sets to the running emulator. The other settings only
+// take effect on the next run.
+func reloadConfig(c *core.Chip8, fs *flag.FlagSet, given map[string]bool) error {
+	apply, err := readConfig(fs, given)
+	if err != nil {
+		return err
+	}
+	c.Do(func() {
+		err = apply(c)
+	})
+
+	return err
+}
+
+// readConfig reads the config file again, as reloadConfig does, returning
+// the function applying its settings, to be called on the emulator
+// goroutine. Nothing is changed until it is called.
+func readConfig(fs *flag.FlagSet, given map[string]bool) (func(c *core.Chip8) error, error) {
+	cfg, err := loadConfig(cfgpath)
+	if os.IsNotExist(err) && !given["config"] {
+		cfg, err = config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return func(c *core.Chip8) error {
+		return applyConfig(c, cfg, fs, given)
+	}, nil
+}
+
+// applyConfig applies the settings of cfg to the flags and to the running
+// emulator, as reloadConfig does. If any of them is invalid, the flags are
+// set back to their values before and nothing is applied.
+func applyConfig(c *core.Chip8, cfg config, fs *flag.FlagSet, given map[string]bool) error {
+	restore := saveFlags(fs)
+	var (
+		fg, bg    color.RGBA
+		perFrame  int
+		keys, pad map[string]uint8
+		input     gameInput
+	)
+	err := func() (err error) {
+		if err := cfg.applySettings(fs, "", given); err != nil {
+			return err
+		}
+		if err := applyRomInfo(fs, c.RomHash(), given); err != nil {
+			return err
+		}
+		if section, ok := cfg.gameSection("", c.RomName(), c.RomHash()); ok {
+			if err := cfg.applySettings(fs, section, given); err != nil {
+				return err
+			}
+		}
+
+		if palette != "" {
+			if fg, bg, err = parsePalette(palette); err != nil {
+				return err
+			}
+		}
+		if perFrame, err = parseSpeed(speed); err != nil {
+			return err
+		}
+		if keys, err = cfg.keymap("keys"); err != nil {
+			return err
+		}
+		if pad, err = cfg.keymap("gamepad"); err != nil {
+			return err
+		}
+		input, err = readGameInput(cfg, c.RomName(), c.RomHash())
+		return err
+	}()
+	if err != nil {
+		restore()
+		return err
+	}
+
+	keymap, padmap = keys, pad
+	input.apply(c)
+	c.SetPalette(fg, bg)
+	c.SetCyclesPerFrame(perFrame)
+	if rebind != nil {
+		if err := rebind(); err != nil {
+			logger.Errorf("Error reloading config: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// saveFlags returns a function setting the flags of fs back to their
+// current values.
+func saveFlags(fs *flag.FlagSet) func() {
+	values := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		values[f.Name] = f.Value.String()
+	})
+
+	return func() {
+		fs.VisitAll(func(f *flag.Flag) {
+			if value := values[f.Name]; f.Value.String() != value {
+				f.Value.Set(value)
+			}
+		})
+	}
+}
+
+// swapRom runs the ROM at path, the one in the zip archive at path or the one
+// downloaded from the URL path, in place of the one running, with the
+// cheats, flags and config file settings it has, as far as they can be
+// changed while running. It is called on the emulator goroutine.
+func swapRom(c *core.Chip8, fs *flag.FlagSet, given map[string]bool, path string) error {
+	chosen := path
+	var err error
+	if isURL(path) {
+		if path, err = downloadRom(path, ""); err != nil {
+			return err
+		}
+	}
+	if isZip(path) {
+		if path, err = extractRom(path, ""); err != nil {
+			return err
+		}
+	}
+	if err := c.SwapRom(path); err != nil {
+		return err
+	}
+	rompath, flagtest = path, false
+	addRecent(chosen)
+
+	if err := loadCheats(c); err != nil {
+		return err
+	}
+	if err := c.SetFlagsFile(filepath.Join(stateDir(c), "flags")); err != nil {
+		return err
+	}
+	apply, err := readConfig(fs, given)
+	if err != nil {
+		return err
+	}
+
+	return apply(c)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"image/color"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// runningFrontend runs the emulator until done is closed.
+type runningFrontend struct {
+	done chan struct{}
+}
+
+func (fe runningFrontend) Render(c *core.Chip8) {}
+
+func (fe runningFrontend) PollEvents(c *core.Chip8) {
+	select {
+	case <-fe.done:
+		c.Stop()
+	default:
+	}
+}
+
+func (fe runningFrontend) Close() {}
+
+// TestReloadConfig reloads the config file while the emulator runs, which
+// go test -race checks is done without racing it.
+func TestReloadConfig(t *testing.T) {
+	defer func(path string) { cfgpath = path }(cfgpath)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	emulatorFlags(fs)
+	cfgpath = filepath.Join(t.TempDir(), "config.toml")
+	given := map[string]bool{}
+
+	c, err := core.NewChip8(core.Options{Unpaced: true, Logger: core.NewLogger(ioutil.Discard, core.LogError)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadRomData([]byte{0x70, 0x01, 0x12, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := c.Run(runningFrontend{done}); err != nil {
+			t.Error(err)
+		}
+	}()
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+
+	write := func(src string) {
+		t.Helper()
+		if err := ioutil.WriteFile(cfgpath, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for n := 0; n < 10; n++ {
+		write("speed = \"20/frame\"\npalette = \"ffffff,102030\"\n[keys]\nQ = 4\n[turbo]\nkeys = \"5\"\n")
+		if err := reloadConfig(c, fs, given); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var perFrame int
+	var fg, bg color.RGBA
+	var keys map[string]uint8
+	c.Do(func() {
+		perFrame = c.CyclesPerFrame()
+		fg, bg = c.Palette()
+		keys = keymap
+	})
+	if perFrame != 20 {
+		t.Errorf("instructions a frame = %d, want 20", perFrame)
+	}
+	if want := (color.RGBA{0x10, 0x20, 0x30, 0xff}); bg != want || fg != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("palette = %v, %v, want white on %v", fg, bg, want)
+	}
+	if keys["Q"] != 4 {
+		t.Errorf("keymap = %v, want Q bound to 4", keys)
+	}
+
+	// An invalid setting leaves the others as they were.
+	write("speed = 700\npalette = \"000000,ffffff\"\n[keys]\nQ = 40\n")
+	if err := reloadConfig(c, fs, given); err == nil {
+		t.Fatal("reloadConfig accepted Q = 40")
+	}
+	c.Do(func() {
+		perFrame = c.CyclesPerFrame()
+	})
+	if speed != "20/frame" || palette != "ffffff,102030" || perFrame != 20 {
+		t.Errorf("speed, palette = %q, %q, %d a frame, want those before the invalid config", speed, palette, perFrame)
+	}
+}
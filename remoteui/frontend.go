@@ -0,0 +1,206 @@
+// Package remoteui implements a frontend for the Chip-8 emulator which is
+// played from a web browser: it serves a page drawing the display streamed
+// to it over a WebSocket, which sends the keys pressed back.
+package remoteui
+
+import (
+	"context"
+	_ "embed"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+//go:embed client.html
+var clientPage []byte
+
+// keyEvent is a keypad key being pressed or released by a client.
+type keyEvent struct {
+	key     uint8
+	pressed bool
+}
+
+// Frontend serves the remote play page and streams the display to the
+// clients connected to it, any number of which can play at once.
+type Frontend struct {
+	server *http.Server
+	keys   chan keyEvent
+	done   chan struct{} // closed by Close
+
+	mu      sync.Mutex
+	frame   []byte               // RGBA pixels of the last frame rendered
+	clients map[*client]struct{} // connected clients
+}
+
+// client is a browser connected to the frontend.
+type client struct {
+	ws     *wsConn
+	notify chan struct{} // signalled when there is a new frame to send
+}
+
+// New starts serving the remote play page on the TCP address addr, such as
+// ":8080".
+func New(addr string) (*Frontend, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Frontend{
+		keys:    make(chan keyEvent, 64),
+		done:    make(chan struct{}),
+		clients: make(map[*client]struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", f.servePage)
+	mux.HandleFunc("/ws", f.serveWebSocket)
+	f.server = &http.Server{Handler: mux}
+
+	go f.server.Serve(l)
+
+	return f, nil
+}
+
+// servePage serves the page of the remote play client.
+func (f *Frontend) servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(clientPage)
+}
+
+// serveWebSocket connects a client, sending it the display and reading its
+// key events until it disconnects.
+func (f *Frontend) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrade(w, r)
+	if err != nil {
+		return
+	}
+
+	cl := &client{ws: ws, notify: make(chan struct{}, 1)}
+	f.mu.Lock()
+	f.clients[cl] = struct{}{}
+	if f.frame != nil {
+		cl.notify <- struct{}{}
+	}
+	f.mu.Unlock()
+
+	go f.sendFrames(cl)
+	f.readKeys(cl)
+
+	f.mu.Lock()
+	delete(f.clients, cl)
+	f.mu.Unlock()
+	close(cl.notify)
+	ws.close()
+}
+
+// sendFrames sends the client the last frame rendered whenever it changes.
+// Frames rendered while one is being sent are skipped, so slow clients only
+// fall behind by one.
+func (f *Frontend) sendFrames(cl *client) {
+	var frame []byte
+	for range cl.notify {
+		f.mu.Lock()
+		frame = append(frame[:0], f.frame...)
+		f.mu.Unlock()
+		if err := cl.ws.writeMessage(opBinary, frame); err != nil {
+			cl.ws.close()
+			return
+		}
+	}
+}
+
+// readKeys reads the client's key events, "down 5" or "up 5" with the key in
+// hex, until it disconnects, then releases the keys it left pressed.
+func (f *Frontend) readKeys(cl *client) {
+	var held [16]bool
+	defer func() {
+		for key, pressed := range held {
+			if pressed {
+				f.sendKey(keyEvent{key: uint8(key)})
+			}
+		}
+	}()
+
+	for {
+		message, err := cl.ws.readMessage()
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(string(message))
+		if len(fields) != 2 || (fields[0] != "down" && fields[0] != "up") {
+			continue
+		}
+		key, err := strconv.ParseUint(fields[1], 16, 4)
+		if err != nil {
+			continue
+		}
+		held[key] = fields[0] == "down"
+		if !f.sendKey(keyEvent{key: uint8(key), pressed: held[key]}) {
+			return
+		}
+	}
+}
+
+// sendKey passes a key event on to PollEvents, reporting false if the
+// frontend was closed first.
+func (f *Frontend) sendKey(ev keyEvent) bool {
+	select {
+	case f.keys <- ev:
+		return true
+	case <-f.done:
+		return false
+	}
+}
+
+// Close stops serving and disconnects the clients.
+func (f *Frontend) Close() {
+	close(f.done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	f.server.Shutdown(ctx)
+
+	f.mu.Lock()
+	for cl := range f.clients {
+		cl.ws.close()
+	}
+	f.mu.Unlock()
+}
+
+// PollEvents applies the key events the clients sent since the last poll.
+func (f *Frontend) PollEvents(c *core.Chip8) {
+	for {
+		select {
+		case ev := <-f.keys:
+			c.SetKey(ev.key, ev.pressed)
+		default:
+			return
+		}
+	}
+}
+
+// Render sends the frame to the clients if it changed.
+func (f *Frontend) Render(c *core.Chip8) {
+	if !c.FrameChanged() && f.frame != nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.frame = c.FrameRGBA(f.frame)
+	for cl := range f.clients {
+		select {
+		case cl.notify <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package remoteui
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// This is the server side of the WebSocket protocol (RFC 6455), as much of
+// it as the remote client needs: messages are small, and extensions and
+// subprotocols aren't negotiated.
+
+// websocketGUID is appended to the key of a handshake to accept it.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxMessageSize is the size of the largest message read from clients,
+// which only send key events.
+const maxMessageSize = 1024
+
+// WebSocket frame opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// wsConn is a WebSocket connection accepted from a client. Messages may be
+// written from several goroutines, and read from one.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex // held while writing a frame
+}
+
+// upgrade completes the WebSocket handshake of the request r, taking over
+// its connection.
+func upgrade(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "WebSocket connections only", http.StatusBadRequest)
+		return nil, errors.New("not a WebSocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported WebSocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "Missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing Sec-WebSocket-Key")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "Connection can't be taken over", http.StatusInternalServerError)
+		return nil, errors.New("connection can't be hijacked")
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+// headerContains reports whether the comma separated values of the header
+// called name include value, ignoring case.
+func headerContains(h http.Header, name, value string) bool {
+	for _, field := range h.Values(name) {
+		for _, v := range strings.Split(field, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// writeMessage writes a message of a single frame with the opcode op.
+func (ws *wsConn) writeMessage(op byte, payload []byte) error {
+	header := []byte{0x80 | op, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	n := 2
+	switch {
+	case len(payload) < 126:
+		header[1] = byte(len(payload))
+	case len(payload) <= 0xFFFF:
+		header[1] = 126
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+		n += 2
+	default:
+		header[1] = 127
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+		n += 8
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if _, err := ws.conn.Write(header[:n]); err != nil {
+		return err
+	}
+	_, err := ws.conn.Write(payload)
+	return err
+}
+
+// readMessage returns the next text or binary message from the client,
+// answering pings on the way. It returns io.EOF once the client closes the
+// connection.
+func (ws *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	for {
+		fin, op, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case opPing:
+			if err := ws.writeMessage(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			ws.writeMessage(opClose, nil)
+			return nil, io.EOF
+		case opText, opBinary, opContinuation:
+		default:
+			return nil, fmt.Errorf("unknown WebSocket opcode %#x", op)
+		}
+
+		message = append(message, payload...)
+		if len(message) > maxMessageSize {
+			return nil, errors.New("WebSocket message too large")
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame reads a frame from the client, unmasking its payload.
+func (ws *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = header[0]&0x80 != 0, header[0]&0x0F
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, errors.New("unmasked frame from client")
+	}
+
+	size := uint64(header[1] & 0x7F)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if size > maxMessageSize {
+		return false, 0, nil, errors.New("WebSocket frame too large")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, size)
+	if _, err := io.ReadFull(ws.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, op, payload, nil
+}
+
+// close closes the connection.
+func (ws *wsConn) close() error {
+	return ws.conn.Close()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	_ "embed"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// romdbData is the database of known ROMs built in, see romdb.toml.
+//
+//go:embed romdb.toml
+var romdbData []byte
+
+// romInfo is what the ROM database knows of a ROM.
+type romInfo struct {
+	Name     string
+	Author   string
+	Year     string
+	Platform string // CHIP-8, SUPER-CHIP, XO-CHIP, ...
+	Speed    string // recommended -speed
+	Quirks   string // recommended -quirks
+	Controls string // keys the game is played with
+}
+
+// romdb is the ROM database, by ROM hash, loaded by loadRomDB.
+var romdb map[string]romInfo
+
+// loadRomDB loads the ROM database built in, adding the entries of
+// romdb.toml in the config directory, if there is one.
+func loadRomDB() {
+	db, err := parseConfig(romdbData)
+	if err != nil {
+		log.Fatal("Error in built in ROM database: ", err)
+	}
+	path := filepath.Join(configDir(), "romdb.toml")
+	user, err := loadConfig(path)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Errorf("Error loading ROM database: %v", err)
+	}
+	for hash, entry := range user {
+		db[hash] = entry
+	}
+
+	romdb = make(map[string]romInfo, len(db))
+	for section, entry := range db {
+		hash, err := unquote(section)
+		if err != nil || hash == "" {
+			continue
+		}
+		romdb[strings.ToLower(hash)] = romInfo{
+			Name:     valueString(entry["name"]),
+			Author:   valueString(entry["author"]),
+			Year:     valueString(entry["year"]),
+			Platform: valueString(entry["platform"]),
+			Speed:    valueString(entry["speed"]),
+			Quirks:   valueString(entry["quirks"]),
+			Controls: valueString(entry["controls"]),
+		}
+	}
+}
+
+// lookupRom returns what the ROM database knows of the ROM with the SHA-1
+// hash, if anything.
+func lookupRom(hash string) (romInfo, bool) {
+	if romdb == nil {
+		loadRomDB()
+	}
+	info, ok := romdb[strings.ToLower(hash)]
+
+	return info, ok
+}
+
+// describe returns who made the ROM, when and for what, and how it is
+// played, as far as known.
+func (info romInfo) describe() string {
+	var parts []string
+	if info.Author != "" {
+		parts = append(parts, "by "+info.Author)
+	}
+	if info.Year != "" {
+		parts = append(parts, info.Year)
+	}
+	if info.Platform != "" {
+		parts = append(parts, info.Platform)
+	}
+	text := strings.Join(parts, ", ")
+	if info.Controls != "" {
+		if text != "" {
+			text += ". "
+		}
+		text += "Controls: " + info.Controls
+	}
+
+	return text
+}
+
+// applyRomInfo applies the speed and quirks the ROM database recommends for
+// the ROM with the SHA-1 hash, unless given.
+func applyRomInfo(fs *flag.FlagSet, hash string, given map[string]bool) error {
+	info, ok := lookupRom(hash)
+	if !ok {
+		return nil
+	}
+	for name, value := range map[string]string{"speed": info.Speed, "quirks": info.Quirks} {
+		if value == "" || given[name] || fs.Lookup(name) == nil {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("ROM database: %s: %s = %q: %v", hash, name, value, err)
+		}
+	}
+
+	return nil
+}
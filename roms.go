@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/sha1"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// romExtensions are the extensions tried when looking a ROM up by name.
+var romExtensions = []string{".ch8", ".c8", ".sc8", ".8o"}
+
+// romDirs returns the directories of the -romdir list.
+func romDirs() []string {
+	return filepath.SplitList(romdirs)
+}
+
+// findRom returns the path of the ROM called name: name itself if there is
+// such a file, or else a file in one of the ROM directories called name,
+// optionally with one of the romExtensions or .zip.
+func findRom(name string) (string, error) {
+	if info, err := os.Stat(name); err == nil && !info.IsDir() {
+		return name, nil
+	}
+
+	if !filepath.IsAbs(name) {
+		for _, dir := range romDirs() {
+			for _, ext := range append(append([]string{""}, romExtensions...), ".zip") {
+				path := filepath.Join(dir, name+ext)
+				if info, err := os.Stat(path); err == nil && !info.IsDir() {
+					return path, nil
+				}
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no ROM called %q here or in the ROM directories (%s)", name, strings.Join(romDirs(), ", "))
+}
+
+// listRoms returns the paths of the ROMs in the ROM directories: their files
+// with one of the romExtensions or none, and zip archives, sorted by
+// directory and name.
+func listRoms() []string {
+	var roms []string
+	for _, dir := range romDirs() {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			name := file.Name()
+			if file.IsDir() || strings.HasPrefix(name, ".") {
+				continue
+			}
+			ext := filepath.Ext(name)
+			for _, romExt := range append(append([]string{""}, romExtensions...), ".zip") {
+				if strings.EqualFold(ext, romExt) {
+					roms = append(roms, filepath.Join(dir, name))
+					break
+				}
+			}
+		}
+	}
+
+	return roms
+}
+
+// launchRom returns the ROM to run chosen from those played recently and
+// those in the ROM directories, when none is given, if the backend can show
+// them. It exits if none is chosen.
+func launchRom() string {
+	choose, ok := launchers[backend]
+	if !ok {
+		log.Fatal("No ROM given: pass its path or name, e.g. chip8 run TETRIS")
+	}
+	roms := launcherRoms()
+	if len(roms) == 0 {
+		log.Fatalf("No ROM given, and none found in the ROM directories (%s)\n", strings.Join(romDirs(), ", "))
+	}
+
+	rom, ok, err := choose(roms)
+	if err != nil {
+		log.Fatal("Unable to show the ROMs: ", err)
+	}
+	if !ok {
+		os.Exit(0)
+	}
+
+	return rom
+}
+
+// launcherRoms returns the ROMs a launcher lists: those played recently,
+// most recent first, and then the others in the ROM directories.
+func launcherRoms() []launcherRom {
+	recent := loadRecent()
+	var roms []launcherRom
+	for _, rom := range recent {
+		roms = append(roms, newLauncherRom(rom, true))
+	}
+	for _, rom := range listRoms() {
+		if !isRecent(recent, rom) {
+			roms = append(roms, newLauncherRom(rom, false))
+		}
+	}
+
+	return roms
+}
+
+// newLauncherRom returns the launcher entry of the ROM at path, or URL,
+// titled by its file name and the name the ROM database knows it by.
+func newLauncherRom(path string, recent bool) launcherRom {
+	rom := launcherRom{path: path, title: filepath.Base(path), recent: recent}
+	if isURL(path) || isZip(path) {
+		return rom
+	}
+
+	data, err := core.ReadRom(path)
+	if err != nil {
+		return rom
+	}
+	if info, ok := lookupRom(fmt.Sprintf("%x", sha1.Sum(data))); ok {
+		if info.Name != "" {
+			rom.title = info.Name + " (" + rom.title + ")"
+		}
+		rom.details = info.describe()
+	}
+
+	return rom
+}
+
+// parseRomArg takes the ROM given as an argument, rather than with -p, and
+// the options following it.
+func parseRomArg(fs *flag.FlagSet) {
+	if rom, ok := romArg(fs); ok {
+		fs.Set("p", rom)
+	}
+}
+
+// romArg returns the ROM given as the argument of a command, parsing the
+// options following it too, so they can be given either side of it. It exits
+// with the command's usage if there are other arguments.
+func romArg(fs *flag.FlagSet) (string, bool) {
+	if fs.NArg() == 0 {
+		return "", false
+	}
+
+	rom := fs.Arg(0)
+	fs.Parse(fs.Args()[1:])
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	return rom, true
+}
@@ -0,0 +1,165 @@
+//go:build lua
+// +build lua
+
+package main
+
+import (
+	"strings"
+
+	"github.com/n-ulricksen/chip8/core"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func init() {
+	loadScript = loadLuaScript
+}
+
+// loadLuaScript runs the Lua script at path, which hooks the emulator
+// through the chip8 table:
+//
+//	chip8.reg(name)              value of V0-VF, I, PC, SP, DT or ST
+//	chip8.setreg(name, value)    set a register
+//	chip8.peek(addr)             byte of RAM at addr
+//	chip8.poke(addr, value)      set a byte of RAM
+//	chip8.press(key, down)       press (or release) a Chip-8 key
+//	chip8.onframe(fn)            call fn() after each frame
+//	chip8.oninstruction(fn)      call fn(addr, opcode) before each instruction
+//	chip8.overlay(text)          show text over the display, "" hides it
+//	chip8.pause()                pause execution
+//
+// The script runs before the emulator starts; its hooks run as it does.
+func loadLuaScript(path string, c *core.Chip8) error {
+	L := lua.NewState()
+	api := L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"reg": func(L *lua.LState) int {
+			v, ok := luaRegister(c.Registers(), L.CheckString(1))
+			if !ok {
+				L.ArgError(1, "unknown register")
+			}
+			L.Push(lua.LNumber(v))
+			return 1
+		},
+		"setreg": func(L *lua.LState) int {
+			r := c.Registers()
+			if !setLuaRegister(&r, L.CheckString(1), L.CheckInt(2)) {
+				L.ArgError(1, "unknown register")
+			}
+			c.SetRegisters(r)
+			return 0
+		},
+		"peek": func(L *lua.LState) int {
+			mem := c.Memory(uint16(L.CheckInt(1)), 1)
+			if len(mem) == 0 {
+				L.ArgError(1, "address outside RAM")
+			}
+			L.Push(lua.LNumber(mem[0]))
+			return 1
+		},
+		"poke": func(L *lua.LState) int {
+			c.WriteMemory(uint16(L.CheckInt(1)), []byte{byte(L.CheckInt(2))})
+			return 0
+		},
+		"press": func(L *lua.LState) int {
+			key := L.CheckInt(1)
+			if key < 0 || key > 0xF {
+				L.ArgError(1, "keys are 0-15")
+			}
+			c.SetKey(uint8(key), L.ToBool(2))
+			return 0
+		},
+		"onframe": func(L *lua.LState) int {
+			fn := L.CheckFunction(1)
+			c.OnFrame(func() {
+				callLua(L, fn)
+			})
+			return 0
+		},
+		"oninstruction": func(L *lua.LState) int {
+			fn := L.CheckFunction(1)
+			c.OnInstruction(func(addr, op uint16) {
+				callLua(L, fn, lua.LNumber(addr), lua.LNumber(op))
+			})
+			return 0
+		},
+		"overlay": func(L *lua.LState) int {
+			c.SetOverlay(L.CheckString(1))
+			return 0
+		},
+		"pause": func(L *lua.LState) int {
+			c.SetPaused(true)
+			return 0
+		},
+	})
+	L.SetGlobal("chip8", api)
+
+	if err := L.DoFile(path); err != nil {
+		L.Close()
+		return err
+	}
+	logger.Infof("Loaded script %s", path)
+
+	return nil
+}
+
+// callLua calls the Lua function fn with args, logging any error it raises.
+func callLua(L *lua.LState, fn *lua.LFunction, args ...lua.LValue) {
+	if err := L.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, args...); err != nil {
+		logger.Errorf("Script error: %v", err)
+	}
+}
+
+// luaRegister returns the value of the register named name.
+func luaRegister(r core.Registers, name string) (int, bool) {
+	switch name = strings.ToUpper(name); name {
+	case "I":
+		return int(r.I), true
+	case "PC":
+		return int(r.PC), true
+	case "SP":
+		return int(r.SP), true
+	case "DT":
+		return int(r.DT), true
+	case "ST":
+		return int(r.ST), true
+	}
+	if n, ok := vRegister(name); ok {
+		return int(r.V[n]), true
+	}
+
+	return 0, false
+}
+
+// setLuaRegister sets the register named name to value.
+func setLuaRegister(r *core.Registers, name string, value int) bool {
+	switch name = strings.ToUpper(name); name {
+	case "I":
+		r.I = uint16(value) & 0xFFF
+	case "PC":
+		r.PC = uint16(value) & 0xFFF
+	case "SP":
+		r.SP = uint8(value)
+	case "DT":
+		r.DT = uint8(value)
+	case "ST":
+		r.ST = uint8(value)
+	default:
+		n, ok := vRegister(name)
+		if !ok {
+			return false
+		}
+		r.V[n] = uint8(value)
+	}
+
+	return true
+}
+
+// vRegister returns the number of the V register named name, e.g. 10 for
+// VA.
+func vRegister(name string) (int, bool) {
+	if len(name) != 2 || name[0] != 'V' {
+		return 0, false
+	}
+	n := strings.IndexByte("0123456789ABCDEF", name[1])
+
+	return n, n >= 0
+}
@@ -0,0 +1,71 @@
+package sdlui
+
+import (
+	"fmt"
+
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	audioFreq = 44100 // samples a second
+
+	// audioQueued is how many samples are kept queued, three frames' worth,
+	// enough to play on between frames without the buzzer lagging behind
+	// the sound timer.
+	audioQueued = 3 * audioFreq / core.VBlankFreq
+)
+
+// beeper plays the buzzer, a square wave, through an SDL audio device,
+// queueing the samples of the tone while it sounds and silence otherwise.
+type beeper struct {
+	dev    sdl.AudioDeviceID
+	step   float64 // phase advanced a sample, tone/audioFreq
+	phase  float64 // phase of the wave, from 0 to 1
+	volume int16   // amplitude of the wave
+	buf    []byte
+}
+
+// newBeeper opens the default audio device to play a tone of the frequency,
+// in Hz, at the volume, from 0 to 100.
+func newBeeper(tone float64, volume int) (*beeper, error) {
+	spec := sdl.AudioSpec{Freq: audioFreq, Format: sdl.AUDIO_S16, Channels: 1, Samples: 512}
+	dev, err := sdl.OpenAudioDevice("", false, &spec, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open audio device: %v", err)
+	}
+	sdl.PauseAudioDevice(dev, false)
+
+	return &beeper{dev: dev, step: tone / audioFreq, volume: int16(volume * 0x7fff / 100)}, nil
+}
+
+// update queues the sound to play until the next frame: the tone if on,
+// silence otherwise.
+func (b *beeper) update(on bool) {
+	queued := int(sdl.GetQueuedAudioSize(b.dev)) / 2
+	if queued >= audioQueued {
+		return
+	}
+
+	b.buf = b.buf[:0]
+	for n := queued; n < audioQueued; n++ {
+		var sample int16
+		if on {
+			sample = b.volume
+			if b.phase >= 0.5 {
+				sample = -b.volume
+			}
+			if b.phase += b.step; b.phase >= 1 {
+				b.phase--
+			}
+		}
+		b.buf = append(b.buf, byte(sample), byte(uint16(sample)>>8))
+	}
+	// Sound failing to queue is dropped rather than stopping the emulator.
+	sdl.QueueAudio(b.dev, b.buf)
+}
+
+// close closes the audio device.
+func (b *beeper) close() {
+	sdl.CloseAudioDevice(b.dev)
+}
@@ -0,0 +1,74 @@
+package sdlui
+
+import (
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// cheatMenu is the list of cheats shown over the display, to toggle them.
+type cheatMenu struct {
+	selected int // index of the highlighted cheat
+}
+
+// openCheatMenu shows the cheat menu. Keypad input is withheld from the
+// emulator while it is open.
+func (f *Frontend) openCheatMenu(c *core.Chip8) {
+	for key := uint8(0); key < 16; key++ {
+		c.SetKey(key, false)
+	}
+	f.cheatMenu = &cheatMenu{}
+	f.redraw = true
+}
+
+// handleCheatMenuKey moves through the cheat menu with the arrow keys and
+// toggles the highlighted cheat with Enter or Space. Escape closes it.
+func (f *Frontend) handleCheatMenuKey(c *core.Chip8, scancode sdl.Scancode) {
+	f.redraw = true
+	cheats := c.Cheats()
+
+	switch scancode {
+	case sdl.SCANCODE_ESCAPE:
+		f.cheatMenu = nil
+	case sdl.SCANCODE_UP:
+		if f.cheatMenu.selected > 0 {
+			f.cheatMenu.selected--
+		}
+	case sdl.SCANCODE_DOWN:
+		if f.cheatMenu.selected < len(cheats)-1 {
+			f.cheatMenu.selected++
+		}
+	case sdl.SCANCODE_RETURN, sdl.SCANCODE_SPACE:
+		if i := f.cheatMenu.selected; i < len(cheats) {
+			c.SetCheatEnabled(i, !cheats[i].Enabled)
+		}
+	}
+}
+
+// renderCheatMenu lists the cheats over the display viewport vp, a line
+// each, marking those enabled and the highlighted one.
+func (f *Frontend) renderCheatMenu(c *core.Chip8, vp sdl.Rect) {
+	lines := []string{"Cheats (Up/Down selects, Enter toggles, Esc closes)"}
+	cheats := c.Cheats()
+	if len(cheats) == 0 {
+		lines = append(lines, "  No cheats loaded, see -cheats")
+	}
+	for i, cheat := range cheats {
+		line := "  "
+		if i == f.cheatMenu.selected {
+			line = "> "
+		}
+		if cheat.Enabled {
+			line += "[x] "
+		} else {
+			line += "[ ] "
+		}
+		lines = append(lines, line+cheat.Name)
+	}
+
+	lineHeight := int32(f.font.Height()) + 8*f.pixelRatio
+	for i, line := range lines {
+		rect := vp
+		rect.Y += int32(i) * lineHeight
+		f.renderLabel(line, rect, false)
+	}
+}
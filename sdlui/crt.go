@@ -0,0 +1,50 @@
+package sdlui
+
+import (
+	"math"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	scanlineAlpha = 80  // opacity of the dark line drawn over every other row
+	vignetteAlpha = 120 // opacity of the vignette at the very edge of the screen
+)
+
+// renderCRT draws the CRT filter over the display viewport vp, which must
+// already hold the scaled display.
+func (f *Frontend) renderCRT(vp sdl.Rect) {
+	f.renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	defer f.renderer.SetDrawBlendMode(sdl.BLENDMODE_NONE)
+
+	// Scanlines.
+	f.renderer.SetDrawColor(0, 0, 0, scanlineAlpha)
+	for y := vp.Y + 1; y < vp.Y+vp.H; y += 2 {
+		f.renderer.DrawLine(vp.X, y, vp.X+vp.W-1, y)
+	}
+
+	// Vignette: rectangles growing more opaque towards the edges.
+	width := vp.H / 12
+	for i := int32(0); i < width; i++ {
+		alpha := uint8((width - i) * vignetteAlpha / width)
+		f.renderer.SetDrawColor(0, 0, 0, alpha)
+		f.renderer.DrawRect(&sdl.Rect{X: vp.X + i, Y: vp.Y + i, W: vp.W - 2*i, H: vp.H - 2*i})
+	}
+
+	// Curvature: mask the corners off with quarter circles.
+	f.renderer.SetDrawColor(0, 0, 0, 255)
+	r := vp.H / 16
+	for dy := int32(0); dy < r; dy++ {
+		d := float64(r - dy)
+		inset := r - int32(math.Sqrt(float64(r*r)-d*d))
+		if inset <= 0 {
+			continue
+		}
+		top, bottom := vp.Y+dy, vp.Y+vp.H-1-dy
+		left, right := vp.X, vp.X+vp.W-inset
+		f.renderer.FillRect(&sdl.Rect{X: left, Y: top, W: inset, H: 1})
+		f.renderer.FillRect(&sdl.Rect{X: right, Y: top, W: inset, H: 1})
+		f.renderer.FillRect(&sdl.Rect{X: left, Y: bottom, W: inset, H: 1})
+		f.renderer.FillRect(&sdl.Rect{X: right, Y: bottom, W: inset, H: 1})
+	}
+}
@@ -0,0 +1,559 @@
+// Package sdlui implements a frontend for the Chip-8 emulator which draws the
+// display in an SDL2 window and reads the keypad from the keyboard.
+package sdlui
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/n-ulricksen/chip8/fonts"
+	"github.com/veandco/go-sdl2/sdl"
+	"github.com/veandco/go-sdl2/ttf"
+)
+
+const fontsize = 12
+
+func init() {
+	// SDL must be used from the main thread, which the main goroutine keeps
+	// while the emulator runs on others.
+	runtime.LockOSThread()
+}
+
+// Frontend is an SDL2 window showing the emulator display, and optionally a
+// debug panel below it.
+type Frontend struct {
+	window    *sdl.Window
+	title     titleStatus // status last shown in the window title
+	renderer  *sdl.Renderer
+	texture   *sdl.Texture // streaming texture holding the display pixels
+	viewport  sdl.Rect     // window area the display was last drawn to
+	font      *ttf.Font
+	remap     *remapper     // keypad rebinding in progress, if any
+	cheatMenu *cheatMenu    // cheat menu, if open
+	romMenu   *launcher     // menu of ROMs to load instead, if open
+	keypad    *touchKeypad  // on-screen keypad, if shown
+	keybinds  map[int]uint8 // scancodes bound to each Chip-8 key
+	padbinds  map[int]uint8 // game controller buttons bound to each Chip-8 key
+	isDebug   bool
+	vsync     bool // presenting waits for the display's vertical blank
+	showStats bool // draw the FPS/IPS overlay
+	redraw    bool // the window needs redrawing even if the frame is unchanged
+
+	pixelRatio int32 // output pixels per window coordinate
+
+	memview memView // hex dump in the debug panel
+
+	inspect bool      // show the display inspector instead of the display
+	mouse   sdl.Point // last mouse position, in output pixels
+
+	controllers map[sdl.JoystickID]*sdl.GameController // connected game controllers
+
+	screenshotDir string // directory screenshots and recordings are saved to
+	stateDir      string // directory the save state slots of the ROM are kept in
+	autosave      bool   // save the state when the window is closed
+	resume        bool   // asking whether to resume from the autosaved state
+	saveKeys      func(keys map[string]uint8) error
+	loadRom       func(c *core.Chip8, path string) error
+	listRoms      func() []RomItem
+
+	fastForward bool    // fast-forwarding while the hotkey is held
+	speedBefore float64 // speed to return to after fast-forwarding
+	slowMotion  bool    // running at half speed
+
+	slot      int       // save state slot selected, from 1
+	slotShown time.Time // when the slot indicator was last shown
+	slotText  string    // slot indicator, while shown
+
+	beeper *beeper // plays the buzzer, if sound is on
+
+	log core.Logger
+}
+
+// Options configures the SDL frontend.
+type Options struct {
+	Debug         bool    // show the debug panel below the display
+	VSync         bool    // synchronize presenting frames with the display
+	Layout        string  // keyboard layout, "standard" (default) or "classic"
+	Keypad        bool    // show a keypad below the display, pressed with the mouse
+	Scale         int     // window pixels per Chip-8 pixel the window opens with, 0 for DisplayScale
+	ScreenshotDir string  // directory screenshots and recordings are saved to
+	StateDir      string  // directory of the ROM's save state slots, saved to (F5) and loaded from (F7)
+	Autosave      bool    // save the state to StateDir when the window is closed, see OfferResume
+	FontPath      string  // TrueType font text is drawn with, instead of the one built in
+	Volume        int     // volume of the buzzer, from 0, which mutes it, to 100
+	Tone          float64 // frequency of the buzzer in Hz, 0 for 440
+
+	// Logger receives the errors of the frontend, such as a state failing
+	// to save. If nil, they are written to stderr.
+	Logger core.Logger
+
+	// Keys binds SDL key names to Chip-8 keys, replacing the default layout.
+	Keys map[string]uint8
+
+	// SaveKeys, if set, is called with the new bindings, by SDL key name,
+	// after the keypad is rebound from the keyboard (F2).
+	SaveKeys func(keys map[string]uint8) error
+
+	// LoadRom, if set, is called to run the ROM at path in place of the one
+	// running, when a file is dropped on the window or a ROM chosen from
+	// the menu Ctrl+O opens.
+	LoadRom func(c *core.Chip8, path string) error
+
+	// Roms, if set, lists the ROMs the menu Ctrl+O opens offers to load.
+	Roms func() []RomItem
+
+	// Buttons binds SDL game controller button names to Chip-8 keys,
+	// replacing the default layout.
+	Buttons map[string]uint8
+
+	// GameKeys and GameButtons bind keys and buttons for the loaded ROM
+	// only, on top of the other bindings.
+	GameKeys    map[string]uint8
+	GameButtons map[string]uint8
+}
+
+// New initializes SDL and opens the emulator window.
+func New(opts Options) (*Frontend, error) {
+	if err := initSDL(); err != nil {
+		return nil, err
+	}
+	binds, buttons, err := bindings(opts)
+	if err != nil {
+		quitSDL()
+		return nil, err
+	}
+
+	var panelHeight int32
+	if opts.Debug {
+		panelHeight += DebugHeight
+	}
+	var keypad *touchKeypad
+	if opts.Keypad {
+		panelHeight += KeypadHeight
+		keypad = &touchKeypad{key: noKey}
+	}
+
+	window, renderer, err := NewDisplayRenderer(panelHeight, opts.VSync)
+	if err != nil {
+		quitSDL()
+		return nil, err
+	}
+	if opts.Scale > 0 {
+		window.SetSize(core.Chip8Width*int32(opts.Scale), core.Chip8Height*int32(opts.Scale)+panelHeight)
+	}
+	ratio := pixelRatio(window, renderer)
+	texture, err := newDisplayTexture(renderer)
+	var font *ttf.Font
+	if err == nil {
+		font, err = openFont(opts.FontPath, ratio)
+	}
+	if err != nil {
+		if texture != nil {
+			texture.Destroy()
+		}
+		renderer.Destroy()
+		window.Destroy()
+		quitSDL()
+		return nil, err
+	}
+
+	log := logger(opts.Logger)
+	var beep *beeper
+	if opts.Volume > 0 {
+		tone := opts.Tone
+		if tone == 0 {
+			tone = 440
+		}
+		if beep, err = newBeeper(tone, opts.Volume); err != nil {
+			log.Warnf("No sound: %v", err)
+		}
+	}
+
+	return &Frontend{
+		window:   window,
+		renderer: renderer,
+		texture:  texture,
+		font:     font,
+		keybinds: binds,
+		padbinds: buttons,
+		keypad:   keypad,
+		isDebug:  opts.Debug,
+		vsync:    opts.VSync,
+		redraw:   true,
+
+		pixelRatio: ratio,
+
+		memview: memView{follow: true},
+
+		controllers: make(map[sdl.JoystickID]*sdl.GameController),
+
+		screenshotDir: opts.ScreenshotDir,
+		stateDir:      opts.StateDir,
+		autosave:      opts.Autosave,
+		saveKeys:      opts.SaveKeys,
+		loadRom:       opts.LoadRom,
+		listRoms:      opts.Roms,
+
+		slot: 1,
+
+		beeper: beep,
+
+		log: log,
+	}, nil
+}
+
+// logger returns log, or a Logger writing to stderr if it is nil.
+func logger(log core.Logger) core.Logger {
+	if log == nil {
+		return core.NewLogger(os.Stderr, core.LogInfo)
+	}
+
+	return log
+}
+
+// initSDL initializes SDL and its font library.
+func initSDL() error {
+	if err := sdl.Init(sdl.INIT_EVERYTHING); err != nil {
+		return fmt.Errorf("unable to initialize SDL: %v", err)
+	}
+	if err := ttf.Init(); err != nil {
+		sdl.Quit()
+		return fmt.Errorf("unable to initialize TTF: %v", err)
+	}
+
+	return nil
+}
+
+// quitSDL shuts down what initSDL initialized.
+func quitSDL() {
+	ttf.Quit()
+	sdl.Quit()
+}
+
+// openFont loads the font at path, or the one built in if path is empty,
+// sized to stay legible on high-DPI displays with ratio output pixels to a
+// window coordinate.
+func openFont(path string, ratio int32) (*ttf.Font, error) {
+	var font *ttf.Font
+	var err error
+	if path != "" {
+		font, err = ttf.OpenFont(path, fontsize*int(ratio))
+	} else {
+		var rw *sdl.RWops
+		if rw, err = sdl.RWFromMem(fonts.DotGothic16); err == nil {
+			font, err = ttf.OpenFontRW(rw, 1, fontsize*int(ratio))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to load font: %v", err)
+	}
+
+	return font, nil
+}
+
+// bindings returns the keyboard and game controller bindings opts
+// configures.
+func bindings(opts Options) (keys, buttons map[int]uint8, err error) {
+	layout := opts.Layout
+	if layout == "" {
+		layout = "standard"
+	}
+	keys, ok := layouts[layout]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown keyboard layout %q", layout)
+	}
+	if opts.Keys != nil {
+		if keys, err = resolveKeybinds(opts.Keys); err != nil {
+			return nil, nil, err
+		}
+	}
+	buttons = padbinds
+	if opts.Buttons != nil {
+		if buttons, err = resolvePadbinds(opts.Buttons); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	gameKeys, err := resolveKeybinds(opts.GameKeys)
+	if err != nil {
+		return nil, nil, err
+	}
+	gameButtons, err := resolvePadbinds(opts.GameButtons)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return mergeBinds(keys, gameKeys), mergeBinds(buttons, gameButtons), nil
+}
+
+// Rebind replaces the keyboard and game controller bindings with those opts
+// configures, as New does, e.g. after the config file changed. The other
+// options are ignored. The bindings are left as they were if those of opts
+// are invalid.
+func (f *Frontend) Rebind(opts Options) error {
+	keys, buttons, err := bindings(opts)
+	if err != nil {
+		return err
+	}
+	f.keybinds, f.padbinds = keys, buttons
+
+	return nil
+}
+
+// SetStateDir sets the directory the save state slots are kept in, e.g.
+// after another ROM is loaded.
+func (f *Frontend) SetStateDir(dir string) {
+	f.stateDir = dir
+}
+
+// openRom runs the ROM at path in place of the one running, closing any
+// menu or prompt shown for the old one.
+func (f *Frontend) openRom(c *core.Chip8, path string) {
+	if f.loadRom == nil {
+		return
+	}
+	if err := f.loadRom(c, path); err != nil {
+		f.log.Errorf("Unable to load ROM: %v", err)
+		return
+	}
+	f.cheatMenu = nil
+	if f.resume {
+		f.resume = false
+		c.SetPaused(false)
+	}
+	f.redraw = true
+}
+
+// Close destroys the window and shuts SDL down.
+func (f *Frontend) Close() {
+	for _, ctrl := range f.controllers {
+		ctrl.Close()
+	}
+	if f.texture != nil {
+		f.texture.Destroy()
+	}
+	if f.beeper != nil {
+		f.beeper.close()
+	}
+	f.renderer.Destroy()
+	f.window.Destroy()
+	f.font.Close()
+	quitSDL()
+}
+
+// PollEvents checks for keyboard, mouse and game controller events.
+func (f *Frontend) PollEvents(c *core.Chip8) {
+	for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+		switch t := event.(type) {
+		case *sdl.QuitEvent:
+			if f.autosave {
+				f.saveAutosave(c)
+			}
+			c.Stop()
+		case *sdl.WindowEvent:
+			// Resized, exposed, etc.
+			f.redraw = true
+		case *sdl.KeyboardEvent:
+			scancode := t.Keysym.Scancode
+			switch t.Type {
+			case sdl.KEYDOWN:
+				if f.remap != nil {
+					if t.Repeat == 0 {
+						f.handleRemapKey(scancode)
+					}
+					break
+				}
+				if f.resume {
+					if t.Repeat == 0 {
+						f.handleResumeKey(c, scancode)
+					}
+					break
+				}
+				if f.romMenu != nil && !(t.Keysym.Mod&sdl.KMOD_CTRL != 0 && scancode == ctrlOpenHotkey) {
+					if t.Repeat == 0 {
+						f.handleRomMenuKey(c, scancode)
+					}
+					break
+				}
+				if f.cheatMenu != nil && !(t.Keysym.Mod&sdl.KMOD_CTRL != 0 && scancode == ctrlCheatsHotkey) {
+					if t.Repeat == 0 {
+						f.handleCheatMenuKey(c, scancode)
+					}
+					break
+				}
+				if t.Keysym.Mod&sdl.KMOD_CTRL != 0 {
+					if t.Repeat == 0 {
+						f.handleCtrlHotkey(c, scancode)
+					}
+					break
+				}
+				if t.Repeat == 0 {
+					f.handleHotkey(c, t.Keysym)
+				}
+				if i, ok := f.keybinds[int(scancode)]; ok {
+					c.SetKey(i, true)
+				}
+			case sdl.KEYUP:
+				if scancode == rewindHotkey {
+					c.SetRewinding(false)
+				}
+				if scancode == fastForwardHotkey && f.fastForward {
+					f.fastForward = false
+					c.SetSpeed(f.speedBefore)
+					f.redraw = true
+				}
+				if i, ok := f.keybinds[int(scancode)]; ok {
+					c.SetKey(i, false)
+				}
+			}
+		case *sdl.MouseButtonEvent, *sdl.MouseMotionEvent:
+			if m, ok := event.(*sdl.MouseMotionEvent); ok {
+				f.mouse = sdl.Point{X: m.X * f.pixelRatio, Y: m.Y * f.pixelRatio}
+			}
+			if f.keypad != nil {
+				f.handleKeypadMouse(c, event)
+			}
+		case *sdl.DropEvent:
+			if t.Type == sdl.DROPFILE {
+				f.openRom(c, t.File)
+			}
+		case *sdl.ControllerDeviceEvent:
+			f.handleControllerDevice(t)
+		case *sdl.ControllerButtonEvent:
+			if f.romMenu != nil {
+				if t.Type == sdl.CONTROLLERBUTTONDOWN {
+					f.handleRomMenuButton(c, int(t.Button))
+				}
+				break
+			}
+			if i, ok := f.padbinds[int(t.Button)]; ok {
+				c.SetKey(i, t.Type == sdl.CONTROLLERBUTTONDOWN)
+			}
+		}
+	}
+}
+
+// handleHotkey performs the emulator action bound to the key, if any.
+func (f *Frontend) handleHotkey(c *core.Chip8, key sdl.Keysym) {
+	if key.Mod&sdl.KMOD_SHIFT != 0 {
+		for i, scancode := range slotHotkeys {
+			if key.Scancode == scancode {
+				f.selectSlot(i + 1)
+				return
+			}
+		}
+	}
+
+	switch key.Scancode {
+	case pauseHotkey, resumeHotkey:
+		c.SetPaused(!c.Paused())
+	case stepHotkey:
+		if key.Mod&sdl.KMOD_SHIFT != 0 {
+			c.StepOver()
+		} else {
+			c.Step()
+		}
+	case frameHotkey:
+		c.AdvanceFrame()
+	case rewindHotkey:
+		c.SetRewinding(true)
+	case fastForwardHotkey:
+		if !f.fastForward {
+			f.fastForward = true
+			f.speedBefore = c.Speed()
+		}
+		factor := 4.0
+		if key.Mod&sdl.KMOD_SHIFT != 0 {
+			factor = 8
+		}
+		c.SetSpeed(f.speedBefore * factor)
+		f.redraw = true
+	case slowMotionHotkey:
+		f.slowMotion = !f.slowMotion
+		if f.slowMotion {
+			c.SetSpeed(c.Speed() / 2)
+		} else {
+			c.SetSpeed(c.Speed() * 2)
+		}
+		f.redraw = true
+	case backHotkey:
+		c.StepBack()
+	case skipHotkey:
+		c.SkipInstruction()
+	case fullscreenHotkey:
+		f.toggleFullscreen()
+	case remapHotkey:
+		f.startRemap(c)
+	case statsHotkey:
+		f.showStats = !f.showStats
+		f.redraw = true
+	case screenshotHotkey:
+		if err := c.SaveScreenshot(f.screenshotDir, f.scale()); err != nil {
+			f.log.Errorf("Unable to save screenshot: %v", err)
+		}
+	case recordHotkey:
+		if err := c.ToggleRecording(f.screenshotDir, f.scale()); err != nil {
+			f.log.Errorf("Unable to save recording: %v", err)
+		}
+	case saveStateHotkey:
+		f.saveSlot(c)
+	case loadStateHotkey:
+		f.loadSlot(c)
+	case inspectHotkey:
+		f.inspect = !f.inspect
+		f.redraw = true
+	case memFollowHotkey:
+		f.memview.toggleFollow(c)
+	case memUpHotkey:
+		f.memview.scroll(-memViewRows)
+	case memDownHotkey:
+		f.memview.scroll(memViewRows)
+	}
+}
+
+// handleCtrlHotkey performs the emulator action bound to Ctrl and scancode,
+// if any.
+func (f *Frontend) handleCtrlHotkey(c *core.Chip8, scancode sdl.Scancode) {
+	switch scancode {
+	case ctrlPauseHotkey:
+		c.SetPaused(!c.Paused())
+	case ctrlResetHotkey:
+		c.Reset()
+	case ctrlSpeedUpHotkey:
+		c.SetSpeed(c.Speed() * 2)
+		f.redraw = true
+	case ctrlSpeedDownHotkey:
+		c.SetSpeed(c.Speed() / 2)
+		f.redraw = true
+	case ctrlCheatsHotkey:
+		if f.cheatMenu != nil {
+			f.cheatMenu = nil
+			f.redraw = true
+		} else {
+			f.openCheatMenu(c)
+		}
+	case ctrlOpenHotkey:
+		if f.romMenu != nil {
+			f.romMenu = nil
+			f.redraw = true
+		} else {
+			f.openRomMenu(c)
+		}
+	}
+}
+
+// toggleFullscreen switches the window between fullscreen, at the desktop's
+// resolution, and windowed.
+func (f *Frontend) toggleFullscreen() {
+	var flags uint32
+	if f.window.GetFlags()&sdl.WINDOW_FULLSCREEN_DESKTOP != sdl.WINDOW_FULLSCREEN_DESKTOP {
+		flags = sdl.WINDOW_FULLSCREEN_DESKTOP
+	}
+	if err := f.window.SetFullscreen(flags); err != nil {
+		f.log.Errorf("Unable to toggle fullscreen: %v", err)
+	}
+	f.redraw = true
+}
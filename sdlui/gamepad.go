@@ -0,0 +1,56 @@
+package sdlui
+
+import (
+	"fmt"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// padbinds is the default game controller layout: the d-pad presses the keys
+// surrounding 5, which most games use for movement, and the face buttons the
+// keys commonly used for actions.
+var padbinds = map[int]uint8{
+	sdl.CONTROLLER_BUTTON_DPAD_UP:    0x2,
+	sdl.CONTROLLER_BUTTON_DPAD_DOWN:  0x8,
+	sdl.CONTROLLER_BUTTON_DPAD_LEFT:  0x4,
+	sdl.CONTROLLER_BUTTON_DPAD_RIGHT: 0x6,
+	sdl.CONTROLLER_BUTTON_A:          0x5,
+	sdl.CONTROLLER_BUTTON_B:          0x0,
+	sdl.CONTROLLER_BUTTON_X:          0x7,
+	sdl.CONTROLLER_BUTTON_Y:          0x9,
+}
+
+// resolvePadbinds converts game controller bindings given by SDL button name,
+// such as "a" or "dpleft", to buttons.
+func resolvePadbinds(buttons map[string]uint8) (map[int]uint8, error) {
+	binds := make(map[int]uint8, len(buttons))
+	for name, key := range buttons {
+		button := sdl.GameControllerGetButtonFromString(name)
+		if button == sdl.CONTROLLER_BUTTON_INVALID {
+			return nil, fmt.Errorf("unknown game controller button %q in bindings", name)
+		}
+		binds[int(button)] = key
+	}
+
+	return binds, nil
+}
+
+// handleControllerDevice opens game controllers as they are connected, which
+// includes those attached at startup, and closes them once disconnected.
+func (f *Frontend) handleControllerDevice(e *sdl.ControllerDeviceEvent) {
+	switch e.Type {
+	case sdl.CONTROLLERDEVICEADDED:
+		// Which is the device index here, rather than the instance id.
+		ctrl := sdl.GameControllerOpen(int(e.Which))
+		if ctrl == nil {
+			f.log.Warnf("Unable to open game controller: %v", sdl.GetError())
+			return
+		}
+		f.controllers[ctrl.Joystick().InstanceID()] = ctrl
+	case sdl.CONTROLLERDEVICEREMOVED:
+		if ctrl, ok := f.controllers[e.Which]; ok {
+			ctrl.Close()
+			delete(f.controllers, e.Which)
+		}
+	}
+}
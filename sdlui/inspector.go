@@ -0,0 +1,86 @@
+package sdlui
+
+import (
+	"fmt"
+
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// renderInspector draws the raw display pixels into the viewport vp on a
+// grid, with the area the last DXYN drew to outlined and the coordinates of
+// the pixel under the mouse shown.
+func (f *Frontend) renderInspector(c *core.Chip8, vp sdl.Rect) {
+	f.renderer.SetDrawColor(0, 0, 0, 255)
+	f.renderer.FillRect(&vp)
+
+	f.renderer.SetDrawColor(255, 255, 255, 255)
+	for y := 0; y < core.Chip8Height; y++ {
+		for x := 0; x < core.Chip8Width; x++ {
+			if c.PixelOn(x, y) {
+				cell := inspectorCell(vp, x, y, 1, 1)
+				f.renderer.FillRect(&cell)
+			}
+		}
+	}
+
+	// Grid lines between pixels, brighter every 8 pixels.
+	for x := 0; x <= core.Chip8Width; x++ {
+		f.setGridColor(x)
+		px := vp.X + int32(x)*vp.W/core.Chip8Width
+		f.renderer.DrawLine(px, vp.Y, px, vp.Y+vp.H)
+	}
+	for y := 0; y <= core.Chip8Height; y++ {
+		f.setGridColor(y)
+		py := vp.Y + int32(y)*vp.H/core.Chip8Height
+		f.renderer.DrawLine(vp.X, py, vp.X+vp.W, py)
+	}
+
+	label := ""
+	if r, ok := c.LastDraw(); ok {
+		// Outline the region, and its parts wrapped around the edges.
+		f.renderer.SetClipRect(&vp)
+		f.renderer.SetDrawColor(255, 60, 60, 255)
+		for _, dx := range []int{0, -core.Chip8Width} {
+			for _, dy := range []int{0, -core.Chip8Height} {
+				outline := inspectorCell(vp, r.X+dx, r.Y+dy, r.W, r.H)
+				f.renderer.DrawRect(&outline)
+			}
+		}
+		f.renderer.SetClipRect(nil)
+		label = fmt.Sprintf("last DRW %d,%d %dx%d", r.X, r.Y, r.W, r.H)
+	}
+
+	if f.mouse.InRect(&vp) {
+		x := int((f.mouse.X - vp.X) * core.Chip8Width / vp.W)
+		y := int((f.mouse.Y - vp.Y) * core.Chip8Height / vp.H)
+		state := "off"
+		if c.PixelOn(x, y) {
+			state = "on"
+		}
+		label = fmt.Sprintf("x %d, y %d: %s  %s", x, y, state, label)
+	}
+	if label != "" {
+		f.renderLabel(label, vp, true)
+	}
+}
+
+// inspectorCell returns the area of the viewport vp covering the w*h Chip-8
+// pixels from x, y.
+func inspectorCell(vp sdl.Rect, x, y, w, h int) sdl.Rect {
+	x0 := vp.X + int32(x)*vp.W/core.Chip8Width
+	y0 := vp.Y + int32(y)*vp.H/core.Chip8Height
+	x1 := vp.X + int32(x+w)*vp.W/core.Chip8Width
+	y1 := vp.Y + int32(y+h)*vp.H/core.Chip8Height
+
+	return sdl.Rect{X: x0, Y: y0, W: x1 - x0, H: y1 - y0}
+}
+
+// setGridColor sets the color of the grid line before pixel i.
+func (f *Frontend) setGridColor(i int) {
+	if i%8 == 0 {
+		f.renderer.SetDrawColor(90, 90, 90, 255)
+	} else {
+		f.renderer.SetDrawColor(40, 40, 40, 255)
+	}
+}
@@ -0,0 +1,143 @@
+package sdlui
+
+import (
+	"fmt"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// layouts are the keyboard layouts for the keypad, by the name given to
+// -layout. The standard layout is the 4x4 block under 1-4 used by most other
+// Chip-8 emulators, the classic one the block under 7-0 this emulator used to
+// be played with.
+var layouts = map[string]map[int]uint8{
+	"standard": {
+		sdl.SCANCODE_1: 0x1,
+		sdl.SCANCODE_2: 0x2,
+		sdl.SCANCODE_3: 0x3,
+		sdl.SCANCODE_4: 0xc,
+		sdl.SCANCODE_Q: 0x4,
+		sdl.SCANCODE_W: 0x5,
+		sdl.SCANCODE_E: 0x6,
+		sdl.SCANCODE_R: 0xd,
+		sdl.SCANCODE_A: 0x7,
+		sdl.SCANCODE_S: 0x8,
+		sdl.SCANCODE_D: 0x9,
+		sdl.SCANCODE_F: 0xe,
+		sdl.SCANCODE_Z: 0xa,
+		sdl.SCANCODE_X: 0x0,
+		sdl.SCANCODE_C: 0xb,
+		sdl.SCANCODE_V: 0xf,
+	},
+	"classic": {
+		sdl.SCANCODE_7:         0x1,
+		sdl.SCANCODE_8:         0x2,
+		sdl.SCANCODE_9:         0x3,
+		sdl.SCANCODE_0:         0xc,
+		sdl.SCANCODE_U:         0x4,
+		sdl.SCANCODE_I:         0x5,
+		sdl.SCANCODE_O:         0x6,
+		sdl.SCANCODE_P:         0xd,
+		sdl.SCANCODE_J:         0x7,
+		sdl.SCANCODE_K:         0x8,
+		sdl.SCANCODE_L:         0x9,
+		sdl.SCANCODE_SEMICOLON: 0xe,
+		sdl.SCANCODE_M:         0xa,
+		sdl.SCANCODE_COMMA:     0x0,
+		sdl.SCANCODE_PERIOD:    0xb,
+		sdl.SCANCODE_SLASH:     0xf,
+	},
+}
+
+// resolveKeybinds converts keypad bindings given by SDL key name, such as
+// "Q" or "Keypad 7", to scancodes.
+func resolveKeybinds(keys map[string]uint8) (map[int]uint8, error) {
+	binds := make(map[int]uint8, len(keys))
+	for name, key := range keys {
+		scancode := sdl.GetScancodeFromName(name)
+		if scancode == sdl.SCANCODE_UNKNOWN {
+			return nil, fmt.Errorf("unknown key name %q in keybindings", name)
+		}
+		binds[int(scancode)] = key
+	}
+
+	return binds, nil
+}
+
+// mergeBinds returns the bindings of base with those of over added, replacing
+// any for the same key or button.
+func mergeBinds(base, over map[int]uint8) map[int]uint8 {
+	if len(over) == 0 {
+		return base
+	}
+
+	merged := make(map[int]uint8, len(base)+len(over))
+	for k, key := range base {
+		merged[k] = key
+	}
+	for k, key := range over {
+		merged[k] = key
+	}
+
+	return merged
+}
+
+// Hotkeys controlling the emulator itself rather than the Chip-8 keypad.
+const (
+	remapHotkey      = sdl.SCANCODE_F2  // rebind the keypad from the keyboard
+	statsHotkey      = sdl.SCANCODE_F3  // toggle the FPS/IPS overlay
+	recordHotkey     = sdl.SCANCODE_F9  // start/stop GIF recording
+	fullscreenHotkey = sdl.SCANCODE_F11 // toggle fullscreen
+	screenshotHotkey = sdl.SCANCODE_F12 // save a PNG screenshot
+	pauseHotkey      = sdl.SCANCODE_PAUSE
+	resumeHotkey     = sdl.SCANCODE_F8  // pause/resume, e.g. after a breakpoint
+	stepHotkey       = sdl.SCANCODE_F10 // execute one instruction while paused, with Shift stepping over CALLs
+	frameHotkey      = sdl.SCANCODE_F6  // run until the next frame while paused
+	saveStateHotkey  = sdl.SCANCODE_F5  // save the machine state to the selected slot
+	loadStateHotkey  = sdl.SCANCODE_F7  // load the machine state from the selected slot
+)
+
+// slotHotkeys select save state slots 1 to 9 when pressed with Shift. F5 and
+// F7 save to and load from the selected slot.
+var slotHotkeys = [...]sdl.Scancode{
+	sdl.SCANCODE_F1, sdl.SCANCODE_F2, sdl.SCANCODE_F3, sdl.SCANCODE_F4, sdl.SCANCODE_F5,
+	sdl.SCANCODE_F6, sdl.SCANCODE_F7, sdl.SCANCODE_F8, sdl.SCANCODE_F9,
+}
+
+// rewindHotkey rewinds gameplay while held.
+const rewindHotkey = sdl.SCANCODE_GRAVE
+
+// Hotkeys changing the emulation speed. Fast-forward runs at 4x while held,
+// or 8x with Shift; slow motion toggles half speed.
+const (
+	fastForwardHotkey = sdl.SCANCODE_TAB
+	slowMotionHotkey  = sdl.SCANCODE_BACKSLASH
+)
+
+// backHotkey undoes the last instruction executed while paused, when
+// debugging.
+const backHotkey = sdl.SCANCODE_BACKSPACE
+
+// skipHotkey moves past the instruction at PC without executing it while
+// paused, e.g. an invalid opcode.
+const skipHotkey = sdl.SCANCODE_DELETE
+
+// inspectHotkey toggles the display inspector, showing the raw pixels.
+const inspectHotkey = sdl.SCANCODE_F4
+
+// Hotkeys of the memory viewer in the debug panel.
+const (
+	memFollowHotkey = sdl.SCANCODE_HOME     // follow I, or stay put
+	memUpHotkey     = sdl.SCANCODE_PAGEUP   // scroll up a page
+	memDownHotkey   = sdl.SCANCODE_PAGEDOWN // scroll down a page
+)
+
+// Hotkeys pressed along with Ctrl, so they can share keys with the keypad.
+const (
+	ctrlPauseHotkey     = sdl.SCANCODE_P      // pause/resume
+	ctrlResetHotkey     = sdl.SCANCODE_R      // restart the ROM
+	ctrlSpeedUpHotkey   = sdl.SCANCODE_EQUALS // double the emulation speed
+	ctrlSpeedDownHotkey = sdl.SCANCODE_MINUS  // halve the emulation speed
+	ctrlCheatsHotkey    = sdl.SCANCODE_C      // open/close the cheat menu
+	ctrlOpenHotkey      = sdl.SCANCODE_O      // open/close the menu of ROMs to load instead
+)
@@ -0,0 +1,171 @@
+package sdlui
+
+import (
+	"fmt"
+
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// KeypadHeight is the height, in window coordinates, of the on-screen keypad
+// drawn below the display.
+const KeypadHeight = 160
+
+// touchKeypad is a 4x4 keypad drawn in the window, pressed by clicking or
+// tapping it. SDL turns taps into mouse events, so both are handled alike.
+type touchKeypad struct {
+	rect sdl.Rect // area the keypad was last drawn to, in output pixels
+	key  uint8    // key held down with the mouse, or noKey
+}
+
+// noKey is the touchKeypad key when none is held.
+const noKey = 0xFF
+
+// renderKeypad draws the on-screen keypad into rect, laid out like the
+// Chip-8 keypad, with the key being held highlighted.
+func (f *Frontend) renderKeypad(rect sdl.Rect) {
+	f.keypad.rect = rect
+
+	f.renderer.SetDrawColor(30, 30, 30, 255)
+	f.renderer.FillRect(&rect)
+
+	for i, key := range keypadOrder {
+		cell := keypadCell(rect, i)
+		if key == f.keypad.key {
+			f.renderer.SetDrawColor(0, 160, 130, 255)
+		} else {
+			f.renderer.SetDrawColor(60, 60, 60, 255)
+		}
+		f.renderer.FillRect(&cell)
+
+		f.renderKeypadLabel(fmt.Sprintf("%X", key), cell)
+	}
+}
+
+// keypadCell returns the area within the keypad rect of the i'th key in
+// keypadOrder, leaving a gap around it.
+func keypadCell(rect sdl.Rect, i int) sdl.Rect {
+	w, h := rect.W/4, rect.H/4
+	gap := h / 16
+	return sdl.Rect{
+		X: rect.X + int32(i%4)*w + gap,
+		Y: rect.Y + int32(i/4)*h + gap,
+		W: w - 2*gap,
+		H: h - 2*gap,
+	}
+}
+
+// renderKeypadLabel draws text centered in cell.
+func (f *Frontend) renderKeypadLabel(text string, cell sdl.Rect) {
+	surface, err := f.font.RenderUTF8Blended(text, sdl.Color{R: 255, G: 255, B: 255, A: 255})
+	if err != nil {
+		f.log.Errorf("Unable to render text: %v", err)
+		return
+	}
+	defer surface.Free()
+
+	texture, err := f.renderer.CreateTextureFromSurface(surface)
+	if err != nil {
+		f.log.Errorf("Unable to render text: %v", err)
+		return
+	}
+	defer texture.Destroy()
+
+	f.renderer.Copy(texture, nil, &sdl.Rect{
+		X: cell.X + (cell.W-surface.W)/2,
+		Y: cell.Y + (cell.H-surface.H)/2,
+		W: surface.W,
+		H: surface.H,
+	})
+}
+
+// renderKeypadState draws a 4x4 keypad into rect, for the debug panel, with
+// the keys the ROM sees held down lit and each key labeled with the
+// keyboard key bound to it.
+func (f *Frontend) renderKeypadState(c *core.Chip8, rect sdl.Rect) {
+	if rect.W <= 0 || rect.H <= 0 {
+		return
+	}
+	labels := f.hostKeyLabels()
+
+	for i, key := range keypadOrder {
+		cell := keypadCell(rect, i)
+		if c.KeyDown(key) {
+			f.renderer.SetDrawColor(0, 160, 130, 255)
+		} else {
+			f.renderer.SetDrawColor(70, 70, 70, 255)
+		}
+		f.renderer.FillRect(&cell)
+
+		label := fmt.Sprintf("%X", key)
+		if labels[key] != "" {
+			label += " " + labels[key]
+		}
+		f.renderKeypadLabel(label, cell)
+	}
+}
+
+// hostKeyLabels returns the name of a keyboard key bound to each Chip-8
+// key, the one with the lowest scancode when there are several.
+func (f *Frontend) hostKeyLabels() [16]string {
+	var labels [16]string
+	var scancodes [16]int
+	for scancode, key := range f.keybinds {
+		if labels[key] == "" || scancode < scancodes[key] {
+			labels[key] = sdl.GetScancodeName(sdl.Scancode(scancode))
+			scancodes[key] = scancode
+		}
+	}
+
+	return labels
+}
+
+// keypadKeyAt returns the key of the on-screen keypad under the window
+// coordinates x, y, if any.
+func (f *Frontend) keypadKeyAt(x, y int32) (uint8, bool) {
+	p := sdl.Point{X: x * f.pixelRatio, Y: y * f.pixelRatio}
+	for i, key := range keypadOrder {
+		cell := keypadCell(f.keypad.rect, i)
+		if p.InRect(&cell) {
+			return key, true
+		}
+	}
+
+	return 0, false
+}
+
+// holdKeypadKey moves the key held with the mouse to the one under x, y,
+// releasing the previous one. With pressed false, it is released.
+func (f *Frontend) holdKeypadKey(c *core.Chip8, x, y int32, pressed bool) {
+	key, ok := f.keypadKeyAt(x, y)
+	if !pressed || !ok {
+		key = noKey
+	}
+	if key == f.keypad.key {
+		return
+	}
+
+	if f.keypad.key != noKey {
+		c.SetKey(f.keypad.key, false)
+	}
+	if key != noKey {
+		c.SetKey(key, true)
+	}
+	f.keypad.key = key
+	f.redraw = true
+}
+
+// handleKeypadMouse presses the on-screen keypad with the left mouse button,
+// following the mouse while it is held.
+func (f *Frontend) handleKeypadMouse(c *core.Chip8, event sdl.Event) {
+	switch e := event.(type) {
+	case *sdl.MouseButtonEvent:
+		if e.Button == sdl.BUTTON_LEFT {
+			f.holdKeypadKey(c, e.X, e.Y, e.State == sdl.PRESSED)
+		}
+	case *sdl.MouseMotionEvent:
+		if e.State&sdl.ButtonLMask() != 0 {
+			f.holdKeypadKey(c, e.X, e.Y, true)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package sdlui
+
+import (
+	"path/filepath"
+
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// launcherTitle heads the list of ROMs shown by ChooseRom.
+const launcherTitle = "Choose a ROM (Up/Down selects, Enter runs, Esc closes)"
+
+// RomItem is a ROM listed by ChooseRom.
+type RomItem struct {
+	Path    string
+	Title   string // name listed, the file name of Path if empty
+	Details string // shown while the ROM is highlighted, such as who made it
+	Recent  bool   // played recently, marked as such
+}
+
+// launcher is the list of ROMs ChooseRom shows.
+type launcher struct {
+	roms     []RomItem
+	selected int // index of the highlighted ROM
+	first    int // index of the ROM at the top of the list, once scrolled
+}
+
+// ChooseRom opens a window listing roms to pick one to run from with the
+// keyboard or a game controller, and closes it again. The first ROM is
+// highlighted, so listing the last one played first lets it run with a
+// single key. Text is drawn with the font at fontPath, or the one built in if
+// it is empty. It returns the path of the ROM chosen, or false if the window
+// was closed or the choice cancelled. Errors, such as a game controller
+// failing to open, are logged to log, or stderr if it is nil.
+func ChooseRom(roms []RomItem, fontPath string, log core.Logger) (string, bool, error) {
+	if err := initSDL(); err != nil {
+		return "", false, err
+	}
+	window, renderer, err := NewDisplayRenderer(0, false)
+	if err != nil {
+		quitSDL()
+		return "", false, err
+	}
+	window.SetTitle(windowTitle)
+	ratio := pixelRatio(window, renderer)
+	font, err := openFont(fontPath, ratio)
+	if err != nil {
+		renderer.Destroy()
+		window.Destroy()
+		quitSDL()
+		return "", false, err
+	}
+	f := &Frontend{
+		window:      window,
+		renderer:    renderer,
+		font:        font,
+		pixelRatio:  ratio,
+		controllers: make(map[sdl.JoystickID]*sdl.GameController),
+		log:         logger(log),
+	}
+	defer f.Close()
+
+	l := &launcher{roms: roms}
+	redraw := true
+	for {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			rom, done := "", false
+			switch t := event.(type) {
+			case *sdl.QuitEvent:
+				return "", false, nil
+			case *sdl.WindowEvent:
+				redraw = true
+			case *sdl.KeyboardEvent:
+				if t.Type == sdl.KEYDOWN {
+					_, h, _ := renderer.GetOutputSize()
+					rom, done = l.handleKey(t.Keysym.Scancode, f.launcherRows(h))
+					redraw = true
+				}
+			case *sdl.ControllerDeviceEvent:
+				f.handleControllerDevice(t)
+			case *sdl.ControllerButtonEvent:
+				if t.Type == sdl.CONTROLLERBUTTONDOWN {
+					rom, done = l.handleButton(int(t.Button))
+					redraw = true
+				}
+			}
+			if done {
+				return rom, rom != "", nil
+			}
+		}
+
+		if redraw {
+			f.renderer.SetDrawColor(0, 0, 0, 255)
+			f.renderer.Clear()
+			w, h, err := f.renderer.GetOutputSize()
+			if err != nil {
+				return "", false, err
+			}
+			f.renderLauncher(l, sdl.Rect{W: w, H: h})
+			f.renderer.Present()
+			redraw = false
+		}
+		sdl.Delay(1000 / 60)
+	}
+}
+
+// handleKey moves through the list with the arrow keys, Page Up and Down,
+// Home and End, given the rows shown a page. It returns the path of the ROM
+// chosen with Enter or Space, or an empty path if Escape closes the list,
+// and whether either was pressed.
+func (l *launcher) handleKey(scancode sdl.Scancode, rows int) (string, bool) {
+	switch scancode {
+	case sdl.SCANCODE_UP:
+		l.move(-1)
+	case sdl.SCANCODE_DOWN:
+		l.move(1)
+	case sdl.SCANCODE_PAGEUP:
+		l.move(-rows)
+	case sdl.SCANCODE_PAGEDOWN:
+		l.move(rows)
+	case sdl.SCANCODE_HOME:
+		l.move(-len(l.roms))
+	case sdl.SCANCODE_END:
+		l.move(len(l.roms))
+	case sdl.SCANCODE_RETURN, sdl.SCANCODE_SPACE:
+		return l.chosen(), true
+	case sdl.SCANCODE_ESCAPE:
+		return "", true
+	}
+
+	return "", false
+}
+
+// handleButton is handleKey for game controllers: the d-pad moves through the
+// list, A or Start chooses a ROM and B or Back closes the list.
+func (l *launcher) handleButton(button int) (string, bool) {
+	switch button {
+	case sdl.CONTROLLER_BUTTON_DPAD_UP:
+		l.move(-1)
+	case sdl.CONTROLLER_BUTTON_DPAD_DOWN:
+		l.move(1)
+	case sdl.CONTROLLER_BUTTON_A, sdl.CONTROLLER_BUTTON_START:
+		return l.chosen(), true
+	case sdl.CONTROLLER_BUTTON_B, sdl.CONTROLLER_BUTTON_BACK:
+		return "", true
+	}
+
+	return "", false
+}
+
+// chosen returns the path of the highlighted ROM, or an empty path if the
+// list is empty.
+func (l *launcher) chosen() string {
+	if l.selected >= len(l.roms) {
+		return ""
+	}
+
+	return l.roms[l.selected].Path
+}
+
+// move moves the highlight n ROMs down the list, or up for negative n,
+// stopping at either end.
+func (l *launcher) move(n int) {
+	l.selected += n
+	if l.selected >= len(l.roms) {
+		l.selected = len(l.roms) - 1
+	}
+	if l.selected < 0 {
+		l.selected = 0
+	}
+}
+
+// launcherLineHeight returns the height of a line of the launcher, in output
+// pixels.
+func (f *Frontend) launcherLineHeight() int32 {
+	return int32(f.font.Height()) + 8*f.pixelRatio
+}
+
+// launcherRows returns how many ROMs fit in h output pixels between the
+// title and the details of the highlighted ROM.
+func (f *Frontend) launcherRows(h int32) int {
+	rows := int(h/f.launcherLineHeight()) - 2
+	if rows < 1 {
+		rows = 1
+	}
+
+	return rows
+}
+
+// renderLauncher draws the title and the ROMs of the launcher which fit in
+// rect, scrolled to keep the highlighted one in view, and the details of the
+// highlighted one at the bottom.
+func (f *Frontend) renderLauncher(l *launcher, rect sdl.Rect) {
+	rows := f.launcherRows(rect.H)
+	if l.selected < l.first {
+		l.first = l.selected
+	}
+	if l.selected >= l.first+rows {
+		l.first = l.selected - rows + 1
+	}
+
+	lines := []string{launcherTitle}
+	if len(l.roms) == 0 {
+		lines = append(lines, "  No ROMs found, see -romdir")
+	}
+	for i := l.first; i < len(l.roms) && i < l.first+rows; i++ {
+		line := "  "
+		if i == l.selected {
+			line = "> "
+		}
+		rom := l.roms[i]
+		if rom.Title != "" {
+			line += rom.Title
+		} else {
+			line += filepath.Base(rom.Path)
+		}
+		if rom.Recent {
+			line += "  (recent)"
+		}
+		lines = append(lines, line)
+	}
+
+	lineHeight := f.launcherLineHeight()
+	for i, line := range lines {
+		row := rect
+		row.Y += int32(i) * lineHeight
+		f.renderLabel(line, row, false)
+	}
+	if l.selected < len(l.roms) && l.roms[l.selected].Details != "" {
+		f.renderLabel(l.roms[l.selected].Details, rect, true)
+	}
+}
+
+// openRomMenu lists the ROMs which can be loaded in place of the one
+// running, over the display. Keypad input is withheld from the emulator
+// while it is open.
+func (f *Frontend) openRomMenu(c *core.Chip8) {
+	if f.listRoms == nil || f.loadRom == nil {
+		return
+	}
+	for key := uint8(0); key < 16; key++ {
+		c.SetKey(key, false)
+	}
+	f.romMenu = &launcher{roms: f.listRoms()}
+	f.redraw = true
+}
+
+// handleRomMenuKey moves through the ROM menu, loading the ROM chosen, as
+// the launcher does.
+func (f *Frontend) handleRomMenuKey(c *core.Chip8, scancode sdl.Scancode) {
+	f.redraw = true
+	rom, done := f.romMenu.handleKey(scancode, f.launcherRows(f.viewport.H))
+	if !done {
+		return
+	}
+	f.romMenu = nil
+	if rom != "" {
+		f.openRom(c, rom)
+	}
+}
+
+// handleRomMenuButton is handleRomMenuKey for game controllers.
+func (f *Frontend) handleRomMenuButton(c *core.Chip8, button int) {
+	f.redraw = true
+	rom, done := f.romMenu.handleButton(button)
+	if !done {
+		return
+	}
+	f.romMenu = nil
+	if rom != "" {
+		f.openRom(c, rom)
+	}
+}
@@ -0,0 +1,149 @@
+package sdlui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	memViewHeight = 160 // height of the memory viewer, in window coordinates
+	memViewRows   = 8   // rows of the hex dump
+	memViewWidth  = 16  // bytes per row
+	memViewEnd    = 0x1000
+)
+
+// memView is the hex dump of RAM in the debug panel. While following I, it
+// scrolls to keep the bytes around I, which FX33, FX55 and FX65 work on, in
+// view.
+type memView struct {
+	addr   uint16 // address of the first row, when not following I
+	follow bool
+}
+
+// toggleFollow switches between following I and staying at the current
+// address.
+func (m *memView) toggleFollow(c *core.Chip8) {
+	if m.follow {
+		m.addr = m.start(c.Registers().I)
+	}
+	m.follow = !m.follow
+}
+
+// scroll moves the view by rows, which stops it from following I.
+func (m *memView) scroll(rows int) {
+	m.follow = false
+	m.addr = clampMemView(int(m.addr) + rows*memViewWidth)
+}
+
+// start returns the address of the first row shown, given register I.
+func (m *memView) start(i uint16) uint16 {
+	if !m.follow {
+		return m.addr
+	}
+
+	// Keep a row of context above I.
+	return clampMemView(int(i&^(memViewWidth-1)) - memViewWidth)
+}
+
+// clampMemView limits the address of the first row so the view stays
+// within RAM.
+func clampMemView(addr int) uint16 {
+	last := memViewEnd - memViewRows*memViewWidth
+	switch {
+	case addr < 0:
+		return 0
+	case addr > last:
+		return uint16(last)
+	}
+
+	return uint16(addr)
+}
+
+// formatMemView dumps the rows of RAM starting at addr, with the byte at I
+// bracketed.
+func formatMemView(c *core.Chip8, addr uint16) string {
+	i := c.Registers().I
+	mem := c.Memory(addr, memViewRows*memViewWidth)
+
+	var b strings.Builder
+	for row := 0; row*memViewWidth < len(mem); row++ {
+		rowAddr := addr + uint16(row*memViewWidth)
+		fmt.Fprintf(&b, "%03X ", rowAddr)
+		for col := 0; col < memViewWidth && row*memViewWidth+col < len(mem); col++ {
+			at := rowAddr + uint16(col)
+			switch {
+			case at == i:
+				b.WriteByte('[')
+			case at == i+1 && col > 0:
+				b.WriteByte(']')
+			default:
+				b.WriteByte(' ')
+			}
+			fmt.Fprintf(&b, "%02X", mem[row*memViewWidth+col])
+		}
+		if rowAddr+memViewWidth-1 == i {
+			b.WriteByte(']')
+		}
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+// renderMemView draws the hex dump into rect.
+func (f *Frontend) renderMemView(c *core.Chip8, rect *sdl.Rect) {
+	addr := f.memview.start(c.Registers().I)
+	title := "RAM (Home: follow I, PgUp/PgDn: scroll)"
+	if f.memview.follow {
+		title = "RAM, following I (Home: stop, PgUp/PgDn: scroll)"
+	}
+
+	f.renderPanelText(title+"\n"+formatMemView(c, addr), sdl.Color{R: 180, G: 180, B: 255, A: 255}, rect)
+}
+
+// Rows of the sprite viewer: as many as the last DXYN drew, or
+// defaultSpriteRows, the height of the font sprites FX29 points I at.
+const (
+	defaultSpriteRows = 5
+	maxSpriteRows     = 15
+)
+
+// renderSpriteView draws the bytes at I as a sprite, magnified to fit rect,
+// with a frame around it.
+func (f *Frontend) renderSpriteView(c *core.Chip8, rect sdl.Rect) {
+	rows := defaultSpriteRows
+	if r, ok := c.LastDraw(); ok {
+		rows = r.H
+	}
+	sprite := c.Memory(c.Registers().I, rows)
+
+	gap := 4 * f.pixelRatio
+	cell := (rect.W - 2*gap) / 8
+	if h := (rect.H - 2*gap) / maxSpriteRows; h < cell {
+		cell = h
+	}
+	if cell <= 0 {
+		return
+	}
+	frame := sdl.Rect{X: rect.X + gap - 1, Y: rect.Y + gap - 1, W: 8*cell + 2, H: int32(rows)*cell + 2}
+	f.renderer.SetDrawColor(120, 120, 120, 255)
+	f.renderer.DrawRect(&frame)
+
+	f.renderer.SetDrawColor(255, 255, 255, 255)
+	for y, b := range sprite {
+		for x := 0; x < 8; x++ {
+			if b&(0x80>>x) == 0 {
+				continue
+			}
+			f.renderer.FillRect(&sdl.Rect{
+				X: rect.X + gap + int32(x)*cell,
+				Y: rect.Y + gap + int32(y)*cell,
+				W: cell,
+				H: cell,
+			})
+		}
+	}
+}
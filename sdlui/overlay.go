@@ -0,0 +1,46 @@
+package sdlui
+
+import (
+	"fmt"
+
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// renderStatsOverlay draws the FPS and IPS counters in the top left corner of
+// the display viewport vp.
+func (f *Frontend) renderStatsOverlay(c *core.Chip8, vp sdl.Rect) {
+	fps, ips := c.Stats()
+	text := fmt.Sprintf("FPS %d  IPS %d", fps, ips)
+	f.renderLabel(text, vp, false)
+}
+
+// renderLabel draws text on a translucent box in the top left corner of the
+// display viewport vp, or the bottom left one.
+func (f *Frontend) renderLabel(text string, vp sdl.Rect, bottom bool) {
+	surface, err := f.font.RenderUTF8Blended(text, sdl.Color{R: 255, G: 255, B: 255, A: 255})
+	if err != nil {
+		f.log.Errorf("Unable to render text: %v", err)
+		return
+	}
+	defer surface.Free()
+
+	texture, err := f.renderer.CreateTextureFromSurface(surface)
+	if err != nil {
+		f.log.Errorf("Unable to render text: %v", err)
+		return
+	}
+	defer texture.Destroy()
+
+	pad := 4 * f.pixelRatio
+	y := vp.Y
+	if bottom {
+		y = vp.Y + vp.H - surface.H - 2*pad
+	}
+	f.renderer.SetDrawBlendMode(sdl.BLENDMODE_BLEND)
+	f.renderer.SetDrawColor(0, 0, 0, 160)
+	f.renderer.FillRect(&sdl.Rect{X: vp.X, Y: y, W: surface.W + 2*pad, H: surface.H + 2*pad})
+	f.renderer.SetDrawBlendMode(sdl.BLENDMODE_NONE)
+
+	f.renderer.Copy(texture, nil, &sdl.Rect{X: vp.X + pad, Y: y + pad, W: surface.W, H: surface.H})
+}
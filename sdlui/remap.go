@@ -0,0 +1,80 @@
+package sdlui
+
+import (
+	"fmt"
+
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// keypadOrder is the order Chip-8 keys are asked for while remapping: row by
+// row, as they sit on the keypad.
+var keypadOrder = [16]uint8{
+	0x1, 0x2, 0x3, 0xc,
+	0x4, 0x5, 0x6, 0xd,
+	0x7, 0x8, 0x9, 0xe,
+	0xa, 0x0, 0xb, 0xf,
+}
+
+// remapper tracks the progress of rebinding the keypad from the keyboard.
+type remapper struct {
+	next  int           // index in keypadOrder of the key asked for
+	binds map[int]uint8 // scancodes bound so far
+}
+
+// startRemap begins asking for a key for each Chip-8 key in turn. Keypad
+// input is withheld from the emulator until remapping ends.
+func (f *Frontend) startRemap(c *core.Chip8) {
+	for key := uint8(0); key < 16; key++ {
+		c.SetKey(key, false)
+	}
+	f.remap = &remapper{binds: make(map[int]uint8)}
+	f.redraw = true
+}
+
+// handleRemapKey binds scancode to the Chip-8 key being asked for. Escape
+// cancels remapping, keeping the previous bindings.
+func (f *Frontend) handleRemapKey(scancode sdl.Scancode) {
+	f.redraw = true
+
+	switch scancode {
+	case sdl.SCANCODE_ESCAPE:
+		f.remap = nil
+		return
+	case statsHotkey, recordHotkey, screenshotHotkey, remapHotkey, fullscreenHotkey, pauseHotkey,
+		resumeHotkey, stepHotkey, frameHotkey, backHotkey, skipHotkey, memFollowHotkey, memUpHotkey, memDownHotkey,
+		inspectHotkey, saveStateHotkey, loadStateHotkey, rewindHotkey, fastForwardHotkey, slowMotionHotkey:
+		return
+	}
+	if _, ok := f.remap.binds[int(scancode)]; ok {
+		return
+	}
+
+	f.remap.binds[int(scancode)] = keypadOrder[f.remap.next]
+	f.remap.next++
+	if f.remap.next < len(keypadOrder) {
+		return
+	}
+
+	f.keybinds = f.remap.binds
+	f.remap = nil
+
+	if f.saveKeys == nil {
+		return
+	}
+	names := make(map[string]uint8, len(f.keybinds))
+	for scancode, key := range f.keybinds {
+		names[sdl.GetScancodeName(sdl.Scancode(scancode))] = key
+	}
+	if err := f.saveKeys(names); err != nil {
+		f.log.Errorf("Unable to save keybindings: %v", err)
+	}
+}
+
+// renderRemapOverlay asks for the next key along the bottom of the display
+// viewport vp.
+func (f *Frontend) renderRemapOverlay(vp sdl.Rect) {
+	key := keypadOrder[f.remap.next]
+	text := fmt.Sprintf("Press the key for Chip-8 key %X (%d/16, Esc cancels)", key, f.remap.next+1)
+	f.renderLabel(text, vp, true)
+}
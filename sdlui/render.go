@@ -0,0 +1,395 @@
+package sdlui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	DisplayScale   = 10
+	EmulatorWidth  = core.Chip8Width * DisplayScale
+	EmulatorHeight = core.Chip8Height * DisplayScale
+	DebugHeight    = 256 + memViewHeight
+)
+
+const windowTitle = "Chip-8 Emulator"
+
+// NewDisplayRenderer creates a resizable window, initially sized to the
+// default DisplayScale plus panelHeight for the panels below the display,
+// and returns it along with a renderer for it. On
+// high-DPI displays the renderer draws at the display's full resolution. With
+// vsync, presenting a frame waits for the display's vertical blank.
+func NewDisplayRenderer(panelHeight int32, vsync bool) (*sdl.Window, *sdl.Renderer, error) {
+	height := EmulatorHeight + panelHeight
+	minHeight := core.Chip8Height + panelHeight
+
+	window, err := sdl.CreateWindow(windowTitle, sdl.WINDOWPOS_UNDEFINED,
+		sdl.WINDOWPOS_UNDEFINED, EmulatorWidth, height, sdl.WINDOW_SHOWN|sdl.WINDOW_RESIZABLE|sdl.WINDOW_ALLOW_HIGHDPI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create window: %v", err)
+	}
+	window.SetMinimumSize(core.Chip8Width, minHeight)
+
+	var flags uint32
+	if vsync {
+		flags |= sdl.RENDERER_PRESENTVSYNC
+	}
+	renderer, err := sdl.CreateRenderer(window, -1, flags)
+	if err != nil {
+		window.Destroy()
+		return nil, nil, fmt.Errorf("unable to create renderer: %v", err)
+	}
+
+	window.Show()
+
+	return window, renderer, nil
+}
+
+// pixelRatio returns how many renderer output pixels span one window
+// coordinate: 1 normally, and 2 or more on high-DPI displays, or if the
+// output size can't be told.
+func pixelRatio(window *sdl.Window, renderer *sdl.Renderer) int32 {
+	ww, _ := window.GetSize()
+	ow, _, err := renderer.GetOutputSize()
+	if err != nil || ww <= 0 || ow < ww {
+		return 1
+	}
+
+	return ow / ww
+}
+
+// newDisplayTexture creates the streaming texture the display pixels are
+// uploaded to each frame.
+func newDisplayTexture(renderer *sdl.Renderer) (*sdl.Texture, error) {
+	texture, err := renderer.CreateTexture(uint32(sdl.PIXELFORMAT_RGBA32),
+		sdl.TEXTUREACCESS_STREAMING, core.Chip8Width, core.Chip8Height)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create display texture: %v", err)
+	}
+
+	return texture, nil
+}
+
+// displayViewport returns the area of a w*h window the Chip-8 display is drawn
+// into. The display is scaled to fit while keeping its aspect ratio, and
+// centered so any leftover space is letterboxed.
+func displayViewport(w, h int32) sdl.Rect {
+	vw, vh := w, w*core.Chip8Height/core.Chip8Width
+	if vh > h {
+		vw, vh = h*core.Chip8Width/core.Chip8Height, h
+	}
+
+	return sdl.Rect{X: (w - vw) / 2, Y: (h - vh) / 2, W: vw, H: vh}
+}
+
+// scale returns the whole number of window pixels each Chip-8 pixel was last
+// drawn with.
+func (f *Frontend) scale() int {
+	return int(f.viewport.W) / core.Chip8Width
+}
+
+// Render presents the current display to the screen via the SDL2 renderer.
+// Nothing is drawn when neither the frame nor the window have changed, unless
+// an overlay with live information is shown. With vsync every frame is
+// presented, since waiting for it is what paces the emulator. The buzzer is
+// kept sounding while the sound timer runs.
+func (f *Frontend) Render(c *core.Chip8) {
+	if f.beeper != nil {
+		f.beeper.update(c.Beeping() && !c.Paused())
+	}
+	f.updateTitle(c)
+	if f.slotText != "" && time.Since(f.slotShown) >= slotIndicatorTime {
+		f.slotText = ""
+		f.redraw = true
+	}
+
+	if !f.vsync && !c.FrameChanged() && !f.redraw && !f.showStats && !f.isDebug && !f.inspect && f.slotText == "" {
+		return
+	}
+	f.redraw = false
+
+	_, bg := c.Palette()
+	f.renderer.SetDrawColor(bg.R, bg.G, bg.B, 255)
+	f.renderer.Clear()
+
+	// Sizes are in output pixels, which on high-DPI displays are smaller
+	// than the window coordinates the window was created with.
+	w, h, err := f.renderer.GetOutputSize()
+	if err != nil {
+		f.log.Errorf("Unable to render: %v", err)
+		return
+	}
+	debugHeight := DebugHeight * f.pixelRatio
+	if f.isDebug {
+		h -= debugHeight
+	}
+	keypadHeight := KeypadHeight * f.pixelRatio
+	if f.keypad != nil {
+		h -= keypadHeight
+	}
+	vp := displayViewport(w, h)
+	f.viewport = vp
+
+	if f.inspect {
+		f.renderInspector(c, vp)
+	} else {
+		f.texture.Update(nil, c.Pixels(), core.Chip8Width*4)
+		f.renderer.Copy(f.texture, nil, &vp)
+
+		if c.HasFilter(core.FilterCRT) {
+			f.renderCRT(vp)
+		}
+	}
+
+	if f.showStats {
+		f.renderStatsOverlay(c, vp)
+	}
+	if f.remap != nil {
+		f.renderRemapOverlay(vp)
+	} else if f.romMenu != nil {
+		f.renderLauncher(f.romMenu, vp)
+	} else if f.cheatMenu != nil {
+		f.renderCheatMenu(c, vp)
+	} else if f.resume {
+		f.renderLabel(resumePrompt, vp, true)
+	} else if f.slotText != "" {
+		f.renderLabel(f.slotText, vp, true)
+	} else if speed := c.Speed(); speed != 1 {
+		f.renderLabel(speedIndicator(speed), vp, true)
+	} else if text := c.Overlay(); text != "" {
+		f.renderLabel(text, vp, true)
+	}
+
+	if f.keypad != nil {
+		f.renderKeypad(sdl.Rect{X: 0, Y: h, W: w, H: keypadHeight})
+		h += keypadHeight
+	}
+	if f.isDebug {
+		f.renderDebugDisplay(c, &sdl.Rect{X: 0, Y: h, W: w, H: debugHeight})
+	}
+
+	f.renderer.Present()
+}
+
+// speedIndicator describes the emulation speed, shown over the display while
+// it isn't normal.
+func speedIndicator(speed float64) string {
+	if speed > 1 {
+		return fmt.Sprintf(">> x%g", speed)
+	}
+
+	return fmt.Sprintf("Slow x%g", speed)
+}
+
+// updateTitle shows the loaded ROM and the emulator's status (frame rate,
+// speed and whether it's paused, and why) in the window title. The title is only set when its text changes.
+func (f *Frontend) updateTitle(c *core.Chip8) {
+	fps, _ := c.Stats()
+	status := titleStatus{c.RomName(), fps, c.Speed(), c.StopReason(), c.Paused()}
+	if status == f.title {
+		return
+	}
+	f.title = status
+
+	title := windowTitle
+	if status.rom != "" {
+		title += " - " + status.rom
+	}
+	title += fmt.Sprintf(" [%d FPS]", status.fps)
+	if status.speed != 1 {
+		title += fmt.Sprintf(" [x%g]", status.speed)
+	}
+	if status.reason != "" {
+		title += " [" + status.reason + "]"
+	} else if status.paused {
+		title += " [Paused]"
+	}
+	f.window.SetTitle(title)
+}
+
+// titleStatus is what the window title shows, so it is only formatted when
+// it changes rather than every frame.
+type titleStatus struct {
+	rom    string
+	fps    int
+	speed  float64
+	reason string
+	paused bool
+}
+
+// renderDebugDisplay draws the CPU registers above the keypad state, the
+// disassembly around PC and
+// the most recent operations side by side into the debug panel occupying
+// rect, above a hex dump of RAM, the sprite at I and the call stack. The
+// registers are
+// highlighted while paused by a breakpoint or watchpoint.
+func (f *Frontend) renderDebugDisplay(c *core.Chip8, rect *sdl.Rect) {
+	f.renderer.SetDrawColor(50, 50, 50, 255)
+	f.renderer.FillRect(rect)
+
+	regs := formatRegisters(c.Registers())
+	color := sdl.Color{R: 0, G: 255, B: 200, A: 255}
+	switch {
+	case c.StopReason() != "":
+		regs = c.StopReason() + "\n" + regs
+		color = sdl.Color{R: 255, G: 220, B: 0, A: 255}
+	case c.Paused():
+		regs = "PAUSED\n" + regs
+	}
+
+	memHeight := memViewHeight * f.pixelRatio
+	top := sdl.Rect{X: rect.X, Y: rect.Y, W: rect.W, H: rect.H - memHeight}
+
+	third := top.W / 3
+	h := f.renderPanelText(regs, color, &sdl.Rect{X: top.X, Y: top.Y, W: third, H: top.H})
+	gap := 4 * f.pixelRatio
+	f.renderKeypadState(c, sdl.Rect{X: top.X + gap, Y: top.Y + h + gap, W: third - 2*gap, H: top.H - h - 2*gap})
+
+	f.renderPanelText(formatDisassembly(c, disasmLines), sdl.Color{R: 255, G: 255, B: 255, A: 255},
+		&sdl.Rect{X: top.X + third, Y: top.Y, W: third, H: top.H})
+
+	f.renderOpTrace(c, &sdl.Rect{X: top.X + 2*third, Y: top.Y, W: top.W - 2*third, H: top.H})
+
+	// RAM, the sprite at I and the stack share the bottom row, the stack
+	// split into two columns of half its depth each.
+	memWidth := rect.W * 9 / 16
+	f.renderMemView(c, &sdl.Rect{X: rect.X, Y: top.Y + top.H, W: memWidth, H: memHeight})
+
+	spriteWidth := rect.W / 16
+	f.renderSpriteView(c, sdl.Rect{X: rect.X + memWidth, Y: top.Y + top.H, W: spriteWidth, H: memHeight})
+
+	half := len(core.Registers{}.Stack) / 2
+	stackX := rect.X + memWidth + spriteWidth
+	stackWidth := (rect.W - memWidth - spriteWidth) / 2
+	stackColor := sdl.Color{R: 255, G: 160, B: 60, A: 255}
+	f.renderPanelText(fmt.Sprintf("Stack (SP %d)\n", c.Registers().SP)+formatStack(c, 0, half), stackColor,
+		&sdl.Rect{X: stackX, Y: top.Y + top.H, W: stackWidth, H: memHeight})
+	f.renderPanelText("\n"+formatStack(c, half, 2*half), stackColor,
+		&sdl.Rect{X: stackX + stackWidth, Y: top.Y + top.H, W: stackWidth, H: memHeight})
+}
+
+// formatStack lists the stack entries from up to to, one per line, each
+// annotated with the CALL which pushed it and the subroutine called. The entry
+// SP points to, which the next CALL pushes to, is marked with >.
+func formatStack(c *core.Chip8, from, to int) string {
+	r := c.Registers()
+
+	var b strings.Builder
+	for i := from; i < to; i++ {
+		marker := "  "
+		if i == int(r.SP) {
+			marker = "> "
+		}
+		if i >= int(r.SP) {
+			fmt.Fprintf(&b, "%s%X ---\n", marker, i)
+			continue
+		}
+
+		// Entries hold return addresses, just past the CALL.
+		site := r.Stack[i] - 2
+		op, _ := c.DisassembleAt(site)
+		if op&0xF000 != 0x2000 {
+			fmt.Fprintf(&b, "%s%X %03X ?\n", marker, i, site)
+			continue
+		}
+		fmt.Fprintf(&b, "%s%X %03X CALL %03X\n", marker, i, site, op&0x0FFF)
+	}
+
+	return b.String()
+}
+
+// opTraceLines is how many of the most recent operations the trace shows.
+const opTraceLines = 14
+
+// renderOpTrace draws the most recently executed operations into rect, oldest
+// first, scrolling up as more are executed. The last one executed is
+// highlighted.
+func (f *Frontend) renderOpTrace(c *core.Chip8, rect *sdl.Rect) {
+	ops := c.OpHistory(opTraceLines)
+	if len(ops) == 0 {
+		return
+	}
+
+	last := len(ops) - 1
+	var h int32
+	if last > 0 {
+		h = f.renderPanelText(strings.Join(ops[:last], "\n"), sdl.Color{R: 255, G: 0, B: 180, A: 255}, rect)
+	}
+	f.renderPanelText("> "+ops[last], sdl.Color{R: 255, G: 255, B: 255, A: 255},
+		&sdl.Rect{X: rect.X, Y: rect.Y + h, W: rect.W, H: rect.H - h})
+}
+
+// disasmLines is how many instructions the disassembly pane shows.
+const disasmLines = 13
+
+// formatDisassembly disassembles n instructions around PC, one per line. The
+// instruction at PC is marked with > and those with breakpoints with *.
+func formatDisassembly(c *core.Chip8, n int) string {
+	pc := c.Registers().PC
+	start := int(pc) - 2*(n/2)
+	if start < 0 {
+		start = 0
+	}
+
+	var b strings.Builder
+	for addr := uint16(start); addr < uint16(start+2*n); addr += 2 {
+		marker := "  "
+		if addr == pc {
+			marker = "> "
+		}
+		if c.HasBreakpoint(addr) {
+			marker = marker[:1] + "*"
+		}
+		op, text := c.DisassembleAt(addr)
+		fmt.Fprintf(&b, "%s%03X  %04X  %s\n", marker, addr, op, text)
+	}
+
+	return b.String()
+}
+
+// formatRegisters lays the CPU registers out as lines of text.
+func formatRegisters(r core.Registers) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "PC %#05x  I %#05x  OP %#06x\n", r.PC, r.I, r.Opcode)
+	fmt.Fprintf(&b, "SP %d  DT %d  ST %d\n", r.SP, r.DT, r.ST)
+	for i, v := range r.V {
+		fmt.Fprintf(&b, "V%X %02x", i, v)
+		if i%4 == 3 {
+			b.WriteString("\n")
+		} else {
+			b.WriteString("  ")
+		}
+	}
+
+	return b.String()
+}
+
+// renderPanelText draws text, wrapped to the width of rect, at its top left
+// corner, and returns the height drawn.
+func (f *Frontend) renderPanelText(text string, color sdl.Color, rect *sdl.Rect) int32 {
+	surface, err := f.font.RenderUTF8BlendedWrapped(text, color, int(rect.W))
+	if err != nil {
+		f.log.Errorf("Unable to render text: %v", err)
+		return 0
+	}
+	defer surface.Free()
+
+	texture, err := f.renderer.CreateTextureFromSurface(surface)
+	if err != nil {
+		f.log.Errorf("Unable to render text: %v", err)
+		return 0
+	}
+	defer texture.Destroy()
+
+	x := rect.X
+	y := rect.Y
+	w := surface.W
+	h := surface.H
+	f.renderer.Copy(texture, nil, &sdl.Rect{X: x, Y: y, W: w, H: h})
+
+	return h
+}
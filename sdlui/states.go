@@ -0,0 +1,105 @@
+package sdlui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/n-ulricksen/chip8/core"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// slotIndicatorTime is how long the selected save state slot is shown after
+// it is selected, saved to or loaded from.
+const slotIndicatorTime = 3 * time.Second
+
+// resumePrompt asks whether to resume from the autosaved state.
+const resumePrompt = "Resume where you left off? Enter: yes, Esc: no"
+
+// slotPath returns the file the state of the slot is saved to.
+func (f *Frontend) slotPath(slot int) string {
+	return filepath.Join(f.stateDir, fmt.Sprintf("slot%d.state", slot))
+}
+
+// selectSlot makes slot the one F5 and F7 save to and load from.
+func (f *Frontend) selectSlot(slot int) {
+	f.slot = slot
+	f.showSlot()
+}
+
+// saveSlot saves the machine state to the selected slot.
+func (f *Frontend) saveSlot(c *core.Chip8) {
+	err := os.MkdirAll(f.stateDir, 0755)
+	if err == nil {
+		err = c.SaveState(f.slotPath(f.slot))
+	}
+	if err != nil {
+		f.log.Errorf("Unable to save state: %v", err)
+	}
+	f.showSlot()
+}
+
+// loadSlot restores the machine state saved to the selected slot.
+func (f *Frontend) loadSlot(c *core.Chip8) {
+	if err := c.LoadState(f.slotPath(f.slot)); err != nil {
+		f.log.Errorf("Unable to load state: %v", err)
+	}
+	f.showSlot()
+}
+
+// showSlot shows the selected slot over the display for a while, with the
+// time its state was saved.
+func (f *Frontend) showSlot() {
+	f.slotText = fmt.Sprintf("Slot %d: empty", f.slot)
+	if info, err := os.Stat(f.slotPath(f.slot)); err == nil {
+		f.slotText = fmt.Sprintf("Slot %d: %s", f.slot, info.ModTime().Format("2006-01-02 15:04:05"))
+	}
+	f.slotShown = time.Now()
+	f.redraw = true
+}
+
+// autosavePath returns the file the state is saved to when the window is
+// closed.
+func (f *Frontend) autosavePath() string {
+	return filepath.Join(f.stateDir, "autosave.state")
+}
+
+// saveAutosave saves the machine state to the autosave file.
+func (f *Frontend) saveAutosave(c *core.Chip8) {
+	err := os.MkdirAll(f.stateDir, 0755)
+	if err == nil {
+		err = c.SaveState(f.autosavePath())
+	}
+	if err != nil {
+		f.log.Errorf("Unable to autosave state: %v", err)
+	}
+}
+
+// OfferResume pauses the emulator and asks whether to resume from the state
+// saved when the window was last closed, if there is one.
+func (f *Frontend) OfferResume(c *core.Chip8) {
+	if _, err := os.Stat(f.autosavePath()); err != nil {
+		return
+	}
+	c.SetPaused(true)
+	f.resume = true
+	f.redraw = true
+}
+
+// handleResumeKey loads the autosaved state on Enter or Y, or starts afresh
+// on Escape or N, resuming execution either way.
+func (f *Frontend) handleResumeKey(c *core.Chip8, scancode sdl.Scancode) {
+	switch scancode {
+	case sdl.SCANCODE_RETURN, sdl.SCANCODE_Y:
+		if err := c.LoadState(f.autosavePath()); err != nil {
+			f.log.Errorf("Unable to resume: %v", err)
+		}
+	case sdl.SCANCODE_ESCAPE, sdl.SCANCODE_N:
+	default:
+		return
+	}
+	f.resume = false
+	f.redraw = true
+	c.SetPaused(false)
+}
@@ -0,0 +1,195 @@
+// Package streamui implements a headless frontend for the Chip-8 emulator,
+// which serves the display over HTTP instead of showing it: as an MJPEG
+// stream browsers play in an img element, and as a PNG of the current
+// frame, for capturing the screen in tests. It reads no input; keys can be
+// pressed through the control API.
+package streamui
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// boundary separates the frames of the MJPEG stream.
+const boundary = "chip8frame"
+
+// jpegQuality is the quality frames are encoded with, high enough for the
+// edges of the pixels to stay sharp.
+const jpegQuality = 90
+
+// page is served at /, showing the stream.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Chip-8 Stream</title>
+  <style>
+    body { background: #111; color: #ccc; font-family: monospace; text-align: center; }
+    img { margin: 1em auto; display: block; image-rendering: pixelated; }
+  </style>
+</head>
+<body>
+  <img src="/stream.mjpg" alt="Chip-8 display">
+  <p><a href="/frame.png">Current frame</a></p>
+</body>
+</html>
+`
+
+// Frontend serves the display of a running emulator over HTTP.
+type Frontend struct {
+	server *http.Server
+	scale  int
+
+	mu      sync.Mutex
+	frame   []byte                     // RGBA pixels of the last frame rendered
+	clients map[chan struct{}]struct{} // signalled when the frame changes
+}
+
+// New starts serving the display on the TCP address addr, such as ":8080",
+// each Chip-8 pixel drawn as a scale*scale square.
+func New(addr string, scale int) (*Frontend, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if scale < 1 {
+		scale = 1
+	}
+
+	f := &Frontend{scale: scale, clients: make(map[chan struct{}]struct{})}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", f.servePage)
+	mux.HandleFunc("/stream.mjpg", f.serveStream)
+	mux.HandleFunc("/frame.png", f.serveFrame)
+	f.server = &http.Server{Handler: mux}
+
+	go f.server.Serve(l)
+
+	return f, nil
+}
+
+// servePage serves a page playing the stream.
+func (f *Frontend) servePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, page)
+}
+
+// serveStream streams the display as MJPEG, a JPEG each time the frame
+// changes, until the client disconnects. Frames rendered while one is being
+// sent are skipped.
+func (f *Frontend) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	notify := make(chan struct{}, 1)
+	notify <- struct{}{} // start with the current frame
+	f.mu.Lock()
+	f.clients[notify] = struct{}{}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.clients, notify)
+		f.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+boundary)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	var img *image.RGBA
+	var buf bytes.Buffer
+	for {
+		select {
+		case <-notify:
+		case <-r.Context().Done():
+			return
+		}
+
+		if img = f.image(img); img == nil {
+			continue
+		}
+		buf.Reset()
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return
+		}
+		fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", boundary, buf.Len())
+		buf.WriteString("\r\n")
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// serveFrame serves the last frame rendered as a PNG.
+func (f *Frontend) serveFrame(w http.ResponseWriter, r *http.Request) {
+	img := f.image(nil)
+	if img == nil {
+		http.Error(w, "No frame rendered yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	png.Encode(w, img)
+}
+
+// image draws the last frame rendered into img, scaled, allocating it if it
+// is nil, and returns it. It returns nil if no frame was rendered yet.
+func (f *Frontend) image(img *image.RGBA) *image.RGBA {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.frame == nil {
+		return nil
+	}
+
+	if img == nil {
+		img = image.NewRGBA(image.Rect(0, 0, core.Chip8Width*f.scale, core.Chip8Height*f.scale))
+	}
+	for y := 0; y < img.Rect.Dy(); y++ {
+		row := f.frame[(y/f.scale)*core.Chip8Width*4:]
+		for x := 0; x < img.Rect.Dx(); x++ {
+			copy(img.Pix[img.PixOffset(x, y):], row[(x/f.scale)*4:(x/f.scale)*4+4])
+		}
+	}
+
+	return img
+}
+
+// Close stops serving, ending the streams.
+func (f *Frontend) Close() {
+	f.server.Close()
+}
+
+// PollEvents does nothing: the stream has no input.
+func (f *Frontend) PollEvents(c *core.Chip8) {}
+
+// Render passes the frame on to the streams if it changed.
+func (f *Frontend) Render(c *core.Chip8) {
+	if !c.FrameChanged() && f.frame != nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.frame = c.FrameRGBA(f.frame)
+	for notify := range f.clients {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}
+}
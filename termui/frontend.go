@@ -0,0 +1,184 @@
+// Package termui implements a frontend for the Chip-8 emulator which draws
+// the display in a terminal using Unicode half blocks and 24-bit color, and
+// reads the keypad from stdin. It needs no graphics libraries, so it also
+// works over SSH.
+package termui
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// keyHold is how long a keypad key stays pressed after its character is
+// read. Terminals only report key presses, so releases are simulated; the
+// terminal's key repeat keeps held keys pressed.
+const keyHold = 120 * time.Millisecond
+
+// Frontend draws the display to stdout and reads keys from stdin, which must
+// be a terminal.
+type Frontend struct {
+	out      *bufio.Writer
+	input    chan byte
+	sttyMode string              // terminal settings to restore on Close
+	pressed  map[uint8]time.Time // when each held keypad key was last read
+	keybinds map[byte]uint8      // characters bound to each Chip-8 key
+}
+
+// New switches the terminal to raw mode and the alternate screen. The keypad
+// is read using the named keyboard layout, "standard" or "classic".
+func New(layout string) *Frontend {
+	binds, ok := layouts[layout]
+	if !ok {
+		log.Fatalf("Unknown keyboard layout %q\n", layout)
+	}
+
+	mode, err := stty("-g")
+	if err != nil {
+		log.Fatal("Unable to read terminal settings, is stdin a terminal?\n", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		log.Fatal("Unable to put terminal in raw mode\n", err)
+	}
+
+	f := &Frontend{
+		out:      bufio.NewWriter(os.Stdout),
+		input:    make(chan byte, 64),
+		sttyMode: strings.TrimSpace(mode),
+		pressed:  make(map[uint8]time.Time),
+		keybinds: binds,
+	}
+
+	// Switch to the alternate screen, hide the cursor and clear.
+	f.out.WriteString("\x1b[?1049h\x1b[?25l\x1b[2J")
+	f.out.Flush()
+
+	go f.readInput()
+
+	return f
+}
+
+// stty runs stty on the terminal attached to stdin.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// readInput forwards bytes read from stdin to the input channel.
+func (f *Frontend) readInput() {
+	r := bufio.NewReader(os.Stdin)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			close(f.input)
+			return
+		}
+		f.input <- b
+	}
+}
+
+// Close restores the terminal to its original state.
+func (f *Frontend) Close() {
+	f.out.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+	f.out.Flush()
+	stty(f.sttyMode)
+}
+
+// PollEvents presses the keypad keys typed since the last poll, and releases
+// those which have not been typed recently. Ctrl-C or Escape quits.
+func (f *Frontend) PollEvents(c *core.Chip8) {
+	now := time.Now()
+	for done := false; !done; {
+		select {
+		case b, ok := <-f.input:
+			if !ok || b == 0x03 || b == 0x1b {
+				c.Stop()
+				return
+			}
+			switch b {
+			case pauseKey:
+				c.SetPaused(!c.Paused())
+			case stepKey:
+				c.Step()
+			case stepOverKey:
+				c.StepOver()
+			case frameStepKey:
+				c.AdvanceFrame()
+			case stepBackKey:
+				c.StepBack()
+			case skipKey:
+				c.SkipInstruction()
+			}
+			if key, ok := f.keybinds[b]; ok {
+				c.SetKey(key, true)
+				f.pressed[key] = now
+			}
+		default:
+			done = true
+		}
+	}
+
+	for key, at := range f.pressed {
+		if now.Sub(at) > keyHold {
+			c.SetKey(key, false)
+			delete(f.pressed, key)
+		}
+	}
+}
+
+// Render draws the display using one character cell per two pixels stacked
+// vertically: the upper half block is colored with the top pixel and the
+// cell background with the bottom one. Colors are only sent when they change,
+// and the display only when the frame has, to keep the output small.
+func (f *Frontend) Render(c *core.Chip8) {
+	if c.FrameChanged() {
+		f.renderDisplay(c)
+	}
+
+	status := "Space pauses, Esc quits"
+	switch {
+	case c.StopReason() != "":
+		status = c.StopReason() + ", Space resumes, n/N/F step, b steps back, S skips"
+	case c.Paused():
+		status = "Paused, Space resumes, n/N/F step, b steps back"
+	}
+
+	fps, ips := c.Stats()
+	fmt.Fprintf(f.out, "\x1b[%d;1HFPS %d  IPS %d  (%s)\x1b[K", core.Chip8Height/2+1, fps, ips, status)
+	f.out.Flush()
+}
+
+// renderDisplay draws the display pixels.
+func (f *Frontend) renderDisplay(c *core.Chip8) {
+	pixels := c.Pixels()
+	pixel := func(x, y int) [3]byte {
+		i := (y*core.Chip8Width + x) * 4
+		return [3]byte{pixels[i], pixels[i+1], pixels[i+2]}
+	}
+
+	f.out.WriteString("\x1b[H")
+	for y := 0; y < core.Chip8Height; y += 2 {
+		var fg, bg [3]byte
+		for x := 0; x < core.Chip8Width; x++ {
+			top, bottom := pixel(x, y), pixel(x, y+1)
+			if x == 0 || top != fg {
+				fmt.Fprintf(f.out, "\x1b[38;2;%d;%d;%dm", top[0], top[1], top[2])
+				fg = top
+			}
+			if x == 0 || bottom != bg {
+				fmt.Fprintf(f.out, "\x1b[48;2;%d;%d;%dm", bottom[0], bottom[1], bottom[2])
+				bg = bottom
+			}
+			f.out.WriteString("▀")
+		}
+		f.out.WriteString("\x1b[0m\r\n")
+	}
+}
@@ -0,0 +1,53 @@
+package termui
+
+// layouts map typed characters to Chip-8 keys, by keyboard layout name,
+// using the same layouts as the SDL frontend.
+var layouts = map[string]map[byte]uint8{
+	"standard": {
+		'1': 0x1,
+		'2': 0x2,
+		'3': 0x3,
+		'4': 0xc,
+		'q': 0x4,
+		'w': 0x5,
+		'e': 0x6,
+		'r': 0xd,
+		'a': 0x7,
+		's': 0x8,
+		'd': 0x9,
+		'f': 0xe,
+		'z': 0xa,
+		'x': 0x0,
+		'c': 0xb,
+		'v': 0xf,
+	},
+	"classic": {
+		'7': 0x1,
+		'8': 0x2,
+		'9': 0x3,
+		'0': 0xc,
+		'u': 0x4,
+		'i': 0x5,
+		'o': 0x6,
+		'p': 0xd,
+		'j': 0x7,
+		'k': 0x8,
+		'l': 0x9,
+		';': 0xe,
+		'm': 0xa,
+		',': 0x0,
+		'.': 0xb,
+		'/': 0xf,
+	},
+}
+
+// Keys controlling the emulator itself, chosen not to clash with either
+// layout.
+const (
+	pauseKey     = ' ' // pause/resume
+	stepKey      = 'n' // execute one instruction while paused
+	stepOverKey  = 'N' // step, running CALLs until they return
+	frameStepKey = 'F' // run until the next frame while paused
+	stepBackKey  = 'b' // undo the last instruction while paused
+	skipKey      = 'S' // move past the instruction at PC while paused
+)
@@ -0,0 +1,12 @@
+// Package testrom holds the emulator test ROM built into the emulator, so -t
+// runs from any directory.
+package testrom
+
+import _ "embed"
+
+// Flags draws the result and VF of the arithmetic instructions on edge
+// values. It is core/testdata/roms/flags.8o, assembled with chip8 asm; the
+// comments there list what it should show.
+//
+//go:embed flags.ch8
+var Flags []byte
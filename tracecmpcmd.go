@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// traceState is the CPU state before an instruction, as logged in a
+// reference trace. Only the registers the trace logs are compared.
+type traceState struct {
+	line   int               // line of the trace
+	fields map[string]uint16 // register values, by upper case name
+}
+
+// readTrace reads a reference trace: a line for each instruction executed,
+// giving the state before it as NAME=VALUE or NAME:VALUE pairs in hex, e.g.
+//
+//	PC=0200 I=0000 V0=00 V1=00 ... VF=00
+//
+// Names are PC, I, SP, DT, ST and V0-VF. Lines without a PC are skipped.
+func readTrace(path string) ([]traceState, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var states []traceState
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.FieldsFunc(scanner.Text(), func(r rune) bool {
+			return r == ' ' || r == '\t' || r == ','
+		})
+		state := traceState{line: n, fields: make(map[string]uint16)}
+		for _, field := range fields {
+			sep := strings.IndexAny(field, "=:")
+			if sep < 0 {
+				continue
+			}
+			name := strings.ToUpper(field[:sep])
+			if _, ok := traceValue(core.Registers{}, name); !ok {
+				continue
+			}
+			hex := strings.TrimPrefix(strings.ToLower(field[sep+1:]), "0x")
+			v, err := strconv.ParseUint(hex, 16, 16)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid value %q of %s", path, n, field[sep+1:], name)
+			}
+			state.fields[name] = uint16(v)
+		}
+		if _, ok := state.fields["PC"]; ok {
+			states = append(states, state)
+		}
+	}
+
+	return states, scanner.Err()
+}
+
+// traceValue returns the value of the register called name in r.
+func traceValue(r core.Registers, name string) (uint16, bool) {
+	switch name {
+	case "PC":
+		return r.PC, true
+	case "I":
+		return r.I, true
+	case "SP":
+		return uint16(r.SP), true
+	case "DT":
+		return uint16(r.DT), true
+	case "ST":
+		return uint16(r.ST), true
+	}
+	if len(name) == 2 && name[0] == 'V' {
+		if n, err := strconv.ParseUint(name[1:], 16, 4); err == nil {
+			return uint16(r.V[n]), true
+		}
+	}
+
+	return 0, false
+}
+
+// runTraceCmp implements the tracecmp command, running a ROM and comparing
+// the state before each instruction with a reference trace from another
+// emulator, stopping at the first difference:
+//
+//	chip8 tracecmp [-n 10000] game.ch8 reference.log
+func runTraceCmp(args []string) {
+	fs := newCommandFlags("tracecmp")
+	limit := fs.Int("n", 0, "Number of instructions to compare (default the length of the trace)")
+	fs.Int64Var(&seed, "seed", 1, "Seed for the random number generator")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	states, err := readTrace(fs.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *limit <= 0 || *limit > len(states) {
+		*limit = len(states)
+	}
+
+	c, err := core.NewChip8(core.Options{Seed: seed, Unpaced: true, ROMCheck: core.ROMCheckOff, Logger: logger})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := c.LoadRom(fs.Arg(0)); err != nil {
+		log.Fatal("Error loading ROM: ", err)
+	}
+
+	const context = 5 // instructions shown before a difference
+	var recent []string
+	executed, diverged := 0, false
+	c.OnInstruction(func(addr, op uint16) {
+		if executed >= *limit || diverged {
+			c.Stop()
+			return
+		}
+		want := states[executed]
+		r := c.Registers()
+
+		var diffs []string
+		for _, name := range traceNames {
+			expected, ok := want.fields[name]
+			if !ok {
+				continue
+			}
+			if got, _ := traceValue(r, name); got != expected {
+				diffs = append(diffs, fmt.Sprintf("%s is %X, expected %X", name, got, expected))
+			}
+		}
+
+		line := fmt.Sprintf("%6d  %04X  %04X  %s", executed, addr, op, core.Disassemble(op))
+		if len(diffs) > 0 {
+			diverged = true
+			c.Stop()
+			fmt.Printf("Divergence before instruction %d (trace line %d):\n", executed, want.line)
+			for _, prev := range recent {
+				fmt.Println("  " + prev)
+			}
+			fmt.Println("> " + line)
+			for _, diff := range diffs {
+				fmt.Println("    " + diff)
+			}
+			return
+		}
+
+		recent = append(recent, line)
+		if len(recent) > context {
+			recent = recent[1:]
+		}
+		executed++
+	})
+	if err := c.Run(&headlessFrontend{}); err != nil {
+		log.Fatal(err)
+	}
+
+	switch {
+	case diverged:
+		os.Exit(1)
+	case executed < *limit:
+		fmt.Printf("Execution stopped after %d of %d instructions: %s\n", executed, *limit, c.StopReason())
+		os.Exit(1)
+	default:
+		fmt.Printf("%d instructions match the trace\n", executed)
+	}
+}
+
+// traceNames are the registers compared, in the order differences are
+// reported in.
+var traceNames = []string{
+	"PC", "I", "SP", "DT", "ST",
+	"V0", "V1", "V2", "V3", "V4", "V5", "V6", "V7",
+	"V8", "V9", "VA", "VB", "VC", "VD", "VE", "VF",
+}
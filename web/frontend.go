@@ -0,0 +1,147 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"strconv"
+	"syscall/js"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+// keyEvent is a keypad key being pressed or released.
+type keyEvent struct {
+	key     uint8
+	pressed bool
+}
+
+// frontend draws the display into the page's canvas and reads the keypad
+// from DOM keyboard events and the page's on-screen keypad.
+type frontend struct {
+	ctx    js.Value // 2D context of the canvas
+	image  js.Value // ImageData holding the display pixels
+	data   js.Value // Uint8Array sharing its buffer with image
+	keys   chan keyEvent
+	roms   chan []byte // ROMs passed in by the page through chip8LoadRom
+	events []js.Func
+}
+
+// newFrontend hooks into the page's #screen canvas, keyboard events and the
+// buttons of its #keypad, and exposes chip8LoadRom(Uint8Array) for the page
+// to start a ROM.
+func newFrontend() *frontend {
+	doc := js.Global().Get("document")
+	canvas := doc.Call("getElementById", "screen")
+	canvas.Set("width", core.Chip8Width)
+	canvas.Set("height", core.Chip8Height)
+
+	data := js.Global().Get("Uint8Array").New(core.Chip8Width * core.Chip8Height * 4)
+	clamped := js.Global().Get("Uint8ClampedArray").New(data.Get("buffer"))
+
+	f := &frontend{
+		ctx:   canvas.Call("getContext", "2d"),
+		image: js.Global().Get("ImageData").New(clamped, core.Chip8Width, core.Chip8Height),
+		data:  data,
+		keys:  make(chan keyEvent, 64),
+		roms:  make(chan []byte, 1),
+	}
+
+	f.listen(doc, "keydown", f.keyHandler(true))
+	f.listen(doc, "keyup", f.keyHandler(false))
+
+	buttons := doc.Call("querySelectorAll", "#keypad button")
+	for i := 0; i < buttons.Length(); i++ {
+		button := buttons.Index(i)
+		key, err := strconv.ParseUint(button.Get("dataset").Get("key").String(), 16, 8)
+		if err != nil {
+			continue
+		}
+		f.listen(button, "pointerdown", f.buttonHandler(uint8(key), true))
+		f.listen(button, "pointerup", f.buttonHandler(uint8(key), false))
+		f.listen(button, "pointerleave", f.buttonHandler(uint8(key), false))
+		f.listen(button, "pointercancel", f.buttonHandler(uint8(key), false))
+	}
+
+	js.Global().Set("chip8LoadRom", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		rom := make([]byte, args[0].Get("length").Int())
+		js.CopyBytesToGo(rom, args[0])
+		select {
+		case f.roms <- rom:
+		default:
+		}
+		return nil
+	}))
+
+	return f
+}
+
+// listen calls handler for each of target's events of the given type.
+func (f *frontend) listen(target js.Value, event string, handler func(js.Value)) {
+	fn := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		handler(args[0])
+		return nil
+	})
+	target.Call("addEventListener", event, fn)
+	f.events = append(f.events, fn)
+}
+
+// keyHandler returns a keyboard event handler queueing keypad key presses
+// (or releases) for PollEvents.
+func (f *frontend) keyHandler(pressed bool) func(js.Value) {
+	return func(event js.Value) {
+		key, ok := keybinds[event.Get("code").String()]
+		if !ok {
+			return
+		}
+		event.Call("preventDefault")
+		select {
+		case f.keys <- keyEvent{key: key, pressed: pressed}:
+		default:
+		}
+	}
+}
+
+// buttonHandler returns a pointer event handler queueing a press (or release)
+// of an on-screen keypad key for PollEvents.
+func (f *frontend) buttonHandler(key uint8, pressed bool) func(js.Value) {
+	return func(event js.Value) {
+		event.Call("preventDefault")
+		select {
+		case f.keys <- keyEvent{key: key, pressed: pressed}:
+		default:
+		}
+	}
+}
+
+// Render copies the display pixels into the canvas when they have changed.
+func (f *frontend) Render(c *core.Chip8) {
+	if !c.FrameChanged() {
+		return
+	}
+	js.CopyBytesToJS(f.data, c.Pixels())
+	f.ctx.Call("putImageData", f.image, 0, 0)
+}
+
+// PollEvents applies queued key events, and stops the emulator when the page
+// has loaded another ROM.
+func (f *frontend) PollEvents(c *core.Chip8) {
+	for {
+		select {
+		case ev := <-f.keys:
+			c.SetKey(ev.key, ev.pressed)
+		default:
+			if len(f.roms) > 0 {
+				c.Stop()
+			}
+			return
+		}
+	}
+}
+
+// Close releases the keypad state so the next ROM starts with no keys held.
+func (f *frontend) Close() {
+	for len(f.keys) > 0 {
+		<-f.keys
+	}
+}
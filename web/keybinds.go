@@ -0,0 +1,25 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+// keybinds maps DOM KeyboardEvent codes to Chip-8 keys, using the standard
+// layout of the SDL frontend.
+var keybinds = map[string]uint8{
+	"Digit1": 0x1,
+	"Digit2": 0x2,
+	"Digit3": 0x3,
+	"Digit4": 0xc,
+	"KeyQ":   0x4,
+	"KeyW":   0x5,
+	"KeyE":   0x6,
+	"KeyR":   0xd,
+	"KeyA":   0x7,
+	"KeyS":   0x8,
+	"KeyD":   0x9,
+	"KeyF":   0xe,
+	"KeyZ":   0xa,
+	"KeyX":   0x0,
+	"KeyC":   0xb,
+	"KeyV":   0xf,
+}
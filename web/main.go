@@ -0,0 +1,39 @@
+//go:build js && wasm
+// +build js,wasm
+
+// Command web runs the Chip-8 emulator in a browser, drawing to a canvas on
+// the host page and reading the keypad from keyboard events. Build it with:
+//
+//	GOOS=js GOARCH=wasm go build -o web/chip8.wasm ./web
+//	cp "$(go env GOROOT)/misc/wasm/wasm_exec.js" web/
+//
+// then serve the web directory and open index.html.
+package main
+
+import (
+	"fmt"
+
+	"github.com/n-ulricksen/chip8/core"
+)
+
+func main() {
+	fe := newFrontend()
+
+	fmt.Println("Waiting for a ROM...")
+	for rom := range fe.roms {
+		chip8, err := core.NewChip8(core.Options{})
+		if err != nil {
+			fmt.Println("Unable to start the emulator:", err)
+			continue
+		}
+		if err := chip8.LoadRomData(rom); err != nil {
+			fmt.Println("Unable to load ROM:", err)
+			continue
+		}
+
+		fmt.Println("Starting program...")
+		if err := chip8.Run(fe); err != nil {
+			fmt.Println("Emulation failed:", err)
+		}
+	}
+}